@@ -9,9 +9,13 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/kaibling/apiforge/ctxkeys"
 	"github.com/kaibling/cerodev/api/auth"
+	"github.com/kaibling/cerodev/api/build"
 	"github.com/kaibling/cerodev/api/container"
 	images "github.com/kaibling/cerodev/api/image"
 	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/api/node"
+	"github.com/kaibling/cerodev/api/quota"
+	"github.com/kaibling/cerodev/api/reconciler"
 	"github.com/kaibling/cerodev/api/template"
 	"github.com/kaibling/cerodev/api/user"
 	"github.com/kaibling/cerodev/bootstrap"
@@ -23,6 +27,10 @@ func Route() chi.Router { //nolint: ireturn
 	r.Mount("/containers", container.Route())
 	r.Mount("/templates", template.Route())
 	r.Mount("/images", images.Route())
+	r.Mount("/builds", build.Route())
+	r.Mount("/reconciler", reconciler.Route())
+	r.Mount("/quotas", quota.Route())
+	r.Mount("/nodes", node.Route())
 	r.Mount("/auth", auth.Route())
 	r.Mount("/ws", WSRoute())
 
@@ -61,10 +69,24 @@ func ws(w http.ResponseWriter, r *http.Request) {
 		fmt.Printf("ctxkeys TokenKey  failed: %s", err)
 		return
 	}
+	userID, ok := ctxkeys.GetValue(r.Context(), ctxkeys.UserIDKey).(string)
+	if !ok {
+		fmt.Printf("ctxkeys UserIDKey failed")
+		return
+	}
 	wss, err := bootstrap.GetWebSocketService(r.Context())
 	if err != nil {
 		fmt.Printf("GetWebSocketService failed: %s", err)
 		return
 	}
-	wss.Add(token, conn)
+	wss.Add(token, userID, conn)
+
+	// clients only answer pings, the connection is gone when reading fails
+	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			wss.Remove(token, conn)
+			return
+		}
+	}
 }
@@ -2,6 +2,7 @@ package apierrs
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/kaibling/apiforge/apierror"
 	"github.com/kaibling/cerodev/errs"
@@ -12,5 +13,25 @@ func HandleError(err error) apierror.HTTPError {
 		return apierror.ErrDataNotFound
 	}
 
+	if errors.Is(err, errs.ErrInvalidRole) || errors.Is(err, errs.ErrInvalidInput) {
+		return apierror.New(err, http.StatusBadRequest)
+	}
+
+	if errors.Is(err, errs.ErrQuotaExceeded) {
+		return apierror.New(err, http.StatusForbidden)
+	}
+
+	if errors.Is(err, errs.ErrTooLarge) {
+		return apierror.New(err, http.StatusRequestEntityTooLarge)
+	}
+
+	if errors.Is(err, errs.ErrNoCapacity) {
+		return apierror.New(err, http.StatusServiceUnavailable)
+	}
+
+	if errors.Is(err, errs.ErrWrongCredentials) {
+		return apierror.New(errs.ErrWrongCredentials, http.StatusUnauthorized)
+	}
+
 	return apierror.ErrServerError
 }
@@ -2,12 +2,15 @@ package auth
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/kaibling/apiforge/envelope"
 	"github.com/kaibling/apiforge/route"
 	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/api/middleware"
 	"github.com/kaibling/cerodev/bootstrap"
 	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/config"
 	"github.com/kaibling/cerodev/errs"
 	"github.com/kaibling/cerodev/errs/msg"
 	"github.com/kaibling/cerodev/model"
@@ -30,7 +33,7 @@ func login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	us, err := bootstrap.NewUserService(r.Context())
+	us, err := bootstrap.GetUserService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -38,7 +41,7 @@ func login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newToken, err := us.Login(&loginRequest)
+	newToken, err := us.Login(r.Context(), &loginRequest)
 	if err != nil {
 		l.Warn(msg.RequestParse, err)
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -46,9 +49,45 @@ func login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := startProxySession(w, r, newToken.UserID); err != nil {
+		l.Warn(errs.ErrMsg("cannot start proxy session", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
 	e.SetResponse(newToken).Finish(w, r, l)
 }
 
+// createSession renews the proxy session cookie of a requester that did not
+// log in with a password, e.g. with an API token.
+func createSession(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_auth")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := startProxySession(w, r, requester.UserID); err != nil {
+		l.Warn(errs.ErrMsg("cannot start proxy session", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
+
 func logout(w http.ResponseWriter, r *http.Request) {
 	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_auth")
 	if merr != nil {
@@ -66,7 +105,7 @@ func logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ts, err := bootstrap.NewTokenService(r.Context())
+	ts, err := bootstrap.GetTokenService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -74,7 +113,7 @@ func logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = ts.Delete(token)
+	err = ts.Delete(r.Context(), token)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot delete token", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -82,6 +121,24 @@ func logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	_, _, cfg, err := appctx.GetBaseData(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot read context", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if cookie, err := r.Cookie(middleware.SessionCookieName); err == nil && cookie.Value != "" {
+		requester, err := appctx.GetRequester(r.Context())
+		if err == nil {
+			if err := ts.DeleteProxySession(r.Context(), requester.UserID, cookie.Value); err != nil {
+				l.Warn(errs.ErrMsg("cannot delete proxy session", err))
+			}
+		}
+	}
+
+	clearSessionCookie(w, cfg)
 	e.SetSuccess().Finish(w, r, l)
 }
 
@@ -103,7 +160,7 @@ func check(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	us, err := bootstrap.NewUserService(r.Context())
+	us, err := bootstrap.GetUserService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -111,7 +168,7 @@ func check(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := us.CheckToken(token)
+	user, _, err := us.CheckToken(r.Context(), token)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot check token", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -121,3 +178,64 @@ func check(w http.ResponseWriter, r *http.Request) {
 
 	e.SetResponse(user).Finish(w, r, l)
 }
+
+// startProxySession creates a proxy session for the user and stores it in the
+// session cookie.
+func startProxySession(w http.ResponseWriter, r *http.Request, userID string) error {
+	_, _, cfg, err := appctx.GetBaseData(r.Context())
+	if err != nil {
+		return err
+	}
+
+	ts, err := bootstrap.GetTokenService(r.Context())
+	if err != nil {
+		return err
+	}
+
+	session, err := ts.CreateProxySession(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+
+	setSessionCookie(w, cfg, session.Token, session.ExpiresAt)
+
+	return nil
+}
+
+// setSessionCookie stores the proxy session in a cookie, so that the browser
+// can authenticate against the workspace proxy. With host based routing the
+// cookie is scoped to the base domain to reach the workspace subdomains. The
+// proxy does not forward it to the workspaces, drops session cookies set by
+// them and rejects cross-site requests to workspace hosts, so that the page of
+// one workspace cannot use the session of its visitor on another one. The
+// session only grants workspaces:access, never the api.
+func setSessionCookie(w http.ResponseWriter, cfg config.Configuration, token string, expiresAt *time.Time) {
+	cookie := &http.Cookie{ //nolint:exhaustruct
+		Name:     middleware.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   cfg.APIEnableTLS,
+		SameSite: http.SameSiteLaxMode,
+		Domain:   cfg.ProxyBaseDomain,
+	}
+
+	if expiresAt != nil {
+		cookie.Expires = *expiresAt
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+func clearSessionCookie(w http.ResponseWriter, cfg config.Configuration) {
+	http.SetCookie(w, &http.Cookie{ //nolint:exhaustruct
+		Name:     middleware.SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cfg.APIEnableTLS,
+		SameSite: http.SameSiteLaxMode,
+		Domain:   cfg.ProxyBaseDomain,
+	})
+}
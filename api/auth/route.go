@@ -3,6 +3,7 @@ package auth
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/model"
 )
 
 func Route() chi.Router { //nolint: ireturn
@@ -11,7 +12,11 @@ func Route() chi.Router { //nolint: ireturn
 		r.Post("/login", login)
 		r.With(middleware.Authentication).Group(func(r chi.Router) {
 			r.Post("/logout", logout)
+			r.With(middleware.Authorize(model.PermWorkspacesAccess)).Post("/session", createSession)
 			r.Get("/check", check)
+			r.Get("/tokens", getTokens)
+			r.Post("/tokens", createToken)
+			r.Delete("/tokens/{id}", revokeToken)
 		})
 	})
 
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+func getTokens(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_auth")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ts, err := bootstrap.GetTokenService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.TokenServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	tokens, err := ts.GetByUserID(r.Context(), requester.UserID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get tokens", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(tokens).Finish(w, r, l)
+}
+
+func createToken(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_auth")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var tokenRequest model.TokenRequest
+	if err := route.ReadPostData(r, &tokenRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ts, err := bootstrap.GetTokenService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.TokenServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	newToken, err := ts.CreateForUser(r.Context(), requester, &tokenRequest)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot create token", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(newToken).Finish(w, r, l)
+}
+
+func revokeToken(w http.ResponseWriter, r *http.Request) {
+	tokenID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_auth")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ts, err := bootstrap.GetTokenService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.TokenServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := ts.Revoke(r.Context(), requester.UserID, tokenID); err != nil {
+		l.Warn(errs.ErrMsg("cannot revoke token", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
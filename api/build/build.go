@@ -0,0 +1,124 @@
+package build
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+)
+
+func getBuilds(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_build")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	bs, err := bootstrap.GetBuildService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.BuildServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	jobs, err := bs.GetAll(r.Context(), requester)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get builds", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(jobs).Finish(w, r, l)
+}
+
+func getBuild(w http.ResponseWriter, r *http.Request) {
+	buildID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_build")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	bs, err := bootstrap.GetBuildService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.BuildServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	job, err := bs.GetByID(r.Context(), requester, buildID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get build", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(job).Finish(w, r, l)
+}
+
+func cancelBuild(w http.ResponseWriter, r *http.Request) {
+	buildID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_build")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	bs, err := bootstrap.GetBuildService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.BuildServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := bs.Cancel(r.Context(), requester, buildID); err != nil {
+		l.Warn(errs.ErrMsg("cannot cancel build", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
@@ -0,0 +1,19 @@
+package build
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/model"
+)
+
+func Route() chi.Router { //nolint: ireturn
+	r := chi.NewRouter()
+	r.Route("/", func(r chi.Router) {
+		r.Use(middleware.Authentication)
+		r.With(middleware.Authorize(model.PermImagesRead)).Get("/", getBuilds)
+		r.With(middleware.Authorize(model.PermImagesRead)).Get("/{id}", getBuild)
+		r.With(middleware.Authorize(model.PermImagesWrite)).Post("/{id}/cancel", cancelBuild)
+	})
+
+	return r
+}
@@ -0,0 +1,207 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/archive"
+)
+
+// getBackup streams a gzip compressed tar of the workspace volume. With
+// name a stored backup is returned instead.
+func getBackup(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+	name := r.URL.Query().Get("name")
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	backup, err := cs.OpenBackup(r.Context(), requester, containerID, name)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot open backup", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+	defer backup.Close()
+
+	if name == "" {
+		name = time.Now().UTC().Format("20060102T150405Z") + ".tar.gz"
+	}
+
+	// large volumes outlive the write timeout of the server
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		l.Warn(errs.ErrMsg("cannot disable write deadline", err))
+	}
+
+	w.Header().Set("Content-Type", archive.ContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+containerID+"-"+name+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, backup); err != nil {
+		l.Warn(errs.ErrMsg("cannot stream backup", err))
+	}
+}
+
+func getBackups(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	backups, err := cs.GetBackups(r.Context(), requester, containerID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get backups", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(backups).Finish(w, r, l)
+}
+
+// restoreBackup replaces the volume of a stopped workspace: an archive body
+// (application/gzip) is unpacked directly, a json body selects a stored backup.
+// Trashed workspaces have to be undeleted first.
+func restoreBackup(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	_, _, cfg, err := appctx.GetBaseData(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot read context", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	trashed, err := cs.IsTrashed(r.Context(), requester, containerID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get container", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if trashed {
+		err := fmt.Errorf("%w: container is in the trash, undelete it first", errs.ErrInvalidInput)
+		l.Warn(errs.ErrMsg("cannot restore backup", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if archive.IsContentType(r.Header.Get("Content-Type")) {
+		// large uploads outlive the read timeout of the server
+		if err := http.NewResponseController(w).SetReadDeadline(time.Time{}); err != nil {
+			l.Warn(errs.ErrMsg("cannot disable read deadline", err))
+		}
+
+		body := r.Body
+		if cfg.MaxRestoreSize > 0 {
+			body = http.MaxBytesReader(w, r.Body, cfg.MaxRestoreSize)
+		}
+
+		err = cs.Restore(r.Context(), requester, containerID, body)
+
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = fmt.Errorf("%w: more than %d bytes uploaded", errs.ErrTooLarge, tooLarge.Limit)
+		}
+	} else {
+		var restoreRequest model.RestoreRequest
+		if err := route.ReadPostData(r, &restoreRequest); err != nil {
+			l.Warn(errs.ErrMsg(msg.RequestParse, err))
+			e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+			return
+		}
+
+		err = cs.RestoreBackup(r.Context(), requester, containerID, restoreRequest)
+	}
+
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot restore backup", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/kaibling/apiforge/route"
 	"github.com/kaibling/cerodev/api/apierrs"
 	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
 	"github.com/kaibling/cerodev/errs"
 	"github.com/kaibling/cerodev/errs/msg"
 	"github.com/kaibling/cerodev/model"
@@ -21,7 +22,15 @@ func getContainers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cs, err := bootstrap.NewContainerService(r.Context())
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -29,7 +38,7 @@ func getContainers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	containers, err := cs.GetAll()
+	containers, err := cs.GetAll(r.Context(), requester)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot get all containers", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -49,7 +58,7 @@ func createContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var requestContainer model.Container
+	var requestContainer model.ContainerRequest
 	if err := route.ReadPostData(r, &requestContainer); err != nil {
 		l.Warn(errs.ErrMsg(msg.RequestParse, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -59,7 +68,17 @@ func createContainer(w http.ResponseWriter, r *http.Request) {
 
 	requestContainer.ID = ""
 
-	cs, err := bootstrap.NewContainerService(r.Context())
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requestContainer.UserID = requester.UserID
+
+	cs, err := bootstrap.GetContainerService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -67,7 +86,13 @@ func createContainer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newContainer, err := cs.Create(&requestContainer)
+	var newContainer *model.Container
+	if requestContainer.Restore != nil {
+		newContainer, err = cs.CreateRestored(r.Context(), &requestContainer.Container, *requestContainer.Restore)
+	} else {
+		newContainer, err = cs.Create(r.Context(), &requestContainer.Container)
+	}
+
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot create container", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -89,7 +114,15 @@ func startContainer(w http.ResponseWriter, r *http.Request) { //nolint:dupl
 		return
 	}
 
-	cs, err := bootstrap.NewContainerService(r.Context())
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -97,7 +130,7 @@ func startContainer(w http.ResponseWriter, r *http.Request) { //nolint:dupl
 		return
 	}
 
-	err = cs.StartContainer(containerID)
+	err = cs.StartContainer(r.Context(), requester, containerID)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot start container", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -119,7 +152,15 @@ func stopContainer(w http.ResponseWriter, r *http.Request) { //nolint:dupl
 		return
 	}
 
-	cs, err := bootstrap.NewContainerService(r.Context())
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -127,7 +168,7 @@ func stopContainer(w http.ResponseWriter, r *http.Request) { //nolint:dupl
 		return
 	}
 
-	err = cs.StopContainer(containerID)
+	err = cs.StopContainer(r.Context(), requester, containerID)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot stop container", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -149,7 +190,15 @@ func deleteContainer(w http.ResponseWriter, r *http.Request) { //nolint:dupl
 		return
 	}
 
-	cs, err := bootstrap.NewContainerService(r.Context())
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -157,7 +206,7 @@ func deleteContainer(w http.ResponseWriter, r *http.Request) { //nolint:dupl
 		return
 	}
 
-	err = cs.DeleteContainer(containerID)
+	err = cs.DeleteContainer(r.Context(), requester, containerID)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot delete container", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -167,3 +216,96 @@ func deleteContainer(w http.ResponseWriter, r *http.Request) { //nolint:dupl
 
 	e.SetSuccess().Finish(w, r, l)
 }
+
+func updateLimits(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var limits model.ResourceLimits
+	if err := route.ReadPostData(r, &limits); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	container, err := cs.UpdateLimits(r.Context(), requester, containerID, limits)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot update container limits", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(container).Finish(w, r, l)
+}
+
+// createSnapshot commits a workspace into an image of the requester.
+func createSnapshot(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var snapshotRequest model.SnapshotRequest
+	if err := route.ReadPostData(r, &snapshotRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	img, err := cs.Snapshot(r.Context(), requester, containerID, snapshotRequest)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot create snapshot", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(img).Finish(w, r, l)
+}
@@ -0,0 +1,200 @@
+package container
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+const (
+	execBufferSize   = 32 * 1024
+	execCloseTimeout = time.Second
+)
+
+var upgrader = websocket.Upgrader{} //nolint:gochecknoglobals,exhaustruct
+
+func createExec(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var execRequest model.ExecRequest
+	if err := route.ReadPostData(r, &execRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	session, err := cs.CreateExec(r.Context(), requester, containerID, execRequest.Cmd)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot create exec", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(session).Finish(w, r, l)
+}
+
+// attachExec starts an exec session and bridges its terminal to a websocket.
+// Binary frames carry terminal data, text frames carry model.ExecMessage.
+func attachExec(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+	execID := route.ReadURLParam("execID", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	stream, err := cs.AttachExec(r.Context(), requester, containerID, execID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot attach exec", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	defer func() {
+		if err := stream.Close(); err != nil {
+			l.Warn(errs.ErrMsg("cannot close exec", err))
+		}
+	}()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		l.Warn(errs.ErrMsg("websocket upgrade failed", err))
+
+		return
+	}
+
+	defer conn.Close()
+
+	// an attached session keeps the workspace from being stopped as idle
+	if is, err := bootstrap.GetIdleService(r.Context()); err == nil {
+		defer is.Attach(containerID)()
+	} else {
+		l.Warn(errs.ServiceBuildError(bootstrap.IdleServiceName, err))
+	}
+
+	bridgeExec(conn, stream, l)
+}
+
+func bridgeExec(conn *websocket.Conn, stream model.ExecStream, l log.Writer) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, execBufferSize)
+
+		for {
+			n, err := stream.Read(buf)
+			if n > 0 {
+				if werr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "exec ended")
+				_ = conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(execCloseTimeout))
+				_ = conn.Close()
+
+				return
+			}
+		}
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		switch messageType {
+		case websocket.BinaryMessage:
+			if _, err := stream.Write(data); err != nil {
+				l.Warn(errs.ErrMsg("cannot write to exec", err))
+			}
+		case websocket.TextMessage:
+			if err := handleExecMessage(stream, data); err != nil {
+				l.Warn(errs.ErrMsg("cannot handle exec message", err))
+			}
+		}
+	}
+
+	_ = stream.Close()
+	<-done
+}
+
+func handleExecMessage(stream model.ExecStream, data []byte) error {
+	var message model.ExecMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return err
+	}
+
+	switch message.Type {
+	case "resize":
+		return stream.Resize(message.Rows, message.Cols)
+	case "input":
+		_, err := stream.Write([]byte(message.Data))
+
+		return err
+	}
+
+	return errs.ErrInvalidInput
+}
@@ -0,0 +1,236 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kaibling/apiforge/ctxkeys"
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+const logMessageType = "container_log"
+
+// getLogs streams the output of a container as chunked plain text. With
+// stream=ws the lines are sent as WebSocketMessage frames on the /ws
+// connection of the requesting token instead.
+func getLogs(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	opts, err := readLogOptions(r)
+	if err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if r.URL.Query().Get("stream") == "ws" {
+		if err := streamLogsToWebSocket(r, requester, containerID, opts); err != nil {
+			l.Warn(errs.ErrMsg("cannot stream logs", err))
+			e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+			return
+		}
+
+		e.SetSuccess().Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	sw := &streamWriter{w: w, rc: http.NewResponseController(w)} //nolint:exhaustruct
+	if opts.Follow {
+		if _, err := cs.GetByID(r.Context(), requester, containerID); err != nil {
+			l.Warn(errs.ErrMsg("cannot stream logs", err))
+			e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+			return
+		}
+
+		defer keepActive(r, l, containerID)()
+
+		// followed logs outlive the write timeout of the server
+		if err := sw.rc.SetWriteDeadline(time.Time{}); err != nil {
+			l.Warn(errs.ErrMsg("cannot disable write deadline", err))
+		}
+	}
+
+	if err := cs.StreamLogs(r.Context(), requester, containerID, opts, sw); err != nil {
+		l.Warn(errs.ErrMsg("cannot stream logs", err))
+
+		if !sw.started {
+			e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+		}
+
+		return
+	}
+
+	sw.start()
+}
+
+// streamLogsToWebSocket verifies access and then sends the logs to the
+// websocket client in the background. It outlives the request, but ends when
+// the websocket client is gone.
+func streamLogsToWebSocket(r *http.Request, requester model.Requester, containerID string, opts model.LogOptions) error {
+	_, l, _, err := appctx.GetBaseData(r.Context())
+	if err != nil {
+		return fmt.Errorf("failed to GetBaseData: %w", err)
+	}
+
+	token, ok := ctxkeys.GetValue(r.Context(), ctxkeys.TokenKey).(string)
+	if !ok {
+		return errs.ErrInvalidToken
+	}
+
+	wss, err := bootstrap.GetWebSocketService(r.Context())
+	if err != nil {
+		return fmt.Errorf("failed to GetWebSocketService: %w", err)
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		return fmt.Errorf("failed to GetContainerService: %w", err)
+	}
+
+	if _, err := cs.GetByID(r.Context(), requester, containerID); err != nil {
+		return fmt.Errorf("failed to GetByID: %w", err)
+	}
+
+	detach := func() {}
+	if opts.Follow {
+		detach = keepActive(r, l, containerID)
+	}
+
+	// the stream is cancelled when the websocket client is gone
+	err = wss.Go(context.WithoutCancel(r.Context()), token, func(ctx context.Context) {
+		defer detach()
+
+		mw := wss.NewMessageWriter(token, logMessageType, containerID)
+		if err := cs.StreamLogs(ctx, requester, containerID, opts, mw); err != nil {
+			if ctx.Err() == nil {
+				l.Warn(errs.ErrMsg("websocket log stream ended", err))
+			}
+
+			return
+		}
+
+		if err := mw.Flush(); err != nil {
+			l.Warn(errs.ErrMsg("cannot flush websocket log stream", err))
+		}
+	})
+	if err != nil {
+		detach()
+
+		return fmt.Errorf("failed to start websocket log stream: %w", err)
+	}
+
+	return nil
+}
+
+// keepActive marks a followed log stream as a session of the workspace, so
+// that it is not stopped as idle while somebody watches it.
+func keepActive(r *http.Request, l log.Writer, containerID string) func() {
+	is, err := bootstrap.GetIdleService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.IdleServiceName, err))
+
+		return func() {}
+	}
+
+	return is.Attach(containerID)
+}
+
+func readLogOptions(r *http.Request) (model.LogOptions, error) {
+	query := r.URL.Query()
+	opts := model.LogOptions{
+		Tail:       query.Get("tail"),
+		Since:      query.Get("since"),
+		Follow:     false,
+		Timestamps: false,
+	}
+
+	if opts.Tail != "" && opts.Tail != "all" {
+		if n, err := strconv.Atoi(opts.Tail); err != nil || n < 0 {
+			return opts, fmt.Errorf("%w: tail must be a number or all", errs.ErrInvalidInput)
+		}
+	}
+
+	for key, target := range map[string]*bool{"follow": &opts.Follow, "timestamps": &opts.Timestamps} {
+		if value := query.Get(key); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, fmt.Errorf("%w: %s must be a boolean", errs.ErrInvalidInput, key)
+			}
+
+			*target = b
+		}
+	}
+
+	return opts, nil
+}
+
+// streamWriter writes chunks to the client as soon as they arrive. Headers are
+// sent with the first chunk, so errors before that can still be reported in
+// the envelope.
+type streamWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func (s *streamWriter) start() {
+	if s.started {
+		return
+	}
+
+	s.started = true
+
+	s.w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	s.w.Header().Set("X-Content-Type-Options", "nosniff")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	s.start()
+
+	n, err := s.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	return n, s.rc.Flush()
+}
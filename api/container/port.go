@@ -0,0 +1,145 @@
+package container
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+func getPorts(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ports, err := cs.GetPublishedPorts(r.Context(), requester, containerID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get published ports", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(ports).Finish(w, r, l)
+}
+
+func publishPort(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var portRequest model.PortRequest
+	if err := route.ReadPostData(r, &portRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	port, err := cs.PublishPort(r.Context(), requester, containerID, portRequest.Port)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot publish port", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(port).Finish(w, r, l)
+}
+
+func unpublishPort(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	port, err := strconv.Atoi(route.ReadURLParam("port", r))
+	if err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(fmt.Errorf("%w: %w", errs.ErrInvalidInput, err))).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := cs.UnpublishPort(r.Context(), requester, containerID, port); err != nil {
+		l.Warn(errs.ErrMsg("cannot unpublish port", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
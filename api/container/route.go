@@ -3,17 +3,45 @@ package container
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/model"
 )
 
 func Route() chi.Router { //nolint: ireturn
 	r := chi.NewRouter()
-	r.Route("/", func(r chi.Router) {
+	r.Group(func(r chi.Router) {
 		r.Use(middleware.Authentication)
-		r.Post("/", createContainer)
-		r.Get("/", getContainers)
-		r.Delete("/{id}", deleteContainer)
-		r.Post("/{id}/start", startContainer)
-		r.Post("/{id}/stop", stopContainer)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/", getContainers)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/{id}/shares", getShares)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/{id}/ports", getPorts)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/{id}/logs", getLogs)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/{id}/backup", getBackup)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/{id}/backups", getBackups)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/trash", getTrash)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/stats", getAllStats)
+		r.With(middleware.Authorize(model.PermContainersRead)).Get("/{id}/stats", getStats)
+		r.With(middleware.Authorize(model.PermContainersRead)).Delete("/stats", unsubscribeStats)
+		r.With(middleware.Authorize(model.PermContainersRead)).Delete("/{id}/stats", unsubscribeStats)
+		r.With(middleware.Authorize(model.PermContainersWrite)).Group(func(r chi.Router) {
+			r.Post("/", createContainer)
+			r.Delete("/{id}", deleteContainer)
+			r.Post("/{id}/start", startContainer)
+			r.Post("/{id}/stop", stopContainer)
+			r.Put("/{id}/limits", updateLimits)
+			r.Post("/{id}/snapshots", createSnapshot)
+			r.Post("/{id}/restore", restoreBackup)
+			r.Post("/{id}/undelete", undeleteContainer)
+			r.Post("/{id}/shares", createShare)
+			r.Delete("/{id}/shares/{userID}", deleteShare)
+			r.Post("/{id}/ports", publishPort)
+			r.Delete("/{id}/ports/{port}", unpublishPort)
+			r.Post("/{id}/exec", createExec)
+		})
+		r.With(middleware.AuthorizeAdmin).Post("/{id}/purge", purgeContainer)
+	})
+	// browsers cannot set headers on websocket requests
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.SessionAuthentication)
+		r.With(middleware.Authorize(model.PermWorkspacesAccess)).Get("/{id}/exec/{execID}", attachExec)
 	})
 
 	return r
@@ -0,0 +1,165 @@
+package container
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/kaibling/apiforge/ctxkeys"
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+// getStats returns the resource usage of a workspace. With stream=ws the
+// /ws connection of the requesting token additionally receives
+// container_stats messages until it disconnects or unsubscribes.
+func getStats(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	stats, err := cs.GetStats(r.Context(), requester, containerID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get container stats", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if r.URL.Query().Get("stream") == "ws" {
+		if err := subscribeStats(r, requester, containerID); err != nil {
+			l.Warn(errs.ErrMsg("cannot subscribe to container stats", err))
+			e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+			return
+		}
+	}
+
+	e.SetResponse(stats).Finish(w, r, l)
+}
+
+// getAllStats returns the resource usage of every workspace the requester can
+// see. stream=ws subscribes to all of them.
+func getAllStats(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	stats, err := cs.GetAllStats(r.Context(), requester)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get container stats", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if r.URL.Query().Get("stream") == "ws" {
+		if err := subscribeStats(r, requester, ""); err != nil {
+			l.Warn(errs.ErrMsg("cannot subscribe to container stats", err))
+			e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+			return
+		}
+	}
+
+	e.SetResponse(stats).Finish(w, r, l)
+}
+
+// unsubscribeStats stops the container_stats messages of a workspace, or of
+// all workspaces without id.
+func unsubscribeStats(w http.ResponseWriter, r *http.Request) {
+	containerID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_container")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	token, ok := ctxkeys.GetValue(r.Context(), ctxkeys.TokenKey).(string)
+	if !ok {
+		l.Warn(errs.ErrMsg("cannot get token", errs.ErrInvalidToken))
+		e.SetError(apierrs.HandleError(errs.ErrInvalidToken)).Finish(w, r, l)
+
+		return
+	}
+
+	ss, err := bootstrap.GetStatsService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.StatsServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ss.Unsubscribe(token, containerID)
+
+	e.SetSuccess().Finish(w, r, l)
+}
+
+// subscribeStats subscribes the /ws connection of the requesting token. Access
+// to the container has to be checked before.
+func subscribeStats(r *http.Request, requester model.Requester, containerID string) error {
+	token, ok := ctxkeys.GetValue(r.Context(), ctxkeys.TokenKey).(string)
+	if !ok {
+		return errs.ErrInvalidToken
+	}
+
+	ss, err := bootstrap.GetStatsService(r.Context())
+	if err != nil {
+		return fmt.Errorf("failed to GetStatsService: %w", err)
+	}
+
+	ss.Subscribe(token, requester, containerID)
+
+	return nil
+}
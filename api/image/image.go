@@ -6,6 +6,7 @@ import (
 	"github.com/kaibling/apiforge/envelope"
 	"github.com/kaibling/cerodev/api/apierrs"
 	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
 	"github.com/kaibling/cerodev/errs"
 	"github.com/kaibling/cerodev/errs/msg"
 )
@@ -19,7 +20,15 @@ func getImages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cs, err := bootstrap.NewContainerService(r.Context())
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -27,7 +36,7 @@ func getImages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	images, err := cs.GetImages()
+	images, err := cs.GetImages(r.Context(), requester)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot get images", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -3,13 +3,14 @@ package images
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/model"
 )
 
 func Route() chi.Router { //nolint: ireturn
 	r := chi.NewRouter()
 	r.Route("/", func(r chi.Router) {
 		r.Use(middleware.Authentication)
-		r.Get("/", getImages)
+		r.With(middleware.Authorize(model.PermImagesRead)).Get("/", getImages)
 	})
 
 	return r
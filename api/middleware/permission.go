@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+
+	apierror "github.com/kaibling/apiforge/apierror"
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/model"
+)
+
+// Authorize rejects requests whose user role or token scopes do not grant the
+// permission. It has to run after Authentication.
+func Authorize(permission model.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			e, l, aerr := envelope.GetEnvelopeAndLogger(r, "authorization")
+			if aerr != nil {
+				e.SetError(aerr).Finish(w, r, l)
+
+				return
+			}
+
+			requester, err := appctx.GetRequester(r.Context())
+			if err != nil {
+				l.Warn("could not read requester: %s", err.Error())
+				e.SetError(apierror.ErrForbidden).Finish(w, r, l)
+
+				return
+			}
+
+			if !requester.Can(permission) {
+				l.Warn("role %s or token scopes are missing permission %s", requester.Role, permission)
+				e.SetError(apierror.ErrForbidden).Finish(w, r, l)
+
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AuthorizeAdmin rejects requests of requesters that are not allowed to act
+// on resources of other users. It has to run after Authentication.
+func AuthorizeAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, l, aerr := envelope.GetEnvelopeAndLogger(r, "authorization")
+		if aerr != nil {
+			e.SetError(aerr).Finish(w, r, l)
+
+			return
+		}
+
+		requester, err := appctx.GetRequester(r.Context())
+		if err != nil {
+			l.Warn("could not read requester: %s", err.Error())
+			e.SetError(apierror.ErrForbidden).Finish(w, r, l)
+
+			return
+		}
+
+		if !requester.IsAdmin() {
+			l.Warn("user %s is not an admin or uses a scoped token", requester.UserID)
+			e.SetError(apierror.ErrForbidden).Finish(w, r, l)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthorizeSelfOr lets users access their own user resource, identified by the
+// "id" url parameter, and everybody else only with the given permission.
+// Scoped tokens always need the permission.
+func AuthorizeSelfOr(permission model.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		authorized := Authorize(permission)(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requester, err := appctx.GetRequester(r.Context())
+			if err == nil && len(requester.Scopes) == 0 && requester.UserID == route.ReadURLParam("id", r) {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			authorized.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kaibling/apiforge/ctxkeys"
+	"github.com/kaibling/apiforge/envelope"
+	apiservice "github.com/kaibling/apiforge/service"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/model"
+)
+
+// serve runs a request of the requester through the middleware and returns
+// the status, 200 if the request reached the handler.
+func serve(t *testing.T, mw func(http.Handler) http.Handler, requester model.Requester, userParam string) int {
+	t.Helper()
+
+	l := apiservice.BuildLogger(apiservice.LogConfig{LogLevel: "error", AppName: "test"}) //nolint:exhaustruct
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", userParam)
+
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, ctxkeys.LoggerKey, l)
+	ctx = context.WithValue(ctx, ctxkeys.EnvelopeKey, envelope.New())
+	ctx = context.WithValue(ctx, ctxkeys.UserIDKey, requester.UserID)
+	ctx = context.WithValue(ctx, appctx.RoleKey, requester.Role)
+	ctx = context.WithValue(ctx, appctx.ScopesKey, requester.Scopes)
+
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+
+	mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func TestAuthorize(t *testing.T) {
+	admin := model.Requester{UserID: "a", Role: model.RoleAdmin}         //nolint:exhaustruct
+	developer := model.Requester{UserID: "d", Role: model.RoleDeveloper} //nolint:exhaustruct
+	viewer := model.Requester{UserID: "v", Role: model.RoleViewer}       //nolint:exhaustruct
+
+	readOnly := model.Requester{ //nolint:exhaustruct
+		UserID: "d",
+		Role:   model.RoleDeveloper,
+		Scopes: []model.Permission{model.PermContainersRead},
+	}
+	scopedAdmin := model.Requester{ //nolint:exhaustruct
+		UserID: "a",
+		Role:   model.RoleAdmin,
+		Scopes: []model.Permission{model.PermUsersRead},
+	}
+
+	usersWrite := Authorize(model.PermUsersWrite)
+	containersRead := Authorize(model.PermContainersRead)
+	containersWrite := Authorize(model.PermContainersWrite)
+	selfOrUsersRead := AuthorizeSelfOr(model.PermUsersRead)
+
+	tests := []struct {
+		name      string
+		mw        func(http.Handler) http.Handler
+		requester model.Requester
+		userParam string
+		want      int
+	}{
+		{name: "admin writes users", mw: usersWrite, requester: admin, want: http.StatusOK},
+		{name: "developer writes users", mw: usersWrite, requester: developer, want: http.StatusForbidden},
+		{name: "developer writes containers", mw: containersWrite, requester: developer, want: http.StatusOK},
+		{name: "viewer writes containers", mw: containersWrite, requester: viewer, want: http.StatusForbidden},
+		{name: "viewer reads containers", mw: containersRead, requester: viewer, want: http.StatusOK},
+		{name: "token scope", mw: containersRead, requester: readOnly, want: http.StatusOK},
+		{name: "outside token scope", mw: containersWrite, requester: readOnly, want: http.StatusForbidden},
+		{name: "admin", mw: AuthorizeAdmin, requester: admin, want: http.StatusOK},
+		{name: "admin with scoped token", mw: AuthorizeAdmin, requester: scopedAdmin, want: http.StatusForbidden},
+		{name: "developer as admin", mw: AuthorizeAdmin, requester: developer, want: http.StatusForbidden},
+		{name: "own user", mw: selfOrUsersRead, requester: developer, userParam: "d", want: http.StatusOK},
+		{name: "other user", mw: selfOrUsersRead, requester: developer, userParam: "v", want: http.StatusForbidden},
+		{name: "own user with a scoped token", mw: selfOrUsersRead, requester: readOnly, userParam: "d",
+			want: http.StatusForbidden},
+		{name: "other user as admin", mw: selfOrUsersRead, requester: admin, userParam: "v", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(t, tt.mw, tt.requester, tt.userParam); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,9 +10,16 @@ import (
 	"github.com/kaibling/apiforge/envelope"
 	"github.com/kaibling/apiforge/log"
 	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
 	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
 )
 
+// SessionCookieName is the cookie holding the proxy session. It is only
+// accepted by the proxy and the terminal, because browsers cannot send bearer
+// headers on navigation and websocket requests.
+const SessionCookieName = "cerodev_session"
+
 func Authentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// read envelope
@@ -32,31 +39,81 @@ func Authentication(next http.Handler) http.Handler {
 			return
 		}
 
-		// validate token and get username
-		us, err := bootstrap.NewUserService(r.Context())
-		if err != nil {
-			l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
-			e.SetError(apierror.ErrForbidden).Finish(w, r, l)
+		authenticate(next, w, r, tokenString, false)
+	})
+}
+
+// SessionAuthentication reads the proxy session from the session cookie and
+// falls back to a bearer token in the Authorization header.
+func SessionAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, l, aerr := envelope.GetEnvelopeAndLogger(r, "authentication")
+		if aerr != nil {
+			e.SetError(aerr).Finish(w, r, l)
 
 			return
 		}
 
-		// todo set token last used
-		user, err := us.CheckToken(tokenString)
-		if err != nil {
-			l.Warn("Error checking token: %s", err.Error())
-			e.SetError(apierror.New(errs.ErrInvalidToken, http.StatusBadRequest)).Finish(w, r, l)
+		if cookie, err := r.Cookie(SessionCookieName); err == nil && cookie.Value != "" {
+			authenticate(next, w, r, cookie.Value, true)
+
+			return
+		}
+
+		tokenString, aerr := extractToken(r.Header, l)
+		if aerr != nil {
+			l.Warn("Session cookie and token not found")
+			e.SetError(apierror.ErrForbidden).Finish(w, r, l)
 
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), ctxkeys.UserNameKey, user.Username)
-		ctx = context.WithValue(ctx, ctxkeys.UserIDKey, user.ID)
-		ctx = context.WithValue(ctx, ctxkeys.TokenKey, tokenString)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		authenticate(next, w, r, tokenString, false)
 	})
 }
 
+// authenticate accepts proxy sessions only from the session cookie and other
+// tokens only as bearer tokens.
+func authenticate(next http.Handler, w http.ResponseWriter, r *http.Request, tokenString string, cookie bool) {
+	e, l, aerr := envelope.GetEnvelopeAndLogger(r, "authentication")
+	if aerr != nil {
+		e.SetError(aerr).Finish(w, r, l)
+
+		return
+	}
+
+	// validate token and get username
+	us, err := bootstrap.GetUserService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
+		e.SetError(apierror.ErrForbidden).Finish(w, r, l)
+
+		return
+	}
+
+	user, token, err := us.CheckToken(r.Context(), tokenString)
+	if err != nil {
+		l.Warn("Error checking token: %s", err.Error())
+		e.SetError(apierror.New(errs.ErrInvalidToken, http.StatusBadRequest)).Finish(w, r, l)
+
+		return
+	}
+
+	if (token.Kind == model.TokenKindSession) != cookie {
+		l.Warn("token %s is not accepted here", token.ID)
+		e.SetError(apierror.ErrForbidden).Finish(w, r, l)
+
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), ctxkeys.UserNameKey, user.Username)
+	ctx = context.WithValue(ctx, ctxkeys.UserIDKey, user.ID)
+	ctx = context.WithValue(ctx, ctxkeys.TokenKey, tokenString)
+	ctx = context.WithValue(ctx, appctx.RoleKey, user.Role)
+	ctx = context.WithValue(ctx, appctx.ScopesKey, token.Scopes)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
 func extractToken(header http.Header, l log.Writer) (string, apierror.HTTPError) {
 	// add logger and remove prints
 	if _, ok := header["Authorization"]; !ok {
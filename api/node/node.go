@@ -0,0 +1,176 @@
+package node
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+func nodesGet(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_node")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ns, err := bootstrap.GetNodeService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.NodeServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	nodes, err := ns.GetAll(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get all nodes", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(nodes).Finish(w, r, l)
+}
+
+func nodeGet(w http.ResponseWriter, r *http.Request) {
+	id := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_node")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ns, err := bootstrap.GetNodeService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.NodeServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	node, err := ns.GetByID(r.Context(), id)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get node", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(node).Finish(w, r, l)
+}
+
+func nodeCreate(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_node")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var node model.Node
+	if err := route.ReadPostData(r, &node); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ns, err := bootstrap.GetNodeService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.NodeServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	created, err := ns.Create(r.Context(), node)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot create node", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(created).Finish(w, r, l)
+}
+
+// nodeUpdate replaces a registered node, empty certificates and key keep the
+// stored ones.
+func nodeUpdate(w http.ResponseWriter, r *http.Request) {
+	id := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_node")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var node model.Node
+	if err := route.ReadPostData(r, &node); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ns, err := bootstrap.GetNodeService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.NodeServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	updated, err := ns.Update(r.Context(), id, node)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot update node", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(updated).Finish(w, r, l)
+}
+
+func nodeDelete(w http.ResponseWriter, r *http.Request) {
+	id := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_node")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ns, err := bootstrap.GetNodeService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.NodeServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := ns.Delete(r.Context(), id); err != nil {
+		l.Warn(errs.ErrMsg("cannot delete node", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
@@ -0,0 +1,21 @@
+package node
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/kaibling/cerodev/api/middleware"
+)
+
+func Route() chi.Router { //nolint: ireturn
+	r := chi.NewRouter()
+	r.Route("/", func(r chi.Router) {
+		r.Use(middleware.Authentication)
+		r.Use(middleware.AuthorizeAdmin)
+		r.Get("/", nodesGet)
+		r.Post("/", nodeCreate)
+		r.Get("/{id}", nodeGet)
+		r.Put("/{id}", nodeUpdate)
+		r.Delete("/{id}", nodeDelete)
+	})
+
+	return r
+}
@@ -0,0 +1,115 @@
+package quota
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+func quotasGet(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_quota")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	qs, err := bootstrap.GetQuotaService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.QuotaServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	quotas, err := qs.GetAll(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get all quotas", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(quotas).Finish(w, r, l)
+}
+
+// quotaSet creates or replaces the quota of a role or a user. Kind and
+// subject are taken from the url.
+func quotaSet(w http.ResponseWriter, r *http.Request) {
+	kind := model.QuotaKind(route.ReadURLParam("kind", r))
+	subject := route.ReadURLParam("subject", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_quota")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var quota model.Quota
+	if err := route.ReadPostData(r, &quota); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	quota.Kind = kind
+	quota.Subject = subject
+
+	qs, err := bootstrap.GetQuotaService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.QuotaServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	saved, err := qs.Save(r.Context(), &quota)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot save quota", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(saved).Finish(w, r, l)
+}
+
+func quotaDelete(w http.ResponseWriter, r *http.Request) {
+	kind := model.QuotaKind(route.ReadURLParam("kind", r))
+	subject := route.ReadURLParam("subject", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_quota")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	qs, err := bootstrap.GetQuotaService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.QuotaServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := qs.Delete(r.Context(), kind, subject); err != nil {
+		l.Warn(errs.ErrMsg("cannot delete quota", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
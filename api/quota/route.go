@@ -0,0 +1,21 @@
+package quota
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/model"
+)
+
+func Route() chi.Router { //nolint: ireturn
+	r := chi.NewRouter()
+	r.Route("/", func(r chi.Router) {
+		r.Use(middleware.Authentication)
+		r.With(middleware.Authorize(model.PermUsersRead)).Get("/", quotasGet)
+		r.With(middleware.Authorize(model.PermUsersWrite)).Group(func(r chi.Router) {
+			r.Put("/{kind}/{subject}", quotaSet)
+			r.Delete("/{kind}/{subject}", quotaDelete)
+		})
+	})
+
+	return r
+}
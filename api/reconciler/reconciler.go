@@ -0,0 +1,61 @@
+package reconciler
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+)
+
+// getReport returns the findings of the latest reconciler run.
+func getReport(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_reconciler")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	rs, err := bootstrap.GetReconcileService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ReconcileServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	report := rs.LastReport()
+	if report == nil {
+		l.Warn("reconciler has not run yet")
+		e.SetError(apierrs.HandleError(errs.ErrDataNotFound)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(report).Finish(w, r, l)
+}
+
+// runReconciler reconciles immediately and returns the report.
+func runReconciler(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_reconciler")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	rs, err := bootstrap.GetReconcileService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ReconcileServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(rs.Run(r.Context())).Finish(w, r, l)
+}
@@ -0,0 +1,18 @@
+package reconciler
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/kaibling/cerodev/api/middleware"
+)
+
+func Route() chi.Router { //nolint: ireturn
+	r := chi.NewRouter()
+	r.Route("/", func(r chi.Router) {
+		r.Use(middleware.Authentication)
+		r.Use(middleware.AuthorizeAdmin)
+		r.Get("/", getReport)
+		r.Post("/run", runReconciler)
+	})
+
+	return r
+}
@@ -3,17 +3,23 @@ package template
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/model"
 )
 
 func Route() chi.Router { //nolint: ireturn
 	r := chi.NewRouter()
 	r.Route("/", func(r chi.Router) {
 		r.Use(middleware.Authentication)
-		r.Post("/", createTemplate)
-		r.Get("/", getTemplates)
-		r.Delete("/{id}", deleteTemplate)
-		r.Post("/{id}", buildImage)
-		r.Put("/{id}", updateTemplate)
+		r.With(middleware.Authorize(model.PermTemplatesRead)).Get("/", getTemplates)
+		r.With(middleware.Authorize(model.PermTemplatesRead)).Get("/{id}/secrets", templateSecretsGet)
+		r.With(middleware.Authorize(model.PermTemplatesWrite)).Group(func(r chi.Router) {
+			r.Post("/", createTemplate)
+			r.Delete("/{id}", deleteTemplate)
+			r.Put("/{id}", updateTemplate)
+			r.Put("/{id}/secrets/{name}", templateSecretSave)
+			r.Delete("/{id}/secrets/{name}", templateSecretDelete)
+		})
+		r.With(middleware.Authorize(model.PermImagesWrite)).Post("/{id}", buildImage)
 	})
 
 	return r
@@ -0,0 +1,114 @@
+package template
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+// templateSecretsGet lists the secrets of a template without their values.
+func templateSecretsGet(w http.ResponseWriter, r *http.Request) {
+	templateID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_template")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ss, err := bootstrap.GetSecretService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.SecretServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	secrets, err := ss.GetAll(r.Context(), model.SecretScopeTemplate, templateID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get secrets", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(secrets).Finish(w, r, l)
+}
+
+// templateSecretSave creates or replaces a secret of a template.
+func templateSecretSave(w http.ResponseWriter, r *http.Request) {
+	templateID := route.ReadURLParam("id", r)
+	name := route.ReadURLParam("name", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_template")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var secretRequest model.SecretRequest
+	if err := route.ReadPostData(r, &secretRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ss, err := bootstrap.GetSecretService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.SecretServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	secret, err := ss.Save(r.Context(), model.SecretScopeTemplate, templateID, name, secretRequest.Value)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot save secret", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(secret).Finish(w, r, l)
+}
+
+func templateSecretDelete(w http.ResponseWriter, r *http.Request) {
+	templateID := route.ReadURLParam("id", r)
+	name := route.ReadURLParam("name", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_template")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ss, err := bootstrap.GetSecretService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.SecretServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := ss.Delete(r.Context(), model.SecretScopeTemplate, templateID, name); err != nil {
+		l.Warn(errs.ErrMsg("cannot delete secret", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
@@ -3,10 +3,12 @@ package template
 import (
 	"net/http"
 
+	"github.com/kaibling/apiforge/ctxkeys"
 	"github.com/kaibling/apiforge/envelope"
 	"github.com/kaibling/apiforge/route"
 	"github.com/kaibling/cerodev/api/apierrs"
 	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
 	"github.com/kaibling/cerodev/errs"
 	"github.com/kaibling/cerodev/errs/msg"
 	"github.com/kaibling/cerodev/model"
@@ -21,7 +23,7 @@ func getTemplates(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cs, err := bootstrap.NewTemplateService(r.Context())
+	cs, err := bootstrap.GetTemplateService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.TemplateServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -29,7 +31,7 @@ func getTemplates(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	templates, err := cs.GetAll()
+	templates, err := cs.GetAll(r.Context())
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot get all tokens", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -59,7 +61,7 @@ func createTemplate(w http.ResponseWriter, r *http.Request) {
 
 	requestTemplate.ID = ""
 
-	cs, err := bootstrap.NewTemplateService(r.Context())
+	cs, err := bootstrap.GetTemplateService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.TemplateServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -67,7 +69,7 @@ func createTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newTemplate, err := cs.Create(&requestTemplate)
+	newTemplate, err := cs.Create(r.Context(), &requestTemplate)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot create template", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -89,7 +91,7 @@ func deleteTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cs, err := bootstrap.NewTemplateService(r.Context())
+	cs, err := bootstrap.GetTemplateService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.TemplateServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -97,7 +99,7 @@ func deleteTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cs.Delete(templateID)
+	err = cs.Delete(r.Context(), templateID)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot delete template", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -105,6 +107,21 @@ func deleteTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ss, err := bootstrap.GetSecretService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.SecretServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := ss.DeleteAll(r.Context(), model.SecretScopeTemplate, templateID); err != nil {
+		l.Warn(errs.ErrMsg("cannot delete template secrets", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
 	e.SetSuccess().Finish(w, r, l)
 }
 
@@ -130,15 +147,25 @@ func buildImage(w http.ResponseWriter, r *http.Request) {
 	buildParams.Validate()
 	buildParams.TemplateID = templateID
 
-	ctrs, err := bootstrap.NewContainerService(r.Context())
+	requester, err := appctx.GetRequester(r.Context())
 	if err != nil {
-		l.Warn(errs.ServiceBuildError(bootstrap.TemplateServiceName, err))
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	token, _ := ctxkeys.GetValue(r.Context(), ctxkeys.TokenKey).(string)
+
+	bs, err := bootstrap.GetBuildService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.BuildServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
 
 		return
 	}
 
-	err = ctrs.BuildTemplate(buildParams.TemplateID, buildParams.Tag, buildParams.BuildArgs)
+	job, err := bs.Enqueue(r.Context(), requester, token, buildParams)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot build template", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -146,7 +173,7 @@ func buildImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	e.SetSuccess().Finish(w, r, l)
+	e.SetResponse(job).Finish(w, r, l)
 }
 
 func updateTemplate(w http.ResponseWriter, r *http.Request) {
@@ -170,7 +197,7 @@ func updateTemplate(w http.ResponseWriter, r *http.Request) {
 
 	template.ID = templateID
 
-	ts, err := bootstrap.NewTemplateService(r.Context())
+	ts, err := bootstrap.GetTemplateService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.TemplateServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -178,7 +205,7 @@ func updateTemplate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newTemplate, err := ts.Update(&template)
+	newTemplate, err := ts.Update(r.Context(), &template)
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot update template", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -0,0 +1,114 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+// userGitCredentialsGet lists the git credentials of a user without secrets.
+func userGitCredentialsGet(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetCredentialService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.CredentialServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	credentials, err := cs.GetAll(r.Context(), userID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get git credentials", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(credentials).Finish(w, r, l)
+}
+
+// userGitCredentialSave stores an https token or ssh key of a user for a
+// host, replacing the previous one of the same kind.
+func userGitCredentialSave(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var credential model.GitCredential
+	if err := route.ReadPostData(r, &credential); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetCredentialService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.CredentialServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	saved, err := cs.Save(r.Context(), userID, credential)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot save git credential", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(saved).Finish(w, r, l)
+}
+
+func userGitCredentialDelete(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+	credentialID := route.ReadURLParam("credentialID", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetCredentialService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.CredentialServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := cs.Delete(r.Context(), userID, credentialID); err != nil {
+		l.Warn(errs.ErrMsg("cannot delete git credential", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
@@ -3,13 +3,33 @@ package user
 import (
 	"github.com/go-chi/chi/v5"
 	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/model"
 )
 
 func Route() chi.Router { //nolint: ireturn
 	r := chi.NewRouter()
 	r.Route("/", func(r chi.Router) {
 		r.Use(middleware.Authentication)
-		r.Get("/", usersGet)
+		r.With(middleware.Authorize(model.PermUsersRead)).Get("/", usersGet)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersRead)).Get("/{id}", userGet)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersWrite)).Put("/{id}", userUpdate)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersRead)).Get("/{id}/tokens", userTokensGet)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersRead)).Get("/{id}/usage", userUsageGet)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersRead)).Get("/{id}/backups", userBackupsGet)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersRead)).Get("/{id}/git-credentials", userGitCredentialsGet)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersWrite)).Post("/{id}/git-credentials", userGitCredentialSave)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersWrite)).
+			Delete("/{id}/git-credentials/{credentialID}", userGitCredentialDelete)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersRead)).Get("/{id}/secrets", userSecretsGet)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersWrite)).Put("/{id}/secrets/{name}", userSecretSave)
+		r.With(middleware.AuthorizeSelfOr(model.PermUsersWrite)).Delete("/{id}/secrets/{name}", userSecretDelete)
+		r.With(middleware.Authorize(model.PermUsersWrite)).Group(func(r chi.Router) {
+			r.Post("/", userCreate)
+			r.Delete("/{id}", userDelete)
+			r.Put("/{id}/role", userRoleSet)
+			r.Put("/{id}/idle-timeout", userIdleTimeoutSet)
+			r.Delete("/{id}/tokens/{tokenID}", userTokenDelete)
+		})
 	})
 
 	return r
@@ -0,0 +1,114 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
+)
+
+// userSecretsGet lists the secrets of a user without their values.
+func userSecretsGet(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ss, err := bootstrap.GetSecretService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.SecretServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	secrets, err := ss.GetAll(r.Context(), model.SecretScopeUser, userID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get secrets", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(secrets).Finish(w, r, l)
+}
+
+// userSecretSave creates or replaces a secret of a user.
+func userSecretSave(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+	name := route.ReadURLParam("name", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var secretRequest model.SecretRequest
+	if err := route.ReadPostData(r, &secretRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	ss, err := bootstrap.GetSecretService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.SecretServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	secret, err := ss.Save(r.Context(), model.SecretScopeUser, userID, name, secretRequest.Value)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot save secret", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(secret).Finish(w, r, l)
+}
+
+func userSecretDelete(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+	name := route.ReadURLParam("name", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ss, err := bootstrap.GetSecretService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.SecretServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := ss.Delete(r.Context(), model.SecretScopeUser, userID, name); err != nil {
+		l.Warn(errs.ErrMsg("cannot delete secret", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
@@ -0,0 +1,72 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
+	"github.com/kaibling/cerodev/api/apierrs"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/errs/msg"
+)
+
+func userTokensGet(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ts, err := bootstrap.GetTokenService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.TokenServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	tokens, err := ts.GetByUserID(r.Context(), userID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get user tokens", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(tokens).Finish(w, r, l)
+}
+
+func userTokenDelete(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+	tokenID := route.ReadURLParam("tokenID", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	ts, err := bootstrap.GetTokenService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.TokenServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if err := ts.Revoke(r.Context(), userID, tokenID); err != nil {
+		l.Warn(errs.ErrMsg("cannot revoke user token", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
@@ -4,10 +4,13 @@ import (
 	"net/http"
 
 	"github.com/kaibling/apiforge/envelope"
+	"github.com/kaibling/apiforge/route"
 	"github.com/kaibling/cerodev/api/apierrs"
 	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/appctx"
 	"github.com/kaibling/cerodev/errs"
 	"github.com/kaibling/cerodev/errs/msg"
+	"github.com/kaibling/cerodev/model"
 )
 
 func usersGet(w http.ResponseWriter, r *http.Request) {
@@ -19,7 +22,7 @@ func usersGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	us, err := bootstrap.NewUserService(r.Context())
+	us, err := bootstrap.GetUserService(r.Context())
 	if err != nil {
 		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -27,7 +30,7 @@ func usersGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	users, err := us.GetAll()
+	users, err := us.GetAll(r.Context())
 	if err != nil {
 		l.Warn(errs.ErrMsg("cannot get all users", err))
 		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
@@ -37,3 +40,311 @@ func usersGet(w http.ResponseWriter, r *http.Request) {
 
 	e.SetResponse(users).Finish(w, r, l)
 }
+
+func userRoleSet(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var roleRequest model.RoleRequest
+	if err := route.ReadPostData(r, &roleRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	us, err := bootstrap.GetUserService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	user, err := us.SetRole(r.Context(), userID, roleRequest.Role)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot set user role", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(user).Finish(w, r, l)
+}
+
+func userIdleTimeoutSet(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var idleTimeoutRequest model.IdleTimeoutRequest
+	if err := route.ReadPostData(r, &idleTimeoutRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	us, err := bootstrap.GetUserService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	user, err := us.SetIdleTimeout(r.Context(), userID, idleTimeoutRequest.IdleTimeout)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot set user idle timeout", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(user).Finish(w, r, l)
+}
+
+func userGet(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	us, err := bootstrap.GetUserService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	user, err := us.GetByID(r.Context(), userID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get user", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(user).Finish(w, r, l)
+}
+
+func userCreate(w http.ResponseWriter, r *http.Request) {
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var requestUser model.User
+	if err := route.ReadPostData(r, &requestUser); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requestUser.ID = ""
+
+	us, err := bootstrap.GetUserService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	newUser, err := us.Create(r.Context(), &requestUser)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot create user", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(newUser).Finish(w, r, l)
+}
+
+func userUpdate(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	var updateRequest model.UserUpdateRequest
+	if err := route.ReadPostData(r, &updateRequest); err != nil {
+		l.Warn(errs.ErrMsg(msg.RequestParse, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get requester", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	us, err := bootstrap.GetUserService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	// users changing their own password have to prove they know the current one
+	user, err := us.Update(r.Context(), userID, &updateRequest, requester.UserID == userID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot update user", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(user).Finish(w, r, l)
+}
+
+func userDelete(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	us, err := bootstrap.GetUserService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.UserServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	if _, err := us.GetByID(r.Context(), userID); err != nil {
+		l.Warn(errs.ErrMsg("cannot get user", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	// remove containers, volumes, ports, snapshots and backups before the db
+	// cascade drops the rows
+	if err := cs.DeleteAllByUserID(r.Context(), userID); err != nil {
+		l.Warn(errs.ErrMsg("cannot delete user containers", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	// the secrets and the user are deleted in one transaction
+	if err := us.Delete(r.Context(), userID); err != nil {
+		l.Warn(errs.ErrMsg("cannot delete user", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetSuccess().Finish(w, r, l)
+}
+
+// userUsageGet reports the current consumption of a user and its quota.
+func userUsageGet(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	qs, err := bootstrap.GetQuotaService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.QuotaServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	usage, err := qs.Usage(r.Context(), userID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get user usage", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(usage).Finish(w, r, l)
+}
+
+// userBackupsGet lists the stored backups of all workspaces of a user,
+// including deleted ones.
+func userBackupsGet(w http.ResponseWriter, r *http.Request) {
+	userID := route.ReadURLParam("id", r)
+
+	e, l, merr := envelope.GetEnvelopeAndLogger(r, "api_user")
+	if merr != nil {
+		l.Warn(errs.ErrMsg(msg.EnvelopeLoad, merr))
+		e.SetError(merr).Finish(w, r, l)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn(errs.ServiceBuildError(bootstrap.ContainerServiceName, err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	backups, err := cs.GetUserBackups(userID)
+	if err != nil {
+		l.Warn(errs.ErrMsg("cannot get user backups", err))
+		e.SetError(apierrs.HandleError(err)).Finish(w, r, l)
+
+		return
+	}
+
+	e.SetResponse(backups).Finish(w, r, l)
+}
@@ -12,6 +12,7 @@ import (
 	apiservice "github.com/kaibling/apiforge/service"
 	"github.com/kaibling/apiforge/status"
 	"github.com/kaibling/cerodev/api"
+	authmiddleware "github.com/kaibling/cerodev/api/middleware"
 	"github.com/kaibling/cerodev/bootstrap"
 	"github.com/kaibling/cerodev/config"
 	"github.com/kaibling/cerodev/web"
@@ -24,19 +25,49 @@ func Start(
 	cfg config.Configuration,
 	baselogger log.Writer,
 	conn *sql.DB,
+	services *bootstrap.Services,
 ) error {
-	root := chi.NewRouter()
+	go services.WebSocket.StartHealthCheck(ctx)
 
-	wss, err := bootstrap.NewWebSocketService()
-	if err != nil {
-		return err
+	if err := services.Build.FailUnfinished(ctx); err != nil {
+		baselogger.Warn("failed to fail unfinished builds: %s", err.Error())
 	}
-	go wss.StartHealthCheck(ctx)
+
+	go services.Idle.Start(ctx)
+	go services.Stats.Start(ctx)
+	go services.Backup.Start(ctx)
+	go services.Janitor.Start(ctx)
+
+	root := Router(cfg, baselogger, conn, services)
+
+	apiServer := apiservice.New(ctx, apiservice.ServerConfig{ //nolint:exhaustruct
+		BindingIP:      cfg.APIBindingIP,
+		BindingPort:    cfg.APIBindingPort,
+		EnableTLS:      cfg.APIEnableTLS,
+		TLSCertPath:    cfg.APITLSCertPath,
+		TLSCertKeyPath: cfg.APITLSCertKeyPath,
+	})
+
+	status.IsReady.Store(true)
+
+	return apiServer.Start(root, baselogger)
+}
+
+// Router returns the handler of the api, the proxy and the ui. The
+// background services are started by Start.
+func Router(
+	cfg config.Configuration,
+	baselogger log.Writer,
+	conn *sql.DB,
+	services *bootstrap.Services,
+) chi.Router {
+	root := chi.NewRouter()
+
 	// context
 	root.Use(middleware.AddContext(ctxkeys.LoggerKey, baselogger))
 	root.Use(middleware.AddContext(ctxkeys.DBConnKey, conn))
 	root.Use(middleware.AddContext(ctxkeys.AppConfigKey, cfg))
-	root.Use(middleware.AddContext("websocket", wss))
+	root.Use(middleware.AddContext(bootstrap.ServicesKey, services))
 
 	// middleware
 	root.Use(cors.Handler(cors.Options{ //nolint:exhaustruct
@@ -50,25 +81,19 @@ func Start(
 	}))
 
 	root.Use(middleware.InitEnvelope)
-	root.Use(middleware.SaveBody)
+	root.Use(saveBody)
 	root.Use(middleware.LogRequest)
 	root.Use(middleware.Recoverer)
 
-	root.Mount("/proxy", proxyHandler())
+	if cfg.ProxyBaseDomain != "" {
+		root.Use(subdomainProxy(cfg.ProxyBaseDomain))
+	}
+
+	root.Mount("/proxy", authmiddleware.SessionAuthentication(proxyHandler()))
 	root.Mount("/api/v1", api.Route())
 	web.AddUIRoute(root)
 
 	// root.NotFound(handler.NotFound)
 
-	apiServer := apiservice.New(ctx, apiservice.ServerConfig{ //nolint:exhaustruct
-		BindingIP:      cfg.APIBindingIP,
-		BindingPort:    cfg.APIBindingPort,
-		EnableTLS:      cfg.APIEnableTLS,
-		TLSCertPath:    cfg.APITLSCertPath,
-		TLSCertKeyPath: cfg.APITLSCertKeyPath,
-	})
-
-	status.IsReady.Store(true)
-
-	return apiServer.Start(root, baselogger)
+	return root
 }
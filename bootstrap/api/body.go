@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/kaibling/apiforge/ctxkeys"
+	"github.com/kaibling/cerodev/pkg/archive"
+)
+
+const maskedValue = "********"
+
+// sensitiveKeys are json keys whose values are masked in the request log.
+var sensitiveKeys = map[string]bool{ //nolint:gochecknoglobals
+	"password":         true,
+	"current_password": true,
+	"secret":           true,
+	"value":            true,
+	"token":            true,
+}
+
+// saveBody keeps the request body for the request log with passwords, tokens
+// and secrets masked. Archive uploads are streamed to the handler instead of
+// being read into memory and logged.
+func saveBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if archive.IsContentType(r.Header.Get("Content-Type")) {
+			ctx := context.WithValue(r.Context(), ctxkeys.ByteBodyKey, []byte{})
+			next.ServeHTTP(w, r.WithContext(ctx))
+
+			return
+		}
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewBuffer(b))
+		ctx := context.WithValue(r.Context(), ctxkeys.ByteBodyKey, maskBody(b))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// maskBody returns the json body with sensitive values masked. Bodies that
+// are not json cannot be checked and are not logged.
+func maskBody(b []byte) []byte {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return b
+	}
+
+	var body any
+	if err := json.Unmarshal(b, &body); err != nil {
+		return []byte{}
+	}
+
+	masked, err := json.Marshal(maskValue(body))
+	if err != nil {
+		return []byte{}
+	}
+
+	return masked
+}
+
+func maskValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if sensitiveKeys[strings.ToLower(key)] && value != nil {
+				v[key] = maskedValue
+			} else {
+				v[key] = maskValue(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = maskValue(value)
+		}
+	}
+
+	return v
+}
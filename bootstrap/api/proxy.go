@@ -1,73 +1,312 @@
 package api
 
 import (
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
 
+	authmiddleware "github.com/kaibling/cerodev/api/middleware"
 	"github.com/kaibling/cerodev/bootstrap"
 	"github.com/kaibling/cerodev/bootstrap/appctx"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/utils"
+	"github.com/kaibling/cerodev/service"
 )
 
+// workspaceStartRetry is the number of seconds after which clients retry a
+// request to a workspace that is starting.
+const workspaceStartRetry = 3
+
+const workspaceStartingPage = `<!DOCTYPE html>
+<html><head><meta http-equiv="refresh" content="%d"><title>Starting workspace</title></head>
+<body>The workspace is starting, this page reloads automatically.</body></html>
+`
+
+// proxyHandler routes /proxy/{id}/... to the code-server and
+// /proxy/{port}-{id}/... to a published port of a workspace.
+// Redirects of the backend are rewritten to stay below the proxy prefix.
 func proxyHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		proxyPath := strings.TrimPrefix(r.URL.Path, "/proxy")
-		containerID := strings.Split(proxyPath, "/")[1]
+		label := strings.Split(proxyPath, "/")[1]
+		prefix := "/proxy/" + label
 
-		_, l, cfg, err := appctx.GetBaseData(r.Context())
-		if err != nil {
-			l.Warn("could not read context: %s", err.Error())
+		containerID, port, ok := parseProxyLabel(label)
+		if !ok {
 			http.Error(w, "Not found", http.StatusNotFound)
 
 			return
 		}
 
-		cs, err := bootstrap.NewContainerService(r.Context())
-		if err != nil {
-			l.Warn("could not build containerservice: %s", err.Error())
-			http.Error(w, "Not found", http.StatusNotFound)
+		r.URL.Path = strings.TrimPrefix(proxyPath, "/"+label)
+		serveProxy(w, r, containerID, port, prefix)
+	})
+}
 
-			return
-		}
+// subdomainProxy routes requests for {container-id}.{base-domain} and
+// {port}-{container-id}.{base-domain} to the workspace, cross-site requests
+// to them are rejected. Requests for all other hosts are passed on.
+func subdomainProxy(baseDomain string) func(http.Handler) http.Handler {
+	proxy := authmiddleware.SessionAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		containerID, port, _ := parseProxyHost(r.Host, baseDomain)
+		serveProxy(w, r, containerID, port, "")
+	}))
 
-		c, err := cs.GetByID(containerID)
-		if err != nil {
-			l.Warn("could not read container: %s", err.Error())
-			http.Error(w, "Not found", http.StatusNotFound)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, _, ok := parseProxyHost(r.Host, baseDomain); !ok {
+				next.ServeHTTP(w, r)
 
-			return
-		}
+				return
+			}
 
-		targetURL := cfg.PublicURL + ":" + c.UIPort
+			if crossSite(r) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
 
-		target, err := url.Parse(targetURL)
-		if err != nil {
-			l.Warn("could not build proxy target: %s", err.Error())
-			http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
 
-			return
+			proxy.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseProxyHost extracts the container id and the optional container port
+// from a workspace host name.
+func parseProxyHost(host, baseDomain string) (string, int, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	label, found := strings.CutSuffix(strings.ToLower(host), "."+baseDomain)
+	if !found || strings.Contains(label, ".") {
+		return "", 0, false
+	}
+
+	return parseProxyLabel(label)
+}
+
+// parseProxyLabel splits {id} or {port}-{id}. Host names are lower case,
+// container ids are upper case ULIDs. Other labels like www or api are not
+// workspaces.
+func parseProxyLabel(label string) (string, int, bool) {
+	portString, containerID, found := strings.Cut(label, "-")
+	if !found {
+		portString, containerID = "", label
+	}
+
+	containerID = strings.ToUpper(containerID)
+	if !utils.IsULID(containerID) {
+		return "", 0, false
+	}
+
+	if !found {
+		return containerID, 0, true
+	}
+
+	port, err := strconv.Atoi(portString)
+	if err != nil || port < 1 {
+		return "", 0, false
+	}
+
+	return containerID, port, true
+}
+
+// serveProxy forwards the request to the workspace. The code-server is used
+// when port is 0. A non-empty prefix is prepended to redirects.
+func serveProxy(w http.ResponseWriter, r *http.Request, containerID string, port int, prefix string) {
+	_, l, _, err := appctx.GetBaseData(r.Context())
+	if err != nil {
+		l.Warn("could not read context: %s", err.Error())
+		http.Error(w, "Not found", http.StatusNotFound)
+
+		return
+	}
+
+	requester, err := appctx.GetRequester(r.Context())
+	if err != nil {
+		l.Warn("could not read requester: %s", err.Error())
+		http.Error(w, "Not found", http.StatusNotFound)
+
+		return
+	}
+
+	if !requester.Can(model.PermWorkspacesAccess) {
+		l.Warn("requester is not allowed to access workspaces")
+		http.Error(w, "Not found", http.StatusNotFound)
+
+		return
+	}
+
+	cs, err := bootstrap.GetContainerService(r.Context())
+	if err != nil {
+		l.Warn("could not get containerservice: %s", err.Error())
+		http.Error(w, "Not found", http.StatusNotFound)
+
+		return
+	}
+
+	targetURL, err := cs.ProxyTarget(r.Context(), requester, containerID, port)
+	if err != nil {
+		l.Warn("could not resolve proxy target: %s", err.Error())
+		startWorkspace(w, r, cs, requester, containerID, http.StatusNotFound)
+
+		return
+	}
+
+	target, err := url.Parse(targetURL)
+	if err != nil {
+		l.Warn("could not build proxy target: %s", err.Error())
+		http.Error(w, "Not found", http.StatusNotFound)
+
+		return
+	}
+
+	// editor and terminal traffic runs over one long-lived websocket, the
+	// workspace is active as long as it is open
+	if is, err := bootstrap.GetIdleService(r.Context()); err == nil {
+		if isUpgrade(r) {
+			defer is.Attach(containerID)()
+		} else {
+			is.Touch(containerID)
 		}
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		stripCredentials(r)
+	}
 
-		proxy := httputil.NewSingleHostReverseProxy(target)
+	// a stopped workspace refuses connections, start it
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		l.Warn("proxy request failed: %s", err.Error())
+		startWorkspace(w, r, cs, requester, containerID, http.StatusBadGateway)
+	}
+
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		dropSessionCookies(resp.Header)
 
 		// Fix redirects from backend that use Location header
-		proxy.ModifyResponse = func(resp *http.Response) error {
-			location := resp.Header.Get("Location")
-			if location != "" {
-				if strings.HasPrefix(location, "/") {
-					resp.Header.Set("Location", "/proxy/"+containerID+location)
-				} else if strings.HasPrefix(location, "./") {
-					newLoc := "/proxy/" + containerID + "/" + strings.TrimPrefix(location, "./")
-					resp.Header.Set("Location", newLoc)
-				}
+		if prefix == "" {
+			return nil
+		}
+
+		location := resp.Header.Get("Location")
+		if location != "" {
+			if strings.HasPrefix(location, "/") {
+				resp.Header.Set("Location", prefix+location)
+			} else if strings.HasPrefix(location, "./") {
+				newLoc := prefix + "/" + strings.TrimPrefix(location, "./")
+				resp.Header.Set("Location", newLoc)
 			}
+		}
 
-			return nil
+		return nil
+	}
+
+	proxy.ServeHTTP(w, r)
+}
+
+// isUpgrade reports whether a request asks to switch the protocol, e.g. to a
+// websocket. The proxy serves it until the connection is closed.
+func isUpgrade(r *http.Request) bool {
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
 		}
+	}
 
-		newPath := strings.TrimPrefix(proxyPath, "/"+containerID)
-		r.URL.Path = newPath
-		proxy.ServeHTTP(w, r)
-	})
+	return false
+}
+
+// stripCredentials removes the session cookie and the bearer token from a
+// request to a workspace. Code running in the workspace must not be able to
+// act on behalf of the visitor.
+func stripCredentials(r *http.Request) {
+	r.Header.Del("Authorization")
+
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+
+	for _, c := range cookies {
+		if c.Name != authmiddleware.SessionCookieName {
+			r.AddCookie(c)
+		}
+	}
+}
+
+// dropSessionCookies removes session cookies set by a workspace. A workspace
+// below the base domain could otherwise replace the session of its visitors
+// with one of its owner.
+func dropSessionCookies(header http.Header) {
+	cookies := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+
+	for _, value := range cookies {
+		if c, err := http.ParseSetCookie(value); err == nil && c.Name == authmiddleware.SessionCookieName {
+			continue
+		}
+
+		header.Add("Set-Cookie", value)
+	}
+}
+
+// crossSite reports whether a request to a workspace host was sent by another
+// site, e.g. by the page of another workspace below the base domain, other
+// than by following a link. Browsers send the session cookie along with
+// those, because the cookie is shared by all workspace hosts.
+func crossSite(r *http.Request) bool {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+
+		return err != nil || !strings.EqualFold(u.Host, r.Host)
+	}
+
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+		return false
+	}
+
+	navigation := r.Header.Get("Sec-Fetch-Mode") == "navigate" &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead)
+
+	return !navigation
+}
+
+// startWorkspace starts a stopped workspace and asks the client to retry.
+// If the workspace is running or cannot be accessed, it responds with status.
+func startWorkspace(
+	w http.ResponseWriter,
+	r *http.Request,
+	cs *service.ContainerService,
+	requester model.Requester,
+	containerID string,
+	status int,
+) {
+	_, l, _, _ := appctx.GetBaseData(r.Context()) //nolint:dogsled
+
+	started, err := cs.EnsureRunning(r.Context(), requester, containerID)
+	if err != nil {
+		l.Warn("could not start workspace: %s", err.Error())
+	}
+
+	if !started {
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Retry-After", strconv.Itoa(workspaceStartRetry))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = fmt.Fprintf(w, workspaceStartingPage, workspaceStartRetry)
 }
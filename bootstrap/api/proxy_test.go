@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	authmiddleware "github.com/kaibling/cerodev/api/middleware"
+)
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		connection []string
+		want       bool
+	}{
+		{connection: nil, want: false},
+		{connection: []string{"keep-alive"}, want: false},
+		{connection: []string{"Upgrade"}, want: true},
+		{connection: []string{"keep-alive, upgrade"}, want: true},
+		{connection: []string{"keep-alive", "Upgrade"}, want: true},
+		{connection: []string{"upgrade-insecure-requests"}, want: false},
+	}
+
+	for _, tt := range tests {
+		r, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, v := range tt.connection {
+			r.Header.Add("Connection", v)
+		}
+
+		if got := isUpgrade(r); got != tt.want {
+			t.Errorf("isUpgrade(%q) = %v, want %v", tt.connection, got, tt.want)
+		}
+	}
+}
+
+func TestParseProxyHost(t *testing.T) {
+	const id = "01JZ3F8Q7V5X2N4M6K8P0R2T4W"
+
+	tests := []struct {
+		host   string
+		wantID string
+		port   int
+		ok     bool
+	}{
+		{host: "01jz3f8q7v5x2n4m6k8p0r2t4w.dev.example.com", wantID: id, ok: true},
+		{host: "01JZ3F8Q7V5X2N4M6K8P0R2T4W.dev.example.com:8443", wantID: id, ok: true},
+		{host: "3000-01jz3f8q7v5x2n4m6k8p0r2t4w.dev.example.com", wantID: id, port: 3000, ok: true},
+		{host: "www.dev.example.com"},
+		{host: "api.dev.example.com"},
+		{host: "dev.example.com"},
+		{host: "my-app.dev.example.com"},
+		{host: "0-01jz3f8q7v5x2n4m6k8p0r2t4w.dev.example.com"},
+		{host: "x-01jz3f8q7v5x2n4m6k8p0r2t4w.dev.example.com"},
+		{host: "01jz3f8q7v5x2n4m6k8p0r2t4.dev.example.com"},
+		{host: "a.01jz3f8q7v5x2n4m6k8p0r2t4w.dev.example.com"},
+		{host: "01jz3f8q7v5x2n4m6k8p0r2t4w.other.com"},
+	}
+
+	for _, tt := range tests {
+		containerID, port, ok := parseProxyHost(tt.host, "dev.example.com")
+		if containerID != tt.wantID || port != tt.port || ok != tt.ok {
+			t.Errorf("parseProxyHost(%q) = %q, %d, %v, want %q, %d, %v",
+				tt.host, containerID, port, ok, tt.wantID, tt.port, tt.ok)
+		}
+	}
+}
+
+func TestCrossSite(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "no fetch metadata", method: http.MethodGet},
+		{name: "same origin", method: http.MethodPost, headers: map[string]string{
+			"Origin": "https://01jz.dev.example.com", "Sec-Fetch-Site": "same-origin",
+		}},
+		{name: "typed into the address bar", method: http.MethodGet, headers: map[string]string{
+			"Sec-Fetch-Site": "none", "Sec-Fetch-Mode": "navigate",
+		}},
+		{name: "link from another workspace", method: http.MethodGet, headers: map[string]string{
+			"Sec-Fetch-Site": "same-site", "Sec-Fetch-Mode": "navigate",
+		}},
+		{name: "fetch from another workspace", method: http.MethodGet, want: true, headers: map[string]string{
+			"Sec-Fetch-Site": "same-site", "Sec-Fetch-Mode": "no-cors",
+		}},
+		{name: "form post from another workspace", method: http.MethodPost, want: true, headers: map[string]string{
+			"Origin": "https://3000-01jz.dev.example.com", "Sec-Fetch-Site": "same-site", "Sec-Fetch-Mode": "navigate",
+		}},
+		{name: "websocket from another site", method: http.MethodGet, want: true, headers: map[string]string{
+			"Origin": "https://evil.example.org",
+		}},
+		{name: "opaque origin", method: http.MethodPost, want: true, headers: map[string]string{
+			"Origin": "null",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(tt.method, "https://01jz.dev.example.com/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+
+			if got := crossSite(r); got != tt.want {
+				t.Errorf("crossSite = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropSessionCookies(t *testing.T) {
+	header := http.Header{}
+	header.Add("Set-Cookie", "theme=dark; Path=/")
+	header.Add("Set-Cookie", authmiddleware.SessionCookieName+"=stolen; Domain=dev.example.com; Path=/")
+	header.Add("Set-Cookie", "csrf=abc; HttpOnly")
+
+	dropSessionCookies(header)
+
+	got := header.Values("Set-Cookie")
+	if len(got) != 2 || got[0] != "theme=dark; Path=/" || got[1] != "csrf=abc; HttpOnly" {
+		t.Errorf("Set-Cookie = %q", got)
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/kaibling/cerodev/migration"
 	"github.com/kaibling/cerodev/model"
 	"github.com/kaibling/cerodev/pkg/repo/sqliterepo"
+	"github.com/kaibling/cerodev/service"
 )
 
 const volumePermissions = 0o755
@@ -55,14 +56,33 @@ func New() error { //nolint:funlen
 		return err
 	}
 
-	if err := ensureAdminUser(ctx); err != nil {
+	services, err := bootstrap.NewServices(ctx, conn, baselogger, cfg)
+	if err != nil {
+		appLogger.Warn("failed to create services: %s", err.Error())
+		ctxCancel()
+
+		return err
+	}
+
+	appLogger.Info("provider: %s", cfg.Provider)
+
+	if cfg.Provider == config.ProviderDocker {
+		if err := services.Node.ConnectAll(ctx); err != nil {
+			appLogger.Warn("failed to connect nodes: %s", err.Error())
+			ctxCancel()
+
+			return err
+		}
+	}
+
+	if err := ensureAdminUser(ctx, services); err != nil {
 		appLogger.Warn("failed to ensure admin user: %s", err.Error())
 		ctxCancel()
 
 		return err
 	}
 
-	if err := ensurePorts(ctx); err != nil {
+	if err := ensurePorts(ctx, services); err != nil {
 		appLogger.Warn("failed to ensure ports: %s", err.Error())
 		ctxCancel()
 
@@ -75,10 +95,12 @@ func New() error { //nolint:funlen
 		return err
 	}
 
+	go services.Reconcile.Start(ctx)
+
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
-	if err := api.Start(ctx, cfg, baselogger, conn); err != nil {
+	if err := api.Start(ctx, cfg, baselogger, conn, services); err != nil {
 		baselogger.Error("failed to start api", err)
 	}
 
@@ -94,7 +116,7 @@ func New() error { //nolint:funlen
 	return nil
 }
 
-func ensurePorts(ctx context.Context) error {
+func ensurePorts(ctx context.Context, services *bootstrap.Services) error {
 	l, ok := ctxkeys.GetValue(ctx, ctxkeys.LoggerKey).(log.Writer)
 	if !ok {
 		return errors.New("logger not found in context") //nolint:err113
@@ -105,12 +127,9 @@ func ensurePorts(ctx context.Context) error {
 		return errors.New("cfg not found in context") //nolint:err113
 	}
 
-	cs, err := bootstrap.NewContainerService(ctx)
-	if err != nil {
-		return err
-	}
+	cs := services.Container
 
-	pc, err := cs.GetPortCount()
+	pc, err := cs.GetPortCount(ctx)
 	if err != nil {
 		return err
 	}
@@ -118,7 +137,7 @@ func ensurePorts(ctx context.Context) error {
 	if pc == 0 {
 		l.Info("no ports found, creating new ones")
 
-		if err := cs.FillPorts(cfg.ContainerMinPort, cfg.ContainerMaxPort); err != nil {
+		if err := cs.FillPorts(ctx, cfg.ContainerMinPort, cfg.ContainerMaxPort); err != nil {
 			return err
 		}
 
@@ -128,7 +147,7 @@ func ensurePorts(ctx context.Context) error {
 	return nil
 }
 
-func ensureAdminUser(ctx context.Context) error {
+func ensureAdminUser(ctx context.Context, services *bootstrap.Services) error {
 	l, ok := ctxkeys.GetValue(ctx, ctxkeys.LoggerKey).(log.Writer)
 	if !ok {
 		return errors.New("logger not found in context") //nolint:err113
@@ -139,23 +158,19 @@ func ensureAdminUser(ctx context.Context) error {
 		return errors.New("cfg not found in context") //nolint:err113
 	}
 
-	adminUsername := "admin"
+	adminUsername := cfg.AdminUser
 
-	us, err := bootstrap.NewUserService(ctx)
-	if err != nil {
-		return err
-	}
-
-	var adminUser *model.User
+	us := services.User
 
-	adminUser, err = us.GetUnsafeByUsername(adminUsername)
+	adminUser, err := us.GetUnsafeByUsername(ctx, adminUsername)
 	if err != nil {
 		newAdminUser := &model.User{ //nolint:exhaustruct
 			Username: adminUsername,
 			Password: cfg.AdminPassword,
+			Role:     model.RoleAdmin,
 		}
 
-		adminUser, err = us.Create(newAdminUser)
+		adminUser, err = us.Create(ctx, newAdminUser)
 		if err != nil {
 			l.Warn("failed to create admin user: %s", err.Error())
 
@@ -163,47 +178,46 @@ func ensureAdminUser(ctx context.Context) error {
 		}
 	}
 
+	if adminUser.Role != model.RoleAdmin {
+		if _, err := us.SetRole(ctx, adminUser.ID, model.RoleAdmin); err != nil {
+			l.Warn("failed to set admin role: %s", err.Error())
+
+			return err
+		}
+
+		l.Info("granted admin role to %s", adminUsername)
+	}
+
 	if cfg.AdminToken != "" {
-		return ensureToken(ctx, adminUser.ID, cfg.AdminToken)
+		return ensureToken(ctx, services.Token, adminUser.ID, cfg.AdminToken)
 	}
 
 	return nil
 }
 
-func ensureToken(ctx context.Context, userID, token string) error {
+func ensureToken(ctx context.Context, ts *service.TokenService, userID, token string) error {
 	l, ok := ctxkeys.GetValue(ctx, ctxkeys.LoggerKey).(log.Writer)
 	if !ok {
 		return errors.New("logger not found in context") //nolint:err113
 	}
 	// check if admin token exists
-	ts, err := bootstrap.NewTokenService(ctx)
-	if err != nil {
-		return err
+	if _, err := ts.GetByTokenKey(ctx, token); err == nil {
+		return nil
 	}
 
-	savedToken, err := ts.GetByTokenKey(token)
-	if err == nil {
-		if savedToken.Token != token {
-			// token is different, delete the old one
-			err = ts.Delete(savedToken.Token)
-			if err != nil {
-				return err
-			}
-
-			l.Info("deleted old admin token")
-		} else {
-			return nil
-		}
+	// token is different, delete the old one
+	if err := ts.DeleteByName(ctx, userID, service.AdminTokenName); err != nil {
+		return err
 	}
 
 	// create token
-	newAdminToken := &model.Token{
+	newAdminToken := &model.Token{ //nolint:exhaustruct
 		UserID: userID,
 		Token:  token,
+		Name:   service.AdminTokenName,
 	}
 
-	_, err = ts.CreateUnsafe(newAdminToken)
-	if err != nil {
+	if _, err := ts.CreateUnsafe(ctx, newAdminToken); err != nil {
 		return err
 	}
 
@@ -0,0 +1,338 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kaibling/apiforge/ctxkeys"
+	apiservice "github.com/kaibling/apiforge/service"
+	"github.com/kaibling/cerodev/api/middleware"
+	"github.com/kaibling/cerodev/bootstrap"
+	"github.com/kaibling/cerodev/bootstrap/api"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/migration"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/repo/sqliterepo"
+)
+
+const testAdminToken = "admintoken123"
+
+// newTestServer starts the api with the demo provider on a fresh database.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("CD_PROVIDER", config.ProviderDemo)
+	t.Setenv("CD_DB_FILE_PATH", filepath.Join(dir, "cerodev.db"))
+	t.Setenv("CD_VOLUMES_PATH", filepath.Join(dir, "volumes"))
+	t.Setenv("CD_ADMIN_TOKEN", testAdminToken)
+	t.Setenv("CD_CONTAINER_PORT_RANGE", "30000-30010")
+	t.Setenv("CD_MASTER_KEY", "k3y")
+
+	cfg := config.Load()
+	l := apiservice.BuildLogger(apiservice.LogConfig{LogLevel: "error", AppName: config.AppName}) //nolint:exhaustruct
+
+	conn, err := sqliterepo.Connect(cfg.DBConfig.FilePath)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	if err := migration.Migrate(conn); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	ctx := context.WithValue(t.Context(), ctxkeys.LoggerKey, l)
+	ctx = context.WithValue(ctx, ctxkeys.DBConnKey, conn)
+	ctx = context.WithValue(ctx, ctxkeys.AppConfigKey, cfg)
+
+	services, err := bootstrap.NewServices(ctx, conn, l, cfg)
+	if err != nil {
+		t.Fatalf("NewServices: %v", err)
+	}
+
+	if err := ensureAdminUser(ctx, services); err != nil {
+		t.Fatalf("ensureAdminUser: %v", err)
+	}
+
+	if err := ensurePorts(ctx, services); err != nil {
+		t.Fatalf("ensurePorts: %v", err)
+	}
+
+	if err := ensureVolumePath(cfg, l); err != nil {
+		t.Fatalf("ensureVolumePath: %v", err)
+	}
+
+	srv := httptest.NewServer(api.Router(cfg, l, conn, services))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// call sends an authenticated request and decodes the data of the envelope
+// into out, if not nil.
+func call(t *testing.T, srv *httptest.Server, method, path string, body, out any) {
+	t.Helper()
+
+	callAs(t, srv, testAdminToken, method, path, body, out)
+}
+
+// callAs is call with the token of another user.
+func callAs(t *testing.T, srv *httptest.Server, token, method, path string, body, out any) {
+	t.Helper()
+
+	status, data := send(t, srv, token, method, path, body)
+	if status != http.StatusOK {
+		t.Fatalf("%s %s: %d %s", method, path, status, data)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+// send sends a request and returns the status and the data of the envelope.
+// Failed envelopes are reported with status 500 at the least.
+func send(t *testing.T, srv *httptest.Server, token, method, path string, body any) (int, json.RawMessage) {
+	t.Helper()
+
+	var b []byte
+
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(t.Context(), method, srv.URL+"/api/v1"+path, bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+
+	if resp.StatusCode == http.StatusOK && !envelope.Success {
+		return http.StatusInternalServerError, envelope.Data
+	}
+
+	return resp.StatusCode, envelope.Data
+}
+
+// buildImage builds a template and waits for its image.
+func buildImage(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+
+	var tmpl model.Template
+
+	call(t, srv, http.MethodPost, "/templates", map[string]string{
+		"name":       "go",
+		"repo_name":  "go",
+		"dockerfile": "FROM alpine",
+	}, &tmpl)
+	call(t, srv, http.MethodPost, "/templates/"+tmpl.ID, map[string]string{"tag": "v1"}, nil)
+
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		var images []model.Image
+
+		call(t, srv, http.MethodGet, "/images", nil, &images)
+
+		for _, img := range images {
+			if img.RepoName == "cd-go" && img.Tag == "v1" {
+				return "cd-go:v1"
+			}
+		}
+	}
+
+	t.Fatal("image was not built")
+
+	return ""
+}
+
+// containerState returns the state of a container in the list of the
+// requester, or "" if it is not listed.
+func containerState(t *testing.T, srv *httptest.Server, id string) string {
+	t.Helper()
+
+	var containers []model.Container
+
+	call(t, srv, http.MethodGet, "/containers", nil, &containers)
+
+	for _, c := range containers {
+		if c.ID == id {
+			return c.State
+		}
+	}
+
+	return ""
+}
+
+func TestContainerLifecycle(t *testing.T) {
+	srv := newTestServer(t)
+	imageName := buildImage(t, srv)
+
+	var c model.Container
+
+	call(t, srv, http.MethodPost, "/containers", map[string]any{
+		"image_name": imageName,
+		"git_repo":   "https://github.com/a/b",
+		"limits":     map[string]int64{"cpu_quota": 100000, "memory": 1 << 30},
+	}, &c)
+
+	if c.ID == "" {
+		t.Fatal("container has no id")
+	}
+
+	call(t, srv, http.MethodPost, "/containers/"+c.ID+"/start", nil, nil)
+
+	if state := containerState(t, srv, c.ID); state != "running" {
+		t.Errorf("state after start = %q", state)
+	}
+
+	call(t, srv, http.MethodPost, "/containers/"+c.ID+"/stop", nil, nil)
+
+	if state := containerState(t, srv, c.ID); state != "exited" {
+		t.Errorf("state after stop = %q", state)
+	}
+
+	call(t, srv, http.MethodDelete, "/containers/"+c.ID, nil, nil)
+
+	if state := containerState(t, srv, c.ID); state != "" {
+		t.Errorf("deleted container is listed with state %q", state)
+	}
+}
+
+// proxySession returns the proxy session cookie of a token.
+func proxySession(t *testing.T, srv *httptest.Server, token string) *http.Cookie {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, srv.URL+"/api/v1/auth/session", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	defer resp.Body.Close()
+
+	for _, c := range resp.Cookies() {
+		if c.Name == middleware.SessionCookieName {
+			return c
+		}
+	}
+
+	t.Fatalf("create session: %d without session cookie", resp.StatusCode)
+
+	return nil
+}
+
+// proxyStatus requests the code-server of a workspace like a browser does,
+// with the session cookie and without an Authorization header.
+func proxyStatus(t *testing.T, srv *httptest.Server, containerID string, session *http.Cookie) int {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, srv.URL+"/proxy/"+containerID+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if session != nil {
+		req.AddCookie(session)
+	}
+
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestProxyAuthentication(t *testing.T) {
+	srv := newTestServer(t)
+	imageName := buildImage(t, srv)
+
+	var c model.Container
+
+	call(t, srv, http.MethodPost, "/containers", map[string]any{
+		"image_name": imageName,
+		"git_repo":   "https://github.com/a/b",
+	}, &c)
+	call(t, srv, http.MethodPost, "/containers/"+c.ID+"/start", nil, nil)
+
+	if status := proxyStatus(t, srv, c.ID, proxySession(t, srv, testAdminToken)); status != http.StatusOK {
+		t.Errorf("proxy with the session of the owner = %d", status)
+	}
+
+	if status := proxyStatus(t, srv, c.ID, nil); status != http.StatusForbidden {
+		t.Errorf("proxy without session = %d", status)
+	}
+
+	call(t, srv, http.MethodPost, "/users", map[string]string{"username": "bob", "password": "bobpass123"}, nil)
+
+	var login struct {
+		Token string `json:"token"`
+	}
+
+	callAs(t, srv, "", http.MethodPost, "/auth/login", map[string]string{"username": "bob", "password": "bobpass123"}, &login)
+
+	if status := proxyStatus(t, srv, c.ID, proxySession(t, srv, login.Token)); status != http.StatusNotFound {
+		t.Errorf("proxy with the session of another user = %d", status)
+	}
+}
+
+func TestUndeleteQuota(t *testing.T) {
+	t.Setenv("CD_TRASH_PERIOD", "1h")
+
+	srv := newTestServer(t)
+	imageName := buildImage(t, srv)
+
+	call(t, srv, http.MethodPut, "/quotas/role/admin", map[string]int{"max_containers": 1}, nil)
+
+	var trashed model.Container
+
+	call(t, srv, http.MethodPost, "/containers", map[string]string{
+		"image_name": imageName,
+		"git_repo":   "https://github.com/a/b",
+	}, &trashed)
+	call(t, srv, http.MethodDelete, "/containers/"+trashed.ID, nil, nil)
+	call(t, srv, http.MethodPost, "/containers", map[string]string{
+		"image_name": imageName,
+		"git_repo":   "https://github.com/a/c",
+	}, nil)
+
+	status, data := send(t, srv, testAdminToken, http.MethodPost, "/containers/"+trashed.ID+"/undelete", nil)
+	if status != http.StatusForbidden {
+		t.Errorf("undelete beyond the quota = %d %s", status, data)
+	}
+}
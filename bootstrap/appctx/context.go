@@ -8,6 +8,12 @@ import (
 	"github.com/kaibling/apiforge/ctxkeys"
 	"github.com/kaibling/apiforge/log"
 	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/model"
+)
+
+const (
+	RoleKey   ctxkeys.String = "role"
+	ScopesKey ctxkeys.String = "scopes"
 )
 
 func GetBaseData(ctx context.Context) (*sql.DB, log.Writer, config.Configuration, error) { //nolint:ireturn
@@ -37,3 +43,24 @@ func GetToken(ctx context.Context) (string, error) {
 
 	return token, nil
 }
+
+func GetRequester(ctx context.Context) (model.Requester, error) {
+	userID, ok := ctxkeys.GetValue(ctx, ctxkeys.UserIDKey).(string)
+	if !ok {
+		return model.Requester{}, errors.New("user id not found in context") //nolint:err113
+	}
+
+	role, ok := ctxkeys.GetValue(ctx, RoleKey).(model.Role)
+	if !ok {
+		return model.Requester{}, errors.New("role not found in context") //nolint:err113
+	}
+
+	// scopes are optional, a missing value means an unrestricted token
+	scopes, _ := ctxkeys.GetValue(ctx, ScopesKey).([]model.Permission)
+
+	return model.Requester{
+		UserID: userID,
+		Role:   role,
+		Scopes: scopes,
+	}, nil
+}
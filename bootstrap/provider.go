@@ -0,0 +1,136 @@
+package bootstrap
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/cluster"
+	"github.com/kaibling/cerodev/pkg/docker"
+	"github.com/kaibling/cerodev/pkg/fake"
+	"github.com/kaibling/cerodev/pkg/kubernetes"
+	"github.com/kaibling/cerodev/pkg/podman"
+	"github.com/kaibling/cerodev/pkg/repo/dbrepo"
+	"github.com/kaibling/cerodev/service"
+)
+
+// NewProvider creates the container provider selected with CD_PROVIDER as the
+// local node. It is created once at startup, its clients are shared by all
+// requests. Registered nodes are connected with the node service.
+func NewProvider(cfg config.Configuration, db *sql.DB, l log.Writer) (*cluster.Provider, error) {
+	local, err := newLocalProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cluster.New(local, dialNode(cfg), dbrepo.NewContainerRepo(db, l)), nil
+}
+
+// dialNode creates the docker client of a registered node.
+func dialNode(cfg config.Configuration) cluster.Dialer {
+	return func(node model.Node) (cluster.Engine, error) { //nolint:ireturn
+		ip, err := bindIP(node.PublicURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve public url of node %s: %w", node.Name, err)
+		}
+
+		r, err := docker.NewRepoWithOptions(cfg.VolumesPath, docker.Options{ //nolint:exhaustruct
+			Host:       node.Host,
+			RelayImage: cfg.RelayImage,
+			BindIP:     ip,
+			CACert:     []byte(node.CACert),
+			ClientCert: []byte(node.ClientCert),
+			ClientKey:  []byte(node.ClientKey),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client for node %s: %w", node.Name, err)
+		}
+
+		return r, nil
+	}
+}
+
+// bindIP returns the address the host ports of a node are bound to, the one
+// its public url resolves to. Workspaces run code-server without
+// authentication, the url has to be an address only cerodev reaches, so that
+// the proxy stays the only way in.
+func bindIP(publicURL string) (string, error) {
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		return "", err
+	}
+
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		return ip.String(), nil
+	}
+
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	// prefer ipv4, localhost resolves to ::1 as well
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+
+	return ips[0].String(), nil
+}
+
+// localOptions returns the options of a local docker or podman engine.
+func localOptions(cfg config.Configuration) (docker.Options, error) {
+	ip, err := bindIP(cfg.PublicURL)
+	if err != nil {
+		return docker.Options{}, fmt.Errorf("failed to resolve CD_PUBLIC_URL: %w", err) //nolint:exhaustruct
+	}
+
+	return docker.Options{RelayImage: cfg.RelayImage, BindIP: ip}, nil //nolint:exhaustruct
+}
+
+func newLocalProvider(cfg config.Configuration) (service.Provider, error) { //nolint:ireturn
+	switch cfg.Provider {
+	case config.ProviderDocker:
+		opts, err := localOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := docker.NewRepoWithOptions(cfg.VolumesPath, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create docker client: %w", err)
+		}
+
+		return r, nil
+	case config.ProviderPodman:
+		opts, err := localOptions(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := podman.NewRepo(cfg.VolumesPath, cfg.PodmanSocket, cfg.PodmanUsernsMode, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create podman client: %w", err)
+		}
+
+		return r, nil
+	case config.ProviderKubernetes:
+		r, err := kubernetes.NewRepo(cfg.VolumesPath, kubernetes.Options(cfg.Kubernetes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+		}
+
+		return r, nil
+	case config.ProviderDemo:
+		// the simulated workspaces live as long as the application
+		return fake.NewRepo(fake.NewDaemon()), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown provider %q", errs.ErrInvalidInput, cfg.Provider)
+	}
+}
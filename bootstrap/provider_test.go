@@ -0,0 +1,30 @@
+package bootstrap
+
+import "testing"
+
+func TestBindIP(t *testing.T) {
+	tests := []struct {
+		publicURL string
+		want      string
+		wantErr   bool
+	}{
+		{publicURL: "http://localhost", want: "127.0.0.1"},
+		{publicURL: "http://10.0.0.2", want: "10.0.0.2"},
+		{publicURL: "https://10.0.0.2:8443/", want: "10.0.0.2"},
+		{publicURL: "http://[::1]", want: "::1"},
+		{publicURL: "http://no-such-host.invalid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.publicURL, func(t *testing.T) {
+			got, err := bindIP(tt.publicURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bindIP error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("bindIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
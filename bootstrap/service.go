@@ -2,81 +2,214 @@ package bootstrap
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 
 	"github.com/kaibling/apiforge/ctxkeys"
-	"github.com/kaibling/cerodev/bootstrap/appctx"
-	"github.com/kaibling/cerodev/pkg/docker"
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
 	"github.com/kaibling/cerodev/pkg/repo/dbrepo"
 	"github.com/kaibling/cerodev/pkg/ws"
 	"github.com/kaibling/cerodev/service"
 )
 
 const (
-	UserServiceName      string = "user_service"
-	TokenServiceName     string = "token_service"
-	ContainerServiceName string = "container_service"
-	TemplateServiceName  string = "template_service"
+	UserServiceName       string = "user_service"
+	TokenServiceName      string = "token_service"
+	ContainerServiceName  string = "container_service"
+	TemplateServiceName   string = "template_service"
+	BuildServiceName      string = "build_service"
+	ReconcileServiceName  string = "reconcile_service"
+	IdleServiceName       string = "idle_service"
+	QuotaServiceName      string = "quota_service"
+	StatsServiceName      string = "stats_service"
+	CredentialServiceName string = "credential_service"
+	SecretServiceName     string = "secret_service"
+	NodeServiceName       string = "node_service"
 )
 
-func NewUserService(ctx context.Context) (*service.UserService, error) {
-	db, l, cfg, err := appctx.GetBaseData(ctx)
+// ServicesKey stores the services in the request context.
+const ServicesKey ctxkeys.String = "services"
+
+var errServicesNotFound = errors.New("services not found in context")
+
+// Services are created once at startup and shared by all requests and
+// background jobs.
+type Services struct {
+	User       *service.UserService
+	Token      *service.TokenService
+	Container  *service.ContainerService
+	Template   *service.TemplateService
+	Build      *service.BuildService
+	Reconcile  *service.ReconcileService
+	Idle       *service.IdleService
+	Quota      *service.QuotaService
+	Stats      *service.StatsService
+	Credential *service.CredentialService
+	Secret     *service.SecretService
+	Node       *service.NodeService
+	Backup     *service.BackupService
+	Janitor    *service.JanitorService
+	WebSocket  *service.WebSocketService
+}
+
+// NewServices creates the provider, the repos and the services. ctx must
+// live as long as the application, builds run in it.
+func NewServices(ctx context.Context, db *sql.DB, l log.Writer, cfg config.Configuration) (*Services, error) {
+	dr, err := NewProvider(cfg, db, l)
 	if err != nil {
 		return nil, err
 	}
 
-	ur := dbrepo.NewUserRepo(ctx, db, l)
-	tr := dbrepo.NewTokenRepo(ctx, db, l)
-	ts := service.NewTokenService(tr, cfg)
+	cr := dbrepo.NewContainerRepo(db, l)
+	tr := dbrepo.NewTemplateRepo(db, l)
+	ur := dbrepo.NewUserRepo(db, l)
+	wss := service.NewWebSocketService(ws.New())
+
+	s := &Services{ //nolint:exhaustruct
+		Token:      service.NewTokenService(dbrepo.NewTokenRepo(db, l), cfg),
+		Template:   service.NewTemplateService(tr, cfg),
+		Quota:      service.NewQuotaService(dbrepo.NewQuotaRepo(db, l), cr, dr, ur, cfg),
+		Credential: service.NewCredentialService(dbrepo.NewCredentialRepo(db, l), cfg),
+		Secret:     service.NewSecretService(dbrepo.NewSecretRepo(db, l), tr, cfg),
+		Node:       service.NewNodeService(dbrepo.NewNodeRepo(db, l), cr, dr, l, cfg),
+		Build:      service.NewBuildService(ctx, dbrepo.NewBuildRepo(db, l), tr, dr, wss, l, cfg),
+		Idle:       service.NewIdleService(cr, dr, ur, tr, wss, l, cfg),
+		Stats:      service.NewStatsService(cr, dr, wss, l, cfg),
+		Backup:     service.NewBackupService(cr, l, cfg),
+		WebSocket:  wss,
+	}
+
+	s.User = service.NewUserService(ur, s.Token, cfg)
+	s.Container = service.NewContainerService(cr, dr, tr, s.Quota, s.Credential, s.Secret, s.Node, l, cfg)
+	s.Reconcile = service.NewReconcileService(cr, dr, ur, s.Secret, l, cfg)
+	s.Janitor = service.NewJanitorService(cr, s.Container, l, cfg)
+
+	return s, nil
+}
+
+func getServices(ctx context.Context) (*Services, error) {
+	s, ok := ctxkeys.GetValue(ctx, ServicesKey).(*Services)
+	if !ok {
+		return nil, errServicesNotFound
+	}
 
-	return service.NewUserService(ur, ts, cfg), nil
+	return s, nil
 }
 
-func NewContainerService(ctx context.Context) (*service.ContainerService, error) {
-	db, l, cfg, err := appctx.GetBaseData(ctx)
+func GetUserService(ctx context.Context) (*service.UserService, error) {
+	s, err := getServices(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	dr := docker.NewRepo(ctx, cfg.VolumesPath)
-	cr := dbrepo.NewContainerRepo(ctx, db, l)
-	tr := dbrepo.NewTemplateRepo(ctx, db, l)
+	return s.User, nil
+}
+
+func GetTokenService(ctx context.Context) (*service.TokenService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return service.NewContainerService(cr, dr, tr, l, cfg), nil
+	return s.Token, nil
 }
 
-func NewTemplateService(ctx context.Context) (*service.TemplateService, error) {
-	db, l, _, err := appctx.GetBaseData(ctx)
+func GetContainerService(ctx context.Context) (*service.ContainerService, error) {
+	s, err := getServices(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	ur := dbrepo.NewTemplateRepo(ctx, db, l)
+	return s.Container, nil
+}
+
+func GetTemplateService(ctx context.Context) (*service.TemplateService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return service.NewTemplateService(ur), nil
+	return s.Template, nil
 }
 
-func NewTokenService(ctx context.Context) (*service.TokenService, error) {
-	db, l, cfg, err := appctx.GetBaseData(ctx)
+func GetBuildService(ctx context.Context) (*service.BuildService, error) {
+	s, err := getServices(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	tr := dbrepo.NewTokenRepo(ctx, db, l)
+	return s.Build, nil
+}
+
+func GetReconcileService(ctx context.Context) (*service.ReconcileService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return service.NewTokenService(tr, cfg), nil
+	return s.Reconcile, nil
 }
 
-func GetWebSocketService(ctx context.Context) (*service.WebSocketService, error) {
-	ws, ok := ctxkeys.GetValue(ctx, "websocket").(*service.WebSocketService)
-	if !ok {
-		return nil, errors.New("websocker service not found in context") //nolint:err113
+func GetIdleService(ctx context.Context) (*service.IdleService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
 	}
-	return ws, nil
+
+	return s.Idle, nil
 }
 
-func NewWebSocketService() (*service.WebSocketService, error) {
-	wsr := ws.New()
+func GetQuotaService(ctx context.Context) (*service.QuotaService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Quota, nil
+}
+
+func GetStatsService(ctx context.Context) (*service.StatsService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Stats, nil
+}
+
+func GetCredentialService(ctx context.Context) (*service.CredentialService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Credential, nil
+}
+
+func GetSecretService(ctx context.Context) (*service.SecretService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Secret, nil
+}
+
+func GetNodeService(ctx context.Context) (*service.NodeService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Node, nil
+}
+
+func GetWebSocketService(ctx context.Context) (*service.WebSocketService, error) {
+	s, err := getServices(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return service.NewWebSocketService(wsr), nil
+	return s.WebSocket, nil
 }
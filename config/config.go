@@ -5,7 +5,9 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/docker/go-units"
 	"github.com/joho/godotenv"
 )
 
@@ -14,8 +16,29 @@ const (
 	AppName                   = "cerodev"
 	defaultPasswordCost       = 11
 	defaultTokenLength        = 32
+	defaultTokenExpiry        = 7 * 24 * time.Hour
+	defaultSessionExpiry      = 12 * time.Hour
 	defaultContainerPortRange = "30000-40000"
 	defaultVolumesPath        = "/var/lib/cerodev/volumes"
+	defaultBuildConcurrency   = 1
+	defaultReconcileInterval  = time.Minute
+	defaultIdleWarning        = 5 * time.Minute
+	defaultStatsInterval      = 10 * time.Second
+	defaultBackupInterval     = 24 * time.Hour
+	defaultBackupRetention    = 7
+	defaultMaxRestoreSize     = 10 << 30
+	defaultProvider           = ProviderDocker
+	// cpuPeriod is the cfs period in microseconds a cpu quota refers to.
+	cpuPeriod = 100000
+)
+
+// container providers selectable with CD_PROVIDER
+const (
+	ProviderDocker     = "docker"
+	ProviderPodman     = "podman"
+	ProviderKubernetes = "kubernetes"
+	// ProviderDemo simulates workspaces in memory, nothing is run.
+	ProviderDemo = "demo"
 )
 
 var (
@@ -34,17 +57,81 @@ type Configuration struct {
 	AdminPassword     string
 	AdminToken        string
 	TokenLength       int
+	TokenExpiry       time.Duration
+	SessionExpiry     time.Duration // lifetime of the session cookie of the workspace proxy
 	PasswordCost      int
 	ContainerMinPort  int
 	ContainerMaxPort  int
 	DBConfig          DBConfiguration
 	VolumesPath       string
+	BuildConcurrency  int
 	PublicURL         string
+	// ProxyBaseDomain enables host based routing to workspaces via
+	// {container-id}.{base-domain} and {port}-{container-id}.{base-domain}.
+	// Path based routing under /proxy is always available.
+	ProxyBaseDomain string
+	// ReconcileInterval is the pause between reconciler runs, 0 disables them.
+	// Recreating missing and adopting orphaned containers is opt-in.
+	ReconcileInterval time.Duration
+	ReconcileRecreate bool
+	ReconcileAdopt    bool
+	// IdleTimeout stops running workspaces without activity, 0 disables it.
+	// Users and templates can override it. The owner is warned IdleWarning
+	// before the workspace is stopped.
+	IdleTimeout time.Duration
+	IdleWarning time.Duration
+	// Maximum resource limits of a workspace, 0 means no maximum. Workspaces
+	// without a limit get the maximum.
+	MaxCPUQuota   int64
+	MaxMemory     int64
+	MaxMemorySwap int64
+	MaxPids       int64
+	// StatsInterval is the pause between two stats pushes to subscribed
+	// websocket clients, 0 disables them.
+	StatsInterval time.Duration
+	// BackupPath stores scheduled volume backups every BackupInterval and a
+	// last backup of deleted workspaces. Empty disables both. BackupRetention
+	// backups are kept per workspace, 0 keeps all. MaxRestoreSize limits
+	// uploaded archives and the unpacked size of restores, 0 does not limit.
+	BackupPath      string
+	BackupInterval  time.Duration
+	BackupRetention int
+	MaxRestoreSize  int64
+	// TrashPeriod keeps deleted workspaces stopped in the trash before they
+	// are purged, 0 deletes them right away.
+	TrashPeriod time.Duration
+	// MasterKey encrypts stored git credentials and secrets. They cannot be
+	// stored without it and become unreadable if it changes.
+	MasterKey string
+	// Provider selects the engine that runs workspaces, see ProviderDocker,
+	// ProviderPodman, ProviderKubernetes and ProviderDemo. PodmanSocket and PodmanUsernsMode default to the
+	// socket and the keep-id mapping of the user running cerodev.
+	Provider         string
+	PodmanSocket     string
+	PodmanUsernsMode string
+	// RelayImage forwards published ports of docker, podman and node workspaces.
+	RelayImage string
+	Kubernetes KubernetesConfiguration
 }
 type DBConfiguration struct {
 	FilePath string
 }
 
+// KubernetesConfiguration configures the kubernetes provider. Empty values
+// use the service account of the pod cerodev runs in.
+type KubernetesConfiguration struct {
+	APIURL           string
+	TokenFile        string
+	CAFile           string
+	Namespace        string
+	StorageClass     string
+	VolumeSize       string
+	Registry         string
+	RegistrySecret   string
+	RegistryInsecure bool
+	BuilderImage     string
+}
+
 func Load() Configuration {
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
@@ -66,14 +153,50 @@ func Load() Configuration {
 		AdminPassword:     getEnv("ADMIN_PASSWORD", "abc123"),
 		AdminToken:        getEnv("ADMIN_TOKEN", ""),
 		TokenLength:       getEnvAsInt("TOKEN_LENGTH", defaultTokenLength),
+		TokenExpiry:       getEnvAsDuration("TOKEN_EXPIRY", defaultTokenExpiry),
+		SessionExpiry:     getEnvAsDuration("PROXY_SESSION_EXPIRY", defaultSessionExpiry),
 		PasswordCost:      defaultPasswordCost,
 		ContainerMinPort:  minPort,
 		ContainerMaxPort:  maxPort,
 		VolumesPath:       getEnv("VOLUMES_PATH", defaultVolumesPath),
+		BuildConcurrency:  getEnvAsInt("BUILD_CONCURRENCY", defaultBuildConcurrency),
 		DBConfig: DBConfiguration{
 			FilePath: getEnv("DB_FILE_PATH", "cerodev.db"),
 		},
-		PublicURL: getEnv("PUBLIC_URL", "http://localhost"),
+		PublicURL:         getEnv("PUBLIC_URL", "http://localhost"),
+		ProxyBaseDomain:   strings.ToLower(strings.Trim(getEnv("PROXY_BASE_DOMAIN", ""), ".")),
+		ReconcileInterval: getEnvAsDuration("RECONCILE_INTERVAL", defaultReconcileInterval),
+		ReconcileRecreate: toBool(getEnv("RECONCILE_RECREATE", "false")),
+		ReconcileAdopt:    toBool(getEnv("RECONCILE_ADOPT", "false")),
+		IdleTimeout:       getEnvAsDuration("IDLE_TIMEOUT", 0),
+		IdleWarning:       getEnvAsDuration("IDLE_WARNING", defaultIdleWarning),
+		MaxCPUQuota:       int64(getEnvAsFloat("MAX_CPUS", 0) * cpuPeriod),
+		MaxMemory:         getEnvAsBytes("MAX_MEMORY", 0),
+		MaxMemorySwap:     getEnvAsBytes("MAX_MEMORY_SWAP", 0),
+		MaxPids:           int64(getEnvAsInt("MAX_PIDS", 0)),
+		StatsInterval:     getEnvAsDuration("STATS_INTERVAL", defaultStatsInterval),
+		BackupPath:        getEnv("BACKUP_PATH", ""),
+		BackupInterval:    getEnvAsDuration("BACKUP_INTERVAL", defaultBackupInterval),
+		BackupRetention:   getEnvAsInt("BACKUP_RETENTION", defaultBackupRetention),
+		MaxRestoreSize:    getEnvAsBytes("MAX_RESTORE_SIZE", defaultMaxRestoreSize),
+		TrashPeriod:       getEnvAsDuration("TRASH_PERIOD", 0),
+		MasterKey:         getEnv("MASTER_KEY", ""),
+		Provider:          strings.ToLower(getEnv("PROVIDER", defaultProvider)),
+		PodmanSocket:      getEnv("PODMAN_SOCKET", ""),
+		PodmanUsernsMode:  getEnv("PODMAN_USERNS", ""),
+		RelayImage:        getEnv("PORT_RELAY_IMAGE", ""),
+		Kubernetes: KubernetesConfiguration{
+			APIURL:           getEnv("KUBE_API_URL", ""),
+			TokenFile:        getEnv("KUBE_TOKEN_FILE", ""),
+			CAFile:           getEnv("KUBE_CA_FILE", ""),
+			Namespace:        getEnv("KUBE_NAMESPACE", ""),
+			StorageClass:     getEnv("KUBE_STORAGE_CLASS", ""),
+			VolumeSize:       getEnv("KUBE_VOLUME_SIZE", ""),
+			Registry:         strings.TrimSuffix(getEnv("KUBE_REGISTRY", ""), "/"),
+			RegistrySecret:   getEnv("KUBE_REGISTRY_SECRET", ""),
+			RegistryInsecure: toBool(getEnv("KUBE_REGISTRY_INSECURE", "false")),
+			BuilderImage:     getEnv("KUBE_BUILDER_IMAGE", ""),
+		},
 	}
 }
 
@@ -106,6 +229,55 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return intVal
 }
 
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	fullKey := osPrefix + "_" + key
+
+	val := os.Getenv(fullKey)
+	if val == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(val)
+	if err != nil {
+		return defaultValue
+	}
+
+	return duration
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	fullKey := osPrefix + "_" + key
+
+	val := os.Getenv(fullKey)
+	if val == "" {
+		return defaultValue
+	}
+
+	floatVal, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return defaultValue
+	}
+
+	return floatVal
+}
+
+// getEnvAsBytes reads sizes like "512m" or "4g".
+func getEnvAsBytes(key string, defaultValue int64) int64 {
+	fullKey := osPrefix + "_" + key
+
+	val := os.Getenv(fullKey)
+	if val == "" {
+		return defaultValue
+	}
+
+	bytes, err := units.RAMInBytes(val)
+	if err != nil {
+		return defaultValue
+	}
+
+	return bytes
+}
+
 func toBool(s string) bool {
 	return strings.ToLower(s) == "true"
 }
@@ -17,6 +17,11 @@ func ErrMsg(msg string, err error) string {
 var (
 	ErrWrongCredentials = errors.New(msg.WrongCredentials)
 	ErrInvalidToken     = errors.New(msg.InvalidToken)
+	ErrInvalidRole      = errors.New(msg.InvalidRole)
+	ErrInvalidInput     = errors.New(msg.InvalidInput)
+	ErrQuotaExceeded    = errors.New(msg.QuotaExceeded)
+	ErrNoCapacity       = errors.New(msg.NoCapacity)
+	ErrTooLarge         = errors.New(msg.TooLarge)
 
 	ErrContainerNotInProvider = errors.New(msg.ContainerNotInProvider)
 
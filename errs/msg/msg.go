@@ -5,6 +5,11 @@ const (
 	RequestParse     = "failed to parse request"
 	WrongCredentials = "user/password missmatch"
 	InvalidToken     = "token invalid"
+	InvalidRole      = "role invalid"
+	InvalidInput     = "input invalid"
+	QuotaExceeded    = "quota exceeded"
+	NoCapacity       = "no node has capacity left"
+	TooLarge         = "content too large"
 
 	ContainerNotInProvider = "container in provider not found"
 
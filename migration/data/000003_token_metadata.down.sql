@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS tokens;
+
+CREATE TABLE
+    IF NOT EXISTS tokens (
+        token TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- Tokens are stored as sha256 hashes from now on. Plaintext tokens cannot be
+-- converted, so existing sessions are dropped and users have to log in again.
+DROP TABLE IF EXISTS tokens;
+
+CREATE TABLE
+    IF NOT EXISTS tokens (
+        id TEXT PRIMARY KEY,
+        token_hash TEXT NOT NULL UNIQUE,
+        user_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        kind TEXT NOT NULL DEFAULT 'api',
+        scopes TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        expires_at DATETIME,
+        last_used_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
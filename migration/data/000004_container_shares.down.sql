@@ -0,0 +1 @@
+DROP TABLE IF EXISTS container_shares;
\ No newline at end of file
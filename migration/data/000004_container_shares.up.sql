@@ -0,0 +1,9 @@
+CREATE TABLE
+    IF NOT EXISTS container_shares (
+        container_id TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        PRIMARY KEY (container_id, user_id),
+        FOREIGN KEY (container_id) REFERENCES containers (id) ON DELETE CASCADE,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
\ No newline at end of file
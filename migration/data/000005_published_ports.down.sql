@@ -0,0 +1 @@
+DROP TABLE IF EXISTS published_ports;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE
+    IF NOT EXISTS published_ports (
+        container_id TEXT NOT NULL,
+        port INTEGER NOT NULL,
+        created_at DATETIME NOT NULL,
+        host_port INTEGER NOT NULL,
+        PRIMARY KEY (container_id, port),
+        FOREIGN KEY (container_id) REFERENCES containers (id) ON DELETE CASCADE
+    );
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS build_jobs;
\ No newline at end of file
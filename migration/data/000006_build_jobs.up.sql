@@ -0,0 +1,14 @@
+CREATE TABLE
+    IF NOT EXISTS build_jobs (
+        id TEXT PRIMARY KEY,
+        template_id TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        tag TEXT NOT NULL,
+        status TEXT NOT NULL,
+        logs TEXT NOT NULL DEFAULT '',
+        error TEXT NOT NULL DEFAULT '',
+        created_at DATETIME NOT NULL,
+        started_at DATETIME,
+        finished_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
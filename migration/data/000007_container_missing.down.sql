@@ -0,0 +1,2 @@
+ALTER TABLE containers
+DROP COLUMN missing_since;
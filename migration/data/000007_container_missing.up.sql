@@ -0,0 +1,2 @@
+ALTER TABLE containers
+ADD COLUMN missing_since DATETIME;
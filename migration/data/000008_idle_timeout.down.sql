@@ -0,0 +1,8 @@
+ALTER TABLE containers
+DROP COLUMN last_activity_at;
+
+ALTER TABLE templates
+DROP COLUMN idle_timeout;
+
+ALTER TABLE users
+DROP COLUMN idle_timeout;
@@ -0,0 +1,8 @@
+ALTER TABLE users
+ADD COLUMN idle_timeout INTEGER;
+
+ALTER TABLE templates
+ADD COLUMN idle_timeout INTEGER;
+
+ALTER TABLE containers
+ADD COLUMN last_activity_at DATETIME;
@@ -0,0 +1,23 @@
+ALTER TABLE containers
+DROP COLUMN pids_limit;
+
+ALTER TABLE containers
+DROP COLUMN memory_swap;
+
+ALTER TABLE containers
+DROP COLUMN memory;
+
+ALTER TABLE containers
+DROP COLUMN cpu_quota;
+
+ALTER TABLE templates
+DROP COLUMN pids_limit;
+
+ALTER TABLE templates
+DROP COLUMN memory_swap;
+
+ALTER TABLE templates
+DROP COLUMN memory;
+
+ALTER TABLE templates
+DROP COLUMN cpu_quota;
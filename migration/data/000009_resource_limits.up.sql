@@ -0,0 +1,23 @@
+ALTER TABLE templates
+ADD COLUMN cpu_quota INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE templates
+ADD COLUMN memory INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE templates
+ADD COLUMN memory_swap INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE templates
+ADD COLUMN pids_limit INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE containers
+ADD COLUMN cpu_quota INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE containers
+ADD COLUMN memory INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE containers
+ADD COLUMN memory_swap INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE containers
+ADD COLUMN pids_limit INTEGER NOT NULL DEFAULT 0;
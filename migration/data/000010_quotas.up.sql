@@ -0,0 +1,11 @@
+CREATE TABLE
+    IF NOT EXISTS quotas (
+        kind TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        max_containers INTEGER NOT NULL DEFAULT 0,
+        max_running INTEGER NOT NULL DEFAULT 0,
+        max_memory INTEGER NOT NULL DEFAULT 0,
+        max_cpu_quota INTEGER NOT NULL DEFAULT 0,
+        max_volume_size INTEGER NOT NULL DEFAULT 0,
+        PRIMARY KEY (kind, subject)
+    );
@@ -0,0 +1,2 @@
+ALTER TABLE containers
+DROP COLUMN deleted_at;
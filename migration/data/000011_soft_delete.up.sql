@@ -0,0 +1,2 @@
+ALTER TABLE containers
+ADD COLUMN deleted_at DATETIME;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS git_credentials;
+
+ALTER TABLE containers
+DROP COLUMN git_depth;
+
+ALTER TABLE containers
+DROP COLUMN git_ref;
@@ -0,0 +1,18 @@
+ALTER TABLE containers
+ADD COLUMN git_ref TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE containers
+ADD COLUMN git_depth INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE
+    IF NOT EXISTS git_credentials (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        kind TEXT NOT NULL,
+        host TEXT NOT NULL,
+        username TEXT NOT NULL DEFAULT '',
+        secret TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        UNIQUE (user_id, kind, host),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
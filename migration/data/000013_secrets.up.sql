@@ -0,0 +1,10 @@
+CREATE TABLE
+    IF NOT EXISTS secrets (
+        scope TEXT NOT NULL,
+        owner_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        value TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        updated_at DATETIME NOT NULL,
+        PRIMARY KEY (scope, owner_id, name)
+    );
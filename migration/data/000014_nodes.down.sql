@@ -0,0 +1,25 @@
+CREATE TABLE
+    IF NOT EXISTS ports (
+        port INTEGER PRIMARY KEY,
+        in_use BOOLEAN NOT NULL,
+        container_id TEXT,
+        FOREIGN KEY (container_id) REFERENCES containers (id)
+    );
+
+INSERT INTO
+    ports (port, in_use, container_id)
+SELECT
+    port,
+    in_use,
+    container_id
+FROM
+    node_ports
+WHERE
+    node_id = 'local';
+
+DROP TABLE IF EXISTS node_ports;
+
+ALTER TABLE containers
+DROP COLUMN node_id;
+
+DROP TABLE IF EXISTS nodes;
@@ -0,0 +1,40 @@
+CREATE TABLE
+    IF NOT EXISTS nodes (
+        id TEXT PRIMARY KEY,
+        name TEXT NOT NULL UNIQUE,
+        host TEXT NOT NULL,
+        public_url TEXT NOT NULL,
+        ca_cert TEXT NOT NULL DEFAULT '',
+        client_cert TEXT NOT NULL DEFAULT '',
+        client_key TEXT NOT NULL DEFAULT '',
+        min_port INTEGER NOT NULL,
+        max_port INTEGER NOT NULL,
+        cordoned BOOLEAN NOT NULL DEFAULT 0,
+        created_at DATETIME NOT NULL
+    );
+
+ALTER TABLE containers
+ADD COLUMN node_id TEXT NOT NULL DEFAULT 'local';
+
+CREATE TABLE
+    IF NOT EXISTS node_ports (
+        node_id TEXT NOT NULL,
+        port INTEGER NOT NULL,
+        in_use BOOLEAN NOT NULL,
+        container_id TEXT,
+        reserved_at DATETIME,
+        PRIMARY KEY (node_id, port),
+        FOREIGN KEY (container_id) REFERENCES containers (id)
+    );
+
+INSERT INTO
+    node_ports (node_id, port, in_use, container_id)
+SELECT
+    'local',
+    port,
+    in_use,
+    container_id
+FROM
+    ports;
+
+DROP TABLE ports;
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Backup is a stored archive of a workspace volume.
+type Backup struct {
+	ContainerID string    `json:"container_id"`
+	Name        string    `json:"name"` // "20250101T030000Z.tar.gz"
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RestoreRequest selects a stored backup to restore. The source defaults to
+// the restored workspace and may be a deleted workspace of the same owner.
+type RestoreRequest struct {
+	SourceContainerID string `json:"source_container_id"`
+	Backup            string `json:"backup"`
+}
+
+// ContainerRequest creates a workspace. With Restore the volume of the new
+// workspace is filled with a stored backup, the source is required then.
+type ContainerRequest struct {
+	Container
+
+	Restore *RestoreRequest `json:"restore"`
+}
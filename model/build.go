@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+type BuildStatus string
+
+const (
+	BuildQueued    BuildStatus = "queued"
+	BuildRunning   BuildStatus = "running"
+	BuildSucceeded BuildStatus = "succeeded"
+	BuildFailed    BuildStatus = "failed"
+	BuildCancelled BuildStatus = "cancelled"
+)
+
+// Finished reports whether a build with this status will not change anymore.
+func (s BuildStatus) Finished() bool {
+	return s == BuildSucceeded || s == BuildFailed || s == BuildCancelled
+}
+
+// BuildJob is an image build of a template running in the background.
+type BuildJob struct {
+	ID         string      `json:"id"`
+	TemplateID string      `json:"template_id"`
+	UserID     string      `json:"user_id"`
+	Tag        string      `json:"tag"`
+	Status     BuildStatus `json:"status"`
+	Logs       string      `json:"logs,omitempty"` // only returned for a single job
+	Error      string      `json:"error"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at"`
+}
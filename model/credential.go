@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+type GitCredentialKind string
+
+const (
+	GitCredentialHTTPS GitCredentialKind = "https" // token used as password for the host
+	GitCredentialSSH   GitCredentialKind = "ssh"   // private key for the host
+)
+
+func (k GitCredentialKind) Valid() bool {
+	return k == GitCredentialHTTPS || k == GitCredentialSSH
+}
+
+// GitCredential grants access to private repositories on a host. The secret
+// is stored encrypted and never returned.
+type GitCredential struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id"`
+	Kind      GitCredentialKind `json:"kind"`
+	Host      string            `json:"host"`     // "github.com"
+	Username  string            `json:"username"` // https only, defaults to "git"
+	Secret    string            `json:"secret,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
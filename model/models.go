@@ -1,17 +1,164 @@
 package model
 
+import (
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
 type Container struct {
-	ID            string   `json:"id"`
-	DockerID      string   `json:"docker_id"`
-	ImageName     string   `json:"image_name"`
-	Status        string   `json:"status"` // "running"
-	State         string   `json:"state"`  // "Up 4 hours"
-	ContainerName string   `json:"container_name"`
-	GitRepo       string   `json:"git_repo"`
-	UserID        string   `json:"user_id"`
-	EnvVars       []string `json:"env_vars"` // ["ENV=prod"]
-	Ports         []string `json:"ports"`    // ["8080:8098/tcp"]
-	UIPort        string   `json:"ui_port"`  // "32102"
+	ID             string         `json:"id"`
+	DockerID       string         `json:"docker_id"`
+	ImageName      string         `json:"image_name"`
+	Status         string         `json:"status"` // "running"
+	State          string         `json:"state"`  // "Up 4 hours"
+	ContainerName  string         `json:"container_name"`
+	GitRepo        string         `json:"git_repo"`
+	GitRef         string         `json:"git_ref"`   // branch or tag to check out, empty uses the default branch
+	GitDepth       int            `json:"git_depth"` // shallow clone depth, 0 clones the full history
+	UserID         string         `json:"user_id"`
+	EnvVars        []string       `json:"env_vars"`         // ["ENV=prod"]
+	Ports          []string       `json:"ports"`            // ["8080:8098/tcp"]
+	UIPort         string         `json:"ui_port"`          // "32102"
+	MissingSince   *time.Time     `json:"missing_since"`    // set by the reconciler when the provider lost the container
+	LastActivityAt *time.Time     `json:"last_activity_at"` // last proxy request, exec session or websocket presence
+	DeletedAt      *time.Time     `json:"deleted_at"`       // set while the container is in the trash
+	Limits         ResourceLimits `json:"limits"`
+	NodeID         string         `json:"node_id"` // node the workspace runs on, see LocalNodeID
+}
+
+// ResourceLimits restricts the resources of a workspace. 0 means unlimited.
+type ResourceLimits struct {
+	CPUQuota   int64 `json:"cpu_quota"`   // microseconds per 100ms period, 100000 is one cpu
+	Memory     int64 `json:"memory"`      // bytes
+	MemorySwap int64 `json:"memory_swap"` // bytes of memory plus swap, -1 allows unlimited swap
+	PidsLimit  int64 `json:"pids_limit"`
+}
+
+// WithDefaults fills unset limits from defaults.
+func (l ResourceLimits) WithDefaults(defaults ResourceLimits) ResourceLimits {
+	if l.CPUQuota == 0 {
+		l.CPUQuota = defaults.CPUQuota
+	}
+
+	if l.Memory == 0 {
+		l.Memory = defaults.Memory
+	}
+
+	if l.MemorySwap == 0 {
+		l.MemorySwap = defaults.MemorySwap
+	}
+
+	if l.PidsLimit == 0 {
+		l.PidsLimit = defaults.PidsLimit
+	}
+
+	return l
+}
+
+// HostPort returns the host port a container port is published on.
+func (c Container) HostPort(containerPort string) (string, bool) {
+	for _, mapping := range c.Ports {
+		hostPort, target, found := strings.Cut(mapping, ":")
+		if !found {
+			continue
+		}
+
+		target, _, _ = strings.Cut(target, "/")
+		if target == containerPort {
+			return hostPort, true
+		}
+	}
+
+	return "", false
+}
+
+// ContainerShare grants a user access to the workspace of another user through the proxy.
+type ContainerShare struct {
+	ContainerID string    `json:"container_id"`
+	UserID      string    `json:"user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ShareRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// PublishedPort is a port of a running workspace that is reachable through the proxy.
+// HostPort is taken from the port pool of the node of the workspace.
+type PublishedPort struct {
+	ContainerID string    `json:"container_id"`
+	Port        int       `json:"port"`
+	HostPort    int       `json:"host_port"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type PortRequest struct {
+	Port int `json:"port"`
+}
+
+type ExecRequest struct {
+	Cmd []string `json:"cmd"` // defaults to a bash shell
+}
+
+// ExecSession is a TTY exec created in a workspace. It is attached once via websocket.
+type ExecSession struct {
+	ID          string   `json:"id"`
+	ContainerID string   `json:"container_id"`
+	DockerID    string   `json:"-"`
+	Cmd         []string `json:"cmd"`
+	Started     bool     `json:"started"`
+}
+
+// ExecStream is the terminal of an attached exec session.
+type ExecStream interface {
+	io.ReadWriteCloser
+	Resize(height, width uint) error
+}
+
+// ExecMessage is a text frame sent by the client of an exec session. Binary
+// frames are passed to the terminal unchanged.
+type ExecMessage struct {
+	Type string `json:"type"` // "input" or "resize"
+	Data string `json:"data"`
+	Rows uint   `json:"rows"`
+	Cols uint   `json:"cols"`
+}
+
+// LogOptions selects the container output to read.
+type LogOptions struct {
+	Tail       string `json:"tail"`  // number of lines or "all"
+	Since      string `json:"since"` // timestamp or relative duration like "10m"
+	Follow     bool   `json:"follow"`
+	Timestamps bool   `json:"timestamps"`
+}
+
+// Requester identifies the user on whose behalf a service call is executed.
+// Admin requesters are not restricted to their own resources.
+type Requester struct {
+	UserID string       `json:"user_id"`
+	Role   Role         `json:"role"`
+	Scopes []Permission `json:"scopes"` // scopes of the token used, empty means unrestricted
+}
+
+// IsAdmin reports whether the requester may act on resources of other users.
+// Scoped tokens never do, even if they belong to an admin.
+func (r Requester) IsAdmin() bool {
+	return r.Role == RoleAdmin && len(r.Scopes) == 0
+}
+
+// Can reports whether both the role and the token scopes grant the permission.
+func (r Requester) Can(p Permission) bool {
+	if !r.Role.Can(p) {
+		return false
+	}
+
+	if len(r.Scopes) == 0 {
+		return true
+	}
+
+	return slices.Contains(r.Scopes, p)
 }
 
 type ContainerStatus struct {
@@ -21,28 +168,91 @@ type ContainerStatus struct {
 }
 
 type User struct {
-	ID       string   `json:"id"`
-	Username string   `json:"username"`
-	Password string   `json:"password,omitempty"`
-	Tokens   []string `json:"tokens"`
+	ID          string   `json:"id"`
+	Username    string   `json:"username"`
+	Password    string   `json:"password,omitempty"`
+	Role        Role     `json:"role"`
+	Tokens      []string `json:"tokens"`       // token ids
+	IdleTimeout *int     `json:"idle_timeout"` // seconds, overrides the template. nil inherits, 0 never stops
+}
+
+type UserUpdateRequest struct {
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	CurrentPassword string `json:"current_password"`
 }
 
+// TokenKind tells api tokens from the tokens of proxy session cookies.
+type TokenKind string
+
+const (
+	TokenKindAPI     TokenKind = "api"
+	TokenKindSession TokenKind = "session"
+)
+
 type Token struct {
-	UserID string `json:"user_id"`
-	Token  string `json:"token"`
+	ID         string       `json:"id"`
+	UserID     string       `json:"user_id"`
+	Token      string       `json:"token,omitempty"` // only returned on creation
+	TokenHash  string       `json:"-"`
+	Name       string       `json:"name"`
+	Kind       TokenKind    `json:"kind"`
+	Scopes     []Permission `json:"scopes"` // empty grants all permissions of the role
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  *time.Time   `json:"expires_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+}
+
+// Expired reports whether the token can no longer be used at the given time.
+func (t *Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+type TokenRequest struct {
+	Name      string       `json:"name"`
+	Scopes    []Permission `json:"scopes"`
+	ExpiresAt *time.Time   `json:"expires_at"`
+}
+
+type IdleTimeoutRequest struct {
+	IdleTimeout *int `json:"idle_timeout"` // seconds, null removes the setting
 }
 
 type Template struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	RepoName   string `json:"repo_name"`
-	Dockerfile string `json:"dockerfile"`
+	ID          string         `json:"id"`
+	Name        string         `json:"name"`
+	RepoName    string         `json:"repo_name"`
+	Dockerfile  string         `json:"dockerfile"`
+	IdleTimeout *int           `json:"idle_timeout"` // seconds, nil uses the global default, 0 never stops
+	Limits      ResourceLimits `json:"limits"`       // defaults for workspaces of the template
+}
+
+// BuiltImage reports whether the image was built from the template.
+func (t Template) BuiltImage(imageName string) bool {
+	return strings.HasPrefix(imageName, "cd-"+t.RepoName+":")
 }
 
 type Image struct {
-	RepoName string `json:"repo_name"` // "gocode"
-	ImageID  string `json:"image_id"`  // "sha256:abc123"
-	Tag      string `json:"tag"`       // "latest"
+	RepoName          string `json:"repo_name"`                     // "gocode"
+	ImageID           string `json:"image_id"`                      // "sha256:abc123"
+	Tag               string `json:"tag"`                           // "latest"
+	Owner             string `json:"owner,omitempty"`               // user id, only set for snapshots
+	SourceContainerID string `json:"source_container_id,omitempty"` // workspace a snapshot was taken of
+	SourceImage       string `json:"source_image,omitempty"`        // image of that workspace
+}
+
+// SnapshotRequest names the image a workspace is committed to.
+type SnapshotRequest struct {
+	Name string `json:"name"` // "my-setup"
+	Tag  string `json:"tag"`  // defaults to "latest"
+}
+
+// Snapshot describes the image a workspace is committed to.
+type Snapshot struct {
+	ImageName         string // "cd-01jz...-my-setup:latest"
+	Owner             string
+	SourceContainerID string
+	SourceImage       string
 }
 
 type BuildParams struct {
@@ -63,13 +273,16 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 type LoginResponse struct {
-	Username string `json:"username"`
-	UserID   string `json:"user_id"`
-	Token    string `json:"token"`
+	Username  string     `json:"username"`
+	UserID    string     `json:"user_id"`
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at"`
 }
 
 type WebSocketMessage struct {
 	Timestamp   string `json:"timestamp"`
 	MessageType string `json:"message_type"`
 	Message     string `json:"message"`
+	ReferenceID string `json:"reference_id,omitempty"` // id of the container or build the message belongs to
+	Data        any    `json:"data,omitempty"`         // structured payload, e.g. container stats
 }
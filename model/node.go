@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// LocalNodeID identifies the engine configured with CD_PROVIDER. It is not
+// stored in the nodes table.
+const LocalNodeID = "local"
+
+// Node is a docker daemon new workspaces can be scheduled on. The local node
+// is the engine cerodev is configured with, registered nodes are reached over
+// tcp with TLS client certificates.
+type Node struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Host       string    `json:"host"`                 // "tcp://10.0.0.2:2376"
+	PublicURL  string    `json:"public_url"`           // "http://10.0.0.2", the host ports of workspaces are reached on it
+	CACert     string    `json:"ca_cert"`              // PEM
+	ClientCert string    `json:"client_cert"`          // PEM
+	ClientKey  string    `json:"client_key,omitempty"` // PEM, write only and stored encrypted
+	MinPort    int       `json:"min_port"`             // first host port of the port pool
+	MaxPort    int       `json:"max_port"`             // last host port of the port pool
+	Cordoned   bool      `json:"cordoned"`             // no new workspaces are scheduled on the node
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NodeResources is the capacity of a node. 0 means unknown, the node is then
+// only limited by its ports.
+type NodeResources struct {
+	CPUs   int64 `json:"cpus"`
+	Memory int64 `json:"memory"` // bytes
+}
+
+// NodeStatus is a node with its capacity and what its workspaces reserve.
+type NodeStatus struct {
+	Node
+	NodeResources
+	Reachable      bool   `json:"reachable"`
+	Error          string `json:"error,omitempty"`
+	Workspaces     int    `json:"workspaces"`
+	ReservedCPU    int64  `json:"reserved_cpu_quota"` // sum of the cpu quotas of its workspaces
+	ReservedMemory int64  `json:"reserved_memory"`    // sum of the memory limits of its workspaces
+	FreePorts      int    `json:"free_ports"`
+}
+
+// NodeReservation sums up the limits of the workspaces on a node, trashed
+// workspaces are not counted.
+type NodeReservation struct {
+	NodeID     string
+	Workspaces int
+	CPUQuota   int64
+	Memory     int64
+}
+
+// NodePort is a host port of a node.
+type NodePort struct {
+	NodeID string `json:"node_id"`
+	Port   int    `json:"port"`
+}
@@ -0,0 +1,35 @@
+package model
+
+type QuotaKind string
+
+const (
+	QuotaKindRole QuotaKind = "role"
+	QuotaKindUser QuotaKind = "user"
+)
+
+func (k QuotaKind) Valid() bool {
+	return k == QuotaKindRole || k == QuotaKindUser
+}
+
+// Quota limits the workspaces of a user or of all users with a role. A quota
+// of the user wins over the quota of the role. 0 means unlimited.
+type Quota struct {
+	Kind          QuotaKind `json:"kind"`
+	Subject       string    `json:"subject"` // role name or user id
+	MaxContainers int       `json:"max_containers"`
+	MaxRunning    int       `json:"max_running"`
+	MaxMemory     int64     `json:"max_memory"`      // bytes over all running workspaces
+	MaxCPUQuota   int64     `json:"max_cpu_quota"`   // cpu quota over all running workspaces, 100000 is one cpu
+	MaxVolumeSize int64     `json:"max_volume_size"` // bytes over all volumes
+}
+
+// Usage is the current consumption of a user, compared against the effective quota.
+type Usage struct {
+	UserID     string `json:"user_id"`
+	Quota      *Quota `json:"quota"` // nil if the user is unlimited
+	Containers int    `json:"containers"`
+	Running    int    `json:"running"`
+	Memory     int64  `json:"memory"`      // limits of the running workspaces
+	CPUQuota   int64  `json:"cpu_quota"`   // limits of the running workspaces
+	VolumeSize int64  `json:"volume_size"` // including the volumes in the trash
+}
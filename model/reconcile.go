@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// ProviderContainer is a container found in the provider, independent of the db.
+type ProviderContainer struct {
+	DockerID      string         `json:"docker_id"`
+	NodeID        string         `json:"node_id"`
+	ContainerName string         `json:"container_name"`
+	ImageName     string         `json:"image_name"`
+	Status        string         `json:"status"`
+	State         string         `json:"state"`
+	EnvVars       []string       `json:"env_vars,omitempty"` // only set when inspected
+	Ports         []string       `json:"ports,omitempty"`    // only set when inspected
+	Limits        ResourceLimits `json:"limits"`             // only set when inspected
+}
+
+// MissingContainer is a stored container the provider does not know anymore.
+type MissingContainer struct {
+	ContainerID   string    `json:"container_id"`
+	ContainerName string    `json:"container_name"`
+	UserID        string    `json:"user_id"`
+	MissingSince  time.Time `json:"missing_since"`
+	Recreated     bool      `json:"recreated"`
+}
+
+// OrphanContainer is a container with the cerodev prefix that is not stored in the db.
+type OrphanContainer struct {
+	ProviderContainer
+	AdoptedAs string `json:"adopted_as,omitempty"` // id of the new db row
+}
+
+// ReconcileReport holds the findings of one reconciler run.
+type ReconcileReport struct {
+	StartedAt     time.Time          `json:"started_at"`
+	FinishedAt    time.Time          `json:"finished_at"`
+	Missing       []MissingContainer `json:"missing"`
+	Orphans       []OrphanContainer  `json:"orphans"`
+	ReleasedPorts []NodePort         `json:"released_ports"`
+	Errors        []string           `json:"errors"`
+}
@@ -0,0 +1,79 @@
+package model
+
+import "slices"
+
+type Role string
+
+const (
+	RoleAdmin     Role = "admin"
+	RoleDeveloper Role = "developer"
+	RoleViewer    Role = "viewer"
+)
+
+type Permission string
+
+const (
+	PermContainersRead  Permission = "containers:read"
+	PermContainersWrite Permission = "containers:write"
+	PermTemplatesRead   Permission = "templates:read"
+	PermTemplatesWrite  Permission = "templates:write"
+	PermImagesRead      Permission = "images:read"
+	PermImagesWrite     Permission = "images:write"
+	PermUsersRead       Permission = "users:read"
+	PermUsersWrite      Permission = "users:write"
+	// PermWorkspacesAccess opens the proxy and the terminal of a workspace.
+	// It is the only permission of the proxy session cookie.
+	PermWorkspacesAccess Permission = "workspaces:access"
+)
+
+// rolePermissions maps every role to the permissions it grants.
+// Admins are granted everything and are not listed.
+var rolePermissions = map[Role][]Permission{ //nolint:gochecknoglobals
+	RoleDeveloper: {
+		PermContainersRead,
+		PermContainersWrite,
+		PermTemplatesRead,
+		PermImagesRead,
+		PermWorkspacesAccess,
+	},
+	RoleViewer: {
+		PermContainersRead,
+		PermTemplatesRead,
+		PermImagesRead,
+		PermWorkspacesAccess,
+	},
+}
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleAdmin, RoleDeveloper, RoleViewer:
+		return true
+	}
+
+	return false
+}
+
+func (r Role) Can(p Permission) bool {
+	if r == RoleAdmin {
+		return true
+	}
+
+	return slices.Contains(rolePermissions[r], p)
+}
+
+func (p Permission) Valid() bool {
+	switch p {
+	case PermContainersRead, PermContainersWrite,
+		PermTemplatesRead, PermTemplatesWrite,
+		PermImagesRead, PermImagesWrite,
+		PermUsersRead, PermUsersWrite,
+		PermWorkspacesAccess:
+		return true
+	}
+
+	return false
+}
+
+type RoleRequest struct {
+	Role Role `json:"role"`
+}
@@ -0,0 +1,112 @@
+package model
+
+import "testing"
+
+func TestRoleCan(t *testing.T) {
+	all := []Permission{
+		PermContainersRead, PermContainersWrite,
+		PermTemplatesRead, PermTemplatesWrite,
+		PermImagesRead, PermImagesWrite,
+		PermUsersRead, PermUsersWrite,
+		PermWorkspacesAccess,
+	}
+
+	tests := []struct {
+		role    Role
+		granted []Permission
+	}{
+		{role: RoleAdmin, granted: all},
+		{role: RoleDeveloper, granted: []Permission{
+			PermContainersRead, PermContainersWrite, PermTemplatesRead, PermImagesRead, PermWorkspacesAccess,
+		}},
+		{role: RoleViewer, granted: []Permission{
+			PermContainersRead, PermTemplatesRead, PermImagesRead, PermWorkspacesAccess,
+		}},
+		{role: "guest"},
+	}
+
+	for _, tt := range tests {
+		granted := map[Permission]bool{}
+		for _, p := range tt.granted {
+			granted[p] = true
+		}
+
+		for _, p := range all {
+			if got := tt.role.Can(p); got != granted[p] {
+				t.Errorf("%s.Can(%s) = %v, want %v", tt.role, p, got, granted[p])
+			}
+		}
+	}
+}
+
+func TestRequesterCan(t *testing.T) {
+	tests := []struct {
+		name      string
+		requester Requester
+		perm      Permission
+		want      bool
+		wantAdmin bool
+	}{
+		{
+			name:      "admin without scopes",
+			requester: Requester{UserID: "a", Role: RoleAdmin},
+			perm:      PermUsersWrite,
+			want:      true,
+			wantAdmin: true,
+		},
+		{
+			name:      "admin with a scoped token",
+			requester: Requester{UserID: "a", Role: RoleAdmin, Scopes: []Permission{PermContainersRead}},
+			perm:      PermUsersWrite,
+		},
+		{
+			name:      "scope within the role",
+			requester: Requester{UserID: "d", Role: RoleDeveloper, Scopes: []Permission{PermContainersRead}},
+			perm:      PermContainersRead,
+			want:      true,
+		},
+		{
+			name:      "role without the scope",
+			requester: Requester{UserID: "d", Role: RoleDeveloper, Scopes: []Permission{PermContainersRead}},
+			perm:      PermContainersWrite,
+		},
+		{
+			name:      "scope beyond the role",
+			requester: Requester{UserID: "v", Role: RoleViewer, Scopes: []Permission{PermContainersWrite}},
+			perm:      PermContainersWrite,
+		},
+		{
+			name:      "proxy session",
+			requester: Requester{UserID: "d", Role: RoleDeveloper, Scopes: []Permission{PermWorkspacesAccess}},
+			perm:      PermContainersRead,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.requester.Can(tt.perm); got != tt.want {
+				t.Errorf("Can(%s) = %v, want %v", tt.perm, got, tt.want)
+			}
+
+			if got := tt.requester.IsAdmin(); got != tt.wantAdmin {
+				t.Errorf("IsAdmin = %v, want %v", got, tt.wantAdmin)
+			}
+		})
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, r := range []Role{RoleAdmin, RoleDeveloper, RoleViewer} {
+		if !r.Valid() {
+			t.Errorf("role %s is not valid", r)
+		}
+	}
+
+	if Role("root").Valid() || Role("").Valid() {
+		t.Error("unknown role is valid")
+	}
+
+	if Permission("containers:*").Valid() || !PermWorkspacesAccess.Valid() {
+		t.Error("permission validation is wrong")
+	}
+}
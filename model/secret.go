@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+type SecretScope string
+
+const (
+	SecretScopeUser     SecretScope = "user"
+	SecretScopeTemplate SecretScope = "template"
+)
+
+// Secret is an encrypted value that workspace env vars reference by name with
+// ${secret:NAME}. A secret of the owner wins over the one of the template the
+// image was built from. The value is never returned.
+type Secret struct {
+	Scope     SecretScope `json:"scope"`
+	OwnerID   string      `json:"owner_id"` // user or template id
+	Name      string      `json:"name"`
+	Value     string      `json:"value,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+type SecretRequest struct {
+	Value string `json:"value"`
+}
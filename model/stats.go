@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// ContainerStats is the resource usage of a workspace. Stopped workspaces
+// only report their volume size.
+type ContainerStats struct {
+	ContainerID string    `json:"container_id"`
+	State       string    `json:"state"`        // "running"
+	CPUPercent  float64   `json:"cpu_percent"`  // 100 is one fully used cpu
+	MemoryUsage int64     `json:"memory_usage"` // bytes without the page cache
+	MemoryLimit int64     `json:"memory_limit"` // bytes, the host memory if unlimited
+	NetworkRx   int64     `json:"network_rx"`   // bytes over all networks
+	NetworkTx   int64     `json:"network_tx"`
+	BlockRead   int64     `json:"block_read"` // bytes
+	BlockWrite  int64     `json:"block_write"`
+	Pids        int64     `json:"pids"`
+	VolumeSize  int64     `json:"volume_size"` // bytes of the volume directory
+	ReadAt      time.Time `json:"read_at"`
+}
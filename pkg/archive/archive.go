@@ -0,0 +1,273 @@
+// Package archive packs and unpacks directories as gzip compressed tar files.
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const dirPermissions = 0o755
+
+var (
+	ErrInvalidArchive = errors.New("invalid archive")
+	ErrTooLarge       = errors.New("archive too large")
+)
+
+// Write packs dir into w. Regular files, directories and symlinks are kept
+// with their mode and owner, other files are skipped. A missing directory
+// results in an empty archive.
+func Write(w io.Writer, dir string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		if path == dir {
+			return nil
+		}
+
+		return writeEntry(tw, dir, path, d)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to pack %s: %w", dir, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to close tar: %w", err)
+	}
+
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("failed to close gzip: %w", err)
+	}
+
+	return nil
+}
+
+func writeEntry(tw *tar.Writer, dir, path string, d fs.DirEntry) error {
+	if !d.IsDir() && !d.Type().IsRegular() && d.Type()&fs.ModeSymlink == 0 {
+		return nil
+	}
+
+	info, err := d.Info()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	var link string
+	if d.Type()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	hdr.Name = filepath.ToSlash(rel)
+	if d.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if !d.Type().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+
+	return err //nolint:wrapcheck
+}
+
+// Extract unpacks an archive created by Write into dir. Entries leaving dir or
+// below a symlink of the archive fail with ErrInvalidArchive. Files larger
+// than maxSize in total fail with ErrTooLarge, 0 does not limit the size.
+// Owners are restored if the process is allowed to.
+func Extract(r io.Reader, dir string, maxSize int64) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	defer gr.Close()
+
+	if err := os.MkdirAll(dir, dirPermissions); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", dir, err)
+	}
+
+	tr := tar.NewReader(gr)
+
+	var size int64
+
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+
+		// the tar reader returns exactly the size of the header
+		if hdr.Typeflag == tar.TypeReg {
+			size += hdr.Size
+		}
+
+		if maxSize > 0 && size > maxSize {
+			return fmt.Errorf("%w: more than %d bytes unpacked", ErrTooLarge, maxSize)
+		}
+
+		if err := extractEntry(tr, hdr, root); err != nil {
+			return err
+		}
+	}
+}
+
+func extractEntry(tr *tar.Reader, hdr *tar.Header, root string) error {
+	name := filepath.FromSlash(strings.TrimSuffix(hdr.Name, "/"))
+	if name == "" || name == "." {
+		return nil
+	}
+
+	if !filepath.IsLocal(name) {
+		return fmt.Errorf("%w: %s leaves the target directory", ErrInvalidArchive, hdr.Name)
+	}
+
+	target := filepath.Join(root, name)
+
+	if err := makeParents(root, name); err != nil {
+		return fmt.Errorf("failed to create parent of %s: %w", hdr.Name, err)
+	}
+
+	mode := hdr.FileInfo().Mode().Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.MkdirAll(target, mode); err != nil {
+			return fmt.Errorf("failed to create %s: %w", hdr.Name, err)
+		}
+	case tar.TypeReg:
+		if err := writeFile(tr, target, mode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", hdr.Name, err)
+		}
+	case tar.TypeSymlink:
+		// never write through an existing entry
+		if err := os.RemoveAll(target); err != nil {
+			return fmt.Errorf("failed to replace %s: %w", hdr.Name, err)
+		}
+
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return fmt.Errorf("failed to link %s: %w", hdr.Name, err)
+		}
+	default:
+		return nil
+	}
+
+	if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil && !errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("failed to chown %s: %w", hdr.Name, err)
+	}
+
+	return nil
+}
+
+// makeParents creates the missing parent directories of name below root one
+// by one. Symlinks are never followed, a parent that is not a directory fails
+// with ErrInvalidArchive.
+func makeParents(root, name string) error {
+	dir := root
+
+	for _, part := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+
+		dir = filepath.Join(dir, part)
+
+		info, err := os.Lstat(dir)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if err := os.Mkdir(dir, dirPermissions); err != nil {
+				return err //nolint:wrapcheck
+			}
+		case err != nil:
+			return err //nolint:wrapcheck
+		case !info.IsDir():
+			return fmt.Errorf("%w: %s is not a directory", ErrInvalidArchive, part)
+		}
+	}
+
+	return nil
+}
+
+func writeFile(r io.Reader, target string, mode fs.FileMode) error {
+	// never write through an existing entry
+	if err := os.RemoveAll(target); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+
+		return err //nolint:wrapcheck
+	}
+
+	return f.Close() //nolint:wrapcheck
+}
+
+// ContentType is the media type of archives.
+const ContentType = "application/gzip"
+
+// IsContentType reports whether a Content-Type header announces an archive.
+func IsContentType(header string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case ContentType, "application/x-gzip", "application/octet-stream":
+		return true
+	}
+
+	return false
+}
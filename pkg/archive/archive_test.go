@@ -0,0 +1,231 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// entry is a header of a test archive, regular files get body as content.
+type entry struct {
+	hdr  tar.Header
+	body string
+}
+
+func file(name, body string, mode int64) entry {
+	return entry{hdr: tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: mode, Size: int64(len(body))}, body: body} //nolint:exhaustruct,lll
+}
+
+func dir(name string, mode int64) entry {
+	return entry{hdr: tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: mode}} //nolint:exhaustruct
+}
+
+func symlink(name, target string) entry {
+	return entry{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: target, Mode: 0o777}} //nolint:exhaustruct,lll
+}
+
+func build(t *testing.T, entries ...entry) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for _, e := range entries {
+		if err := tw.WriteHeader(&e.hdr); err != nil {
+			t.Fatalf("write header %s: %v", e.hdr.Name, err)
+		}
+
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatalf("write %s: %v", e.hdr.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &buf
+}
+
+func TestExtractRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []entry
+		maxSize int64
+		wantErr error
+	}{
+		{
+			name:    "parent directory",
+			entries: []entry{file("../evil", "x", 0o644)},
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name:    "parent directory inside the path",
+			entries: []entry{dir("a/", 0o755), file("a/../../evil", "x", 0o644)},
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name:    "absolute path",
+			entries: []entry{file("/evil", "x", 0o644)},
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name:    "file through a symlink leaving the directory",
+			entries: []entry{symlink("link", "../outside"), file("link/evil", "x", 0o644)},
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name:    "directory through a symlink leaving the directory",
+			entries: []entry{symlink("link", "../outside"), file("link/sub/evil", "x", 0o644)},
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name:    "file through an absolute symlink",
+			entries: []entry{symlink("link", "/"), file("link/evil", "x", 0o644)},
+			wantErr: ErrInvalidArchive,
+		},
+		{
+			name:    "larger than the maximum",
+			entries: []entry{file("a", "12345", 0o644), file("b", "123456", 0o644)},
+			maxSize: 10,
+			wantErr: ErrTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := t.TempDir()
+			target := filepath.Join(base, "volume")
+
+			if err := os.Mkdir(filepath.Join(base, "outside"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Extract(build(t, tt.entries...), target, tt.maxSize)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Extract error = %v, want %v", err, tt.wantErr)
+			}
+
+			for _, name := range []string{"evil", "outside/evil", "outside/sub"} {
+				if _, err := os.Lstat(filepath.Join(base, name)); err == nil {
+					t.Errorf("%s was written outside the target directory", name)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractReplacesSymlink(t *testing.T) {
+	base := t.TempDir()
+	outside := filepath.Join(base, "outside")
+
+	if err := os.WriteFile(outside, []byte("keep"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// a file with the name of an earlier symlink replaces the link
+	archive := build(t, symlink("link", outside), file("link", "x", 0o644))
+	if err := Extract(archive, filepath.Join(base, "volume"), 0); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+
+	if b, err := os.ReadFile(outside); err != nil || string(b) != "keep" {
+		t.Errorf("file outside = %q, %v", b, err)
+	}
+
+	info, err := os.Lstat(filepath.Join(base, "volume", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !info.Mode().IsRegular() {
+		t.Errorf("link has mode %s, want a regular file", info.Mode())
+	}
+}
+
+func TestExtractStripsSpecialBits(t *testing.T) {
+	target := t.TempDir()
+
+	archive := build(t, dir("bin/", 0o2755), file("bin/sh", "#!/bin/sh", 0o4755))
+	if err := Extract(archive, target, 0); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+
+	for _, name := range []string{"bin", "bin/sh"} {
+		info, err := os.Stat(filepath.Join(target, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode()&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky) != 0 {
+			t.Errorf("%s has mode %s", name, info.Mode())
+		}
+	}
+}
+
+func TestWriteExtract(t *testing.T) {
+	src := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(src, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(src, "a", "b", "c.txt"), []byte("hello"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("b/c.txt", filepath.Join(src, "a", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, src); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "volume")
+	if err := Extract(&buf, dst, 5); err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dst, "a", "link"))
+	if err != nil || string(b) != "hello" {
+		t.Errorf("content through link = %q, %v", b, err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "a", "b", "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %s", info.Mode())
+	}
+}
+
+func TestIsContentType(t *testing.T) {
+	tests := map[string]bool{
+		"application/gzip":                true,
+		"application/x-gzip":              true,
+		"application/octet-stream":        true,
+		"application/gzip; charset=utf-8": true,
+		"application/json":                false,
+		"":                                false,
+	}
+
+	for header, want := range tests {
+		if got := IsContentType(header); got != want {
+			t.Errorf("IsContentType(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
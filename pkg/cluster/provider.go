@@ -0,0 +1,506 @@
+// Package cluster spreads workspaces over several container engines. The
+// local engine selected with CD_PROVIDER builds and stores the images,
+// registered docker daemons run workspaces too. Calls for a container are
+// routed to the node it was created on, images are copied from the local
+// engine to a node when a workspace is created there.
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+// Engine runs the workspaces of a node.
+type Engine interface {
+	CreateContainer(ctx context.Context, container *model.Container) (string, error)
+	StartContainer(ctx context.Context, containerID string) error
+	StopContainer(ctx context.Context, containerID string) error
+	UpdateLimits(ctx context.Context, containerID string, limits model.ResourceLimits) error
+	DeleteContainer(ctx context.Context, containerID string) error
+	GetContainerStatuses(ctx context.Context, containerID []string) ([]model.ContainerStatus, error)
+	GetContainerIP(ctx context.Context, containerID string) (string, error)
+	PublishPort(ctx context.Context, containerID string, hostPort, port int) error
+	UnpublishPort(ctx context.Context, containerID string, hostPort int) error
+	GetContainerStats(ctx context.Context, containerID string) (model.ContainerStats, error)
+	FollowLogs(ctx context.Context, containerID string, opts model.LogOptions, w io.Writer) error
+	CreateExec(ctx context.Context, containerID string, cmd []string) (string, error)
+	GetExec(ctx context.Context, execID string) (model.ExecSession, error)
+	AttachExec(ctx context.Context, execID string) (model.ExecStream, error)
+	GetImages(ctx context.Context) ([]model.Image, error)
+	GetImage(ctx context.Context, imageName string) (model.Image, error)
+	CommitContainer(ctx context.Context, containerID string, snapshot model.Snapshot) (model.Image, error)
+	RemoveImage(ctx context.Context, imageName string) error
+	Build(ctx context.Context, t model.Template, tag string, env map[string]*string, w io.Writer) error
+	ListManagedContainers(ctx context.Context) ([]model.ProviderContainer, error)
+	InspectManagedContainer(ctx context.Context, containerID string) (model.ProviderContainer, error)
+}
+
+// resourceReporter is implemented by engines that know their capacity.
+type resourceReporter interface {
+	Resources(ctx context.Context) (model.NodeResources, error)
+}
+
+// imageStore is implemented by engines that can export and import images.
+type imageStore interface {
+	SaveImage(ctx context.Context, imageName string) (io.ReadCloser, error)
+	LoadImage(ctx context.Context, archive io.Reader) error
+}
+
+// Locator finds the node of a container by its docker id.
+type Locator interface {
+	GetNodeID(ctx context.Context, dockerID string) (string, error)
+}
+
+// Dialer creates the engine of a registered node.
+type Dialer func(node model.Node) (Engine, error)
+
+// Provider implements the provider of the services on top of the local
+// engine and the registered nodes. It is shared by all requests, nodes are
+// connected and disconnected while it is in use.
+type Provider struct {
+	local   Engine
+	dial    Dialer
+	locator Locator
+
+	mu    sync.RWMutex
+	nodes map[string]Engine
+}
+
+// New creates a provider for the local engine. Without connected nodes every
+// call goes to the local engine.
+func New(local Engine, dial Dialer, locator Locator) *Provider {
+	return &Provider{local: local, dial: dial, locator: locator, nodes: map[string]Engine{}} //nolint:exhaustruct
+}
+
+// Connect creates the engine of a registered node, replacing the previous
+// one of the node.
+func (p *Provider) Connect(node model.Node) error {
+	e, err := p.dial(node)
+	if err != nil {
+		return fmt.Errorf("failed to connect to node %s: %w", node.Name, err)
+	}
+
+	p.mu.Lock()
+	old := p.nodes[node.ID]
+	p.nodes[node.ID] = e
+	p.mu.Unlock()
+
+	closeEngine(old)
+
+	return nil
+}
+
+// Disconnect removes the engine of a node.
+func (p *Provider) Disconnect(nodeID string) {
+	p.mu.Lock()
+	old := p.nodes[nodeID]
+	delete(p.nodes, nodeID)
+	p.mu.Unlock()
+
+	closeEngine(old)
+}
+
+// closeEngine releases the client of a replaced or removed engine. Calls
+// that still use it fail.
+func closeEngine(e Engine) {
+	if c, ok := e.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// engine returns the engine of a node, an empty id is the local node.
+func (p *Provider) engine(nodeID string) (Engine, error) { //nolint:ireturn
+	if nodeID == "" || nodeID == model.LocalNodeID {
+		return p.local, nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	e, ok := p.nodes[nodeID]
+	if !ok {
+		return nil, fmt.Errorf("node %s is not available", nodeID) //nolint:err113
+	}
+
+	return e, nil
+}
+
+// nodeIDs returns the local node and the connected nodes.
+func (p *Provider) nodeIDs() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return append([]string{model.LocalNodeID}, slices.Sorted(maps.Keys(p.nodes))...)
+}
+
+// clustered reports whether nodes besides the local one are connected.
+func (p *Provider) clustered() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.nodes) > 0
+}
+
+// locate returns the node of a container. Containers unknown to the db, e.g.
+// orphans, are searched on every node.
+func (p *Provider) locate(ctx context.Context, dockerID string) (string, Engine, error) { //nolint:ireturn
+	if !p.clustered() {
+		return model.LocalNodeID, p.local, nil
+	}
+
+	nodeID, err := p.locator.GetNodeID(ctx, dockerID)
+	if err == nil {
+		e, err := p.engine(nodeID)
+
+		return nodeID, e, err
+	}
+
+	if !errors.Is(err, errs.ErrDataNotFound) {
+		return "", nil, fmt.Errorf("failed to locate container: %w", err)
+	}
+
+	for _, id := range p.nodeIDs() {
+		e, _ := p.engine(id)
+		if _, err := e.InspectManagedContainer(ctx, dockerID); err == nil {
+			return id, e, nil
+		}
+	}
+
+	return model.LocalNodeID, p.local, nil
+}
+
+// NodeResources returns the capacity of a node. Engines that do not report
+// it return zero values.
+func (p *Provider) NodeResources(ctx context.Context, nodeID string) (model.NodeResources, error) {
+	e, err := p.engine(nodeID)
+	if err != nil {
+		return model.NodeResources{}, err //nolint:exhaustruct
+	}
+
+	r, ok := e.(resourceReporter)
+	if !ok {
+		return model.NodeResources{}, nil //nolint:exhaustruct
+	}
+
+	return r.Resources(ctx)
+}
+
+// CreateContainer creates the container on its node. Nodes get the image
+// from the local engine if they do not have the current one.
+func (p *Provider) CreateContainer(ctx context.Context, container *model.Container) (string, error) {
+	e, err := p.engine(container.NodeID)
+	if err != nil {
+		return "", err
+	}
+
+	if e != p.local {
+		if err := p.ensureImage(ctx, e, container.ImageName); err != nil {
+			return "", fmt.Errorf("failed to copy image to node %s: %w", container.NodeID, err)
+		}
+	}
+
+	return e.CreateContainer(ctx, container)
+}
+
+// ensureImage copies an image from the local engine unless the node has the
+// same image already. Rebuilt templates keep their name, so the ids are
+// compared.
+func (p *Provider) ensureImage(ctx context.Context, node Engine, imageName string) error {
+	want, err := p.local.GetImage(ctx, imageName)
+	if err != nil {
+		return err
+	}
+
+	have, err := node.GetImage(ctx, imageName)
+	if err == nil && have.ImageID == want.ImageID {
+		return nil
+	}
+
+	if err != nil && !strings.Contains(err.Error(), "No such image") {
+		return err
+	}
+
+	return copyImage(ctx, p.local, node, imageName)
+}
+
+func copyImage(ctx context.Context, from, to Engine, imageName string) error {
+	src, srcOK := from.(imageStore)
+	dst, dstOK := to.(imageStore)
+
+	if !srcOK || !dstOK {
+		return fmt.Errorf("%w: images cannot be copied between these engines", errs.ErrInvalidInput)
+	}
+
+	archive, err := src.SaveImage(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to save image: %w", err)
+	}
+	defer archive.Close()
+
+	if err := dst.LoadImage(ctx, archive); err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Provider) StartContainer(ctx context.Context, containerID string) error {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return e.StartContainer(ctx, containerID)
+}
+
+func (p *Provider) StopContainer(ctx context.Context, containerID string) error {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return e.StopContainer(ctx, containerID)
+}
+
+func (p *Provider) UpdateLimits(ctx context.Context, containerID string, limits model.ResourceLimits) error {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return e.UpdateLimits(ctx, containerID, limits)
+}
+
+func (p *Provider) DeleteContainer(ctx context.Context, containerID string) error {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return e.DeleteContainer(ctx, containerID)
+}
+
+// GetContainerStatuses asks every node for the statuses of its containers.
+// An unreachable node fails the call, so that its containers are not taken
+// for missing.
+func (p *Provider) GetContainerStatuses(ctx context.Context, containerID []string) ([]model.ContainerStatus, error) {
+	if !p.clustered() {
+		return p.local.GetContainerStatuses(ctx, containerID)
+	}
+
+	byNode := map[string][]string{}
+
+	for _, id := range containerID {
+		nodeID, _, err := p.locate(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		byNode[nodeID] = append(byNode[nodeID], id)
+	}
+
+	statuses := []model.ContainerStatus{}
+
+	for _, nodeID := range slices.Sorted(maps.Keys(byNode)) {
+		e, err := p.engine(nodeID)
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := e.GetContainerStatuses(ctx, byNode[nodeID])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read statuses of node %s: %w", nodeID, err)
+		}
+
+		statuses = append(statuses, s...)
+	}
+
+	return statuses, nil
+}
+
+func (p *Provider) GetContainerIP(ctx context.Context, containerID string) (string, error) {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+
+	return e.GetContainerIP(ctx, containerID)
+}
+
+func (p *Provider) PublishPort(ctx context.Context, containerID string, hostPort, port int) error {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return e.PublishPort(ctx, containerID, hostPort, port)
+}
+
+func (p *Provider) UnpublishPort(ctx context.Context, containerID string, hostPort int) error {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return e.UnpublishPort(ctx, containerID, hostPort)
+}
+
+func (p *Provider) GetContainerStats(ctx context.Context, containerID string) (model.ContainerStats, error) {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return model.ContainerStats{}, err //nolint:exhaustruct
+	}
+
+	return e.GetContainerStats(ctx, containerID)
+}
+
+func (p *Provider) FollowLogs(ctx context.Context, containerID string, opts model.LogOptions, w io.Writer) error {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	return e.FollowLogs(ctx, containerID, opts, w)
+}
+
+func (p *Provider) CreateExec(ctx context.Context, containerID string, cmd []string) (string, error) {
+	_, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+
+	return e.CreateExec(ctx, containerID, cmd)
+}
+
+// GetExec asks the nodes for the exec, exec ids are unique across engines.
+func (p *Provider) GetExec(ctx context.Context, execID string) (model.ExecSession, error) {
+	_, session, err := p.findExec(ctx, execID)
+
+	return session, err
+}
+
+func (p *Provider) AttachExec(ctx context.Context, execID string) (model.ExecStream, error) { //nolint:ireturn
+	e, _, err := p.findExec(ctx, execID)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.AttachExec(ctx, execID)
+}
+
+func (p *Provider) findExec(ctx context.Context, execID string) (Engine, model.ExecSession, error) { //nolint:ireturn
+	var firstErr error
+
+	for _, id := range p.nodeIDs() {
+		e, _ := p.engine(id)
+
+		session, err := e.GetExec(ctx, execID)
+		if err == nil {
+			return e, session, nil
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return nil, model.ExecSession{}, firstErr //nolint:exhaustruct
+}
+
+// CommitContainer commits the container on its node. Snapshots taken on a
+// registered node are copied to the local engine, which keeps all images.
+func (p *Provider) CommitContainer(
+	ctx context.Context,
+	containerID string,
+	snapshot model.Snapshot,
+) (model.Image, error) {
+	nodeID, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return model.Image{}, err //nolint:exhaustruct
+	}
+
+	img, err := e.CommitContainer(ctx, containerID, snapshot)
+	if err != nil {
+		return img, err
+	}
+
+	if e != p.local {
+		if err := copyImage(ctx, e, p.local, snapshot.ImageName); err != nil {
+			return img, fmt.Errorf("failed to copy snapshot from node %s: %w", nodeID, err)
+		}
+	}
+
+	return img, nil
+}
+
+// RemoveImage deletes an image from the local engine and the copies on the
+// registered nodes.
+func (p *Provider) RemoveImage(ctx context.Context, imageName string) error {
+	for _, id := range p.nodeIDs() {
+		e, err := p.engine(id)
+		if err != nil {
+			return err
+		}
+
+		if err := e.RemoveImage(ctx, imageName); err != nil {
+			return fmt.Errorf("failed to remove image from node %s: %w", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Provider) GetImages(ctx context.Context) ([]model.Image, error) {
+	return p.local.GetImages(ctx)
+}
+
+func (p *Provider) GetImage(ctx context.Context, imageName string) (model.Image, error) {
+	return p.local.GetImage(ctx, imageName)
+}
+
+func (p *Provider) Build(ctx context.Context, t model.Template, tag string, env map[string]*string, w io.Writer) error {
+	return p.local.Build(ctx, t, tag, env, w)
+}
+
+// ListManagedContainers lists the managed containers of all nodes. An
+// unreachable node fails the call.
+func (p *Provider) ListManagedContainers(ctx context.Context) ([]model.ProviderContainer, error) {
+	containers := []model.ProviderContainer{}
+
+	for _, nodeID := range p.nodeIDs() {
+		e, _ := p.engine(nodeID)
+
+		list, err := e.ListManagedContainers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers of node %s: %w", nodeID, err)
+		}
+
+		for _, pc := range list {
+			pc.NodeID = nodeID
+			containers = append(containers, pc)
+		}
+	}
+
+	return containers, nil
+}
+
+func (p *Provider) InspectManagedContainer(ctx context.Context, containerID string) (model.ProviderContainer, error) {
+	nodeID, e, err := p.locate(ctx, containerID)
+	if err != nil {
+		return model.ProviderContainer{}, err //nolint:exhaustruct
+	}
+
+	pc, err := e.InspectManagedContainer(ctx, containerID)
+	pc.NodeID = nodeID
+
+	return pc, err
+}
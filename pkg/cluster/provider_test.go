@@ -0,0 +1,218 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+// fakeEngine is a node that knows a set of containers and records the ports
+// published on it. Calls outside the tests panic on the nil Engine.
+type fakeEngine struct {
+	Engine
+
+	containers map[string]bool
+	imageID    string
+	published  map[string]int
+	loaded     int
+}
+
+func newFakeEngine(imageID string, containers ...string) *fakeEngine {
+	f := &fakeEngine{containers: map[string]bool{}, imageID: imageID, published: map[string]int{}} //nolint:exhaustruct
+	for _, id := range containers {
+		f.containers[id] = true
+	}
+
+	return f
+}
+
+func (f *fakeEngine) PublishPort(_ context.Context, containerID string, hostPort, _ int) error {
+	if !f.containers[containerID] {
+		return fmt.Errorf("no such container %s", containerID) //nolint:err113
+	}
+
+	f.published[containerID] = hostPort
+
+	return nil
+}
+
+func (f *fakeEngine) UnpublishPort(_ context.Context, containerID string, hostPort int) error {
+	if f.published[containerID] != hostPort {
+		return fmt.Errorf("port %d of %s is not published", hostPort, containerID) //nolint:err113
+	}
+
+	delete(f.published, containerID)
+
+	return nil
+}
+
+func (f *fakeEngine) InspectManagedContainer(_ context.Context, containerID string) (model.ProviderContainer, error) {
+	if !f.containers[containerID] {
+		return model.ProviderContainer{}, fmt.Errorf("no such container %s", containerID) //nolint:err113,exhaustruct
+	}
+
+	return model.ProviderContainer{}, nil //nolint:exhaustruct
+}
+
+func (f *fakeEngine) GetImage(_ context.Context, imageName string) (model.Image, error) {
+	if f.imageID == "" {
+		return model.Image{}, fmt.Errorf("No such image: %s", imageName) //nolint:err113,exhaustruct
+	}
+
+	return model.Image{ImageID: f.imageID}, nil //nolint:exhaustruct
+}
+
+func (f *fakeEngine) CreateContainer(_ context.Context, container *model.Container) (string, error) {
+	f.containers[container.ID] = true
+
+	return container.ID, nil
+}
+
+func (f *fakeEngine) SaveImage(_ context.Context, _ string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader([]byte(f.imageID))), nil
+}
+
+func (f *fakeEngine) LoadImage(_ context.Context, archive io.Reader) error {
+	b, err := io.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+
+	f.imageID = string(b)
+	f.loaded++
+
+	return nil
+}
+
+// fakeLocator knows the nodes of the containers stored in the db.
+type fakeLocator map[string]string
+
+func (l fakeLocator) GetNodeID(_ context.Context, dockerID string) (string, error) {
+	nodeID, ok := l[dockerID]
+	if !ok {
+		return "", errs.ErrDataNotFound
+	}
+
+	return nodeID, nil
+}
+
+func newTestProvider(t *testing.T, local Engine, nodes map[string]Engine, locator fakeLocator) *Provider {
+	t.Helper()
+
+	p := New(local, func(node model.Node) (Engine, error) {
+		e, ok := nodes[node.ID]
+		if !ok {
+			return nil, errors.New("unreachable") //nolint:err113
+		}
+
+		return e, nil
+	}, locator)
+
+	for id := range nodes {
+		if err := p.Connect(model.Node{ID: id}); err != nil { //nolint:exhaustruct
+			t.Fatalf("Connect: %v", err)
+		}
+	}
+
+	return p
+}
+
+func TestPublishPortOnNode(t *testing.T) {
+	tests := []struct {
+		name        string
+		containerID string
+		locator     fakeLocator
+		want        string
+		wantErr     bool
+	}{
+		{name: "local container", containerID: "l1", locator: fakeLocator{"l1": model.LocalNodeID}, want: "local"},
+		{name: "container of a node", containerID: "r1", locator: fakeLocator{"r1": "n1"}, want: "n1"},
+		{name: "container of another node", containerID: "s1", locator: fakeLocator{"s1": "n2"}, want: "n2"},
+		{name: "orphan on a node", containerID: "r1", locator: fakeLocator{}, want: "n1"},
+		{name: "node not connected", containerID: "r1", locator: fakeLocator{"r1": "n3"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engines := map[string]*fakeEngine{
+				"local": newFakeEngine("img", "l1"),
+				"n1":    newFakeEngine("img", "r1"),
+				"n2":    newFakeEngine("img", "s1"),
+			}
+			p := newTestProvider(t, engines["local"], map[string]Engine{"n1": engines["n1"], "n2": engines["n2"]}, tt.locator)
+
+			err := p.PublishPort(context.Background(), tt.containerID, 30005, 3000)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PublishPort error = %v, want error %v", err, tt.wantErr)
+			}
+
+			for id, e := range engines {
+				hostPort, ok := e.published[tt.containerID]
+				if ok != (id == tt.want) || (ok && hostPort != 30005) {
+					t.Errorf("published on %s = %d, %v", id, hostPort, ok)
+				}
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if err := p.UnpublishPort(context.Background(), tt.containerID, 30005); err != nil {
+				t.Errorf("UnpublishPort: %v", err)
+			}
+		})
+	}
+}
+
+func TestPublishPortWithoutNodes(t *testing.T) {
+	local := newFakeEngine("img", "l1")
+
+	// without nodes the db is not asked for the node of a container
+	p := newTestProvider(t, local, nil, nil)
+	if err := p.PublishPort(context.Background(), "l1", 30000, 8080); err != nil {
+		t.Fatalf("PublishPort: %v", err)
+	}
+
+	if local.published["l1"] != 30000 {
+		t.Errorf("published = %v", local.published)
+	}
+}
+
+func TestCreateContainerCopiesImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		nodeImage  string
+		wantLoaded int
+	}{
+		{name: "node without the image", nodeImage: "", wantLoaded: 1},
+		{name: "node with an old build", nodeImage: "old", wantLoaded: 1},
+		{name: "node with the current image", nodeImage: "img", wantLoaded: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newFakeEngine("img")
+			node := newFakeEngine(tt.nodeImage)
+			p := newTestProvider(t, local, map[string]Engine{"n1": node}, fakeLocator{})
+
+			c := &model.Container{ID: "c1", NodeID: "n1", ImageName: "cd-go:v1"} //nolint:exhaustruct
+			if _, err := p.CreateContainer(context.Background(), c); err != nil {
+				t.Fatalf("CreateContainer: %v", err)
+			}
+
+			if node.loaded != tt.wantLoaded || node.imageID != "img" {
+				t.Errorf("loaded = %d with image %q, want %d", node.loaded, node.imageID, tt.wantLoaded)
+			}
+
+			if !node.containers["c1"] || local.containers["c1"] {
+				t.Errorf("container was not created on the node")
+			}
+		})
+	}
+}
@@ -1,12 +1,19 @@
 package crypto
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrCiphertextTooShort = errors.New("ciphertext too short")
+
 func HashPassword(password string, passwordCost int) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 
@@ -31,3 +38,59 @@ func GenerateToken(length int) (string, error) {
 
 	return hex.EncodeToString(key), nil
 }
+
+// HashToken returns the hex encoded sha256 hash of an api token. Tokens are
+// random and long enough that a salted slow hash is not required.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Encrypt seals plaintext with AES-256-GCM under a key derived from the
+// master key. The result is base64 encoded with the nonce in front.
+func Encrypt(masterKey string, plaintext []byte) (string, error) {
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Decrypt opens a value sealed by Encrypt with the same master key.
+func Decrypt(masterKey string, ciphertext string) ([]byte, error) {
+	gcm, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrCiphertextTooShort
+	}
+
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+func newGCM(masterKey string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(masterKey))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, plaintext := range []string{"", "s3cret", "a longer value with\nnewlines and ünicode"} {
+		sealed, err := Encrypt("master", []byte(plaintext))
+		if err != nil {
+			t.Fatalf("Encrypt: %v", err)
+		}
+
+		if plaintext != "" && sealed == plaintext {
+			t.Errorf("Encrypt(%q) returned the plaintext", plaintext)
+		}
+
+		opened, err := Decrypt("master", sealed)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+
+		if string(opened) != plaintext {
+			t.Errorf("Decrypt = %q, want %q", opened, plaintext)
+		}
+	}
+}
+
+func TestEncryptUsesNonce(t *testing.T) {
+	a, err := Encrypt("master", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Encrypt("master", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Error("the same value was sealed to the same ciphertext twice")
+	}
+}
+
+func TestDecryptFails(t *testing.T) {
+	sealed, err := Encrypt("master", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw[len(raw)-1] ^= 1
+
+	tests := []struct {
+		name       string
+		key        string
+		ciphertext string
+	}{
+		{name: "wrong key", key: "other", ciphertext: sealed},
+		{name: "tampered", key: "master", ciphertext: base64.StdEncoding.EncodeToString(raw)},
+		{name: "too short", key: "master", ciphertext: base64.StdEncoding.EncodeToString([]byte("short"))},
+		{name: "not base64", key: "master", ciphertext: "%%%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if value, err := Decrypt(tt.key, tt.ciphertext); err == nil {
+				t.Errorf("Decrypt = %q, want an error", value)
+			}
+		})
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	if HashToken("a") != HashToken("a") {
+		t.Error("HashToken is not deterministic")
+	}
+
+	if HashToken("a") == HashToken("b") {
+		t.Error("different tokens have the same hash")
+	}
+}
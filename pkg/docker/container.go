@@ -4,10 +4,13 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"os"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,8 +19,11 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/utils"
 )
 
 const entrypoint = `
@@ -34,12 +40,25 @@ fi
 
 WORKDIR="/home/coder/workspace"
 
+# Optional branch or tag and shallow clone depth
+CLONE_ARGS=()
+if [ -n "$GIT_REF" ]; then
+  CLONE_ARGS+=(--branch "$GIT_REF")
+fi
+if [ -n "$GIT_DEPTH" ] && [ "$GIT_DEPTH" != "0" ]; then
+  CLONE_ARGS+=(--depth "$GIT_DEPTH")
+fi
+
 # Clean workspace before clone (optional: use caution)
 if [ -n "$(ls -A $WORKDIR 2>/dev/null)" ]; then
   echo "⚠️ Workspace is not empty. Skipping clone."
 else
   echo "📥 Cloning $GIT_REPO into $WORKDIR..."
-  git clone "$GIT_REPO" "$WORKDIR"
+  # credentials are read from the files mounted by cerodev, see GIT_CONFIG_* and GIT_SSH_COMMAND
+  if ! git clone "${CLONE_ARGS[@]}" "$GIT_REPO" "$WORKDIR"; then
+    echo "❌ ERROR: cloning $GIT_REPO failed. Private repositories need git credentials of the owner."
+    exit 1
+  fi
 fi
 
 # Start Code Server
@@ -89,17 +108,30 @@ func addFileToTar(tw *tar.Writer, name string, content string) error {
 	return err
 }
 
-func build(ctx context.Context, cli *client.Client, t model.Template, tag string, buildArgs map[string]*string) error {
-	tarBuffer, err := createTar(t.Dockerfile, map[string]string{
+// ContextFiles returns the files of the build context next to the
+// Dockerfile of a template.
+func ContextFiles() map[string]string {
+	return map[string]string{
 		"entrypoint.sh": entrypoint,
-	})
+	}
+}
+
+func build(
+	ctx context.Context,
+	cli *client.Client,
+	t model.Template,
+	tag string,
+	buildArgs map[string]*string,
+	w io.Writer,
+) error {
+	tarBuffer, err := createTar(t.Dockerfile, ContextFiles())
 	if err != nil {
 		return err
 	}
 
 	// Use it in ImageBuild
 	res, err := cli.ImageBuild(ctx, tarBuffer, types.ImageBuildOptions{ //nolint:exhaustruct
-		Tags:       []string{containerPrefix + "-" + t.RepoName + ":" + tag},
+		Tags:       []string{ImageName(t.RepoName, tag)},
 		Dockerfile: "Dockerfile",
 		Remove:     true,
 		BuildArgs:  buildArgs,
@@ -113,16 +145,55 @@ func build(ctx context.Context, cli *client.Client, t model.Template, tag string
 			fmt.Printf("failed to close rows: %s", err.Error()) //nolint:forbidigo
 		}
 	}()
-	// Stream build logs
-	_, err = io.Copy(os.Stdout, res.Body)
-	if err != nil {
-		return err
+
+	return copyBuildOutput(res.Body, w)
+}
+
+// copyBuildOutput decodes the JSON message stream of a build, writes the
+// output to w and returns the first error reported by the daemon.
+func copyBuildOutput(r io.Reader, w io.Writer) error {
+	decoder := json.NewDecoder(r)
+
+	for {
+		var message jsonmessage.JSONMessage
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		if message.Error != nil {
+			return message.Error
+		}
+
+		if message.ErrorMessage != "" {
+			return errors.New(message.ErrorMessage) //nolint:err113
+		}
+
+		// skip download progress updates, they would flood the logs
+		if message.Progress != nil && message.Progress.Current > 0 {
+			continue
+		}
+
+		line := message.Stream
+		if message.Status != "" {
+			line = strings.TrimSpace(message.ID+" "+message.Status+" "+message.ProgressMessage) + "\n"
+		}
+
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
 	}
+}
 
-	return nil
+// ImageName returns the name of the image built from a template.
+func ImageName(repoName, tag string) string {
+	return containerPrefix + "-" + repoName + ":" + tag
 }
 
-func containerCreate(ctx context.Context, cli *client.Client, c Container, volumesPath string) (string, error) {
+func containerCreate(ctx context.Context, cli *client.Client, c Container, volumesPath, gitDir, usernsMode, bindIP string) (string, error) { //nolint:lll
 	exposedPorts := nat.PortSet{}
 	for _, port := range c.Ports {
 		exposedPorts[nat.Port(port.ContainerPort)] = struct{}{}
@@ -131,7 +202,7 @@ func containerCreate(ctx context.Context, cli *client.Client, c Container, volum
 	portbindings := nat.PortMap{}
 	for _, port := range c.Ports {
 		portbindings[nat.Port(port.ContainerPort)] = []nat.PortBinding{ //nolint:exhaustruct,nolintlint
-			{HostPort: port.HostPort}, //nolint:exhaustruct
+			{HostIP: bindIP, HostPort: port.HostPort},
 		}
 	}
 
@@ -142,7 +213,12 @@ func containerCreate(ctx context.Context, cli *client.Client, c Container, volum
 		Volumes:      map[string]struct{}{volumesPath: {}},
 	}, &container.HostConfig{ //nolint:exhaustruct
 		PortBindings: portbindings,
-		Binds:        []string{volumesPath + ":/home/coder/workspace"},
+		Binds: []string{
+			volumesPath + ":/home/coder/workspace",
+			gitDir + ":" + utils.GitCredentialsMount + ":ro",
+		},
+		Resources:  resources(c.Limits),
+		UsernsMode: container.UsernsMode(usernsMode),
 	}, nil, nil, c.ContainerName)
 	if err != nil {
 		return "", err
@@ -151,6 +227,42 @@ func containerCreate(ctx context.Context, cli *client.Client, c Container, volum
 	return resp.ID, nil
 }
 
+// resources converts limits into the docker representation. 0 leaves a
+// resource unlimited.
+func resources(limits model.ResourceLimits) container.Resources {
+	r := container.Resources{ //nolint:exhaustruct
+		CPUQuota:   limits.CPUQuota,
+		Memory:     limits.Memory,
+		MemorySwap: limits.MemorySwap,
+	}
+
+	if limits.CPUQuota > 0 {
+		r.CPUPeriod = cpuPeriod
+	}
+
+	if limits.PidsLimit > 0 {
+		r.PidsLimit = &limits.PidsLimit
+	}
+
+	return r
+}
+
+// containerUpdateLimits changes the limits of an existing container. Docker
+// ignores 0 on updates, so only the pids limit can be removed again.
+func containerUpdateLimits(ctx context.Context, cli *client.Client, containerID string, limits model.ResourceLimits) error {
+	r := resources(limits)
+	if limits.PidsLimit == 0 {
+		unlimited := int64(-1)
+		r.PidsLimit = &unlimited
+	}
+
+	_, err := cli.ContainerUpdate(ctx, containerID, container.UpdateConfig{ //nolint:exhaustruct
+		Resources: r,
+	})
+
+	return err
+}
+
 func containerStart(ctx context.Context, cli *client.Client, containerID string) error {
 	return cli.ContainerStart(ctx, containerID, container.StartOptions{}) //nolint:exhaustruct
 }
@@ -172,6 +284,58 @@ func containerDelete(ctx context.Context, cli *client.Client, containerID string
 	})
 }
 
+// containerLogs copies the demultiplexed stdout and stderr of a container to w.
+// With follow it blocks until the container stops or ctx is cancelled.
+func containerLogs(ctx context.Context, cli *client.Client, containerID string, opts model.LogOptions, w io.Writer) error {
+	tail := opts.Tail
+	if tail == "" {
+		tail = "all"
+	}
+
+	logs, err := cli.ContainerLogs(ctx, containerID, container.LogsOptions{ //nolint:exhaustruct
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      opts.Since,
+		Timestamps: opts.Timestamps,
+		Follow:     opts.Follow,
+		Tail:       tail,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := logs.Close(); err != nil {
+			fmt.Printf("failed to close logs: %s", err.Error()) //nolint:forbidigo
+		}
+	}()
+
+	_, err = stdcopy.StdCopy(w, w, logs)
+
+	return err
+}
+
+// containerIP returns the address of the container in its first network.
+func containerIP(ctx context.Context, cli *client.Client, containerID string) (string, error) {
+	inspect, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return "", err
+	}
+
+	if inspect.NetworkSettings == nil {
+		return "", fmt.Errorf("container %s has no network settings", containerID) //nolint:err113
+	}
+
+	networks := slices.Sorted(maps.Keys(inspect.NetworkSettings.Networks))
+	for _, name := range networks {
+		if ip := inspect.NetworkSettings.Networks[name].IPAddress; ip != "" {
+			return ip, nil
+		}
+	}
+
+	return "", fmt.Errorf("container %s has no ip address", containerID) //nolint:err113
+}
+
 func (c Container) Status(ctx context.Context, cli *client.Client) {
 	containers, err := cli.ContainerList(ctx, container.ListOptions{ //nolint:exhaustruct
 		All:     true,
@@ -248,7 +412,7 @@ func getAllContainerStatuses(ctx context.Context, cli *client.Client, containerI
 // 	}
 // }
 
-func getImages(ctx context.Context, cli *client.Client) ([]model.Image, error) {
+func getImages(ctx context.Context, cli *client.Client, localPrefix string) ([]model.Image, error) {
 	images, err := cli.ImageList(ctx, image.ListOptions{}) //nolint:exhaustruct
 	if err != nil {
 		return nil, err
@@ -258,16 +422,105 @@ func getImages(ctx context.Context, cli *client.Client) ([]model.Image, error) {
 
 	for _, image := range images {
 		for _, repoTag := range image.RepoTags {
-			repo := strings.Split(repoTag, ":")
+			repo := strings.Split(strings.TrimPrefix(repoTag, localPrefix), ":")
 			if strings.HasPrefix(repo[0], "cd-") {
-				imageList = append(imageList, model.Image{
+				img := model.Image{ //nolint:exhaustruct
 					RepoName: repo[0],
 					ImageID:  image.ID,
 					Tag:      repo[1],
-				})
+				}
+				withSnapshotLabels(&img, image.Labels)
+				imageList = append(imageList, img)
 			}
 		}
 	}
 
 	return imageList, nil
 }
+
+// listManaged returns all containers whose name carries the cerodev prefix.
+func listManaged(ctx context.Context, cli *client.Client, localPrefix string) ([]model.ProviderContainer, error) {
+	namePrefix := "/" + containerPrefix + "-"
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{ //nolint:exhaustruct
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", namePrefix)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	managed := []model.ProviderContainer{}
+
+	for _, c := range containers {
+		for _, name := range c.Names {
+			// the name filter matches substrings, docker prepends "/" to names
+			if strings.HasPrefix(name, namePrefix) {
+				managed = append(managed, model.ProviderContainer{ //nolint:exhaustruct
+					DockerID:      c.ID,
+					ContainerName: strings.TrimPrefix(name, "/"),
+					ImageName:     strings.TrimPrefix(c.Image, localPrefix),
+					Status:        c.Status,
+					State:         c.State,
+				})
+
+				break
+			}
+		}
+	}
+
+	return managed, nil
+}
+
+// inspectManaged reads the spec of a container. Environment variables that
+// are inherited from the image are left out.
+func inspectManaged(ctx context.Context, cli *client.Client, containerID, localPrefix string) (model.ProviderContainer, error) { //nolint:lll
+	inspect, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return model.ProviderContainer{}, err
+	}
+
+	if inspect.Config == nil || inspect.HostConfig == nil || inspect.State == nil {
+		return model.ProviderContainer{}, fmt.Errorf("container %s has no config", containerID) //nolint:err113
+	}
+
+	env := inspect.Config.Env
+
+	if img, err := cli.ImageInspect(ctx, inspect.Image); err == nil && img.Config != nil {
+		env = slices.DeleteFunc(slices.Clone(env), func(e string) bool {
+			return slices.Contains(img.Config.Env, e)
+		})
+	}
+
+	ports := []string{}
+
+	for containerPort, bindings := range inspect.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			ports = append(ports, binding.HostPort+":"+string(containerPort))
+		}
+	}
+
+	slices.Sort(ports)
+
+	limits := model.ResourceLimits{
+		CPUQuota:   inspect.HostConfig.CPUQuota,
+		Memory:     inspect.HostConfig.Memory,
+		MemorySwap: inspect.HostConfig.MemorySwap,
+		PidsLimit:  0,
+	}
+
+	if inspect.HostConfig.PidsLimit != nil && *inspect.HostConfig.PidsLimit > 0 {
+		limits.PidsLimit = *inspect.HostConfig.PidsLimit
+	}
+
+	return model.ProviderContainer{
+		DockerID:      inspect.ID,
+		ContainerName: strings.TrimPrefix(inspect.Name, "/"),
+		ImageName:     strings.TrimPrefix(inspect.Config.Image, localPrefix),
+		Status:        inspect.State.Status,
+		State:         inspect.State.Status,
+		EnvVars:       env,
+		Ports:         ports,
+		Limits:        limits,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/kaibling/cerodev/model"
+)
+
+// ExecStream is an attached TTY exec session.
+type ExecStream struct {
+	ctx    context.Context //nolint:containedctx
+	cli    *client.Client
+	execID string
+	resp   types.HijackedResponse
+}
+
+func (s *ExecStream) Read(p []byte) (int, error) {
+	return s.resp.Reader.Read(p)
+}
+
+func (s *ExecStream) Write(p []byte) (int, error) {
+	return s.resp.Conn.Write(p)
+}
+
+func (s *ExecStream) Close() error {
+	s.resp.Close()
+
+	return nil
+}
+
+func (s *ExecStream) Resize(height, width uint) error {
+	return s.cli.ContainerExecResize(s.ctx, s.execID, container.ResizeOptions{
+		Height: height,
+		Width:  width,
+	})
+}
+
+func execCreate(ctx context.Context, cli *client.Client, containerID string, cmd []string) (string, error) {
+	resp, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{ //nolint:exhaustruct
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          []string{"TERM=xterm-256color"},
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+func execInspect(ctx context.Context, cli *client.Client, execID string) (model.ExecSession, error) {
+	inspect, err := cli.ContainerExecInspect(ctx, execID)
+	if err != nil {
+		return model.ExecSession{}, err //nolint:exhaustruct
+	}
+
+	return model.ExecSession{ //nolint:exhaustruct
+		ID:       inspect.ExecID,
+		DockerID: inspect.ContainerID,
+		Started:  inspect.Running || inspect.Pid != 0,
+	}, nil
+}
+
+func execAttach(ctx context.Context, cli *client.Client, execID string) (*ExecStream, error) {
+	resp, err := cli.ContainerExecAttach(ctx, execID, container.ExecAttachOptions{ //nolint:exhaustruct
+		Tty: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecStream{ctx: ctx, cli: cli, execID: execID, resp: resp}, nil
+}
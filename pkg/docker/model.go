@@ -1,5 +1,7 @@
 package docker
 
+import "github.com/kaibling/cerodev/model"
+
 type Port struct {
 	HostPort      string `json:"host_port"`      //  "8089"
 	ContainerPort string `json:"container_port"` //  "8080/tcp"
@@ -10,7 +12,11 @@ type ImageTemplate struct {
 	Dockerfile string `json:"dockerfile"` // "Dockerfile"
 }
 
-const containerPrefix = "cd"
+const (
+	containerPrefix = "cd"
+	// cpuPeriod is the cfs period in microseconds a cpu quota refers to.
+	cpuPeriod = 100000
+)
 
 type ContainerStatus struct {
 	ContainerName string `json:"container_name"`
@@ -19,11 +25,12 @@ type ContainerStatus struct {
 }
 
 type Container struct {
-	ContainerID   string   `json:"container_id"`
-	ContainerName string   `json:"container_name"`
-	ImageName     string   `json:"image_name"`
-	GitRepo       string   `json:"git_repo"`
-	UserID        string   `json:"user_id"`
-	Environment   []string `json:"environment"` // ["ENV=prod"]
-	Ports         []Port   `json:"ports"`
+	ContainerID   string               `json:"container_id"`
+	ContainerName string               `json:"container_name"`
+	ImageName     string               `json:"image_name"`
+	GitRepo       string               `json:"git_repo"`
+	UserID        string               `json:"user_id"`
+	Environment   []string             `json:"environment"` // ["ENV=prod"]
+	Ports         []Port               `json:"ports"`
+	Limits        model.ResourceLimits `json:"limits"`
 }
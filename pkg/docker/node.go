@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/client"
+	"github.com/kaibling/cerodev/model"
+)
+
+var errInvalidCA = errors.New("no certificate found in the ca")
+
+// clientTLSConfig verifies the engine with the CA and authenticates with the
+// client certificate.
+func clientTLSConfig(caCert, clientCert, clientKey []byte) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errInvalidCA
+	}
+
+	cert, err := tls.X509KeyPair(clientCert, clientKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+
+	return &tls.Config{ //nolint:exhaustruct
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Resources returns the cpus and the memory of the engine host.
+func (r *Repo) Resources(ctx context.Context) (model.NodeResources, error) {
+	return engineResources(ctx, r.cli)
+}
+
+// SaveImage exports an image as a tar archive to be loaded by another engine.
+func (r *Repo) SaveImage(ctx context.Context, imageName string) (io.ReadCloser, error) {
+	return r.cli.ImageSave(ctx, []string{r.opts.LocalImagePrefix + imageName})
+}
+
+// LoadImage imports an image exported by SaveImage.
+func (r *Repo) LoadImage(ctx context.Context, archive io.Reader) error {
+	resp, err := r.cli.ImageLoad(ctx, archive)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the daemon reports failures in the message stream
+	return copyBuildOutput(resp.Body, io.Discard)
+}
+
+func engineResources(ctx context.Context, cli *client.Client) (model.NodeResources, error) {
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return model.NodeResources{}, err //nolint:exhaustruct
+	}
+
+	return model.NodeResources{
+		CPUs:   int64(info.NCPU),
+		Memory: info.MemTotal,
+	}, nil
+}
@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+)
+
+const (
+	// DefaultRelayImage runs socat, it forwards the host ports of published
+	// ports to the workspace.
+	DefaultRelayImage = "alpine/socat:latest"
+	// relayPrefix does not match the prefix of workspaces, relays are not
+	// managed containers.
+	relayPrefix   = containerPrefix + "_relay-"
+	labelRelayFor = "cerodev.relay_for"
+)
+
+// A port binding cannot be added to an existing container. A published port
+// is reached through a relay container on the same node that binds the host
+// port and forwards to the address of the workspace. The address changes
+// with every start, so relays only exist while the workspace runs.
+
+// relayStart replaces the relay of a host port, it binds the host port to
+// bindIP like the ports of the workspace. Nothing is started while the
+// workspace is stopped.
+func relayStart(ctx context.Context, cli *client.Client, relayImage, bindIP, containerID string, hostPort, port int) error {
+	inspect, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	if inspect.State == nil || !inspect.State.Running {
+		return nil
+	}
+
+	ip, err := containerIP(ctx, cli, containerID)
+	if err != nil {
+		return err
+	}
+
+	if err := relayRemove(ctx, cli, relayPrefix+strconv.Itoa(hostPort)); err != nil {
+		return err
+	}
+
+	if err := pullMissing(ctx, cli, relayImage); err != nil {
+		return fmt.Errorf("failed to pull relay image %s: %w", relayImage, err)
+	}
+
+	target := strconv.Itoa(port)
+	relayPort := nat.Port(target + "/tcp")
+
+	resp, err := cli.ContainerCreate(ctx, &container.Config{ //nolint:exhaustruct
+		Image:        relayImage,
+		Cmd:          []string{"TCP-LISTEN:" + target + ",fork,reuseaddr", "TCP:" + net.JoinHostPort(ip, target)},
+		ExposedPorts: nat.PortSet{relayPort: {}},
+		Labels:       map[string]string{labelRelayFor: containerID},
+	}, &container.HostConfig{ //nolint:exhaustruct
+		PortBindings: nat.PortMap{relayPort: {{HostIP: bindIP, HostPort: strconv.Itoa(hostPort)}}},
+	}, nil, nil, relayPrefix+strconv.Itoa(hostPort))
+	if err != nil {
+		return fmt.Errorf("failed to create relay: %w", err)
+	}
+
+	if err := containerStart(ctx, cli, resp.ID); err != nil {
+		_ = containerDelete(context.WithoutCancel(ctx), cli, resp.ID)
+
+		return fmt.Errorf("failed to start relay: %w", err)
+	}
+
+	return nil
+}
+
+// relayRemove deletes a relay, a missing one is ignored.
+func relayRemove(ctx context.Context, cli *client.Client, name string) error {
+	if err := containerDelete(ctx, cli, name); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to delete relay %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// relayRemoveAll deletes the relays of a workspace, it also works after the
+// workspace is gone.
+func relayRemoveAll(ctx context.Context, cli *client.Client, containerID string) error {
+	relays, err := cli.ContainerList(ctx, container.ListOptions{ //nolint:exhaustruct
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", labelRelayFor+"="+containerID)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list relays: %w", err)
+	}
+
+	for _, relay := range relays {
+		if err := relayRemove(ctx, cli, relay.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pullMissing pulls an image that is not on the engine yet.
+func pullMissing(ctx context.Context, cli *client.Client, imageName string) error {
+	if _, err := cli.ImageInspect(ctx, imageName); err == nil || !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	progress, err := cli.ImagePull(ctx, imageName, image.PullOptions{}) //nolint:exhaustruct
+	if err != nil {
+		return err
+	}
+
+	defer progress.Close()
+
+	// the pull is done when the progress is read to the end
+	_, err = io.Copy(io.Discard, progress)
+
+	return err
+}
@@ -2,58 +2,186 @@ package docker
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/docker/docker/client"
 	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/utils"
 )
 
 type Repo struct {
 	cli         *client.Client
-	ctx         context.Context //nolint:containedctx
 	volumesPath string
+	opts        Options
 }
 
-func NewRepo(ctx context.Context, volumesPath string) *Repo {
-	cli, err := client.NewClientWithOpts(
+// Options adapt the repo to other engines that serve the Docker API.
+type Options struct {
+	// Host is the address of the engine, empty reads DOCKER_HOST.
+	Host string
+	// UsernsMode is the user namespace mode of workspaces, empty uses the
+	// default of the engine.
+	UsernsMode string
+	// LocalImagePrefix is prepended by the engine to the names of locally
+	// built images and stripped from the names it returns.
+	LocalImagePrefix string
+	// RelayImage forwards published ports, empty uses DefaultRelayImage.
+	RelayImage string
+	// BindIP is the host address the ports of workspaces and relays are
+	// bound to, empty binds all addresses.
+	BindIP string
+	// CACert, ClientCert and ClientKey are the PEM encoded TLS material of
+	// a remote engine. The environment is not read when they are set.
+	CACert     []byte
+	ClientCert []byte
+	ClientKey  []byte
+}
+
+// NewRepoWithOptions creates a repo for the engine described by opts.
+func NewRepoWithOptions(volumesPath string, opts Options) (*Repo, error) {
+	clientOpts := []client.Opt{
 		client.FromEnv,
 		client.WithAPIVersionNegotiation(),
-	)
+	}
+
+	if len(opts.CACert) > 0 {
+		tlsConfig, err := clientTLSConfig(opts.CACert, opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+
+		clientOpts = []client.Opt{
+			client.WithHTTPClient(&http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}), //nolint:exhaustruct
+			client.WithAPIVersionNegotiation(),
+		}
+	}
+
+	if opts.Host != "" {
+		clientOpts = append(clientOpts, client.WithHost(opts.Host))
+	}
+
+	cli, err := client.NewClientWithOpts(clientOpts...)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return &Repo{cli, ctx, volumesPath}
+	return &Repo{cli, volumesPath, opts}, nil
+}
+
+// Close releases the connections of the client.
+func (r *Repo) Close() error {
+	return r.cli.Close()
 }
 
-func (r *Repo) StartContainer(containerID string) error {
-	return containerStart(r.ctx, r.cli, containerID)
+func (r *Repo) StartContainer(ctx context.Context, containerID string) error {
+	return containerStart(ctx, r.cli, containerID)
 }
 
-func (r *Repo) CreateContainer(mc *model.Container) (string, error) {
+func (r *Repo) CreateContainer(ctx context.Context, mc *model.Container) (string, error) {
 	c := unmarshalContainer(*mc)
 
-	return containerCreate(r.ctx, r.cli, c, r.volumesPath+"/"+mc.ID)
+	volumePath := r.volumesPath + "/" + mc.ID
+	gitDir := utils.GitCredentialsDir(r.volumesPath, mc.ID)
+
+	return containerCreate(ctx, r.cli, c, volumePath, gitDir, r.opts.UsernsMode, r.opts.BindIP)
+}
+
+func (r *Repo) UpdateLimits(ctx context.Context, containerID string, limits model.ResourceLimits) error {
+	return containerUpdateLimits(ctx, r.cli, containerID, limits)
+}
+
+func (r *Repo) StopContainer(ctx context.Context, containerID string) error {
+	if err := containerStop(ctx, r.cli, containerID); err != nil {
+		return err
+	}
+
+	return relayRemoveAll(ctx, r.cli, containerID)
+}
+
+func (r *Repo) DeleteContainer(ctx context.Context, containerID string) error {
+	if err := relayRemoveAll(ctx, r.cli, containerID); err != nil {
+		return err
+	}
+
+	return containerDelete(ctx, r.cli, containerID)
+}
+
+// PublishPort starts a relay for a published port, see relayStart.
+func (r *Repo) PublishPort(ctx context.Context, containerID string, hostPort, port int) error {
+	return relayStart(ctx, r.cli, r.relayImage(), r.opts.BindIP, containerID, hostPort, port)
+}
+
+func (r *Repo) UnpublishPort(ctx context.Context, _ string, hostPort int) error {
+	return relayRemove(ctx, r.cli, relayPrefix+strconv.Itoa(hostPort))
+}
+
+func (r *Repo) relayImage() string {
+	if r.opts.RelayImage == "" {
+		return DefaultRelayImage
+	}
+
+	return r.opts.RelayImage
+}
+
+func (r *Repo) FollowLogs(ctx context.Context, containerID string, opts model.LogOptions, w io.Writer) error {
+	return containerLogs(ctx, r.cli, containerID, opts, w)
+}
+
+func (r *Repo) CreateExec(ctx context.Context, containerID string, cmd []string) (string, error) {
+	return execCreate(ctx, r.cli, containerID, cmd)
+}
+
+func (r *Repo) GetExec(ctx context.Context, execID string) (model.ExecSession, error) {
+	return execInspect(ctx, r.cli, execID)
+}
+
+func (r *Repo) AttachExec(ctx context.Context, execID string) (model.ExecStream, error) { //nolint:ireturn
+	return execAttach(ctx, r.cli, execID)
+}
+
+func (r *Repo) CommitContainer(ctx context.Context, containerID string, snapshot model.Snapshot) (model.Image, error) {
+	return containerCommit(ctx, r.cli, containerID, snapshot)
+}
+
+func (r *Repo) GetImage(ctx context.Context, imageName string) (model.Image, error) {
+	return imageInspect(ctx, r.cli, imageName)
+}
+
+func (r *Repo) RemoveImage(ctx context.Context, imageName string) error {
+	return imageRemove(ctx, r.cli, imageName)
+}
+
+func (r *Repo) GetContainerStats(ctx context.Context, containerID string) (model.ContainerStats, error) {
+	return containerStats(ctx, r.cli, containerID)
+}
+
+func (r *Repo) GetContainerIP(ctx context.Context, containerID string) (string, error) {
+	return containerIP(ctx, r.cli, containerID)
 }
 
-func (r *Repo) StopContainer(containerID string) error {
-	return containerStop(r.ctx, r.cli, containerID)
+func (r *Repo) GetContainerStatuses(ctx context.Context, containerID []string) ([]model.ContainerStatus, error) {
+	return getAllContainerStatuses(ctx, r.cli, containerID)
 }
 
-func (r *Repo) DeleteContainer(containerID string) error {
-	return containerDelete(r.ctx, r.cli, containerID)
+// ListManagedContainers returns all containers named with the cerodev
+// prefix, including those unknown to the db.
+func (r *Repo) ListManagedContainers(ctx context.Context) ([]model.ProviderContainer, error) {
+	return listManaged(ctx, r.cli, r.opts.LocalImagePrefix)
 }
 
-func (r *Repo) GetContainerStatuses(containerID []string) ([]model.ContainerStatus, error) {
-	return getAllContainerStatuses(r.ctx, r.cli, containerID)
+func (r *Repo) InspectManagedContainer(ctx context.Context, containerID string) (model.ProviderContainer, error) {
+	return inspectManaged(ctx, r.cli, containerID, r.opts.LocalImagePrefix)
 }
 
-func (r *Repo) Build(t model.Template, tag string, env map[string]*string) error {
-	return build(r.ctx, r.cli, t, tag, env)
+func (r *Repo) Build(ctx context.Context, t model.Template, tag string, env map[string]*string, w io.Writer) error {
+	return build(ctx, r.cli, t, tag, env, w)
 }
 
-func (r *Repo) GetImages() ([]model.Image, error) {
-	return getImages(r.ctx, r.cli)
+func (r *Repo) GetImages(ctx context.Context) ([]model.Image, error) {
+	return getImages(ctx, r.cli, r.opts.LocalImagePrefix)
 }
 
 func unmarshalContainer(c model.Container) Container {
@@ -75,5 +203,6 @@ func unmarshalContainer(c model.Container) Container {
 		UserID:        c.UserID,
 		Environment:   c.EnvVars,
 		Ports:         ports,
+		Limits:        c.Limits,
 	}
 }
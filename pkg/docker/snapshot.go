@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/kaibling/cerodev/model"
+)
+
+// labels of snapshot images
+const (
+	labelOwner           = "cerodev.owner"
+	labelSourceContainer = "cerodev.source_container"
+	labelSourceImage     = "cerodev.source_image"
+)
+
+// containerCommit commits the file system of a container into an image. The
+// container is paused meanwhile. Bind mounted volumes are not included.
+func containerCommit(ctx context.Context, cli *client.Client, containerID string, snapshot model.Snapshot) (model.Image, error) { //nolint:lll
+	resp, err := cli.ContainerCommit(ctx, containerID, container.CommitOptions{ //nolint:exhaustruct
+		Reference: snapshot.ImageName,
+		Comment:   "snapshot of workspace " + snapshot.SourceContainerID,
+		Author:    snapshot.Owner,
+		Pause:     true,
+		Changes: []string{
+			fmt.Sprintf("LABEL %s=%q %s=%q %s=%q",
+				labelOwner, snapshot.Owner,
+				labelSourceContainer, snapshot.SourceContainerID,
+				labelSourceImage, snapshot.SourceImage),
+		},
+	})
+	if err != nil {
+		return model.Image{}, err //nolint:exhaustruct
+	}
+
+	repoName, tag, _ := strings.Cut(snapshot.ImageName, ":")
+
+	return model.Image{
+		RepoName:          repoName,
+		ImageID:           resp.ID,
+		Tag:               tag,
+		Owner:             snapshot.Owner,
+		SourceContainerID: snapshot.SourceContainerID,
+		SourceImage:       snapshot.SourceImage,
+	}, nil
+}
+
+// imageInspect returns an image by name or id.
+func imageInspect(ctx context.Context, cli *client.Client, imageName string) (model.Image, error) {
+	inspect, err := cli.ImageInspect(ctx, imageName)
+	if err != nil {
+		return model.Image{}, err //nolint:exhaustruct
+	}
+
+	repoName, tag, _ := strings.Cut(imageName, ":")
+	img := model.Image{ //nolint:exhaustruct
+		RepoName: repoName,
+		ImageID:  inspect.ID,
+		Tag:      tag,
+	}
+
+	if inspect.Config != nil {
+		withSnapshotLabels(&img, inspect.Config.Labels)
+	}
+
+	return img, nil
+}
+
+// imageRemove deletes an image by name, a missing one is ignored.
+func imageRemove(ctx context.Context, cli *client.Client, imageName string) error {
+	_, err := cli.ImageRemove(ctx, imageName, image.RemoveOptions{PruneChildren: true}) //nolint:exhaustruct
+	if err != nil && !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+func withSnapshotLabels(img *model.Image, labels map[string]string) {
+	img.Owner = labels[labelOwner]
+	img.SourceContainerID = labels[labelSourceContainer]
+	img.SourceImage = labels[labelSourceImage]
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/kaibling/cerodev/model"
+)
+
+// containerStats reads one sample of the stats api. Docker waits for a second
+// sample internally, so the cpu usage is relative to the previous second.
+func containerStats(ctx context.Context, cli *client.Client, containerID string) (model.ContainerStats, error) {
+	resp, err := cli.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return model.ContainerStats{}, err //nolint:exhaustruct
+	}
+	defer resp.Body.Close()
+
+	var raw container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return model.ContainerStats{}, fmt.Errorf("failed to decode stats: %w", err) //nolint:exhaustruct
+	}
+
+	stats := model.ContainerStats{ //nolint:exhaustruct
+		CPUPercent:  cpuPercent(raw),
+		MemoryUsage: int64(memoryUsage(raw.MemoryStats)), //nolint:gosec
+		MemoryLimit: int64(raw.MemoryStats.Limit),        //nolint:gosec
+		Pids:        int64(raw.PidsStats.Current),        //nolint:gosec
+		ReadAt:      raw.Read,
+	}
+
+	for _, network := range raw.Networks {
+		stats.NetworkRx += int64(network.RxBytes) //nolint:gosec
+		stats.NetworkTx += int64(network.TxBytes) //nolint:gosec
+	}
+
+	for _, entry := range raw.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockRead += int64(entry.Value) //nolint:gosec
+		case "write":
+			stats.BlockWrite += int64(entry.Value) //nolint:gosec
+		}
+	}
+
+	return stats, nil
+}
+
+// cpuPercent is calculated like docker stats does, 100 is one fully used cpu.
+func cpuPercent(raw container.StatsResponse) float64 {
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+
+	cpus := float64(raw.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	return cpuDelta / systemDelta * cpus * 100 //nolint:mnd
+}
+
+// memoryUsage subtracts the page cache like docker stats does. cgroup v1
+// reports it as total_inactive_file, v2 as inactive_file.
+func memoryUsage(mem container.MemoryStats) uint64 {
+	cache, ok := mem.Stats["total_inactive_file"]
+	if !ok {
+		cache = mem.Stats["inactive_file"]
+	}
+
+	if cache > mem.Usage {
+		return mem.Usage
+	}
+
+	return mem.Usage - cache
+}
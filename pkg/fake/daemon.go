@@ -0,0 +1,200 @@
+// Package fake is an in-memory container provider. It simulates a docker
+// daemon closely enough to run the API and the UI without one, e.g. in demo
+// mode or in end-to-end tests. Nothing is executed: builds succeed after
+// echoing the Dockerfile, containers only change their state and write log
+// lines, and started workspaces answer on their host ports with a placeholder
+// page.
+package fake
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/kaibling/cerodev/model"
+)
+
+const (
+	stateCreated = "created"
+	stateRunning = "running"
+	stateExited  = "exited"
+)
+
+type container struct {
+	id         string
+	spec       model.Container
+	state      string
+	ip         string
+	startedAt  time.Time
+	finishedAt time.Time
+	logs       []logLine
+	servers    []*http.Server
+	// published holds the servers of published ports by host port, they
+	// only exist while the container runs.
+	published map[int]*http.Server
+	// changed is closed and replaced whenever logs or state change, followers
+	// wait on it.
+	changed chan struct{}
+}
+
+type logLine struct {
+	at   time.Time
+	text string
+}
+
+type execSession struct {
+	containerID string
+	cmd         []string
+	started     bool
+}
+
+// Daemon holds the simulated containers, images and exec sessions. It is
+// created once and shared by all repos.
+type Daemon struct {
+	mu         sync.Mutex
+	containers map[string]*container
+	images     map[string]model.Image
+	execs      map[string]*execSession
+	nextIP     int
+}
+
+func NewDaemon() *Daemon {
+	return &Daemon{ //nolint:exhaustruct
+		containers: map[string]*container{},
+		images:     map[string]model.Image{},
+		execs:      map[string]*execSession{},
+		nextIP:     2, //nolint:mnd
+	}
+}
+
+// errNoSuchContainer mirrors the docker message the services recognise.
+func errNoSuchContainer(id string) error {
+	return fmt.Errorf("No such container: %s", id) //nolint:err113,stylecheck
+}
+
+func randomID() string {
+	b := make([]byte, 32) //nolint:mnd
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func imageID(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// get returns a container by id or unique id prefix, like docker does. The
+// caller holds mu.
+func (d *Daemon) get(id string) (*container, error) {
+	if c, ok := d.containers[id]; ok {
+		return c, nil
+	}
+
+	var found *container
+
+	for cid, c := range d.containers {
+		if id != "" && strings.HasPrefix(cid, id) {
+			if found != nil {
+				return nil, errNoSuchContainer(id)
+			}
+
+			found = c
+		}
+	}
+
+	if found == nil {
+		return nil, errNoSuchContainer(id)
+	}
+
+	return found, nil
+}
+
+// logf appends a log line and wakes up followers. The caller holds mu.
+func (c *container) logf(format string, args ...any) {
+	c.logs = append(c.logs, logLine{at: time.Now(), text: fmt.Sprintf(format, args...)})
+	c.notify()
+}
+
+func (c *container) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// status returns the docker like status text, e.g. "Up 5 minutes".
+func (c *container) status() string {
+	switch c.state {
+	case stateRunning:
+		return "Up " + units.HumanDuration(time.Since(c.startedAt))
+	case stateExited:
+		return "Exited (0) " + units.HumanDuration(time.Since(c.finishedAt)) + " ago"
+	default:
+		return "Created"
+	}
+}
+
+// serve answers on the host ports of a started container with a placeholder
+// page, so that the proxy has something to forward to. The caller holds mu.
+func (c *container) serve() error {
+	for _, p := range c.spec.Ports {
+		hostPort, _, _ := strings.Cut(p, ":")
+
+		srv, err := c.listen(hostPort)
+		if err != nil {
+			c.shutdown()
+
+			return err
+		}
+
+		c.servers = append(c.servers, srv)
+	}
+
+	return nil
+}
+
+// listen serves the placeholder page on a host port.
+func (c *container) listen(hostPort string) (*http.Server, error) {
+	// like the ports of real workspaces only the proxy reaches them
+	ln, err := net.Listen("tcp", "127.0.0.1:"+hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind port %s: %w", hostPort, err)
+	}
+
+	name := html.EscapeString(c.spec.ContainerName)
+	srv := &http.Server{ //nolint:exhaustruct
+		ReadHeaderTimeout: 5 * time.Second, //nolint:mnd
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, "<!doctype html><title>%[1]s</title><h1>%[1]s</h1>"+
+				"<p>cerodev runs in demo mode, this workspace is simulated.</p>", name)
+		}),
+	}
+
+	go func() { _ = srv.Serve(ln) }()
+
+	return srv, nil
+}
+
+// shutdown closes the placeholder servers, including those of published
+// ports. The caller holds mu.
+func (c *container) shutdown() {
+	for _, srv := range c.servers {
+		_ = srv.Close()
+	}
+
+	for _, srv := range c.published {
+		_ = srv.Close()
+	}
+
+	c.servers = nil
+	c.published = nil
+}
@@ -0,0 +1,116 @@
+package fake
+
+import (
+	"io"
+	"strings"
+	"sync"
+)
+
+// shellBuffer is the number of pending outputs before input blocks.
+const shellBuffer = 64
+
+// shell is the terminal of an exec session. It echoes the input like a tty
+// and answers every command line without executing it. "exit" ends the
+// session.
+type shell struct {
+	prompt string
+	out    *io.PipeReader
+	output chan string // written to the pipe in order by a single goroutine
+	mu     sync.Mutex
+	closed bool
+	line   []byte
+}
+
+func newShell(containerName string) *shell {
+	r, w := io.Pipe()
+	s := &shell{ //nolint:exhaustruct
+		prompt: "coder@" + containerName + ":~/workspace$ ",
+		out:    r,
+		output: make(chan string, shellBuffer),
+	}
+
+	go func() {
+		for out := range s.output {
+			if _, err := io.WriteString(w, out); err != nil {
+				break
+			}
+		}
+
+		_ = w.Close()
+	}()
+
+	s.output <- "cerodev demo mode, commands are not executed.\r\n" + s.prompt
+
+	return s
+}
+
+func (s *shell) Read(p []byte) (int, error) {
+	return s.out.Read(p)
+}
+
+func (s *shell) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	var echo strings.Builder
+
+	for _, b := range p {
+		switch b {
+		case '\r', '\n':
+			cmd := strings.TrimSpace(string(s.line))
+			s.line = s.line[:0]
+
+			echo.WriteString("\r\n")
+
+			if cmd == "exit" {
+				s.output <- echo.String()
+				s.close()
+
+				return len(p), nil
+			}
+
+			if cmd != "" {
+				echo.WriteString(strings.Fields(cmd)[0] + ": not available in demo mode\r\n")
+			}
+
+			echo.WriteString(s.prompt)
+		case 0x7f, '\b':
+			if len(s.line) > 0 {
+				s.line = s.line[:len(s.line)-1]
+				echo.WriteString("\b \b")
+			}
+		default:
+			s.line = append(s.line, b)
+			echo.WriteByte(b)
+		}
+	}
+
+	s.output <- echo.String()
+
+	return len(p), nil
+}
+
+func (s *shell) Close() error {
+	s.mu.Lock()
+	s.close()
+	s.mu.Unlock()
+
+	return s.out.Close()
+}
+
+// close ends the output after the pending writes. The caller holds mu.
+func (s *shell) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.output)
+	}
+}
+
+// Resize is a no-op, the output does not depend on the terminal size.
+func (s *shell) Resize(_, _ uint) error {
+	return nil
+}
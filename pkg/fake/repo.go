@@ -0,0 +1,573 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/docker"
+)
+
+const (
+	// buildStepDelay makes build progress visible.
+	buildStepDelay = 200 * time.Millisecond
+	// hostMemory is reported as memory limit of unlimited containers.
+	hostMemory = 8 << 30
+	hostCPUs   = 4
+)
+
+// Repo is the provider view on a daemon.
+type Repo struct {
+	d *Daemon
+}
+
+func NewRepo(d *Daemon) *Repo {
+	return &Repo{d: d}
+}
+
+func (r *Repo) CreateContainer(_ context.Context, mc *model.Container) (string, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	if _, ok := r.d.images[fullImageName(mc.ImageName)]; !ok {
+		return "", fmt.Errorf("No such image: %s", mc.ImageName) //nolint:err113,stylecheck
+	}
+
+	for _, c := range r.d.containers {
+		if c.spec.ContainerName == mc.ContainerName {
+			return "", fmt.Errorf("Conflict. The container name %q is already in use", "/"+mc.ContainerName) //nolint:err113,stylecheck,lll
+		}
+	}
+
+	spec := *mc
+	spec.EnvVars = slices.Clone(mc.EnvVars)
+	spec.Ports = slices.Clone(mc.Ports)
+
+	c := &container{ //nolint:exhaustruct
+		id:      randomID(),
+		spec:    spec,
+		state:   stateCreated,
+		changed: make(chan struct{}),
+	}
+	r.d.containers[c.id] = c
+
+	return c.id, nil
+}
+
+func (r *Repo) StartContainer(_ context.Context, containerID string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return err
+	}
+
+	if c.state == stateRunning {
+		return nil
+	}
+
+	if err := c.serve(); err != nil {
+		return err
+	}
+
+	if c.ip == "" {
+		c.ip = "172.17.0." + strconv.Itoa(r.d.nextIP)
+		r.d.nextIP++
+	}
+
+	c.state = stateRunning
+	c.startedAt = time.Now()
+	c.logf("📥 Cloning %s into /home/coder/workspace...", c.spec.GitRepo)
+	c.logf("🚀 Starting Code Server...")
+	c.logf("[%s] info  HTTP server listening on http://0.0.0.0:8765/", c.startedAt.UTC().Format(time.RFC3339))
+
+	return nil
+}
+
+func (r *Repo) StopContainer(_ context.Context, containerID string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return err
+	}
+
+	if c.state != stateRunning {
+		return nil
+	}
+
+	c.shutdown()
+	c.state = stateExited
+	c.finishedAt = time.Now()
+	c.logf("[%s] info  Received SIGTERM, shutting down", c.finishedAt.UTC().Format(time.RFC3339))
+
+	return nil
+}
+
+func (r *Repo) DeleteContainer(_ context.Context, containerID string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return err
+	}
+
+	c.shutdown()
+	delete(r.d.containers, c.id)
+	c.notify()
+
+	return nil
+}
+
+func (r *Repo) UpdateLimits(_ context.Context, containerID string, limits model.ResourceLimits) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return err
+	}
+
+	c.spec.Limits = limits
+
+	return nil
+}
+
+// FollowLogs writes the log lines of a container to w. With follow it blocks
+// until the container stops or ctx is cancelled.
+func (r *Repo) FollowLogs(ctx context.Context, containerID string, opts model.LogOptions, w io.Writer) error {
+	from, err := sinceTime(opts.Since)
+	if err != nil {
+		return err
+	}
+
+	r.d.mu.Lock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		r.d.mu.Unlock()
+
+		return err
+	}
+
+	lines := slices.DeleteFunc(slices.Clone(c.logs), func(l logLine) bool { return l.at.Before(from) })
+	if n, err := strconv.Atoi(opts.Tail); err == nil && n >= 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+
+	written := len(c.logs)
+	r.d.mu.Unlock()
+
+	if err := writeLogs(w, lines, opts.Timestamps); err != nil {
+		return err
+	}
+
+	for opts.Follow {
+		r.d.mu.Lock()
+		gone := r.d.containers[c.id] != c
+		running := c.state == stateRunning
+		lines = slices.Clone(c.logs[written:])
+		written = len(c.logs)
+		changed := c.changed
+		r.d.mu.Unlock()
+
+		if err := writeLogs(w, lines, opts.Timestamps); err != nil {
+			return err
+		}
+
+		if gone || !running {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+
+	return nil
+}
+
+func writeLogs(w io.Writer, lines []logLine, timestamps bool) error {
+	for _, l := range lines {
+		line := l.text + "\n"
+		if timestamps {
+			line = l.at.UTC().Format(time.RFC3339Nano) + " " + line
+		}
+
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sinceTime parses the docker notation of a start time, a relative duration,
+// a RFC 3339 timestamp or unix seconds.
+func sinceTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("%w: invalid since %q", errs.ErrInvalidInput, value)
+}
+
+func (r *Repo) CreateExec(_ context.Context, containerID string, cmd []string) (string, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return "", err
+	}
+
+	if c.state != stateRunning {
+		return "", fmt.Errorf("container %s is not running", c.id) //nolint:err113
+	}
+
+	id := randomID()
+	r.d.execs[id] = &execSession{containerID: c.id, cmd: cmd, started: false}
+
+	return id, nil
+}
+
+func (r *Repo) GetExec(_ context.Context, execID string) (model.ExecSession, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	s, ok := r.d.execs[execID]
+	if !ok {
+		return model.ExecSession{}, fmt.Errorf("No such exec instance: %s", execID) //nolint:err113,stylecheck,exhaustruct
+	}
+
+	return model.ExecSession{ //nolint:exhaustruct
+		ID:       execID,
+		DockerID: s.containerID,
+		Cmd:      s.cmd,
+		Started:  s.started,
+	}, nil
+}
+
+func (r *Repo) AttachExec(_ context.Context, execID string) (model.ExecStream, error) { //nolint:ireturn
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	s, ok := r.d.execs[execID]
+	if !ok {
+		return nil, fmt.Errorf("No such exec instance: %s", execID) //nolint:err113,stylecheck
+	}
+
+	c, err := r.d.get(s.containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.started = true
+
+	return newShell(c.spec.ContainerName), nil
+}
+
+func (r *Repo) CommitContainer(_ context.Context, containerID string, snapshot model.Snapshot) (model.Image, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return model.Image{}, err //nolint:exhaustruct
+	}
+
+	repoName, tag, _ := strings.Cut(snapshot.ImageName, ":")
+	img := model.Image{
+		RepoName:          repoName,
+		ImageID:           imageID(c.id, snapshot.ImageName, time.Now().String()),
+		Tag:               tag,
+		Owner:             snapshot.Owner,
+		SourceContainerID: snapshot.SourceContainerID,
+		SourceImage:       snapshot.SourceImage,
+	}
+	r.d.images[snapshot.ImageName] = img
+
+	return img, nil
+}
+
+func (r *Repo) GetImage(_ context.Context, imageName string) (model.Image, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	img, ok := r.d.images[fullImageName(imageName)]
+	if !ok {
+		return model.Image{}, fmt.Errorf("No such image: %s", imageName) //nolint:err113,stylecheck,exhaustruct
+	}
+
+	return img, nil
+}
+
+func (r *Repo) RemoveImage(_ context.Context, imageName string) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	delete(r.d.images, fullImageName(imageName))
+
+	return nil
+}
+
+func (r *Repo) GetImages(_ context.Context) ([]model.Image, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	images := []model.Image{}
+	for _, name := range slices.Sorted(maps.Keys(r.d.images)) {
+		images = append(images, r.d.images[name])
+	}
+
+	return images, nil
+}
+
+// Build echoes the instructions of the Dockerfile as build steps and stores
+// the image. Cancelling the context of the repo aborts it.
+func (r *Repo) Build(ctx context.Context, t model.Template, tag string, _ map[string]*string, w io.Writer) error {
+	steps := []string{}
+
+	for _, line := range strings.Split(t.Dockerfile, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			steps = append(steps, line)
+		}
+	}
+
+	name := docker.ImageName(t.RepoName, tag)
+	id := imageID(t.Dockerfile, name, time.Now().String())
+
+	for i, step := range steps {
+		if _, err := fmt.Fprintf(w, "Step %d/%d : %s\n ---> %s\n", i+1, len(steps), step, randomID()[:12]); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(buildStepDelay):
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "Successfully built %s\nSuccessfully tagged %s\n", id[7:19], name); err != nil {
+		return err
+	}
+
+	repoName, _, _ := strings.Cut(name, ":")
+
+	r.d.mu.Lock()
+	r.d.images[name] = model.Image{RepoName: repoName, ImageID: id, Tag: tag} //nolint:exhaustruct
+	r.d.mu.Unlock()
+
+	return nil
+}
+
+// GetContainerStats returns made up but plausible usage of a running
+// container.
+func (r *Repo) GetContainerStats(_ context.Context, containerID string) (model.ContainerStats, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return model.ContainerStats{}, err //nolint:exhaustruct
+	}
+
+	now := time.Now()
+	stats := model.ContainerStats{ //nolint:exhaustruct
+		MemoryLimit: c.spec.Limits.Memory,
+		ReadAt:      now,
+	}
+
+	if stats.MemoryLimit == 0 {
+		stats.MemoryLimit = hostMemory
+	}
+
+	if c.state != stateRunning {
+		return stats, nil
+	}
+
+	uptime := now.Sub(c.startedAt).Seconds()
+	stats.CPUPercent = 5 + 20*math.Abs(math.Sin(uptime/30))                //nolint:mnd
+	stats.MemoryUsage = min(int64(300<<20+uptime*1024), stats.MemoryLimit) //nolint:mnd
+	stats.NetworkRx = int64(uptime * 2048)                                 //nolint:mnd
+	stats.NetworkTx = int64(uptime * 512)                                  //nolint:mnd
+	stats.BlockRead = int64(50<<20 + uptime*256)                           //nolint:mnd
+	stats.BlockWrite = int64(10<<20 + uptime*128)                          //nolint:mnd
+	stats.Pids = 12                                                        //nolint:mnd
+
+	return stats, nil
+}
+
+// Resources returns the simulated host, the scheduler sees it like a docker
+// daemon.
+func (r *Repo) Resources(_ context.Context) (model.NodeResources, error) {
+	return model.NodeResources{CPUs: hostCPUs, Memory: hostMemory}, nil
+}
+
+func (r *Repo) GetContainerIP(_ context.Context, containerID string) (string, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return "", err
+	}
+
+	if c.state != stateRunning {
+		return "", fmt.Errorf("container %s has no ip address", c.id) //nolint:err113
+	}
+
+	return c.ip, nil
+}
+
+// PublishPort serves the placeholder page on the host port while the
+// container runs. Like the relays of docker, published ports of a stopped
+// container are published again after it started.
+func (r *Repo) PublishPort(_ context.Context, containerID string, hostPort, _ int) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return err
+	}
+
+	if c.state != stateRunning {
+		return nil
+	}
+
+	if _, ok := c.published[hostPort]; ok {
+		return nil
+	}
+
+	srv, err := c.listen(strconv.Itoa(hostPort))
+	if err != nil {
+		return err
+	}
+
+	if c.published == nil {
+		c.published = map[int]*http.Server{}
+	}
+
+	c.published[hostPort] = srv
+
+	return nil
+}
+
+func (r *Repo) UnpublishPort(_ context.Context, containerID string, hostPort int) error {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return err
+	}
+
+	if srv, ok := c.published[hostPort]; ok {
+		_ = srv.Close()
+
+		delete(c.published, hostPort)
+	}
+
+	return nil
+}
+
+func (r *Repo) GetContainerStatuses(_ context.Context, containerID []string) ([]model.ContainerStatus, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	statuses := []model.ContainerStatus{}
+
+	for _, id := range containerID {
+		c, err := r.d.get(id)
+		if err != nil {
+			continue
+		}
+
+		statuses = append(statuses, model.ContainerStatus{
+			DockerID: c.id,
+			Status:   c.status(),
+			State:    c.state,
+		})
+	}
+
+	return statuses, nil
+}
+
+func (r *Repo) ListManagedContainers(_ context.Context) ([]model.ProviderContainer, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	managed := []model.ProviderContainer{}
+
+	for _, id := range slices.Sorted(maps.Keys(r.d.containers)) {
+		c := r.d.containers[id]
+		managed = append(managed, model.ProviderContainer{ //nolint:exhaustruct
+			DockerID:      c.id,
+			ContainerName: c.spec.ContainerName,
+			ImageName:     c.spec.ImageName,
+			Status:        c.status(),
+			State:         c.state,
+		})
+	}
+
+	return managed, nil
+}
+
+func (r *Repo) InspectManagedContainer(_ context.Context, containerID string) (model.ProviderContainer, error) {
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	c, err := r.d.get(containerID)
+	if err != nil {
+		return model.ProviderContainer{}, err //nolint:exhaustruct
+	}
+
+	return model.ProviderContainer{
+		DockerID:      c.id,
+		ContainerName: c.spec.ContainerName,
+		ImageName:     c.spec.ImageName,
+		Status:        c.state,
+		State:         c.state,
+		EnvVars:       slices.Clone(c.spec.EnvVars),
+		Ports:         slices.Clone(c.spec.Ports),
+		Limits:        c.spec.Limits,
+	}, nil
+}
+
+// fullImageName adds the latest tag to untagged image names.
+func fullImageName(imageName string) string {
+	if strings.Contains(imageName, ":") {
+		return imageName
+	}
+
+	return imageName + ":latest"
+}
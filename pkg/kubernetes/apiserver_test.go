@@ -0,0 +1,206 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+const testNamespace = "test"
+
+// apiServer is an in-memory api server of a single namespace. Objects are
+// kept as JSON by path, patches replace the whole object.
+type apiServer struct {
+	mu      sync.Mutex
+	objects map[string]json.RawMessage
+}
+
+func newTestRepo(t *testing.T, opts Options) (*Repo, *apiServer) {
+	t.Helper()
+
+	api := &apiServer{objects: map[string]json.RawMessage{}} //nolint:exhaustruct
+
+	if opts.VolumeSize == "" {
+		opts.VolumeSize = defaultVolumeSize
+	}
+
+	return &Repo{client: api, volumesPath: t.TempDir(), opts: opts}, api
+}
+
+func (a *apiServer) path(resource, name string) string {
+	p := "/api/v1/namespaces/" + testNamespace + "/" + resource
+	if name != "" {
+		p += "/" + name
+	}
+
+	return p
+}
+
+func (a *apiServer) metricsPath(name string) string {
+	return "/apis/metrics.k8s.io/v1beta1/namespaces/" + testNamespace + "/pods/" + name
+}
+
+func (a *apiServer) do(_ context.Context, method, path string, query url.Values, body, out any) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var result any
+
+	switch method {
+	case http.MethodGet:
+		if stored, ok := a.objects[path]; ok {
+			result = stored
+
+			break
+		}
+
+		if !a.isCollection(path) {
+			return notFound(method, path)
+		}
+
+		result = map[string]any{"items": a.list(path, query.Get("labelSelector"))}
+	case http.MethodPost:
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		var o object
+		if err := json.Unmarshal(b, &o); err != nil {
+			return err
+		}
+
+		if _, ok := a.objects[path+"/"+o.Metadata.Name]; ok {
+			return &apiError{Code: http.StatusConflict, Reason: "AlreadyExists", Message: method + " " + path}
+		}
+
+		a.objects[path+"/"+o.Metadata.Name] = b
+	case http.MethodPut, http.MethodPatch:
+		if _, ok := a.objects[path]; !ok {
+			return notFound(method, path)
+		}
+
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		a.objects[path] = b
+	case http.MethodDelete:
+		if _, ok := a.objects[path]; !ok {
+			return notFound(method, path)
+		}
+
+		delete(a.objects, path)
+	}
+
+	if out == nil || result == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+func (a *apiServer) patch(ctx context.Context, path string, body any) error {
+	return a.do(ctx, http.MethodPatch, path, nil, body, nil)
+}
+
+func (a *apiServer) stream(_ context.Context, path string, _ url.Values) (io.ReadCloser, error) {
+	return nil, notFound(http.MethodGet, path)
+}
+
+func (a *apiServer) dial(_ context.Context, path string, _ url.Values, _ string) (*websocket.Conn, error) {
+	return nil, notFound(http.MethodGet, path)
+}
+
+// isCollection reports whether path names a resource instead of an object.
+func (a *apiServer) isCollection(path string) bool {
+	return strings.Count(strings.TrimPrefix(path, a.path("", "")), "/") == 0
+}
+
+// list returns the objects of a collection matching all terms of selector.
+func (a *apiServer) list(path, selector string) []json.RawMessage {
+	items := []json.RawMessage{}
+
+	for p, stored := range a.objects {
+		if !strings.HasPrefix(p, path+"/") {
+			continue
+		}
+
+		var o object
+		if err := json.Unmarshal(stored, &o); err != nil {
+			continue
+		}
+
+		if matches(o.Metadata.Labels, selector) {
+			items = append(items, stored)
+		}
+	}
+
+	return items
+}
+
+func matches(labels map[string]string, selector string) bool {
+	if selector == "" {
+		return true
+	}
+
+	for _, term := range strings.Split(selector, ",") {
+		key, value, _ := strings.Cut(term, "=")
+		if labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func notFound(method, path string) error {
+	return &apiError{Code: http.StatusNotFound, Reason: "NotFound", Message: method + " " + path}
+}
+
+// get decodes a stored object, it fails the test if the object is missing.
+func (a *apiServer) get(t *testing.T, resource, name string, out any) {
+	t.Helper()
+
+	if err := a.do(context.Background(), http.MethodGet, a.path(resource, name), nil, nil, out); err != nil {
+		t.Fatalf("get %s %s: %v", resource, name, err)
+	}
+}
+
+// exists reports whether an object is stored.
+func (a *apiServer) exists(t *testing.T, resource, name string) bool {
+	t.Helper()
+
+	err := a.do(context.Background(), http.MethodGet, a.path(resource, name), nil, nil, nil)
+	if err != nil && !isNotFound(err) {
+		t.Fatalf("get %s %s: %v", resource, name, err)
+	}
+
+	return err == nil
+}
+
+// setPodStatus replaces the status of a stored pod like the kubelet does.
+func (a *apiServer) setPodStatus(t *testing.T, name string, status podStatus) {
+	t.Helper()
+
+	var p pod
+	a.get(t, "pods", name, &p)
+	p.Status = status
+
+	if err := a.do(context.Background(), http.MethodPut, a.path("pods", name), nil, p, nil); err != nil {
+		t.Fatalf("update pod %s: %v", name, err)
+	}
+}
@@ -0,0 +1,173 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/docker"
+)
+
+const (
+	builderContainer  = "builder"
+	contextMount      = "/workspace"
+	dockerConfigMount = "/kaniko/.docker"
+	cleanupTimeout    = 30 * time.Second
+)
+
+// build runs kaniko in a pod that pushes the image to the registry. The build
+// context is mounted from a config map. Cancelling ctx deletes the pod.
+func (r *Repo) build(
+	ctx context.Context,
+	t model.Template,
+	tag string,
+	buildArgs map[string]*string,
+	w io.Writer,
+) error {
+	if r.opts.Registry == "" {
+		return fmt.Errorf("%w: builds on kubernetes require a registry", errs.ErrInvalidInput)
+	}
+
+	b := make([]byte, 6) //nolint:mnd
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	name := "cd-build-" + hex.EncodeToString(b)
+
+	files := docker.ContextFiles()
+	files["Dockerfile"] = t.Dockerfile
+
+	cm := configMap{object: meta("ConfigMap", name, labels(name, partBuild)), Data: files}
+	if err := r.client.do(ctx, http.MethodPost, r.client.path("configmaps", ""), nil, cm, nil); err != nil {
+		return fmt.Errorf("failed to create build context: %w", err)
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+		defer cancel()
+
+		_ = r.deleteObject(ctx, "pods", name)
+		_ = r.deleteObject(ctx, "configmaps", name)
+	}()
+
+	if err := r.client.do(ctx, http.MethodPost, r.client.path("pods", ""), nil, r.builderPod(name, t, tag, buildArgs), nil); err != nil { //nolint:lll
+		return fmt.Errorf("failed to create builder: %w", err)
+	}
+
+	if _, err := r.waitPhase(ctx, name, "Running", "Succeeded", "Failed"); err != nil {
+		return err
+	}
+
+	logs, err := r.client.stream(ctx, r.client.path("pods", name)+"/log", url.Values{
+		"container": {builderContainer},
+		"follow":    {"true"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read build output: %w", err)
+	}
+
+	_, err = io.Copy(w, logs)
+	logs.Close()
+
+	if err != nil {
+		return err
+	}
+
+	p, err := r.waitPhase(ctx, name, "Succeeded", "Failed")
+	if err != nil {
+		return err
+	}
+
+	if p.Status.Phase == "Failed" {
+		for _, cs := range p.Status.ContainerStatuses {
+			if cs.State.Terminated != nil {
+				return fmt.Errorf("build failed with exit code %d: %s", cs.State.Terminated.ExitCode, cs.State.Terminated.Reason) //nolint:err113,lll
+			}
+		}
+
+		return fmt.Errorf("build failed") //nolint:err113
+	}
+
+	return nil
+}
+
+func (r *Repo) builderPod(name string, t model.Template, tag string, buildArgs map[string]*string) pod {
+	args := []string{
+		"--dockerfile=Dockerfile",
+		"--context=dir://" + contextMount,
+		"--destination=" + r.imageRef(docker.ImageName(t.RepoName, tag)),
+	}
+
+	if r.opts.RegistryInsecure {
+		args = append(args, "--insecure")
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(buildArgs)) {
+		if value := buildArgs[key]; value != nil {
+			args = append(args, "--build-arg="+key+"="+*value)
+		}
+	}
+
+	c := podContainer{ //nolint:exhaustruct
+		Name:         builderContainer,
+		Image:        r.opts.BuilderImage,
+		Args:         args,
+		VolumeMounts: []volumeMount{{Name: "context", MountPath: contextMount}}, //nolint:exhaustruct
+	}
+
+	p := pod{ //nolint:exhaustruct
+		object: meta("Pod", name, labels(name, partBuild)),
+		Spec: podSpec{ //nolint:exhaustruct
+			RestartPolicy: "Never",
+			Containers:    []podContainer{c},
+			Volumes:       []volume{{Name: "context", ConfigMap: &localObjectRef{Name: name}}}, //nolint:exhaustruct
+		},
+	}
+
+	if r.opts.RegistrySecret != "" {
+		p.Spec.Containers[0].VolumeMounts = append(p.Spec.Containers[0].VolumeMounts, volumeMount{
+			Name:      "docker-config",
+			MountPath: dockerConfigMount,
+			ReadOnly:  true,
+		})
+		p.Spec.Volumes = append(p.Spec.Volumes, volume{ //nolint:exhaustruct
+			Name: "docker-config",
+			Secret: &secretVolume{ //nolint:exhaustruct
+				SecretName: r.opts.RegistrySecret,
+				Items:      []keyToPathRef{{Key: ".dockerconfigjson", Path: "config.json"}},
+			},
+		})
+	}
+
+	return p
+}
+
+// waitPhase polls a pod until it reaches one of phases.
+func (r *Repo) waitPhase(ctx context.Context, name string, phases ...string) (pod, error) {
+	for {
+		var p pod
+		if err := r.client.do(ctx, http.MethodGet, r.client.path("pods", name), nil, nil, &p); err != nil {
+			return pod{}, fmt.Errorf("failed to read pod: %w", err) //nolint:exhaustruct
+		}
+
+		if slices.Contains(phases, p.Status.Phase) {
+			return p, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return pod{}, ctx.Err() //nolint:exhaustruct
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// apiError is the Status object the api server answers failed requests with.
+type apiError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("kubernetes: %s (%d %s)", e.Message, e.Code, e.Reason)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *apiError
+
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+func isConflict(err error) bool {
+	var apiErr *apiError
+
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
+
+// apiClient sends the requests of the repo to the api server. It is
+// implemented by client and replaced by an in-memory api server in tests.
+type apiClient interface {
+	// path returns the api path of a namespaced core resource, name may be
+	// empty.
+	path(resource, name string) string
+	// metricsPath returns the api path of the metrics of a pod.
+	metricsPath(name string) string
+	do(ctx context.Context, method, path string, query url.Values, body, out any) error
+	patch(ctx context.Context, path string, body any) error
+	stream(ctx context.Context, path string, query url.Values) (io.ReadCloser, error)
+	dial(ctx context.Context, path string, query url.Values, subprotocol string) (*websocket.Conn, error)
+}
+
+// client is a minimal client of the core and metrics apis. It authenticates
+// with a service account token that is read on every request, the kubelet
+// rotates it.
+type client struct {
+	http      *http.Client
+	tlsConfig *tls.Config
+	apiURL    string
+	tokenFile string
+	namespace string
+}
+
+func newClient(apiURL, tokenFile, caFile, namespace string) (*client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12} //nolint:exhaustruct
+
+	if caFile != "" {
+		ca, err := os.ReadFile(caFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read ca: %w", err)
+		}
+
+		if len(ca) > 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificates found in %s", caFile) //nolint:err113
+			}
+
+			tlsConfig.RootCAs = pool
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.TLSClientConfig = tlsConfig
+
+	return &client{
+		http:      &http.Client{Transport: transport}, //nolint:exhaustruct
+		tlsConfig: tlsConfig,
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		tokenFile: tokenFile,
+		namespace: namespace,
+	}, nil
+}
+
+// path returns the api path of a namespaced core resource, name may be empty.
+func (c *client) path(resource, name string) string {
+	p := "/api/v1/namespaces/" + c.namespace + "/" + resource
+	if name != "" {
+		p += "/" + name
+	}
+
+	return p
+}
+
+func (c *client) metricsPath(name string) string {
+	return "/apis/metrics.k8s.io/v1beta1/namespaces/" + c.namespace + "/pods/" + name
+}
+
+func (c *client) header() (http.Header, error) {
+	h := http.Header{}
+
+	if c.tokenFile == "" {
+		return h, nil
+	}
+
+	token, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token: %w", err)
+	}
+
+	h.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	return h, nil
+}
+
+func (c *client) request(
+	ctx context.Context,
+	method, path string,
+	query url.Values,
+	body any,
+	contentType string,
+) (*http.Response, error) {
+	var r io.Reader
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	u := c.apiURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := c.header()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = header
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		apiErr := &apiError{Code: resp.StatusCode, Reason: resp.Status, Message: method + " " + path}
+		_ = json.NewDecoder(resp.Body).Decode(apiErr)
+
+		return nil, apiErr
+	}
+
+	return resp, nil
+}
+
+// do sends a JSON request and decodes the response into out, if not nil.
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resp, err := c.request(ctx, method, path, query, body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// patch applies a JSON merge patch.
+func (c *client) patch(ctx context.Context, path string, body any) error {
+	resp, err := c.request(ctx, http.MethodPatch, path, nil, body, "application/merge-patch+json")
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// stream returns the body of a GET request, e.g. followed logs.
+func (c *client) stream(ctx context.Context, path string, query url.Values) (io.ReadCloser, error) {
+	resp, err := c.request(ctx, http.MethodGet, path, query, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// dial opens a websocket, e.g. to the exec subresource of a pod.
+func (c *client) dial(ctx context.Context, path string, query url.Values, subprotocol string) (*websocket.Conn, error) {
+	u := "ws" + strings.TrimPrefix(c.apiURL, "http") + path + "?" + query.Encode()
+
+	header, err := c.header()
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := websocket.Dialer{ //nolint:exhaustruct
+		TLSClientConfig:  c.tlsConfig,
+		Subprotocols:     []string{subprotocol},
+		HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout,
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, u, header)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	return conn, err
+}
@@ -0,0 +1,102 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newClient(srv.URL+"/", tokenFile, "", testNamespace)
+	if err != nil {
+		t.Fatalf("newClient: %v", err)
+	}
+
+	return c
+}
+
+func TestClientDo(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if r.URL.Path != "/api/v1/namespaces/test/pods/cd-a" || r.URL.Query().Get("gracePeriodSeconds") != "5" {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(pod{object: meta("Pod", "cd-a", nil)}) //nolint:exhaustruct
+	})
+
+	var p pod
+
+	query := url.Values{"gracePeriodSeconds": {"5"}}
+	if err := c.do(context.Background(), http.MethodGet, c.path("pods", "cd-a"), query, nil, &p); err != nil {
+		t.Fatalf("do: %v", err)
+	}
+
+	if p.Metadata.Name != "cd-a" {
+		t.Errorf("name = %q", p.Metadata.Name)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":404,"reason":"NotFound","message":"pods \"cd-a\" not found"}`))
+		case http.MethodPost:
+			w.WriteHeader(http.StatusConflict)
+		}
+	})
+
+	err := c.do(context.Background(), http.MethodGet, c.path("pods", "cd-a"), nil, nil, nil)
+	if !isNotFound(err) || isConflict(err) {
+		t.Errorf("get = %v", err)
+	}
+
+	if err.Error() != `kubernetes: pods "cd-a" not found (404 NotFound)` {
+		t.Errorf("message = %q", err.Error())
+	}
+
+	err = c.do(context.Background(), http.MethodPost, c.path("pods", ""), nil, pod{}, nil) //nolint:exhaustruct
+	if !isConflict(err) || isNotFound(err) {
+		t.Errorf("post = %v", err)
+	}
+}
+
+func TestClientPatch(t *testing.T) {
+	var contentType string
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+	})
+
+	if err := c.patch(context.Background(), c.path("services", "cd-a"), service{}); err != nil { //nolint:exhaustruct
+		t.Fatalf("patch: %v", err)
+	}
+
+	if contentType != "application/merge-patch+json" {
+		t.Errorf("content type = %q", contentType)
+	}
+}
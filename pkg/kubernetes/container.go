@@ -0,0 +1,654 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/utils"
+)
+
+const (
+	labelManagedBy = "app.kubernetes.io/managed-by"
+	labelWorkspace = "cerodev.io/workspace"
+	labelPart      = "cerodev.io/part"
+	managedBy      = "cerodev"
+
+	partSpec      = "spec"
+	partGit       = "git"
+	partWorkspace = "workspace"
+	partBuild     = "build"
+
+	// workspaceContainer is the name of the container in a workspace pod.
+	workspaceContainer = "workspace"
+	workspaceMount     = "/home/coder/workspace"
+	specKey            = "workspace.json"
+	// coderGID owns the mounted volumes, it is the group of the coder user of
+	// the workspace images.
+	coderGID = 1000
+	// gitFileMode is group readable, ssh accepts keys owned by root that are
+	// readable through the group.
+	gitFileMode = 0o440
+
+	stopGracePeriod = 10
+	stopTimeout     = 30 * time.Second
+	pollInterval    = 500 * time.Millisecond
+	cpuPeriod       = 100000
+)
+
+// workspace is the spec of a workspace kept in its spec secret. The pod is
+// created from it on every start. It is a secret, the env may hold resolved
+// secrets.
+type workspace struct {
+	ContainerID   string               `json:"container_id"`
+	ContainerName string               `json:"container_name"`
+	UserID        string               `json:"user_id"`
+	ImageName     string               `json:"image_name"`
+	EnvVars       []string             `json:"env_vars"`
+	Ports         []string             `json:"ports"`
+	Limits        model.ResourceLimits `json:"limits"`
+	// Published are the ports published after the creation. They are kept
+	// apart from Ports, which are the ports the workspace was created with.
+	Published []string `json:"published,omitempty"`
+}
+
+// errNoSuchContainer reports a workspace unknown to the cluster. The services
+// recognise missing containers by the message docker uses.
+func errNoSuchContainer(name string) error {
+	return fmt.Errorf("No such container: %s", name) //nolint:err113,stylecheck
+}
+
+// resourceName derives the name of all objects of a workspace from its id,
+// ulids are valid dns labels once lowercased.
+func resourceName(containerID string) string {
+	return "cd-" + strings.ToLower(containerID)
+}
+
+func labels(name, part string) map[string]string {
+	return map[string]string{
+		labelManagedBy: managedBy,
+		labelWorkspace: name,
+		labelPart:      part,
+	}
+}
+
+func selector(part string) url.Values {
+	return url.Values{"labelSelector": {labelManagedBy + "=" + managedBy + "," + labelPart + "=" + part}}
+}
+
+func meta(kind, name string, l map[string]string) object {
+	return object{
+		APIVersion: "v1",
+		Kind:       kind,
+		Metadata:   objectMeta{Name: name, Labels: l}, //nolint:exhaustruct
+	}
+}
+
+func (r *Repo) create(ctx context.Context, mc *model.Container) (string, error) {
+	name := resourceName(mc.ID)
+	ws := workspace{
+		ContainerID:   mc.ID,
+		ContainerName: mc.ContainerName,
+		UserID:        mc.UserID,
+		ImageName:     mc.ImageName,
+		EnvVars:       mc.EnvVars,
+		Ports:         mc.Ports,
+		Limits:        mc.Limits,
+	}
+
+	if err := r.saveWorkspace(ctx, name, ws); err != nil {
+		return "", err
+	}
+
+	claim := persistentVolumeClaim{
+		object: meta("PersistentVolumeClaim", name, labels(name, partWorkspace)),
+		Spec: pvcSpec{
+			AccessModes: []string{"ReadWriteOnce"},
+			Resources:   resourceLimit{Requests: map[string]string{"storage": r.opts.VolumeSize}}, //nolint:exhaustruct
+		},
+	}
+
+	if r.opts.StorageClass != "" {
+		claim.Spec.StorageClassName = &r.opts.StorageClass
+	}
+
+	// a recreated workspace keeps its volume
+	err := r.client.do(ctx, http.MethodPost, r.client.path("persistentvolumeclaims", ""), nil, claim, nil)
+	if err != nil && !isConflict(err) {
+		return "", fmt.Errorf("failed to create volume claim: %w", err)
+	}
+
+	if err := r.saveService(ctx, name, ws.Ports); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// saveService exposes the ports of a workspace as node ports. The host port
+// allocated from CD_CONTAINER_PORT_RANGE becomes the node port.
+func (r *Repo) saveService(ctx context.Context, name string, ports []string) error {
+	svc := service{
+		object: meta("Service", name, labels(name, partWorkspace)),
+		Spec: serviceSpec{
+			Type:     "NodePort",
+			Selector: labels(name, partWorkspace),
+			Ports:    []servicePort{},
+		},
+	}
+
+	for _, p := range ports {
+		hostPort, target, _ := strings.Cut(p, ":")
+		portNumber, protocol, _ := strings.Cut(target, "/")
+
+		targetPort, err := strconv.Atoi(portNumber)
+		if err != nil {
+			return fmt.Errorf("invalid port %q: %w", p, err)
+		}
+
+		nodePort, err := strconv.Atoi(hostPort)
+		if err != nil {
+			return fmt.Errorf("invalid port %q: %w", p, err)
+		}
+
+		svc.Spec.Ports = append(svc.Spec.Ports, servicePort{
+			Name:       "port-" + portNumber,
+			Protocol:   protocolName(protocol),
+			Port:       targetPort,
+			TargetPort: targetPort,
+			NodePort:   nodePort,
+		})
+	}
+
+	if len(svc.Spec.Ports) == 0 {
+		return r.deleteObject(ctx, "services", name)
+	}
+
+	err := r.client.do(ctx, http.MethodPost, r.client.path("services", ""), nil, svc, nil)
+	if isConflict(err) {
+		err = r.client.patch(ctx, r.client.path("services", name), svc)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to save service: %w", err)
+	}
+
+	return nil
+}
+
+// publishPort adds a node port to the service of a workspace. It is kept in
+// the spec, the service outlives the pod.
+func (r *Repo) publishPort(ctx context.Context, name string, hostPort, port int) error {
+	ws, err := r.workspace(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	p := strconv.Itoa(hostPort) + ":" + strconv.Itoa(port) + "/tcp"
+	if slices.Contains(ws.Published, p) {
+		return nil
+	}
+
+	ws.Published = append(ws.Published, p)
+
+	if err := r.saveWorkspace(ctx, name, ws); err != nil {
+		return err
+	}
+
+	return r.saveService(ctx, name, slices.Concat(ws.Ports, ws.Published))
+}
+
+func (r *Repo) unpublishPort(ctx context.Context, name string, hostPort int) error {
+	ws, err := r.workspace(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	ws.Published = slices.DeleteFunc(ws.Published, func(p string) bool {
+		return strings.HasPrefix(p, strconv.Itoa(hostPort)+":")
+	})
+
+	if err := r.saveWorkspace(ctx, name, ws); err != nil {
+		return err
+	}
+
+	return r.saveService(ctx, name, slices.Concat(ws.Ports, ws.Published))
+}
+
+func protocolName(protocol string) string {
+	if protocol == "" {
+		return "TCP"
+	}
+
+	return strings.ToUpper(protocol)
+}
+
+func (r *Repo) start(ctx context.Context, name string) error {
+	ws, err := r.workspace(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var existing pod
+
+	err = r.client.do(ctx, http.MethodGet, r.client.path("pods", name), nil, nil, &existing)
+
+	switch {
+	case isNotFound(err):
+	case err != nil:
+		return fmt.Errorf("failed to read pod: %w", err)
+	case existing.Metadata.DeletionTimestamp == nil &&
+		(existing.Status.Phase == "Pending" || existing.Status.Phase == "Running"):
+		return nil
+	default:
+		// pods cannot be restarted, a stopped or stopping one is replaced
+		if err := r.deletePod(ctx, name, 0); err != nil {
+			return err
+		}
+	}
+
+	if err := r.syncGitSecret(ctx, name, ws.ContainerID); err != nil {
+		return err
+	}
+
+	if err := r.client.do(ctx, http.MethodPost, r.client.path("pods", ""), nil, r.workspacePod(name, ws), nil); err != nil {
+		return fmt.Errorf("failed to create pod: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Repo) workspacePod(name string, ws workspace) pod {
+	fsGroup := int64(coderGID)
+	gitMode := int32(gitFileMode)
+
+	c := podContainer{ //nolint:exhaustruct
+		Name:      workspaceContainer,
+		Image:     r.imageRef(ws.ImageName),
+		Env:       []envVar{},
+		Ports:     []containerPort{},
+		Resources: podResources(ws.Limits),
+		VolumeMounts: []volumeMount{
+			{Name: "workspace", MountPath: workspaceMount}, //nolint:exhaustruct
+			{Name: "git", MountPath: utils.GitCredentialsMount, ReadOnly: true},
+		},
+	}
+
+	for _, e := range ws.EnvVars {
+		key, value, _ := strings.Cut(e, "=")
+		c.Env = append(c.Env, envVar{Name: key, Value: value})
+	}
+
+	for _, p := range ws.Ports {
+		_, target, _ := strings.Cut(p, ":")
+		portNumber, protocol, _ := strings.Cut(target, "/")
+
+		if n, err := strconv.Atoi(portNumber); err == nil {
+			c.Ports = append(c.Ports, containerPort{ContainerPort: n, Protocol: protocolName(protocol)})
+		}
+	}
+
+	p := pod{ //nolint:exhaustruct
+		object: meta("Pod", name, labels(name, partWorkspace)),
+		Spec: podSpec{
+			RestartPolicy:   "Never",
+			SecurityContext: &podSecurityContext{FSGroup: &fsGroup},
+			Containers:      []podContainer{c},
+			Volumes: []volume{
+				{Name: "workspace", PersistentVolumeClaim: &pvcVolumeSource{ClaimName: name}}, //nolint:exhaustruct
+				{Name: "git", Secret: &secretVolume{ //nolint:exhaustruct
+					SecretName:  name + "-" + partGit,
+					DefaultMode: &gitMode,
+					Optional:    true,
+				}},
+			},
+		},
+	}
+
+	if r.opts.RegistrySecret != "" {
+		p.Spec.ImagePullSecrets = []localObjectRef{{Name: r.opts.RegistrySecret}}
+	}
+
+	return p
+}
+
+// podResources converts limits into pod resources. Swap and pids limits are
+// set per node in kubernetes and are ignored.
+func podResources(limits model.ResourceLimits) resourceLimit {
+	res := resourceLimit{Limits: map[string]string{}} //nolint:exhaustruct
+
+	if limits.CPUQuota > 0 {
+		res.Limits["cpu"] = strconv.FormatInt(max(limits.CPUQuota*1000/cpuPeriod, 1), 10) + "m"
+	}
+
+	if limits.Memory > 0 {
+		res.Limits["memory"] = strconv.FormatInt(limits.Memory, 10)
+	}
+
+	return res
+}
+
+// syncGitSecret copies the git credential files written by cerodev into the
+// secret mounted at utils.GitCredentialsMount.
+func (r *Repo) syncGitSecret(ctx context.Context, name, containerID string) error {
+	dir := utils.GitCredentialsDir(r.volumesPath, containerID)
+	data := map[string][]byte{}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read git credentials: %w", err)
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read git credentials: %w", err)
+		}
+
+		data[e.Name()] = b
+	}
+
+	s := secret{object: meta("Secret", name+"-"+partGit, labels(name, partGit)), Type: "Opaque", Data: data}
+
+	return r.saveSecret(ctx, s)
+}
+
+// saveSecret creates a secret or replaces an existing one.
+func (r *Repo) saveSecret(ctx context.Context, s secret) error {
+	err := r.client.do(ctx, http.MethodPost, r.client.path("secrets", ""), nil, s, nil)
+	if isConflict(err) {
+		err = r.client.do(ctx, http.MethodPut, r.client.path("secrets", s.Metadata.Name), nil, s, nil)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to save secret %s: %w", s.Metadata.Name, err)
+	}
+
+	return nil
+}
+
+func (r *Repo) saveWorkspace(ctx context.Context, name string, ws workspace) error {
+	b, err := json.Marshal(ws)
+	if err != nil {
+		return err
+	}
+
+	return r.saveSecret(ctx, secret{
+		object: meta("Secret", name+"-"+partSpec, labels(name, partSpec)),
+		Type:   "Opaque",
+		Data:   map[string][]byte{specKey: b},
+	})
+}
+
+func (r *Repo) workspace(ctx context.Context, name string) (workspace, error) {
+	var s secret
+
+	err := r.client.do(ctx, http.MethodGet, r.client.path("secrets", name+"-"+partSpec), nil, nil, &s)
+	if isNotFound(err) {
+		return workspace{}, errNoSuchContainer(name) //nolint:exhaustruct
+	}
+
+	if err != nil {
+		return workspace{}, fmt.Errorf("failed to read workspace: %w", err) //nolint:exhaustruct
+	}
+
+	return decodeWorkspace(s)
+}
+
+func decodeWorkspace(s secret) (workspace, error) {
+	var ws workspace
+	if err := json.Unmarshal(s.Data[specKey], &ws); err != nil {
+		return workspace{}, fmt.Errorf("invalid workspace %s: %w", s.Metadata.Name, err) //nolint:exhaustruct
+	}
+
+	return ws, nil
+}
+
+func (r *Repo) updateLimits(ctx context.Context, name string, limits model.ResourceLimits) error {
+	ws, err := r.workspace(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	ws.Limits = limits
+
+	return r.saveWorkspace(ctx, name, ws)
+}
+
+// stop deletes the pod of a workspace and waits until it is gone.
+func (r *Repo) stop(ctx context.Context, name string) error {
+	if _, err := r.workspace(ctx, name); err != nil {
+		return err
+	}
+
+	return r.deletePod(ctx, name, stopGracePeriod)
+}
+
+func (r *Repo) deletePod(ctx context.Context, name string, gracePeriod int) error {
+	path := r.client.path("pods", name)
+	query := url.Values{"gracePeriodSeconds": {strconv.Itoa(gracePeriod)}}
+
+	if err := r.client.do(ctx, http.MethodDelete, path, query, nil, nil); err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+
+		return fmt.Errorf("failed to delete pod: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, stopTimeout)
+	defer cancel()
+
+	for {
+		err := r.client.do(ctx, http.MethodGet, path, nil, nil, nil)
+		if isNotFound(err) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("pod %s did not stop: %w", name, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// delete removes a workspace including its volume.
+func (r *Repo) delete(ctx context.Context, name string) error {
+	if err := r.deletePod(ctx, name, 0); err != nil {
+		return err
+	}
+
+	for _, o := range []struct{ resource, name string }{
+		{"services", name},
+		{"persistentvolumeclaims", name},
+		{"secrets", name + "-" + partGit},
+		{"secrets", name + "-" + partSpec},
+	} {
+		if err := r.deleteObject(ctx, o.resource, o.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Repo) deleteObject(ctx context.Context, resource, name string) error {
+	err := r.client.do(ctx, http.MethodDelete, r.client.path(resource, name), nil, nil, nil)
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("failed to delete %s %s: %w", resource, name, err)
+	}
+
+	return nil
+}
+
+func (r *Repo) podIP(ctx context.Context, name string) (string, error) {
+	var p pod
+
+	err := r.client.do(ctx, http.MethodGet, r.client.path("pods", name), nil, nil, &p)
+	if isNotFound(err) {
+		return "", errNoSuchContainer(name)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read pod: %w", err)
+	}
+
+	if p.Status.PodIP == "" {
+		return "", fmt.Errorf("pod %s has no ip address", name) //nolint:err113
+	}
+
+	return p.Status.PodIP, nil
+}
+
+// managed returns the specs of all workspaces and their pods by name.
+func (r *Repo) managed(ctx context.Context) (map[string]workspace, map[string]*pod, error) {
+	var specs secretList
+	if err := r.client.do(ctx, http.MethodGet, r.client.path("secrets", ""), selector(partSpec), nil, &specs); err != nil {
+		return nil, nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+
+	var pods podList
+	if err := r.client.do(ctx, http.MethodGet, r.client.path("pods", ""), selector(partWorkspace), nil, &pods); err != nil {
+		return nil, nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	workspaces := map[string]workspace{}
+
+	for _, s := range specs.Items {
+		ws, err := decodeWorkspace(s)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		workspaces[s.Metadata.Labels[labelWorkspace]] = ws
+	}
+
+	podsByName := map[string]*pod{}
+	for i := range pods.Items {
+		podsByName[pods.Items[i].Metadata.Name] = &pods.Items[i]
+	}
+
+	return workspaces, podsByName, nil
+}
+
+func (r *Repo) statuses(ctx context.Context, names []string) ([]model.ContainerStatus, error) {
+	workspaces, pods, err := r.managed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []model.ContainerStatus{}
+
+	for _, name := range names {
+		if _, ok := workspaces[name]; !ok {
+			continue
+		}
+
+		state, status := podState(pods[name])
+		statuses = append(statuses, model.ContainerStatus{
+			DockerID: name,
+			Status:   status,
+			State:    state,
+		})
+	}
+
+	return statuses, nil
+}
+
+// podState maps a pod to the docker container states the services know. A
+// workspace without pod is stopped.
+func podState(p *pod) (string, string) {
+	switch {
+	case p == nil:
+		return "exited", "Exited"
+	case p.Metadata.DeletionTimestamp != nil:
+		return "removing", "Stopping"
+	}
+
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Name != workspaceContainer {
+			continue
+		}
+
+		switch {
+		case cs.State.Running != nil:
+			return "running", "Up since " + cs.State.Running.StartedAt.Format(time.RFC3339)
+		case cs.State.Terminated != nil:
+			return "exited", fmt.Sprintf("Exited (%d) %s", cs.State.Terminated.ExitCode, cs.State.Terminated.Reason)
+		case cs.State.Waiting != nil:
+			return "created", cs.State.Waiting.Reason
+		}
+	}
+
+	return "created", p.Status.Phase
+}
+
+func (r *Repo) listManaged(ctx context.Context) ([]model.ProviderContainer, error) {
+	workspaces, pods, err := r.managed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	managed := []model.ProviderContainer{}
+
+	for name, ws := range workspaces {
+		state, status := podState(pods[name])
+		managed = append(managed, model.ProviderContainer{ //nolint:exhaustruct
+			DockerID:      name,
+			ContainerName: ws.ContainerName,
+			ImageName:     ws.ImageName,
+			Status:        status,
+			State:         state,
+		})
+	}
+
+	return managed, nil
+}
+
+func (r *Repo) inspectManaged(ctx context.Context, name string) (model.ProviderContainer, error) {
+	ws, err := r.workspace(ctx, name)
+	if err != nil {
+		return model.ProviderContainer{}, err //nolint:exhaustruct
+	}
+
+	var p *pod
+
+	var existing pod
+
+	err = r.client.do(ctx, http.MethodGet, r.client.path("pods", name), nil, nil, &existing)
+
+	switch {
+	case err == nil:
+		p = &existing
+	case !isNotFound(err):
+		return model.ProviderContainer{}, fmt.Errorf("failed to read pod: %w", err) //nolint:exhaustruct
+	}
+
+	state, status := podState(p)
+
+	return model.ProviderContainer{
+		DockerID:      name,
+		ContainerName: ws.ContainerName,
+		ImageName:     ws.ImageName,
+		Status:        status,
+		State:         state,
+		EnvVars:       ws.EnvVars,
+		Ports:         ws.Ports,
+		Limits:        ws.Limits,
+	}, nil
+}
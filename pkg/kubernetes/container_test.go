@@ -0,0 +1,383 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaibling/cerodev/model"
+)
+
+const testContainerID = "01JTESTCONTAINER0000000000"
+
+func testContainer() *model.Container {
+	return &model.Container{ //nolint:exhaustruct
+		ID:            testContainerID,
+		ContainerName: "cd-test",
+		UserID:        "01JTESTUSER",
+		ImageName:     "cd-go:v1",
+		EnvVars:       []string{"FOO=bar"},
+		Ports:         []string{"30001:8080"},
+		Limits:        model.ResourceLimits{CPUQuota: 50000, Memory: 1 << 30}, //nolint:exhaustruct
+	}
+}
+
+func createTestContainer(t *testing.T, r *Repo) string {
+	t.Helper()
+
+	name, err := r.CreateContainer(context.Background(), testContainer())
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+
+	return name
+}
+
+func TestCreateContainer(t *testing.T) {
+	r, api := newTestRepo(t, Options{StorageClass: "fast"}) //nolint:exhaustruct
+
+	name := createTestContainer(t, r)
+	if name != "cd-"+strings.ToLower(testContainerID) {
+		t.Fatalf("name = %q", name)
+	}
+
+	ws, err := r.workspace(context.Background(), name)
+	if err != nil {
+		t.Fatalf("workspace: %v", err)
+	}
+
+	if ws.ContainerID != testContainerID || ws.ImageName != "cd-go:v1" || len(ws.Ports) != 1 {
+		t.Errorf("workspace = %+v", ws)
+	}
+
+	var claim persistentVolumeClaim
+	api.get(t, "persistentvolumeclaims", name, &claim)
+
+	if claim.Spec.Resources.Requests["storage"] != defaultVolumeSize {
+		t.Errorf("storage = %q", claim.Spec.Resources.Requests["storage"])
+	}
+
+	if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName != "fast" {
+		t.Errorf("storage class = %v", claim.Spec.StorageClassName)
+	}
+
+	var svc service
+	api.get(t, "services", name, &svc)
+
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].NodePort != 30001 || svc.Spec.Ports[0].TargetPort != 8080 {
+		t.Errorf("service ports = %+v", svc.Spec.Ports)
+	}
+
+	if svc.Spec.Selector[labelWorkspace] != name {
+		t.Errorf("service selector = %v", svc.Spec.Selector)
+	}
+
+	// a recreated workspace keeps its volume
+	if _, err := r.CreateContainer(context.Background(), testContainer()); err != nil {
+		t.Fatalf("CreateContainer again: %v", err)
+	}
+}
+
+func TestCreateContainerWithoutPorts(t *testing.T) {
+	r, api := newTestRepo(t, Options{}) //nolint:exhaustruct
+
+	c := testContainer()
+	c.Ports = nil
+
+	name, err := r.CreateContainer(context.Background(), c)
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+
+	if api.exists(t, "services", name) {
+		t.Error("service created for a workspace without ports")
+	}
+}
+
+func TestStartStopContainer(t *testing.T) {
+	ctx := context.Background()
+	r, api := newTestRepo(t, Options{Registry: "registry:5000", RegistrySecret: "pull"}) //nolint:exhaustruct
+	name := createTestContainer(t, r)
+
+	if err := r.StartContainer(ctx, name); err != nil {
+		t.Fatalf("StartContainer: %v", err)
+	}
+
+	var p pod
+	api.get(t, "pods", name, &p)
+
+	c := p.Spec.Containers[0]
+	if c.Image != "registry:5000/cd-go:v1" {
+		t.Errorf("image = %q", c.Image)
+	}
+
+	if c.Resources.Limits["cpu"] != "500m" || c.Resources.Limits["memory"] != "1073741824" {
+		t.Errorf("limits = %v", c.Resources.Limits)
+	}
+
+	if len(c.Env) != 1 || c.Env[0].Name != "FOO" || c.Env[0].Value != "bar" {
+		t.Errorf("env = %+v", c.Env)
+	}
+
+	if p.Spec.Volumes[0].PersistentVolumeClaim.ClaimName != name {
+		t.Errorf("volumes = %+v", p.Spec.Volumes)
+	}
+
+	if len(p.Spec.ImagePullSecrets) != 1 || p.Spec.ImagePullSecrets[0].Name != "pull" {
+		t.Errorf("pull secrets = %+v", p.Spec.ImagePullSecrets)
+	}
+
+	if !api.exists(t, "secrets", name+"-"+partGit) {
+		t.Error("git secret not created")
+	}
+
+	// a pending pod is kept
+	api.setPodStatus(t, name, podStatus{Phase: "Pending"}) //nolint:exhaustruct
+
+	if err := r.StartContainer(ctx, name); err != nil {
+		t.Fatalf("StartContainer again: %v", err)
+	}
+
+	p = pod{} //nolint:exhaustruct
+	api.get(t, "pods", name, &p)
+
+	if p.Status.Phase != "Pending" {
+		t.Error("pending pod was replaced")
+	}
+
+	// a finished pod is replaced
+	api.setPodStatus(t, name, podStatus{Phase: "Succeeded"}) //nolint:exhaustruct
+
+	if err := r.StartContainer(ctx, name); err != nil {
+		t.Fatalf("StartContainer after exit: %v", err)
+	}
+
+	p = pod{} //nolint:exhaustruct
+	api.get(t, "pods", name, &p)
+
+	if p.Status.Phase != "" {
+		t.Error("finished pod was not replaced")
+	}
+
+	if err := r.StopContainer(ctx, name); err != nil {
+		t.Fatalf("StopContainer: %v", err)
+	}
+
+	if api.exists(t, "pods", name) {
+		t.Error("pod not deleted")
+	}
+
+	if !api.exists(t, "persistentvolumeclaims", name) {
+		t.Error("volume deleted on stop")
+	}
+
+	// stopping a stopped workspace succeeds
+	if err := r.StopContainer(ctx, name); err != nil {
+		t.Fatalf("StopContainer again: %v", err)
+	}
+}
+
+func TestStartUnknownContainer(t *testing.T) {
+	r, _ := newTestRepo(t, Options{}) //nolint:exhaustruct
+
+	err := r.StartContainer(context.Background(), "cd-missing")
+	if err == nil || !strings.Contains(err.Error(), "No such container") {
+		t.Fatalf("StartContainer = %v", err)
+	}
+}
+
+func TestDeleteContainer(t *testing.T) {
+	ctx := context.Background()
+	r, api := newTestRepo(t, Options{}) //nolint:exhaustruct
+	name := createTestContainer(t, r)
+
+	if err := r.StartContainer(ctx, name); err != nil {
+		t.Fatalf("StartContainer: %v", err)
+	}
+
+	if err := r.DeleteContainer(ctx, name); err != nil {
+		t.Fatalf("DeleteContainer: %v", err)
+	}
+
+	for _, o := range []struct{ resource, name string }{
+		{"pods", name},
+		{"services", name},
+		{"persistentvolumeclaims", name},
+		{"secrets", name + "-" + partGit},
+		{"secrets", name + "-" + partSpec},
+	} {
+		if api.exists(t, o.resource, o.name) {
+			t.Errorf("%s %s not deleted", o.resource, o.name)
+		}
+	}
+
+	// deleting a deleted workspace succeeds
+	if err := r.DeleteContainer(ctx, name); err != nil {
+		t.Fatalf("DeleteContainer again: %v", err)
+	}
+}
+
+func TestGetContainerStatuses(t *testing.T) {
+	ctx := context.Background()
+	r, api := newTestRepo(t, Options{}) //nolint:exhaustruct
+	name := createTestContainer(t, r)
+
+	now := time.Now()
+	running := decodeState(t, `{"running":{"startedAt":"2025-01-02T03:04:05Z"}}`)
+	terminated := decodeState(t, `{"terminated":{"exitCode":137,"reason":"OOMKilled"}}`)
+	waiting := decodeState(t, `{"waiting":{"reason":"ImagePullBackOff"}}`)
+
+	tests := []struct {
+		name     string
+		pod      bool
+		status   podStatus
+		deleting bool
+		state    string
+		detail   string
+	}{
+		{name: "no pod", state: "exited", detail: "Exited"},
+		{name: "scheduling", pod: true, status: podStatus{Phase: "Pending"}, state: "created", detail: "Pending"},
+		{
+			name:   "running",
+			pod:    true,
+			status: podStatus{Phase: "Running", ContainerStatuses: []containerStatus{{Name: workspaceContainer, State: running}}},
+			state:  "running",
+			detail: "Up since 2025-01-02T03:04:05Z",
+		},
+		{
+			name:   "terminated",
+			pod:    true,
+			status: podStatus{Phase: "Failed", ContainerStatuses: []containerStatus{{Name: workspaceContainer, State: terminated}}},
+			state:  "exited",
+			detail: "Exited (137) OOMKilled",
+		},
+		{
+			name:   "waiting",
+			pod:    true,
+			status: podStatus{Phase: "Pending", ContainerStatuses: []containerStatus{{Name: workspaceContainer, State: waiting}}},
+			state:  "created",
+			detail: "ImagePullBackOff",
+		},
+		{name: "stopping", pod: true, deleting: true, state: "removing", detail: "Stopping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.deleteObject(ctx, "pods", name); err != nil {
+				t.Fatalf("delete pod: %v", err)
+			}
+
+			if tt.pod {
+				p := r.workspacePod(name, workspace{}) //nolint:exhaustruct
+				p.Status = tt.status
+
+				if tt.deleting {
+					p.Metadata.DeletionTimestamp = &now
+				}
+
+				if err := api.do(ctx, http.MethodPost, api.path("pods", ""), nil, p, nil); err != nil {
+					t.Fatalf("create pod: %v", err)
+				}
+			}
+
+			statuses, err := r.GetContainerStatuses(ctx, []string{name, "cd-unknown"})
+			if err != nil {
+				t.Fatalf("GetContainerStatuses: %v", err)
+			}
+
+			if len(statuses) != 1 {
+				t.Fatalf("statuses = %+v", statuses)
+			}
+
+			if statuses[0].DockerID != name || statuses[0].State != tt.state || statuses[0].Status != tt.detail {
+				t.Errorf("status = %+v, want %s %q", statuses[0], tt.state, tt.detail)
+			}
+		})
+	}
+}
+
+// decodeState builds a container state the way the api server reports it.
+func decodeState(t *testing.T, state string) containerState {
+	t.Helper()
+
+	var cs containerState
+	if err := json.Unmarshal([]byte(state), &cs); err != nil {
+		t.Fatalf("decode state: %v", err)
+	}
+
+	return cs
+}
+
+func TestGetContainerIP(t *testing.T) {
+	ctx := context.Background()
+	r, api := newTestRepo(t, Options{}) //nolint:exhaustruct
+	name := createTestContainer(t, r)
+
+	if _, err := r.GetContainerIP(ctx, name); err == nil || !strings.Contains(err.Error(), "No such container") {
+		t.Fatalf("GetContainerIP of a stopped workspace = %v", err)
+	}
+
+	if err := r.StartContainer(ctx, name); err != nil {
+		t.Fatalf("StartContainer: %v", err)
+	}
+
+	if _, err := r.GetContainerIP(ctx, name); err == nil {
+		t.Fatal("GetContainerIP of an unscheduled pod succeeded")
+	}
+
+	api.setPodStatus(t, name, podStatus{Phase: "Running", PodIP: "10.0.0.7"}) //nolint:exhaustruct
+
+	ip, err := r.GetContainerIP(ctx, name)
+	if err != nil || ip != "10.0.0.7" {
+		t.Fatalf("GetContainerIP = %q, %v", ip, err)
+	}
+}
+
+func TestPublishPort(t *testing.T) {
+	ctx := context.Background()
+	r, api := newTestRepo(t, Options{}) //nolint:exhaustruct
+
+	c := testContainer()
+	c.Ports = nil
+
+	name, err := r.CreateContainer(ctx, c)
+	if err != nil {
+		t.Fatalf("CreateContainer: %v", err)
+	}
+
+	if err := r.PublishPort(ctx, name, 30005, 3000); err != nil {
+		t.Fatalf("PublishPort: %v", err)
+	}
+
+	// publishing twice keeps a single port
+	if err := r.PublishPort(ctx, name, 30005, 3000); err != nil {
+		t.Fatalf("PublishPort again: %v", err)
+	}
+
+	var svc service
+	api.get(t, "services", name, &svc)
+
+	if len(svc.Spec.Ports) != 1 || svc.Spec.Ports[0].NodePort != 30005 || svc.Spec.Ports[0].TargetPort != 3000 {
+		t.Errorf("service ports = %+v", svc.Spec.Ports)
+	}
+
+	if err := r.UnpublishPort(ctx, name, 30005); err != nil {
+		t.Fatalf("UnpublishPort: %v", err)
+	}
+
+	if api.exists(t, "services", name) {
+		t.Error("service without ports not deleted")
+	}
+
+	ws, err := r.workspace(ctx, name)
+	if err != nil {
+		t.Fatalf("workspace: %v", err)
+	}
+
+	if len(ws.Published) != 0 {
+		t.Errorf("published = %v", ws.Published)
+	}
+}
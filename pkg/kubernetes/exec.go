@@ -0,0 +1,185 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/kaibling/cerodev/model"
+)
+
+// channels of the v4.channel.k8s.io exec protocol, every websocket message
+// starts with the channel byte.
+const (
+	execProtocol  = "v4.channel.k8s.io"
+	channelStdin  = 0
+	channelStdout = 1
+	channelStderr = 2
+	channelError  = 3
+	channelResize = 4
+
+	// execTTL drops exec sessions that were never attached.
+	execTTL = 10 * time.Minute
+)
+
+// execSession is an exec created but not necessarily attached yet. The api
+// server runs the command only while it is attached.
+type execSession struct {
+	pod       string
+	cmd       []string
+	started   bool
+	createdAt time.Time
+}
+
+// execRegistry remembers the created exec sessions. It is shared by all repos,
+// a repo is created per request.
+type execRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*execSession
+}
+
+var execs = &execRegistry{sessions: map[string]*execSession{}} //nolint:exhaustruct,gochecknoglobals
+
+func (r *Repo) createExec(ctx context.Context, name string, cmd []string) (string, error) {
+	if _, err := r.podIP(ctx, name); err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 16) //nolint:mnd
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	id := hex.EncodeToString(b)
+
+	execs.mu.Lock()
+	defer execs.mu.Unlock()
+
+	for execID, s := range execs.sessions {
+		if time.Since(s.createdAt) > execTTL {
+			delete(execs.sessions, execID)
+		}
+	}
+
+	execs.sessions[id] = &execSession{pod: name, cmd: cmd, started: false, createdAt: time.Now()}
+
+	return id, nil
+}
+
+func getExec(execID string) (model.ExecSession, error) {
+	execs.mu.Lock()
+	defer execs.mu.Unlock()
+
+	s, ok := execs.sessions[execID]
+	if !ok {
+		return model.ExecSession{}, fmt.Errorf("no such exec instance: %s", execID) //nolint:err113,exhaustruct
+	}
+
+	return model.ExecSession{ //nolint:exhaustruct
+		ID:       execID,
+		DockerID: s.pod,
+		Cmd:      s.cmd,
+		Started:  s.started,
+	}, nil
+}
+
+func (r *Repo) attachExec(ctx context.Context, execID string) (*ExecStream, error) {
+	execs.mu.Lock()
+	s, ok := execs.sessions[execID]
+
+	if ok {
+		s.started = true
+	}
+	execs.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no such exec instance: %s", execID) //nolint:err113
+	}
+
+	query := url.Values{
+		"container": {workspaceContainer},
+		"command":   s.cmd,
+		"stdin":     {"true"},
+		"stdout":    {"true"},
+		"tty":       {"true"},
+	}
+
+	conn, err := r.client.dial(ctx, r.client.path("pods", s.pod)+"/exec", query, execProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach exec: %w", err)
+	}
+
+	return &ExecStream{conn: conn}, nil //nolint:exhaustruct
+}
+
+// ExecStream is an attached TTY exec session.
+type ExecStream struct {
+	conn *websocket.Conn
+	mu   sync.Mutex // websocket writes must not run concurrently
+	buf  []byte
+}
+
+func (s *ExecStream) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return 0, io.EOF
+			}
+
+			return 0, err
+		}
+
+		if len(msg) == 0 {
+			continue
+		}
+
+		switch msg[0] {
+		case channelStdout, channelStderr:
+			s.buf = msg[1:]
+		case channelError:
+			// the exit status of the command, the session is over
+			return 0, io.EOF
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+
+	return n, nil
+}
+
+func (s *ExecStream) Write(p []byte) (int, error) {
+	if err := s.write(channelStdin, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (s *ExecStream) Close() error {
+	return s.conn.Close()
+}
+
+func (s *ExecStream) Resize(height, width uint) error {
+	b, err := json.Marshal(map[string]uint{"Width": width, "Height": height})
+	if err != nil {
+		return err
+	}
+
+	return s.write(channelResize, b)
+}
+
+func (s *ExecStream) write(channel byte, p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.conn.WriteMessage(websocket.BinaryMessage, append([]byte{channel}, p...))
+}
@@ -0,0 +1,198 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kaibling/cerodev/model"
+)
+
+// manifestTypes are accepted when reading the digest of an image.
+var manifestTypes = []string{ //nolint:gochecknoglobals
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// imageRef returns the reference nodes pull an image by.
+func (r *Repo) imageRef(imageName string) string {
+	if r.opts.Registry == "" {
+		return imageName
+	}
+
+	return r.opts.Registry + "/" + imageName
+}
+
+// images lists the cerodev images of the registry through the distribution
+// api. Snapshots do not exist on kubernetes, so no image has an owner.
+func (r *Repo) images(ctx context.Context) ([]model.Image, error) {
+	imageList := []model.Image{}
+
+	if r.opts.Registry == "" {
+		return imageList, nil
+	}
+
+	_, prefix, _ := strings.Cut(r.opts.Registry, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var catalog struct {
+		Repositories []string `json:"repositories"`
+	}
+
+	if err := r.registryJSON(ctx, "/v2/_catalog?n=1000", &catalog); err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	for _, repo := range catalog.Repositories {
+		repoName := strings.TrimPrefix(repo, prefix)
+		if !strings.HasPrefix(repo, prefix) || !strings.HasPrefix(repoName, "cd-") {
+			continue
+		}
+
+		var tags struct {
+			Tags []string `json:"tags"`
+		}
+
+		if err := r.registryJSON(ctx, "/v2/"+repo+"/tags/list", &tags); err != nil {
+			return nil, fmt.Errorf("failed to read tags of %s: %w", repo, err)
+		}
+
+		for _, tag := range tags.Tags {
+			img, err := r.image(ctx, repoName+":"+tag)
+			if err != nil {
+				return nil, err
+			}
+
+			imageList = append(imageList, img)
+		}
+	}
+
+	return imageList, nil
+}
+
+// image reads the digest of an image from the registry.
+func (r *Repo) image(ctx context.Context, imageName string) (model.Image, error) {
+	repoName, tag, _ := strings.Cut(imageName, ":")
+	if tag == "" {
+		tag = "latest"
+	}
+
+	if r.opts.Registry == "" {
+		return model.Image{}, fmt.Errorf("No such image: %s", imageName) //nolint:err113,stylecheck,exhaustruct
+	}
+
+	_, prefix, _ := strings.Cut(r.opts.Registry, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	resp, err := r.registryRequest(ctx, http.MethodHead, "/v2/"+prefix+repoName+"/manifests/"+url.PathEscape(tag))
+	if err != nil {
+		return model.Image{}, err //nolint:exhaustruct
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return model.Image{}, fmt.Errorf("No such image: %s", imageName) //nolint:err113,stylecheck,exhaustruct
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return model.Image{}, fmt.Errorf("registry answered %s", resp.Status) //nolint:err113,exhaustruct
+	}
+
+	return model.Image{ //nolint:exhaustruct
+		RepoName: repoName,
+		ImageID:  resp.Header.Get("Docker-Content-Digest"),
+		Tag:      tag,
+	}, nil
+}
+
+func (r *Repo) registryJSON(ctx context.Context, path string, out any) error {
+	resp, err := r.registryRequest(ctx, http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry answered %s", resp.Status) //nolint:err113
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// registryRequest sends a request to the registry. Registries with basic
+// authentication are accessed with the credentials of the registry secret.
+func (r *Repo) registryRequest(ctx context.Context, method, path string) (*http.Response, error) {
+	host, _, _ := strings.Cut(r.opts.Registry, "/")
+
+	scheme := "https://"
+	if r.opts.RegistryInsecure {
+		scheme = "http://"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, scheme+host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+
+	auth, err := r.registryAuth(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth != "" {
+		req.Header.Set("Authorization", "Basic "+auth)
+	}
+
+	return http.DefaultClient.Do(req)
+}
+
+// registryAuth returns the base64 encoded credentials for host stored in the
+// dockerconfigjson registry secret.
+func (r *Repo) registryAuth(ctx context.Context, host string) (string, error) {
+	if r.opts.RegistrySecret == "" {
+		return "", nil
+	}
+
+	var s secret
+	if err := r.client.do(ctx, http.MethodGet, r.client.path("secrets", r.opts.RegistrySecret), nil, nil, &s); err != nil {
+		return "", fmt.Errorf("failed to read registry secret: %w", err)
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+
+	if err := json.Unmarshal(s.Data[".dockerconfigjson"], &config); err != nil {
+		return "", fmt.Errorf("invalid registry secret: %w", err)
+	}
+
+	for server, a := range config.Auths {
+		if strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://") != host {
+			continue
+		}
+
+		if a.Auth != "" {
+			return a.Auth, nil
+		}
+
+		return base64.StdEncoding.EncodeToString([]byte(a.Username + ":" + a.Password)), nil
+	}
+
+	return "", nil
+}
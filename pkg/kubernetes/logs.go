@@ -0,0 +1,72 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+// logs copies the output of a workspace pod to w. With follow it blocks
+// until the pod stops or ctx is cancelled.
+func (r *Repo) logs(ctx context.Context, name string, opts model.LogOptions, w io.Writer) error {
+	query := url.Values{"container": {workspaceContainer}}
+
+	if opts.Follow {
+		query.Set("follow", "true")
+	}
+
+	if opts.Timestamps {
+		query.Set("timestamps", "true")
+	}
+
+	if opts.Tail != "" && opts.Tail != "all" {
+		query.Set("tailLines", opts.Tail)
+	}
+
+	if opts.Since != "" {
+		key, value, err := since(opts.Since)
+		if err != nil {
+			return err
+		}
+
+		query.Set(key, value)
+	}
+
+	body, err := r.client.stream(ctx, r.client.path("pods", name)+"/log", query)
+	if isNotFound(err) {
+		return errNoSuchContainer(name)
+	}
+
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	_, err = io.Copy(w, body)
+
+	return err
+}
+
+// since converts the docker notation of a start time, a relative duration, a
+// RFC 3339 timestamp or unix seconds, into the matching query parameter.
+func since(value string) (string, string, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return "sinceSeconds", strconv.Itoa(max(int(d.Seconds()), 1)), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return "sinceTime", t.UTC().Format(time.RFC3339), nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return "sinceTime", time.Unix(seconds, 0).UTC().Format(time.RFC3339), nil
+	}
+
+	return "", "", fmt.Errorf("%w: invalid since %q", errs.ErrInvalidInput, value)
+}
@@ -0,0 +1,185 @@
+package kubernetes
+
+import "time"
+
+// The types below cover the fields of the core api objects cerodev reads or
+// writes, everything else is left to the api server defaults.
+
+type objectMeta struct {
+	Name              string            `json:"name"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	CreationTimestamp *time.Time        `json:"creationTimestamp,omitempty"`
+	DeletionTimestamp *time.Time        `json:"deletionTimestamp,omitempty"`
+}
+
+type object struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+}
+
+type secret struct {
+	object
+
+	Type string            `json:"type,omitempty"`
+	Data map[string][]byte `json:"data"`
+}
+
+type secretList struct {
+	Items []secret `json:"items"`
+}
+
+type configMap struct {
+	object
+
+	Data map[string]string `json:"data"`
+}
+
+type persistentVolumeClaim struct {
+	object
+
+	Spec pvcSpec `json:"spec"`
+}
+
+type pvcSpec struct {
+	AccessModes      []string      `json:"accessModes"`
+	StorageClassName *string       `json:"storageClassName,omitempty"`
+	Resources        resourceLimit `json:"resources"`
+}
+
+type resourceLimit struct {
+	Limits   map[string]string `json:"limits,omitempty"`
+	Requests map[string]string `json:"requests,omitempty"`
+}
+
+type service struct {
+	object
+
+	Spec serviceSpec `json:"spec"`
+}
+
+type serviceSpec struct {
+	Type     string            `json:"type"`
+	Selector map[string]string `json:"selector"`
+	Ports    []servicePort     `json:"ports"`
+}
+
+type servicePort struct {
+	Name       string `json:"name"`
+	Protocol   string `json:"protocol"`
+	Port       int    `json:"port"`
+	TargetPort int    `json:"targetPort"`
+	NodePort   int    `json:"nodePort,omitempty"`
+}
+
+type pod struct {
+	object
+
+	Spec   podSpec   `json:"spec"`
+	Status podStatus `json:"status,omitempty"`
+}
+
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+type podSpec struct {
+	RestartPolicy    string              `json:"restartPolicy"`
+	SecurityContext  *podSecurityContext `json:"securityContext,omitempty"`
+	Containers       []podContainer      `json:"containers"`
+	Volumes          []volume            `json:"volumes,omitempty"`
+	ImagePullSecrets []localObjectRef    `json:"imagePullSecrets,omitempty"`
+}
+
+type podSecurityContext struct {
+	FSGroup *int64 `json:"fsGroup,omitempty"`
+}
+
+type podContainer struct {
+	Name         string          `json:"name"`
+	Image        string          `json:"image"`
+	Args         []string        `json:"args,omitempty"`
+	Env          []envVar        `json:"env,omitempty"`
+	Ports        []containerPort `json:"ports,omitempty"`
+	Resources    resourceLimit   `json:"resources"`
+	VolumeMounts []volumeMount   `json:"volumeMounts,omitempty"`
+}
+
+type envVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type containerPort struct {
+	ContainerPort int    `json:"containerPort"`
+	Protocol      string `json:"protocol"`
+}
+
+type volumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+type volume struct {
+	Name                  string           `json:"name"`
+	PersistentVolumeClaim *pvcVolumeSource `json:"persistentVolumeClaim,omitempty"`
+	Secret                *secretVolume    `json:"secret,omitempty"`
+	ConfigMap             *localObjectRef  `json:"configMap,omitempty"`
+}
+
+type pvcVolumeSource struct {
+	ClaimName string `json:"claimName"`
+}
+
+type secretVolume struct {
+	SecretName  string         `json:"secretName"`
+	DefaultMode *int32         `json:"defaultMode,omitempty"`
+	Optional    bool           `json:"optional,omitempty"`
+	Items       []keyToPathRef `json:"items,omitempty"`
+}
+
+type keyToPathRef struct {
+	Key  string `json:"key"`
+	Path string `json:"path"`
+}
+
+type localObjectRef struct {
+	Name string `json:"name"`
+}
+
+type podStatus struct {
+	Phase             string            `json:"phase,omitempty"`
+	PodIP             string            `json:"podIP,omitempty"`
+	StartTime         *time.Time        `json:"startTime,omitempty"`
+	ContainerStatuses []containerStatus `json:"containerStatuses,omitempty"`
+}
+
+type containerStatus struct {
+	Name  string         `json:"name"`
+	Ready bool           `json:"ready"`
+	State containerState `json:"state"`
+}
+
+type containerState struct {
+	Waiting *struct {
+		Reason string `json:"reason"`
+	} `json:"waiting,omitempty"`
+	Running *struct {
+		StartedAt time.Time `json:"startedAt"`
+	} `json:"running,omitempty"`
+	Terminated *struct {
+		ExitCode   int       `json:"exitCode"`
+		Reason     string    `json:"reason"`
+		Message    string    `json:"message"`
+		FinishedAt time.Time `json:"finishedAt"`
+	} `json:"terminated,omitempty"`
+}
+
+type podMetrics struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Containers []struct {
+		Name  string            `json:"name"`
+		Usage map[string]string `json:"usage"`
+	} `json:"containers"`
+}
@@ -0,0 +1,186 @@
+// Package kubernetes runs workspaces as pods in a namespace of a cluster. It
+// talks to the api server over REST with the service account of cerodev.
+//
+// A workspace is stored as a secret holding its spec, a persistent volume
+// claim replacing the volume directory and a NodePort service exposing the
+// allocated ports on every node. Starting a workspace creates its pod from
+// the spec, stopping deletes the pod and keeps the volume. Images are built
+// by a kaniko pod and pushed to a registry the nodes pull from.
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+const (
+	serviceAccountDir   = "/var/run/secrets/kubernetes.io/serviceaccount"
+	defaultVolumeSize   = "10Gi"
+	defaultBuilderImage = "gcr.io/kaniko-project/executor:latest"
+)
+
+// Options configure the cluster access. Empty values use the service account
+// of the pod cerodev runs in.
+type Options struct {
+	APIURL    string
+	TokenFile string
+	CAFile    string
+	Namespace string
+	// StorageClass of the workspace volumes, empty uses the cluster default.
+	StorageClass string
+	VolumeSize   string
+	// Registry receives the built images and is the source of all workspace
+	// images, e.g. "registry.example.com:5000". RegistrySecret names a
+	// dockerconfigjson secret used to push, pull and list images.
+	Registry         string
+	RegistrySecret   string
+	RegistryInsecure bool
+	BuilderImage     string
+}
+
+type Repo struct {
+	client      apiClient
+	volumesPath string
+	opts        Options
+}
+
+func NewRepo(volumesPath string, opts Options) (*Repo, error) {
+	if opts.APIURL == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" {
+			return nil, fmt.Errorf("%w: not running in a cluster, set the api url", errs.ErrInvalidInput)
+		}
+
+		opts.APIURL = "https://" + net.JoinHostPort(host, port)
+	}
+
+	if opts.TokenFile == "" {
+		opts.TokenFile = serviceAccountDir + "/token"
+	}
+
+	if opts.CAFile == "" {
+		opts.CAFile = serviceAccountDir + "/ca.crt"
+	}
+
+	if opts.Namespace == "" {
+		opts.Namespace = "default"
+
+		if ns, err := os.ReadFile(serviceAccountDir + "/namespace"); err == nil {
+			opts.Namespace = strings.TrimSpace(string(ns))
+		}
+	}
+
+	if opts.VolumeSize == "" {
+		opts.VolumeSize = defaultVolumeSize
+	}
+
+	if opts.BuilderImage == "" {
+		opts.BuilderImage = defaultBuilderImage
+	}
+
+	c, err := newClient(opts.APIURL, opts.TokenFile, opts.CAFile, opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Repo{c, volumesPath, opts}, nil
+}
+
+func (r *Repo) StartContainer(ctx context.Context, containerID string) error {
+	return r.start(ctx, containerID)
+}
+
+func (r *Repo) CreateContainer(ctx context.Context, mc *model.Container) (string, error) {
+	return r.create(ctx, mc)
+}
+
+// UpdateLimits stores new limits. Running pods keep theirs until the next
+// start, resources of a pod cannot be changed.
+func (r *Repo) UpdateLimits(ctx context.Context, containerID string, limits model.ResourceLimits) error {
+	return r.updateLimits(ctx, containerID, limits)
+}
+
+func (r *Repo) StopContainer(ctx context.Context, containerID string) error {
+	return r.stop(ctx, containerID)
+}
+
+func (r *Repo) DeleteContainer(ctx context.Context, containerID string) error {
+	return r.delete(ctx, containerID)
+}
+
+func (r *Repo) FollowLogs(ctx context.Context, containerID string, opts model.LogOptions, w io.Writer) error {
+	return r.logs(ctx, containerID, opts, w)
+}
+
+func (r *Repo) CreateExec(ctx context.Context, containerID string, cmd []string) (string, error) {
+	return r.createExec(ctx, containerID, cmd)
+}
+
+func (r *Repo) GetExec(_ context.Context, execID string) (model.ExecSession, error) {
+	return getExec(execID)
+}
+
+func (r *Repo) AttachExec(ctx context.Context, execID string) (model.ExecStream, error) { //nolint:ireturn
+	return r.attachExec(ctx, execID)
+}
+
+// CommitContainer is not supported, the file system of a pod cannot be
+// committed through the api.
+func (r *Repo) CommitContainer(_ context.Context, _ string, _ model.Snapshot) (model.Image, error) {
+	return model.Image{}, fmt.Errorf("%w: snapshots are not supported on kubernetes", errs.ErrInvalidInput) //nolint:exhaustruct,lll
+}
+
+// RemoveImage is not supported, there are no snapshots on kubernetes.
+func (r *Repo) RemoveImage(_ context.Context, _ string) error {
+	return fmt.Errorf("%w: snapshots are not supported on kubernetes", errs.ErrInvalidInput)
+}
+
+func (r *Repo) GetImage(ctx context.Context, imageName string) (model.Image, error) {
+	return r.image(ctx, imageName)
+}
+
+func (r *Repo) GetContainerStats(ctx context.Context, containerID string) (model.ContainerStats, error) {
+	return r.stats(ctx, containerID)
+}
+
+func (r *Repo) GetContainerIP(ctx context.Context, containerID string) (string, error) {
+	return r.podIP(ctx, containerID)
+}
+
+// PublishPort exposes a port of the workspace as an additional node port.
+func (r *Repo) PublishPort(ctx context.Context, containerID string, hostPort, port int) error {
+	return r.publishPort(ctx, containerID, hostPort, port)
+}
+
+func (r *Repo) UnpublishPort(ctx context.Context, containerID string, hostPort int) error {
+	return r.unpublishPort(ctx, containerID, hostPort)
+}
+
+func (r *Repo) GetContainerStatuses(ctx context.Context, containerID []string) ([]model.ContainerStatus, error) {
+	return r.statuses(ctx, containerID)
+}
+
+// ListManagedContainers returns all workspaces in the namespace, including
+// those unknown to the db.
+func (r *Repo) ListManagedContainers(ctx context.Context) ([]model.ProviderContainer, error) {
+	return r.listManaged(ctx)
+}
+
+func (r *Repo) InspectManagedContainer(ctx context.Context, containerID string) (model.ProviderContainer, error) {
+	return r.inspectManaged(ctx, containerID)
+}
+
+func (r *Repo) Build(ctx context.Context, t model.Template, tag string, env map[string]*string, w io.Writer) error {
+	return r.build(ctx, t, tag, env, w)
+}
+
+func (r *Repo) GetImages(ctx context.Context) ([]model.Image, error) {
+	return r.images(ctx)
+}
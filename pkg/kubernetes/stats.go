@@ -0,0 +1,88 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kaibling/cerodev/model"
+)
+
+// quantitySuffixes are the suffixes of resource quantities, binary ones first
+// so that "Mi" is not read as "M".
+var quantitySuffixes = []struct { //nolint:gochecknoglobals
+	suffix string
+	factor float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40}, {"Pi", 1 << 50}, {"Ei", 1 << 60},
+	{"n", 1e-9}, {"u", 1e-6}, {"m", 1e-3},
+	{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12}, {"P", 1e15}, {"E", 1e18},
+}
+
+// stats reads the usage of a workspace from the metrics api, it requires the
+// metrics-server. Network, block io and pids are not reported by it.
+func (r *Repo) stats(ctx context.Context, name string) (model.ContainerStats, error) {
+	ws, err := r.workspace(ctx, name)
+	if err != nil {
+		return model.ContainerStats{}, err //nolint:exhaustruct
+	}
+
+	var metrics podMetrics
+
+	if err := r.client.do(ctx, http.MethodGet, r.client.metricsPath(name), nil, nil, &metrics); err != nil {
+		return model.ContainerStats{}, fmt.Errorf("failed to read pod metrics: %w", err) //nolint:exhaustruct
+	}
+
+	stats := model.ContainerStats{ //nolint:exhaustruct
+		MemoryLimit: ws.Limits.Memory,
+		ReadAt:      metrics.Timestamp,
+	}
+
+	for _, c := range metrics.Containers {
+		if c.Name != workspaceContainer {
+			continue
+		}
+
+		cpu, err := parseQuantity(c.Usage["cpu"])
+		if err != nil {
+			return model.ContainerStats{}, err //nolint:exhaustruct
+		}
+
+		memory, err := parseQuantity(c.Usage["memory"])
+		if err != nil {
+			return model.ContainerStats{}, err //nolint:exhaustruct
+		}
+
+		stats.CPUPercent = cpu * 100 //nolint:mnd
+		stats.MemoryUsage = int64(memory)
+	}
+
+	return stats, nil
+}
+
+// parseQuantity parses a resource quantity like "250m" or "128Mi".
+func parseQuantity(q string) (float64, error) {
+	if q == "" {
+		return 0, nil
+	}
+
+	factor := 1.0
+
+	for _, s := range quantitySuffixes {
+		if strings.HasSuffix(q, s.suffix) {
+			q = strings.TrimSuffix(q, s.suffix)
+			factor = s.factor
+
+			break
+		}
+	}
+
+	v, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quantity %q: %w", q, err)
+	}
+
+	return v * factor, nil
+}
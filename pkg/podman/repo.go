@@ -0,0 +1,59 @@
+// Package podman runs workspaces on Podman. It talks to the REST socket of
+// the Podman service through its Docker compatible endpoints and adapts the
+// docker repo to the differences of rootless Podman.
+package podman
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/kaibling/cerodev/pkg/docker"
+)
+
+const (
+	// rootfulSocket is the socket of the Podman service started by root.
+	rootfulSocket = "unix:///run/podman/podman.sock"
+	// rootlessUsernsMode maps the user running cerodev onto the coder user
+	// (uid 1000) of the workspace images, so that the files in the volume
+	// stay owned by both.
+	rootlessUsernsMode = "keep-id:uid=1000,gid=1000"
+	// localImagePrefix is prepended by Podman to the names of local images.
+	localImagePrefix = "localhost/"
+)
+
+// NewRepo creates a repo for the Podman service listening on socket. An empty
+// socket selects the one of the user running cerodev, an empty usernsMode
+// keeps the ids of that user when it is rootless. The relay image and the
+// bind address are taken from opts, see docker.Options.
+func NewRepo(volumesPath, socket, usernsMode string, opts docker.Options) (*docker.Repo, error) {
+	rootless := os.Geteuid() != 0
+
+	if socket == "" {
+		socket = defaultSocket(rootless)
+	}
+
+	if usernsMode == "" && rootless {
+		usernsMode = rootlessUsernsMode
+	}
+
+	opts.Host = socket
+	opts.UsernsMode = usernsMode
+	opts.LocalImagePrefix = localImagePrefix
+
+	return docker.NewRepoWithOptions(volumesPath, opts)
+}
+
+// defaultSocket returns the socket podman.socket listens on for root or the
+// current user.
+func defaultSocket(rootless bool) string {
+	if !rootless {
+		return rootfulSocket
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = "/run/user/" + strconv.Itoa(os.Geteuid())
+	}
+
+	return "unix://" + runtimeDir + "/podman/podman.sock"
+}
@@ -0,0 +1,131 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/repo/sqlcrepo"
+)
+
+type BuildRepo struct {
+	sqlcRepo *sqlcrepo.Queries
+	l        log.Writer
+}
+
+func NewBuildRepo(db *sql.DB, l log.Writer) *BuildRepo {
+	return &BuildRepo{sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_build")}
+}
+
+func (r *BuildRepo) Create(ctx context.Context, job *model.BuildJob) (*model.BuildJob, error) {
+	err := r.sqlcRepo.CreateBuildJob(ctx, sqlcrepo.CreateBuildJobParams{
+		ID:         job.ID,
+		TemplateID: job.TemplateID,
+		UserID:     job.UserID,
+		Tag:        job.Tag,
+		Status:     string(job.Status),
+		CreatedAt:  job.CreatedAt,
+	})
+	if err != nil {
+		r.l.Error("failed to create build job", err)
+
+		return nil, ToAppError(err)
+	}
+
+	return r.GetByID(ctx, job.ID)
+}
+
+func (r *BuildRepo) GetByID(ctx context.Context, id string) (*model.BuildJob, error) {
+	job, err := r.sqlcRepo.GetBuildJobByID(ctx, id)
+	if err != nil {
+		return nil, ToAppError(err)
+	}
+
+	return unmarshalBuildJob(job), nil
+}
+
+func (r *BuildRepo) GetAll(ctx context.Context) ([]*model.BuildJob, error) {
+	jobs, err := r.sqlcRepo.GetAllBuildJobs(ctx)
+	if err != nil {
+		r.l.Error("failed to get build jobs", err)
+
+		return nil, ToAppError(err)
+	}
+
+	return unmarshalBuildJobs(jobs), nil
+}
+
+func (r *BuildRepo) GetByUserID(ctx context.Context, userID string) ([]*model.BuildJob, error) {
+	jobs, err := r.sqlcRepo.GetBuildJobsByUserID(ctx, userID)
+	if err != nil {
+		r.l.Error("failed to get build jobs", err)
+
+		return nil, ToAppError(err)
+	}
+
+	return unmarshalBuildJobs(jobs), nil
+}
+
+func (r *BuildRepo) Start(ctx context.Context, id string, startedAt time.Time) error {
+	return ToAppError(r.sqlcRepo.StartBuildJob(ctx, sqlcrepo.StartBuildJobParams{
+		Status:    string(model.BuildRunning),
+		StartedAt: toNullTime(&startedAt),
+		ID:        id,
+	}))
+}
+
+func (r *BuildRepo) Finish(
+	ctx context.Context,
+	id string,
+	status model.BuildStatus,
+	errMsg string,
+	finishedAt time.Time,
+) error {
+	return ToAppError(r.sqlcRepo.FinishBuildJob(ctx, sqlcrepo.FinishBuildJobParams{
+		Status:     string(status),
+		Error:      errMsg,
+		FinishedAt: toNullTime(&finishedAt),
+		ID:         id,
+	}))
+}
+
+func (r *BuildRepo) UpdateLogs(ctx context.Context, id, logs string) error {
+	return ToAppError(r.sqlcRepo.UpdateBuildJobLogs(ctx, sqlcrepo.UpdateBuildJobLogsParams{
+		Logs: logs,
+		ID:   id,
+	}))
+}
+
+func (r *BuildRepo) FailUnfinished(ctx context.Context, errMsg string, finishedAt time.Time) error {
+	return ToAppError(r.sqlcRepo.FailUnfinishedBuildJobs(ctx, sqlcrepo.FailUnfinishedBuildJobsParams{
+		Status:     string(model.BuildFailed),
+		Error:      errMsg,
+		FinishedAt: toNullTime(&finishedAt),
+	}))
+}
+
+func unmarshalBuildJobs(jobs []sqlcrepo.BuildJob) []*model.BuildJob {
+	result := []*model.BuildJob{}
+	for _, job := range jobs {
+		result = append(result, unmarshalBuildJob(job))
+	}
+
+	return result
+}
+
+func unmarshalBuildJob(job sqlcrepo.BuildJob) *model.BuildJob {
+	return &model.BuildJob{
+		ID:         job.ID,
+		TemplateID: job.TemplateID,
+		UserID:     job.UserID,
+		Tag:        job.Tag,
+		Status:     model.BuildStatus(job.Status),
+		Logs:       job.Logs,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  fromNullTime(job.StartedAt),
+		FinishedAt: fromNullTime(job.FinishedAt),
+	}
+}
@@ -6,111 +6,194 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/errs"
 	"github.com/kaibling/cerodev/model"
 	"github.com/kaibling/cerodev/pkg/repo/sqlcrepo"
 	_ "modernc.org/sqlite" // Import the SQLite driver
 )
 
 type ContainerRepo struct {
-	ctx context.Context
-	db  *sql.DB
-	l   log.Writer
+	db *sql.DB
+	l  log.Writer
 }
 
-func NewContainerRepo(ctx context.Context, db *sql.DB, l log.Writer) *ContainerRepo {
-	return &ContainerRepo{ctx: ctx, db: db, l: l.Named("repo_container")}
+func NewContainerRepo(db *sql.DB, l log.Writer) *ContainerRepo {
+	return &ContainerRepo{db: db, l: l.Named("repo_container")}
 }
 
-func (r *ContainerRepo) GetByID(id string) (*model.Container, error) {
-	container, err := sqlcrepo.New(r.db).GetContainerByID(r.ctx, id)
+func (r *ContainerRepo) GetByID(ctx context.Context, id string) (*model.Container, error) {
+	container, err := sqlcrepo.New(r.db).GetContainerByID(ctx, id)
 	if err != nil {
 		return nil, ToAppError(fmt.Errorf("GetContainerByID failed: %w", err))
 	}
 
-	env := container.EnvVars.String
-	ports := container.Ports.String
+	return unmarshalContainer(sqlcrepo.GetAllContainersRow(container)), nil
+}
 
-	return &model.Container{
-		ID:            container.ID,
-		DockerID:      container.DockerID,
-		ContainerName: container.ContainerName,
-		ImageName:     container.ImageName,
-		EnvVars:       splitString(env),
-		Ports:         splitString(ports),
-		UIPort:        strconv.FormatInt(container.UiPort, 10),
-	}, nil
+func (r *ContainerRepo) GetByIDAndUserID(ctx context.Context, id, userID string) (*model.Container, error) {
+	container, err := sqlcrepo.New(r.db).GetContainerByIDAndUserID(ctx, sqlcrepo.GetContainerByIDAndUserIDParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		return nil, ToAppError(fmt.Errorf("GetContainerByIDAndUserID failed: %w", err))
+	}
+
+	return unmarshalContainer(sqlcrepo.GetAllContainersRow(container)), nil
 }
 
-func (r *ContainerRepo) GetAll() ([]model.Container, error) {
-	containers, err := sqlcrepo.New(r.db).GetAllContainers(r.ctx)
+func (r *ContainerRepo) GetAll(ctx context.Context) ([]model.Container, error) {
+	containers, err := sqlcrepo.New(r.db).GetAllContainers(ctx)
 	if err != nil {
 		return nil, ToAppError(fmt.Errorf("GetAllContainers failed: %w", err))
 	}
 
 	result := []model.Container{}
+	for _, container := range containers {
+		result = append(result, *unmarshalContainer(container))
+	}
 
+	return result, nil
+}
+
+func (r *ContainerRepo) GetAllByUserID(ctx context.Context, userID string) ([]model.Container, error) {
+	containers, err := sqlcrepo.New(r.db).GetAllContainersByUserID(ctx, userID)
+	if err != nil {
+		return nil, ToAppError(fmt.Errorf("GetAllContainersByUserID failed: %w", err))
+	}
+
+	result := []model.Container{}
 	for _, container := range containers {
-		env := container.EnvVars.String
-		ports := container.Ports.String
-
-		result = append(result, model.Container{
-			ID:            container.ID,
-			DockerID:      container.DockerID,
-			ContainerName: container.ContainerName,
-			ImageName:     container.ImageName,
-			EnvVars:       splitString(env),
-			Ports:         splitString(ports),
-			UIPort:        strconv.FormatInt(container.UiPort, 10),
-		})
+		result = append(result, *unmarshalContainer(sqlcrepo.GetAllContainersRow(container)))
+	}
+
+	return result, nil
+}
+
+// GetAnyByID reads a container regardless of whether it is in the trash.
+func (r *ContainerRepo) GetAnyByID(ctx context.Context, id string) (*model.Container, error) {
+	container, err := sqlcrepo.New(r.db).GetAnyContainerByID(ctx, id)
+	if err != nil {
+		return nil, ToAppError(fmt.Errorf("GetAnyContainerByID failed: %w", err))
+	}
+
+	return unmarshalContainer(sqlcrepo.GetAllContainersRow(container)), nil
+}
+
+// GetAllWithDeleted returns all containers including the ones in the trash.
+func (r *ContainerRepo) GetAllWithDeleted(ctx context.Context) ([]model.Container, error) {
+	containers, err := sqlcrepo.New(r.db).GetAllContainersWithDeleted(ctx)
+	if err != nil {
+		return nil, ToAppError(fmt.Errorf("GetAllContainersWithDeleted failed: %w", err))
+	}
+
+	result := []model.Container{}
+	for _, container := range containers {
+		result = append(result, *unmarshalContainer(sqlcrepo.GetAllContainersRow(container)))
+	}
+
+	return result, nil
+}
+
+// GetDeleted returns the containers in the trash, the oldest deletion first.
+func (r *ContainerRepo) GetDeleted(ctx context.Context) ([]model.Container, error) {
+	containers, err := sqlcrepo.New(r.db).GetDeletedContainers(ctx)
+	if err != nil {
+		return nil, ToAppError(fmt.Errorf("GetDeletedContainers failed: %w", err))
+	}
+
+	result := []model.Container{}
+	for _, container := range containers {
+		result = append(result, *unmarshalContainer(sqlcrepo.GetAllContainersRow(container)))
 	}
 
 	return result, nil
 }
 
-func (r *ContainerRepo) Create(container *model.Container) (*model.Container, error) {
-	containerID, err := sqlcrepo.New(r.db).CreateContainer(r.ctx, sqlcrepo.CreateContainerParams{ //nolint:exhaustruct
+func (r *ContainerRepo) GetDeletedByUserID(ctx context.Context, userID string) ([]model.Container, error) {
+	containers, err := sqlcrepo.New(r.db).GetDeletedContainersByUserID(ctx, userID)
+	if err != nil {
+		return nil, ToAppError(fmt.Errorf("GetDeletedContainersByUserID failed: %w", err))
+	}
+
+	result := []model.Container{}
+	for _, container := range containers {
+		result = append(result, *unmarshalContainer(sqlcrepo.GetAllContainersRow(container)))
+	}
+
+	return result, nil
+}
+
+// SetDeleted moves a container into the trash, nil takes it out again.
+func (r *ContainerRepo) SetDeleted(ctx context.Context, id string, deletedAt *time.Time) error {
+	return ToAppError(sqlcrepo.New(r.db).SetContainerDeleted(ctx, sqlcrepo.SetContainerDeletedParams{
+		DeletedAt: toNullTime(deletedAt),
+		ID:        id,
+	}))
+}
+
+func (r *ContainerRepo) Create(ctx context.Context, container *model.Container) (*model.Container, error) {
+	containerID, err := sqlcrepo.New(r.db).CreateContainer(ctx, sqlcrepo.CreateContainerParams{
 		ID:            container.ID,
 		DockerID:      container.DockerID,
 		ContainerName: container.ContainerName,
 		ImageName:     container.ImageName,
+		GitRepo:       sql.NullString{String: container.GitRepo, Valid: container.GitRepo != ""},
+		GitRef:        container.GitRef,
+		GitDepth:      int64(container.GitDepth),
+		UserID:        container.UserID,
 		EnvVars:       sql.NullString{String: joinStrings(container.EnvVars), Valid: true},
 		Ports:         sql.NullString{String: joinStrings(container.Ports), Valid: true},
+		CpuQuota:      container.Limits.CPUQuota,
+		Memory:        container.Limits.Memory,
+		MemorySwap:    container.Limits.MemorySwap,
+		PidsLimit:     container.Limits.PidsLimit,
+		NodeID:        container.NodeID,
 	})
 	if err != nil {
 		return nil, ToAppError(err)
 	}
 
-	return r.GetByID(containerID)
+	return r.GetByID(ctx, containerID)
 }
 
-func (r *ContainerRepo) Delete(id string) error {
-	return sqlcrepo.New(r.db).DeleteContainer(r.ctx, id)
+func (r *ContainerRepo) Delete(ctx context.Context, id string) error {
+	return sqlcrepo.New(r.db).DeleteContainer(ctx, id)
 }
 
-func (r *ContainerRepo) Update(container *model.Container) (*model.Container, error) {
-	err := sqlcrepo.New(r.db).UpdateContainer(r.ctx, sqlcrepo.UpdateContainerParams{ //nolint:exhaustruct
+func (r *ContainerRepo) Update(ctx context.Context, container *model.Container) (*model.Container, error) {
+	err := sqlcrepo.New(r.db).UpdateContainer(ctx, sqlcrepo.UpdateContainerParams{
 		ID:            container.ID,
 		DockerID:      container.DockerID,
 		ContainerName: container.ContainerName,
 		ImageName:     container.ImageName,
+		GitRepo:       sql.NullString{String: container.GitRepo, Valid: container.GitRepo != ""},
+		GitRef:        container.GitRef,
+		GitDepth:      int64(container.GitDepth),
+		UserID:        container.UserID,
 		EnvVars:       sql.NullString{String: joinStrings(container.EnvVars), Valid: true},
 		Ports:         sql.NullString{String: joinStrings(container.Ports), Valid: true},
+		CpuQuota:      container.Limits.CPUQuota,
+		Memory:        container.Limits.Memory,
+		MemorySwap:    container.Limits.MemorySwap,
+		PidsLimit:     container.Limits.PidsLimit,
 	})
 	if err != nil {
 		return nil, ToAppError(err)
 	}
 
-	return r.GetByID(container.ID)
+	return r.GetByID(ctx, container.ID)
 }
 
-func (r *ContainerRepo) ReleasePort(containerID string) error {
-	return sqlcrepo.New(r.db).ReleasePortByContainer(r.ctx, sql.NullString{String: containerID, Valid: true})
+func (r *ContainerRepo) ReleasePort(ctx context.Context, containerID string) error {
+	return sqlcrepo.New(r.db).ReleasePortByContainer(ctx, sql.NullString{String: containerID, Valid: true})
 }
 
-func (r *ContainerRepo) GetFreePort() (int, error) {
-	port, err := sqlcrepo.New(r.db).GetFreePort(r.ctx)
+func (r *ContainerRepo) GetFreePort(ctx context.Context, nodeID string) (int, error) {
+	port, err := sqlcrepo.New(r.db).GetFreePort(ctx, nodeID)
 	if err != nil {
 		return 0, ToAppError(err)
 	}
@@ -118,22 +201,109 @@ func (r *ContainerRepo) GetFreePort() (int, error) {
 	return int(port), nil
 }
 
-func (r *ContainerRepo) AllocatePort(containerID string, port int) error {
-	return sqlcrepo.New(r.db).AllocatePort(r.ctx, sqlcrepo.AllocatePortParams{
+// AllocatePort assigns a port to a container. The container row may be
+// created later, the reservation time keeps the reconciler from releasing the
+// port in the meantime.
+func (r *ContainerRepo) AllocatePort(ctx context.Context, nodeID, containerID string, port int) error {
+	now := time.Now().UTC()
+
+	return sqlcrepo.New(r.db).AllocatePort(ctx, sqlcrepo.AllocatePortParams{
 		ContainerID: sql.NullString{String: containerID, Valid: true},
+		ReservedAt:  toNullTime(&now),
+		NodeID:      nodeID,
 		Port:        int64(port),
 	},
 	)
 }
 
-func (r *ContainerRepo) GetPortCount() (int, error) {
-	count, err := sqlcrepo.New(r.db).GetPortCount(r.ctx)
+// AllocateFreePort allocates a specific port and reports false if it is
+// already in use or not part of the port pool of the node.
+func (r *ContainerRepo) AllocateFreePort(ctx context.Context, nodeID, containerID string, port int) (bool, error) {
+	now := time.Now().UTC()
+
+	count, err := sqlcrepo.New(r.db).AllocateFreePort(ctx, sqlcrepo.AllocateFreePortParams{
+		ContainerID: sql.NullString{String: containerID, Valid: true},
+		ReservedAt:  toNullTime(&now),
+		NodeID:      nodeID,
+		Port:        int64(port),
+	})
+	if err != nil {
+		return false, ToAppError(err)
+	}
+
+	return count > 0, nil
+}
+
+// ReservePort takes a port of the pool of a node that belongs to no
+// container, e.g. the host port of a published port. It reports false if the
+// port is already in use.
+func (r *ContainerRepo) ReservePort(ctx context.Context, port model.NodePort) (bool, error) {
+	now := time.Now().UTC()
+
+	count, err := sqlcrepo.New(r.db).ReservePort(ctx, sqlcrepo.ReservePortParams{
+		ReservedAt: toNullTime(&now),
+		NodeID:     port.NodeID,
+		Port:       int64(port.Port),
+	})
+	if err != nil {
+		return false, ToAppError(err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *ContainerRepo) ReleasePortByPort(ctx context.Context, port model.NodePort) error {
+	return ToAppError(sqlcrepo.New(r.db).ReleasePortbyPort(ctx, sqlcrepo.ReleasePortbyPortParams{
+		NodeID: port.NodeID,
+		Port:   int64(port.Port),
+	}))
+}
+
+// GetStalePorts returns ports in use by containers that do not exist anymore.
+// Host ports of published ports are in use without a container. Ports
+// reserved after reservedBefore are left out, their container may still be
+// created.
+func (r *ContainerRepo) GetStalePorts(ctx context.Context, reservedBefore time.Time) ([]model.NodePort, error) {
+	// reservations are stored in UTC to be compared as text
+	reservedBefore = reservedBefore.UTC()
+
+	ports, err := sqlcrepo.New(r.db).GetStalePorts(ctx, toNullTime(&reservedBefore))
+	if err != nil {
+		return nil, ToAppError(err)
+	}
+
+	result := make([]model.NodePort, len(ports))
+	for i, port := range ports {
+		result[i] = model.NodePort{NodeID: port.NodeID, Port: int(port.Port)}
+	}
+
+	return result, nil
+}
+
+func (r *ContainerRepo) SetMissing(ctx context.Context, id string, missingSince *time.Time) error {
+	return ToAppError(sqlcrepo.New(r.db).SetContainerMissing(ctx, sqlcrepo.SetContainerMissingParams{
+		MissingSince: toNullTime(missingSince),
+		ID:           id,
+	}))
+}
+
+func (r *ContainerRepo) SetLastActivity(ctx context.Context, id string, lastActivityAt time.Time) error {
+	return ToAppError(sqlcrepo.New(r.db).SetContainerLastActivity(ctx, sqlcrepo.SetContainerLastActivityParams{
+		LastActivityAt: toNullTime(&lastActivityAt),
+		ID:             id,
+	}))
+}
+
+func (r *ContainerRepo) GetPortCount(ctx context.Context, nodeID string) (int, error) {
+	count, err := sqlcrepo.New(r.db).GetPortCount(ctx, nodeID)
 
 	return int(count), ToAppError(err)
 }
 
-func (r *ContainerRepo) FillPorts(minPort, maxPort int) error {
-	tx, err := r.db.BeginTx(r.ctx, nil)
+// FillPorts adds the ports of the range to the port pool of a node. Ports
+// already in the pool are kept.
+func (r *ContainerRepo) FillPorts(ctx context.Context, nodeID string, minPort, maxPort int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return ToAppError(err)
 	}
@@ -141,7 +311,7 @@ func (r *ContainerRepo) FillPorts(minPort, maxPort int) error {
 	qtx := sqlcrepo.New(tx)
 
 	for port := minPort; port <= maxPort; port++ {
-		err := qtx.CreatePort(r.ctx, int64(port))
+		err := qtx.CreatePort(ctx, sqlcrepo.CreatePortParams{NodeID: nodeID, Port: int64(port)})
 		if err != nil {
 			if rerr := tx.Rollback(); rerr != nil {
 				r.l.Error("failed to rollback transaction", rerr)
@@ -156,6 +326,211 @@ func (r *ContainerRepo) FillPorts(minPort, maxPort int) error {
 	return tx.Commit()
 }
 
+// ResizePorts changes the port pool of a node to the range. It fails with
+// ErrInvalidInput if a port outside of the range is in use.
+func (r *ContainerRepo) ResizePorts(ctx context.Context, nodeID string, minPort, maxPort int) error {
+	inUse, err := sqlcrepo.New(r.db).CountPortsInUseOutside(ctx, sqlcrepo.CountPortsInUseOutsideParams{
+		NodeID:  nodeID,
+		MinPort: int64(minPort),
+		MaxPort: int64(maxPort),
+	})
+	if err != nil {
+		return ToAppError(err)
+	}
+
+	if inUse > 0 {
+		return fmt.Errorf("%w: %d ports outside of %d-%d are in use", errs.ErrInvalidInput, inUse, minPort, maxPort)
+	}
+
+	if err := sqlcrepo.New(r.db).DeletePortsOutside(ctx, sqlcrepo.DeletePortsOutsideParams{
+		NodeID:  nodeID,
+		MinPort: int64(minPort),
+		MaxPort: int64(maxPort),
+	}); err != nil {
+		return ToAppError(err)
+	}
+
+	return r.FillPorts(ctx, nodeID, minPort, maxPort)
+}
+
+// DeletePorts removes the port pool of a node.
+func (r *ContainerRepo) DeletePorts(ctx context.Context, nodeID string) error {
+	return ToAppError(sqlcrepo.New(r.db).DeletePortsByNode(ctx, nodeID))
+}
+
+// GetFreePortCounts returns the number of free ports by node.
+func (r *ContainerRepo) GetFreePortCounts(ctx context.Context) (map[string]int, error) {
+	counts, err := sqlcrepo.New(r.db).GetFreePortCounts(ctx)
+	if err != nil {
+		return nil, ToAppError(err)
+	}
+
+	result := map[string]int{}
+	for _, c := range counts {
+		result[c.NodeID] = int(c.Free)
+	}
+
+	return result, nil
+}
+
+// GetNodeID returns the node a container runs on, trashed containers
+// included.
+func (r *ContainerRepo) GetNodeID(ctx context.Context, dockerID string) (string, error) {
+	nodeID, err := sqlcrepo.New(r.db).GetContainerNodeID(ctx, dockerID)
+	if err != nil {
+		return "", ToAppError(fmt.Errorf("GetContainerNodeID failed: %w", err))
+	}
+
+	return nodeID, nil
+}
+
+// GetNodeReservations sums up the limits of the workspaces by node.
+func (r *ContainerRepo) GetNodeReservations(ctx context.Context) (map[string]model.NodeReservation, error) {
+	rows, err := sqlcrepo.New(r.db).GetNodeReservations(ctx)
+	if err != nil {
+		return nil, ToAppError(err)
+	}
+
+	result := map[string]model.NodeReservation{}
+	for _, row := range rows {
+		result[row.NodeID] = model.NodeReservation{
+			NodeID:     row.NodeID,
+			Workspaces: int(row.Workspaces),
+			CPUQuota:   row.CpuQuota,
+			Memory:     row.Memory,
+		}
+	}
+
+	return result, nil
+}
+
+// CountByNode returns the number of containers on a node, trashed containers
+// included.
+func (r *ContainerRepo) CountByNode(ctx context.Context, nodeID string) (int, error) {
+	count, err := sqlcrepo.New(r.db).CountContainersByNode(ctx, nodeID)
+
+	return int(count), ToAppError(err)
+}
+
+func (r *ContainerRepo) CreateShare(ctx context.Context, share *model.ContainerShare) error {
+	return ToAppError(sqlcrepo.New(r.db).CreateContainerShare(ctx, sqlcrepo.CreateContainerShareParams{
+		ContainerID: share.ContainerID,
+		UserID:      share.UserID,
+		CreatedAt:   share.CreatedAt,
+	}))
+}
+
+func (r *ContainerRepo) DeleteShare(ctx context.Context, containerID, userID string) error {
+	return ToAppError(sqlcrepo.New(r.db).DeleteContainerShare(ctx, sqlcrepo.DeleteContainerShareParams{
+		ContainerID: containerID,
+		UserID:      userID,
+	}))
+}
+
+func (r *ContainerRepo) GetShares(ctx context.Context, containerID string) ([]model.ContainerShare, error) {
+	shares, err := sqlcrepo.New(r.db).GetContainerShares(ctx, containerID)
+	if err != nil {
+		return nil, ToAppError(fmt.Errorf("GetContainerShares failed: %w", err))
+	}
+
+	result := []model.ContainerShare{}
+	for _, share := range shares {
+		result = append(result, model.ContainerShare{
+			ContainerID: share.ContainerID,
+			UserID:      share.UserID,
+			CreatedAt:   share.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func (r *ContainerRepo) IsSharedWith(ctx context.Context, containerID, userID string) (bool, error) {
+	count, err := sqlcrepo.New(r.db).CountContainerShare(ctx, sqlcrepo.CountContainerShareParams{
+		ContainerID: containerID,
+		UserID:      userID,
+	})
+	if err != nil {
+		return false, ToAppError(err)
+	}
+
+	return count > 0, nil
+}
+
+func (r *ContainerRepo) CreatePublishedPort(ctx context.Context, port *model.PublishedPort) error {
+	return ToAppError(sqlcrepo.New(r.db).CreatePublishedPort(ctx, sqlcrepo.CreatePublishedPortParams{
+		ContainerID: port.ContainerID,
+		Port:        int64(port.Port),
+		HostPort:    int64(port.HostPort),
+		CreatedAt:   port.CreatedAt,
+	}))
+}
+
+func (r *ContainerRepo) DeletePublishedPort(ctx context.Context, containerID string, port int) error {
+	count, err := sqlcrepo.New(r.db).DeletePublishedPort(ctx, sqlcrepo.DeletePublishedPortParams{
+		ContainerID: containerID,
+		Port:        int64(port),
+	})
+	if err != nil {
+		return ToAppError(err)
+	}
+
+	if count == 0 {
+		return ToAppError(sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (r *ContainerRepo) DeletePublishedPorts(ctx context.Context, containerID string) error {
+	return ToAppError(sqlcrepo.New(r.db).DeletePublishedPortsByContainer(ctx, containerID))
+}
+
+func (r *ContainerRepo) GetPublishedPorts(ctx context.Context, containerID string) ([]model.PublishedPort, error) {
+	ports, err := sqlcrepo.New(r.db).GetPublishedPorts(ctx, containerID)
+	if err != nil {
+		return nil, ToAppError(fmt.Errorf("GetPublishedPorts failed: %w", err))
+	}
+
+	result := []model.PublishedPort{}
+	for _, port := range ports {
+		result = append(result, model.PublishedPort{
+			ContainerID: port.ContainerID,
+			Port:        int(port.Port),
+			HostPort:    int(port.HostPort),
+			CreatedAt:   port.CreatedAt,
+		})
+	}
+
+	return result, nil
+}
+
+func unmarshalContainer(container sqlcrepo.GetAllContainersRow) *model.Container {
+	return &model.Container{ //nolint:exhaustruct
+		ID:             container.ID,
+		DockerID:       container.DockerID,
+		ContainerName:  container.ContainerName,
+		ImageName:      container.ImageName,
+		GitRepo:        container.GitRepo.String,
+		GitRef:         container.GitRef,
+		GitDepth:       int(container.GitDepth),
+		UserID:         container.UserID,
+		EnvVars:        splitString(container.EnvVars.String),
+		Ports:          splitString(container.Ports.String),
+		UIPort:         strconv.FormatInt(container.UiPort, 10),
+		MissingSince:   fromNullTime(container.MissingSince),
+		LastActivityAt: fromNullTime(container.LastActivityAt),
+		DeletedAt:      fromNullTime(container.DeletedAt),
+		NodeID:         container.NodeID,
+		Limits: model.ResourceLimits{
+			CPUQuota:   container.CpuQuota,
+			Memory:     container.Memory,
+			MemorySwap: container.MemorySwap,
+			PidsLimit:  container.PidsLimit,
+		},
+	}
+}
+
 func joinStrings(s []string) string {
 	if len(s) == 0 {
 		return ""
@@ -0,0 +1,120 @@
+package dbrepo
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apiservice "github.com/kaibling/apiforge/service"
+	"github.com/kaibling/cerodev/migration"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/repo/sqliterepo"
+)
+
+func newTestContainerRepo(t *testing.T) *ContainerRepo {
+	t.Helper()
+
+	conn, err := sqliterepo.Connect(filepath.Join(t.TempDir(), "cerodev.db"))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	if err := migration.Migrate(conn); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	l := apiservice.BuildLogger(apiservice.LogConfig{LogLevel: "error", AppName: "test"}) //nolint:exhaustruct
+
+	return NewContainerRepo(conn, l)
+}
+
+func TestGetStalePortsSkipsNewReservations(t *testing.T) {
+	ctx := context.Background()
+	r := newTestContainerRepo(t)
+
+	if err := r.FillPorts(ctx, "local", 30000, 30002); err != nil {
+		t.Fatalf("FillPorts: %v", err)
+	}
+
+	// the container row of a workspace is only stored once it was created
+	if err := r.AllocatePort(ctx, "local", "01JZ3F8Q7V5X2N4M6K8P0R2T4W", 30000); err != nil {
+		t.Fatalf("AllocatePort: %v", err)
+	}
+
+	if ok, err := r.ReservePort(ctx, model.NodePort{NodeID: "local", Port: 30001}); err != nil || !ok {
+		t.Fatalf("ReservePort = %v, %v", ok, err)
+	}
+
+	stale, err := r.GetStalePorts(ctx, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("GetStalePorts: %v", err)
+	}
+
+	if len(stale) != 0 {
+		t.Errorf("stale ports within the grace period = %v", stale)
+	}
+
+	stale, err = r.GetStalePorts(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("GetStalePorts: %v", err)
+	}
+
+	if len(stale) != 2 || stale[0].Port+stale[1].Port != 60001 {
+		t.Errorf("stale ports after the grace period = %v", stale)
+	}
+
+	if err := r.ReleasePortByPort(ctx, stale[0]); err != nil {
+		t.Fatalf("ReleasePortByPort: %v", err)
+	}
+
+	if ok, err := r.ReservePort(ctx, stale[0]); err != nil || !ok {
+		t.Errorf("ReservePort of a released port = %v, %v", ok, err)
+	}
+}
+
+func TestPortPoolsPerNode(t *testing.T) {
+	ctx := context.Background()
+	r := newTestContainerRepo(t)
+
+	for _, nodeID := range []string{"local", "n1"} {
+		if err := r.FillPorts(ctx, nodeID, 30000, 30001); err != nil {
+			t.Fatalf("FillPorts %s: %v", nodeID, err)
+		}
+	}
+
+	if err := r.AllocatePort(ctx, "local", "01JZ3F8Q7V5X2N4M6K8P0R2T4W", 30000); err != nil {
+		t.Fatalf("AllocatePort: %v", err)
+	}
+
+	if port, err := r.GetFreePort(ctx, "n1"); err != nil || port != 30000 {
+		t.Errorf("GetFreePort of another node = %d, %v", port, err)
+	}
+
+	tests := []struct {
+		name   string
+		nodeID string
+		port   int
+		want   bool
+	}{
+		{name: "port in use on the node", nodeID: "local", port: 30000, want: false},
+		{name: "same port on another node", nodeID: "n1", port: 30000, want: true},
+		{name: "port outside the pool", nodeID: "n1", port: 30002, want: false},
+		{name: "unknown node", nodeID: "n2", port: 30001, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.AllocateFreePort(ctx, tt.nodeID, "01JZ3F8Q7V5X2N4M6K8P0R2T4X", tt.port)
+			if err != nil {
+				t.Fatalf("AllocateFreePort: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("AllocateFreePort = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
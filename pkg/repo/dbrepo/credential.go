@@ -0,0 +1,98 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/repo/sqlcrepo"
+)
+
+// CredentialRepo stores git credentials. Secrets are passed in and returned
+// encrypted, the repo never sees them in plain text.
+type CredentialRepo struct {
+	sqlcRepo *sqlcrepo.Queries
+	l        log.Writer
+}
+
+func NewCredentialRepo(db *sql.DB, l log.Writer) *CredentialRepo {
+	return &CredentialRepo{sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_credential")}
+}
+
+func (r *CredentialRepo) GetByUserID(ctx context.Context, userID string) ([]model.GitCredential, error) {
+	credentials, err := r.sqlcRepo.GetGitCredentialsByUserID(ctx, userID)
+	if err != nil {
+		r.l.Error("failed to get git credentials", err)
+
+		return nil, ToAppError(err)
+	}
+
+	result := make([]model.GitCredential, len(credentials))
+	for i, credential := range credentials {
+		result[i] = unmarshalGitCredential(credential)
+	}
+
+	return result, nil
+}
+
+// Save creates the credential or replaces the one of the same kind and host.
+func (r *CredentialRepo) Save(ctx context.Context, credential *model.GitCredential) (*model.GitCredential, error) {
+	err := r.sqlcRepo.UpsertGitCredential(ctx, sqlcrepo.UpsertGitCredentialParams{
+		ID:        credential.ID,
+		UserID:    credential.UserID,
+		Kind:      string(credential.Kind),
+		Host:      credential.Host,
+		Username:  credential.Username,
+		Secret:    credential.Secret,
+		CreatedAt: credential.CreatedAt,
+	})
+	if err != nil {
+		r.l.Error("failed to save git credential", err)
+
+		return nil, ToAppError(err)
+	}
+
+	saved, err := r.sqlcRepo.GetGitCredential(ctx, sqlcrepo.GetGitCredentialParams{
+		UserID: credential.UserID,
+		Kind:   string(credential.Kind),
+		Host:   credential.Host,
+	})
+	if err != nil {
+		return nil, ToAppError(err)
+	}
+
+	val := unmarshalGitCredential(saved)
+
+	return &val, nil
+}
+
+func (r *CredentialRepo) Delete(ctx context.Context, id, userID string) error {
+	rows, err := r.sqlcRepo.DeleteGitCredential(ctx, sqlcrepo.DeleteGitCredentialParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		r.l.Error("failed to delete git credential", err)
+
+		return ToAppError(err)
+	}
+
+	if rows == 0 {
+		return ToAppError(sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+func unmarshalGitCredential(credential sqlcrepo.GitCredential) model.GitCredential {
+	return model.GitCredential{
+		ID:        credential.ID,
+		UserID:    credential.UserID,
+		Kind:      model.GitCredentialKind(credential.Kind),
+		Host:      credential.Host,
+		Username:  credential.Username,
+		Secret:    credential.Secret,
+		CreatedAt: credential.CreatedAt,
+	}
+}
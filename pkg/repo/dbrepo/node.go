@@ -0,0 +1,113 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/repo/sqlcrepo"
+)
+
+// NodeRepo stores the registered nodes. Client keys are passed in and
+// returned encrypted.
+type NodeRepo struct {
+	sqlcRepo *sqlcrepo.Queries
+	l        log.Writer
+}
+
+func NewNodeRepo(db *sql.DB, l log.Writer) *NodeRepo {
+	return &NodeRepo{sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_node")}
+}
+
+func (r *NodeRepo) GetAll(ctx context.Context) ([]model.Node, error) {
+	nodes, err := r.sqlcRepo.GetAllNodes(ctx)
+	if err != nil {
+		r.l.Error("failed to get nodes", err)
+
+		return nil, ToAppError(err)
+	}
+
+	result := make([]model.Node, len(nodes))
+	for i, node := range nodes {
+		result[i] = unmarshalNode(node)
+	}
+
+	return result, nil
+}
+
+func (r *NodeRepo) GetByID(ctx context.Context, id string) (*model.Node, error) {
+	node, err := r.sqlcRepo.GetNodeByID(ctx, id)
+	if err != nil {
+		return nil, ToAppError(err)
+	}
+
+	n := unmarshalNode(node)
+
+	return &n, nil
+}
+
+func (r *NodeRepo) Create(ctx context.Context, node *model.Node) (*model.Node, error) {
+	err := r.sqlcRepo.CreateNode(ctx, sqlcrepo.CreateNodeParams{
+		ID:         node.ID,
+		Name:       node.Name,
+		Host:       node.Host,
+		PublicUrl:  node.PublicURL,
+		CaCert:     node.CACert,
+		ClientCert: node.ClientCert,
+		ClientKey:  node.ClientKey,
+		MinPort:    int64(node.MinPort),
+		MaxPort:    int64(node.MaxPort),
+		Cordoned:   node.Cordoned,
+		CreatedAt:  node.CreatedAt,
+	})
+	if err != nil {
+		r.l.Error("failed to create node", err)
+
+		return nil, ToAppError(err)
+	}
+
+	return r.GetByID(ctx, node.ID)
+}
+
+func (r *NodeRepo) Update(ctx context.Context, node *model.Node) (*model.Node, error) {
+	err := r.sqlcRepo.UpdateNode(ctx, sqlcrepo.UpdateNodeParams{
+		Name:       node.Name,
+		Host:       node.Host,
+		PublicUrl:  node.PublicURL,
+		CaCert:     node.CACert,
+		ClientCert: node.ClientCert,
+		ClientKey:  node.ClientKey,
+		MinPort:    int64(node.MinPort),
+		MaxPort:    int64(node.MaxPort),
+		Cordoned:   node.Cordoned,
+		ID:         node.ID,
+	})
+	if err != nil {
+		r.l.Error("failed to update node", err)
+
+		return nil, ToAppError(err)
+	}
+
+	return r.GetByID(ctx, node.ID)
+}
+
+func (r *NodeRepo) Delete(ctx context.Context, id string) error {
+	return ToAppError(r.sqlcRepo.DeleteNode(ctx, id))
+}
+
+func unmarshalNode(node sqlcrepo.Node) model.Node {
+	return model.Node{
+		ID:         node.ID,
+		Name:       node.Name,
+		Host:       node.Host,
+		PublicURL:  node.PublicUrl,
+		CACert:     node.CaCert,
+		ClientCert: node.ClientCert,
+		ClientKey:  node.ClientKey,
+		MinPort:    int(node.MinPort),
+		MaxPort:    int(node.MaxPort),
+		Cordoned:   node.Cordoned,
+		CreatedAt:  node.CreatedAt,
+	}
+}
@@ -0,0 +1,97 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/repo/sqlcrepo"
+)
+
+type QuotaRepo struct {
+	sqlcRepo *sqlcrepo.Queries
+	l        log.Writer
+}
+
+func NewQuotaRepo(db *sql.DB, l log.Writer) *QuotaRepo {
+	return &QuotaRepo{sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_quota")}
+}
+
+func (r *QuotaRepo) Get(ctx context.Context, kind model.QuotaKind, subject string) (*model.Quota, error) {
+	quota, err := r.sqlcRepo.GetQuota(ctx, sqlcrepo.GetQuotaParams{
+		Kind:    string(kind),
+		Subject: subject,
+	})
+	if err != nil {
+		return nil, ToAppError(err)
+	}
+
+	return unmarshalQuota(quota), nil
+}
+
+func (r *QuotaRepo) GetAll(ctx context.Context) ([]*model.Quota, error) {
+	quotas, err := r.sqlcRepo.GetAllQuotas(ctx)
+	if err != nil {
+		r.l.Error("failed to get quotas", err)
+
+		return nil, ToAppError(err)
+	}
+
+	result := make([]*model.Quota, len(quotas))
+	for i, quota := range quotas {
+		result[i] = unmarshalQuota(quota)
+	}
+
+	return result, nil
+}
+
+// Save creates the quota or replaces the existing one of the subject.
+func (r *QuotaRepo) Save(ctx context.Context, quota *model.Quota) (*model.Quota, error) {
+	err := r.sqlcRepo.UpsertQuota(ctx, sqlcrepo.UpsertQuotaParams{
+		Kind:          string(quota.Kind),
+		Subject:       quota.Subject,
+		MaxContainers: int64(quota.MaxContainers),
+		MaxRunning:    int64(quota.MaxRunning),
+		MaxMemory:     quota.MaxMemory,
+		MaxCpuQuota:   quota.MaxCPUQuota,
+		MaxVolumeSize: quota.MaxVolumeSize,
+	})
+	if err != nil {
+		r.l.Error("failed to save quota", err)
+
+		return nil, ToAppError(err)
+	}
+
+	return r.Get(ctx, quota.Kind, quota.Subject)
+}
+
+func (r *QuotaRepo) Delete(ctx context.Context, kind model.QuotaKind, subject string) error {
+	rows, err := r.sqlcRepo.DeleteQuota(ctx, sqlcrepo.DeleteQuotaParams{
+		Kind:    string(kind),
+		Subject: subject,
+	})
+	if err != nil {
+		r.l.Error("failed to delete quota", err)
+
+		return ToAppError(err)
+	}
+
+	if rows == 0 {
+		return ToAppError(sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+func unmarshalQuota(quota sqlcrepo.Quota) *model.Quota {
+	return &model.Quota{
+		Kind:          model.QuotaKind(quota.Kind),
+		Subject:       quota.Subject,
+		MaxContainers: int(quota.MaxContainers),
+		MaxRunning:    int(quota.MaxRunning),
+		MaxMemory:     quota.MaxMemory,
+		MaxCPUQuota:   quota.MaxCpuQuota,
+		MaxVolumeSize: quota.MaxVolumeSize,
+	}
+}
@@ -0,0 +1,106 @@
+package dbrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/repo/sqlcrepo"
+)
+
+// SecretRepo stores secrets. Values are passed in and returned encrypted.
+type SecretRepo struct {
+	sqlcRepo *sqlcrepo.Queries
+	l        log.Writer
+}
+
+func NewSecretRepo(db *sql.DB, l log.Writer) *SecretRepo {
+	return &SecretRepo{sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_secret")}
+}
+
+func (r *SecretRepo) GetByOwner(ctx context.Context, scope model.SecretScope, ownerID string) ([]model.Secret, error) {
+	secrets, err := r.sqlcRepo.GetSecretsByOwner(ctx, sqlcrepo.GetSecretsByOwnerParams{
+		Scope:   string(scope),
+		OwnerID: ownerID,
+	})
+	if err != nil {
+		r.l.Error("failed to get secrets", err)
+
+		return nil, ToAppError(err)
+	}
+
+	result := make([]model.Secret, len(secrets))
+	for i, secret := range secrets {
+		result[i] = unmarshalSecret(secret)
+	}
+
+	return result, nil
+}
+
+// Save creates the secret or replaces the value of the existing one.
+func (r *SecretRepo) Save(ctx context.Context, secret *model.Secret) (*model.Secret, error) {
+	err := r.sqlcRepo.UpsertSecret(ctx, sqlcrepo.UpsertSecretParams{
+		Scope:     string(secret.Scope),
+		OwnerID:   secret.OwnerID,
+		Name:      secret.Name,
+		Value:     secret.Value,
+		CreatedAt: secret.CreatedAt,
+		UpdatedAt: secret.UpdatedAt,
+	})
+	if err != nil {
+		r.l.Error("failed to save secret", err)
+
+		return nil, ToAppError(err)
+	}
+
+	saved, err := r.sqlcRepo.GetSecret(ctx, sqlcrepo.GetSecretParams{
+		Scope:   string(secret.Scope),
+		OwnerID: secret.OwnerID,
+		Name:    secret.Name,
+	})
+	if err != nil {
+		return nil, ToAppError(err)
+	}
+
+	val := unmarshalSecret(saved)
+
+	return &val, nil
+}
+
+func (r *SecretRepo) Delete(ctx context.Context, scope model.SecretScope, ownerID, name string) error {
+	rows, err := r.sqlcRepo.DeleteSecret(ctx, sqlcrepo.DeleteSecretParams{
+		Scope:   string(scope),
+		OwnerID: ownerID,
+		Name:    name,
+	})
+	if err != nil {
+		r.l.Error("failed to delete secret", err)
+
+		return ToAppError(err)
+	}
+
+	if rows == 0 {
+		return ToAppError(sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (r *SecretRepo) DeleteByOwner(ctx context.Context, scope model.SecretScope, ownerID string) error {
+	return ToAppError(r.sqlcRepo.DeleteSecretsByOwner(ctx, sqlcrepo.DeleteSecretsByOwnerParams{
+		Scope:   string(scope),
+		OwnerID: ownerID,
+	}))
+}
+
+func unmarshalSecret(secret sqlcrepo.Secret) model.Secret {
+	return model.Secret{
+		Scope:     model.SecretScope(secret.Scope),
+		OwnerID:   secret.OwnerID,
+		Name:      secret.Name,
+		Value:     secret.Value,
+		CreatedAt: secret.CreatedAt,
+		UpdatedAt: secret.UpdatedAt,
+	}
+}
@@ -10,19 +10,18 @@ import (
 )
 
 type TemplateRepo struct {
-	ctx      context.Context
 	sqlcRepo *sqlcrepo.Queries
 	l        log.Writer
 }
 
-func NewTemplateRepo(ctx context.Context, db *sql.DB, l log.Writer) *TemplateRepo {
-	return &TemplateRepo{ctx: ctx, sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_template")}
+func NewTemplateRepo(db *sql.DB, l log.Writer) *TemplateRepo {
+	return &TemplateRepo{sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_template")}
 }
 
-func (r *TemplateRepo) GetByID(id string) (*model.Template, error) {
+func (r *TemplateRepo) GetByID(ctx context.Context, id string) (*model.Template, error) {
 	r.l.Info("Fetching template by ID", "id", id)
 
-	template, err := r.sqlcRepo.GetTemplate(r.ctx, id)
+	template, err := r.sqlcRepo.GetTemplate(ctx, id)
 	if err != nil {
 		r.l.Error("Error fetching template by ID", err)
 
@@ -32,10 +31,10 @@ func (r *TemplateRepo) GetByID(id string) (*model.Template, error) {
 	return unmarshalTemplate(template), nil
 }
 
-func (r *TemplateRepo) GetAll() ([]*model.Template, error) {
+func (r *TemplateRepo) GetAll(ctx context.Context) ([]*model.Template, error) {
 	r.l.Info("Fetching all templates")
 
-	templates, err := r.sqlcRepo.GetAllTemplates(r.ctx)
+	templates, err := r.sqlcRepo.GetAllTemplates(ctx)
 	if err != nil {
 		r.l.Error("Error fetching all templates", err)
 
@@ -45,14 +44,19 @@ func (r *TemplateRepo) GetAll() ([]*model.Template, error) {
 	return unmarshalTemplates(templates), nil
 }
 
-func (r *TemplateRepo) Create(template *model.Template) (*model.Template, error) {
+func (r *TemplateRepo) Create(ctx context.Context, template *model.Template) (*model.Template, error) {
 	r.l.Info("Creating new template", "template", template)
 
-	createdTemplateID, err := r.sqlcRepo.CreateTemplate(r.ctx, sqlcrepo.CreateTemplateParams{
-		ID:         template.ID,
-		Name:       template.Name,
-		RepoName:   template.RepoName,
-		Dockerfile: template.Dockerfile,
+	createdTemplateID, err := r.sqlcRepo.CreateTemplate(ctx, sqlcrepo.CreateTemplateParams{
+		ID:          template.ID,
+		Name:        template.Name,
+		RepoName:    template.RepoName,
+		Dockerfile:  template.Dockerfile,
+		IdleTimeout: toNullInt(template.IdleTimeout),
+		CpuQuota:    template.Limits.CPUQuota,
+		Memory:      template.Limits.Memory,
+		MemorySwap:  template.Limits.MemorySwap,
+		PidsLimit:   template.Limits.PidsLimit,
 	})
 	if err != nil {
 		r.l.Error("Error creating template", err)
@@ -60,13 +64,13 @@ func (r *TemplateRepo) Create(template *model.Template) (*model.Template, error)
 		return nil, err
 	}
 
-	return r.GetByID(createdTemplateID)
+	return r.GetByID(ctx, createdTemplateID)
 }
 
-func (r *TemplateRepo) Delete(id string) error {
+func (r *TemplateRepo) Delete(ctx context.Context, id string) error {
 	r.l.Info("Deleting template by ID", "id", id)
 
-	err := r.sqlcRepo.DeleteTemplate(r.ctx, id)
+	err := r.sqlcRepo.DeleteTemplate(ctx, id)
 	if err != nil {
 		r.l.Error("Error deleting template by ID", err)
 
@@ -76,29 +80,41 @@ func (r *TemplateRepo) Delete(id string) error {
 	return nil
 }
 
-func (r *TemplateRepo) Update(template *model.Template) (*model.Template, error) {
+func (r *TemplateRepo) Update(ctx context.Context, template *model.Template) (*model.Template, error) {
 	r.l.Info("Updating template", template)
 
-	if err := r.sqlcRepo.UpdateTemplate(r.ctx, sqlcrepo.UpdateTemplateParams{
-		Name:       template.Name,
-		RepoName:   template.RepoName,
-		Dockerfile: template.Dockerfile,
-		ID:         template.ID,
+	if err := r.sqlcRepo.UpdateTemplate(ctx, sqlcrepo.UpdateTemplateParams{
+		Name:        template.Name,
+		RepoName:    template.RepoName,
+		Dockerfile:  template.Dockerfile,
+		IdleTimeout: toNullInt(template.IdleTimeout),
+		CpuQuota:    template.Limits.CPUQuota,
+		Memory:      template.Limits.Memory,
+		MemorySwap:  template.Limits.MemorySwap,
+		PidsLimit:   template.Limits.PidsLimit,
+		ID:          template.ID,
 	}); err != nil {
 		r.l.Error("Error updating template", err)
 
 		return nil, err
 	}
 
-	return r.GetByID(template.ID)
+	return r.GetByID(ctx, template.ID)
 }
 
 func unmarshalTemplate(template sqlcrepo.Template) *model.Template {
 	return &model.Template{
-		ID:         template.ID,
-		Name:       template.Name,
-		RepoName:   template.RepoName,
-		Dockerfile: template.Dockerfile,
+		ID:          template.ID,
+		Name:        template.Name,
+		RepoName:    template.RepoName,
+		Dockerfile:  template.Dockerfile,
+		IdleTimeout: fromNullInt(template.IdleTimeout),
+		Limits: model.ResourceLimits{
+			CPUQuota:   template.CpuQuota,
+			Memory:     template.Memory,
+			MemorySwap: template.MemorySwap,
+			PidsLimit:  template.PidsLimit,
+		},
 	}
 }
 
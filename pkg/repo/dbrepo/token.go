@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/kaibling/apiforge/log"
 	"github.com/kaibling/cerodev/model"
@@ -12,19 +14,24 @@ import (
 )
 
 type TokenRepo struct {
-	ctx      context.Context
 	sqlcRepo *sqlcrepo.Queries
 	l        log.Writer
 }
 
-func NewTokenRepo(ctx context.Context, db *sql.DB, l log.Writer) *TokenRepo {
-	return &TokenRepo{ctx: ctx, sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_token")}
+func NewTokenRepo(db *sql.DB, l log.Writer) *TokenRepo {
+	return &TokenRepo{sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_token")}
 }
 
-func (r *TokenRepo) Create(token *model.Token) (*model.Token, error) {
-	err := r.sqlcRepo.CreateToken(r.ctx, sqlcrepo.CreateTokenParams{
-		Token:  token.Token,
-		UserID: token.UserID,
+func (r *TokenRepo) Create(ctx context.Context, token *model.Token) (*model.Token, error) {
+	err := r.sqlcRepo.CreateToken(ctx, sqlcrepo.CreateTokenParams{
+		ID:        token.ID,
+		TokenHash: token.TokenHash,
+		UserID:    token.UserID,
+		Name:      token.Name,
+		Kind:      string(token.Kind),
+		Scopes:    joinScopes(token.Scopes),
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: toNullTime(token.ExpiresAt),
 	})
 	if err != nil {
 		r.l.Error("failed to create token", err)
@@ -32,16 +39,16 @@ func (r *TokenRepo) Create(token *model.Token) (*model.Token, error) {
 		return nil, err
 	}
 
-	return r.Get(token.Token)
+	return r.GetByID(ctx, token.ID)
 }
 
-func (r *TokenRepo) Get(tokenKey string) (*model.Token, error) {
-	token, err := r.sqlcRepo.GetToken(r.ctx, tokenKey)
+func (r *TokenRepo) GetByHash(ctx context.Context, tokenHash string) (*model.Token, error) {
+	token, err := r.sqlcRepo.GetTokenByHash(ctx, tokenHash)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			r.l.Info("no token found")
 
-			return nil, fmt.Errorf("no token found: %w", err)
+			return nil, fmt.Errorf("no token found: %w", ToAppError(err))
 		}
 
 		r.l.Error("failed to get token", err)
@@ -49,14 +56,22 @@ func (r *TokenRepo) Get(tokenKey string) (*model.Token, error) {
 		return nil, err
 	}
 
-	return &model.Token{
-		Token:  token.Token,
-		UserID: token.UserID,
-	}, nil
+	return unmarshalToken(token), nil
 }
 
-func (r *TokenRepo) GetByUserID(userID string) ([]*model.Token, error) {
-	tokens, err := r.sqlcRepo.GetTokenByUserID(r.ctx, userID)
+func (r *TokenRepo) GetByID(ctx context.Context, id string) (*model.Token, error) {
+	token, err := r.sqlcRepo.GetTokenByID(ctx, id)
+	if err != nil {
+		r.l.Error("failed to get token by ID", err)
+
+		return nil, ToAppError(err)
+	}
+
+	return unmarshalToken(token), nil
+}
+
+func (r *TokenRepo) GetByUserID(ctx context.Context, userID string) ([]*model.Token, error) {
+	tokens, err := r.sqlcRepo.GetTokensByUserID(ctx, userID)
 	if err != nil {
 		r.l.Error("failed to get tokens by user ID", err)
 
@@ -65,17 +80,14 @@ func (r *TokenRepo) GetByUserID(userID string) ([]*model.Token, error) {
 
 	result := []*model.Token{}
 	for _, token := range tokens {
-		result = append(result, &model.Token{
-			Token:  token.Token,
-			UserID: token.UserID,
-		})
+		result = append(result, unmarshalToken(token))
 	}
 
 	return result, nil
 }
 
-func (r *TokenRepo) Delete(token string) error {
-	err := r.sqlcRepo.DeleteToken(r.ctx, token)
+func (r *TokenRepo) Delete(ctx context.Context, id string) error {
+	err := r.sqlcRepo.DeleteToken(ctx, id)
 	if err != nil {
 		r.l.Error("failed to delete token", err)
 
@@ -84,3 +96,111 @@ func (r *TokenRepo) Delete(token string) error {
 
 	return nil
 }
+
+func (r *TokenRepo) DeleteByHash(ctx context.Context, tokenHash string) error {
+	err := r.sqlcRepo.DeleteTokenByHash(ctx, tokenHash)
+	if err != nil {
+		r.l.Error("failed to delete token by hash", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *TokenRepo) DeleteByUserIDAndName(ctx context.Context, userID, name string) error {
+	err := r.sqlcRepo.DeleteTokensByUserIDAndName(ctx, sqlcrepo.DeleteTokensByUserIDAndNameParams{
+		UserID: userID,
+		Name:   name,
+	})
+	if err != nil {
+		r.l.Error("failed to delete tokens by name", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *TokenRepo) UpdateLastUsed(ctx context.Context, id string, lastUsed time.Time) error {
+	err := r.sqlcRepo.UpdateTokenLastUsed(ctx, sqlcrepo.UpdateTokenLastUsedParams{
+		LastUsedAt: toNullTime(&lastUsed),
+		ID:         id,
+	})
+	if err != nil {
+		r.l.Error("failed to update token last used", err)
+
+		return err
+	}
+
+	return nil
+}
+
+func unmarshalToken(token sqlcrepo.Token) *model.Token {
+	return &model.Token{ //nolint:exhaustruct
+		ID:         token.ID,
+		TokenHash:  token.TokenHash,
+		UserID:     token.UserID,
+		Name:       token.Name,
+		Kind:       model.TokenKind(token.Kind),
+		Scopes:     splitScopes(token.Scopes),
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  fromNullTime(token.ExpiresAt),
+		LastUsedAt: fromNullTime(token.LastUsedAt),
+	}
+}
+
+func joinScopes(scopes []model.Permission) string {
+	s := make([]string, len(scopes))
+	for i, scope := range scopes {
+		s[i] = string(scope)
+	}
+
+	return strings.Join(s, ",")
+}
+
+func splitScopes(s string) []model.Permission {
+	scopes := []model.Permission{}
+
+	for _, scope := range strings.Split(s, ",") {
+		if scope != "" {
+			scopes = append(scopes, model.Permission(scope))
+		}
+	}
+
+	return scopes
+}
+
+func toNullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{} //nolint:exhaustruct
+	}
+
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func fromNullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.Time
+}
+
+func toNullInt(i *int) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{} //nolint:exhaustruct
+	}
+
+	return sql.NullInt64{Int64: int64(*i), Valid: true}
+}
+
+func fromNullInt(i sql.NullInt64) *int {
+	if !i.Valid {
+		return nil
+	}
+
+	v := int(i.Int64)
+
+	return &v
+}
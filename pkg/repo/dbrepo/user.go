@@ -10,17 +10,17 @@ import (
 )
 
 type UserRepo struct {
-	ctx      context.Context
+	db       *sql.DB
 	sqlcRepo *sqlcrepo.Queries
 	l        log.Writer
 }
 
-func NewUserRepo(ctx context.Context, db *sql.DB, l log.Writer) *UserRepo {
-	return &UserRepo{ctx: ctx, sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_user")}
+func NewUserRepo(db *sql.DB, l log.Writer) *UserRepo {
+	return &UserRepo{db: db, sqlcRepo: sqlcrepo.New(db), l: l.Named("repo_user")}
 }
 
-func (r *UserRepo) GetByID(id string) (*model.User, error) {
-	rows, err := r.sqlcRepo.GetUserByID(r.ctx, id)
+func (r *UserRepo) GetByID(ctx context.Context, id string) (*model.User, error) {
+	rows, err := r.sqlcRepo.GetUserByID(ctx, id)
 	if err != nil {
 		r.l.Error("failed to get user by username", err)
 
@@ -33,16 +33,18 @@ func (r *UserRepo) GetByID(id string) (*model.User, error) {
 	for _, row := range rows {
 		user.ID = row.ID
 		user.Username = row.Username
+		user.Role = model.Role(row.Role)
+		user.IdleTimeout = fromNullInt(row.IdleTimeout)
 
-		if row.Token.Valid {
-			tokens = append(tokens, row.Token.String)
+		if row.TokenID.Valid {
+			tokens = append(tokens, row.TokenID.String)
 		}
 	}
 
 	if user.ID == "" {
-		r.l.Warn("no user found with username")
+		r.l.Warn("no user found with id")
 
-		return nil, sql.ErrNoRows
+		return nil, ToAppError(sql.ErrNoRows)
 	}
 
 	user.Tokens = tokens
@@ -50,8 +52,8 @@ func (r *UserRepo) GetByID(id string) (*model.User, error) {
 	return &user, nil
 }
 
-func (r *UserRepo) GetUnsafeByUsername(username string) (*model.User, error) {
-	rows, err := r.sqlcRepo.GetUnsafeUserByUsername(r.ctx, username)
+func (r *UserRepo) GetUnsafeByUsername(ctx context.Context, username string) (*model.User, error) {
+	rows, err := r.sqlcRepo.GetUnsafeUserByUsername(ctx, username)
 	if err != nil {
 		r.l.Error("failed to get user by username", err)
 
@@ -64,10 +66,12 @@ func (r *UserRepo) GetUnsafeByUsername(username string) (*model.User, error) {
 	for _, row := range rows {
 		user.ID = row.ID
 		user.Username = row.Username
+		user.Role = model.Role(row.Role)
+		user.IdleTimeout = fromNullInt(row.IdleTimeout)
 		user.Password = row.Password
 
-		if row.Token.Valid {
-			tokens = append(tokens, row.Token.String)
+		if row.TokenID.Valid {
+			tokens = append(tokens, row.TokenID.String)
 		}
 	}
 
@@ -82,8 +86,8 @@ func (r *UserRepo) GetUnsafeByUsername(username string) (*model.User, error) {
 	return &user, nil
 }
 
-func (r *UserRepo) GetAll() ([]*model.User, error) {
-	rows, err := r.sqlcRepo.GetAllUsers(r.ctx)
+func (r *UserRepo) GetAll(ctx context.Context) ([]*model.User, error) {
+	rows, err := r.sqlcRepo.GetAllUsers(ctx)
 	if err != nil {
 		r.l.Error("failed to get all users", err)
 
@@ -91,21 +95,24 @@ func (r *UserRepo) GetAll() ([]*model.User, error) {
 	}
 
 	users := []*model.User{}
-	currentTokens := []string{}
-	currentUser := model.User{} //nolint:exhaustruct
+	byID := map[string]*model.User{}
 
 	for _, row := range rows {
-		if currentUser.ID != row.ID && currentUser.ID != "" {
-			currentUser := model.User{}
-			currentUser.ID = row.ID
-			currentUser.Username = row.Username
-			currentUser.Tokens = currentTokens
-			users = append(users, &currentUser)
-			currentTokens = []string{}
+		user, ok := byID[row.ID]
+		if !ok {
+			user = &model.User{ //nolint:exhaustruct
+				ID:          row.ID,
+				Username:    row.Username,
+				Role:        model.Role(row.Role),
+				Tokens:      []string{},
+				IdleTimeout: fromNullInt(row.IdleTimeout),
+			}
+			byID[row.ID] = user
+			users = append(users, user)
 		}
 
-		if row.Token.Valid {
-			currentTokens = append(currentTokens, row.Token.String)
+		if row.TokenID.Valid {
+			user.Tokens = append(user.Tokens, row.TokenID.String)
 		}
 	}
 
@@ -118,11 +125,12 @@ func (r *UserRepo) GetAll() ([]*model.User, error) {
 	return users, nil
 }
 
-func (r *UserRepo) Create(user *model.User) (*model.User, error) {
-	userID, err := r.sqlcRepo.CreateUser(r.ctx, sqlcrepo.CreateUserParams{
+func (r *UserRepo) Create(ctx context.Context, user *model.User) (*model.User, error) {
+	userID, err := r.sqlcRepo.CreateUser(ctx, sqlcrepo.CreateUserParams{
 		ID:       user.ID,
 		Username: user.Username,
 		Password: user.Password,
+		Role:     string(user.Role),
 	})
 	if err != nil {
 		r.l.Error("failed to create user", err)
@@ -130,22 +138,44 @@ func (r *UserRepo) Create(user *model.User) (*model.User, error) {
 		return nil, err
 	}
 
-	return r.GetByID(userID)
+	return r.GetByID(ctx, userID)
 }
 
-func (r *UserRepo) Delete(id string) error {
-	err := r.sqlcRepo.DeleteUser(r.ctx, id)
+// Delete removes the secrets of a user and the user in one transaction. The
+// rows referencing the user are removed by the db cascade.
+func (r *UserRepo) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	qtx := sqlcrepo.New(tx)
+
+	err = qtx.DeleteSecretsByOwner(ctx, sqlcrepo.DeleteSecretsByOwnerParams{
+		Scope:   string(model.SecretScopeUser),
+		OwnerID: id,
+	})
+	if err == nil {
+		err = qtx.DeleteUser(ctx, id)
+	}
+
 	if err != nil {
 		r.l.Error("failed to delete user", err)
 
+		if rerr := tx.Rollback(); rerr != nil {
+			r.l.Error("failed to rollback transaction", rerr)
+
+			return rerr
+		}
+
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (r *UserRepo) Update(user *model.User) error {
-	err := r.sqlcRepo.UpdateUser(r.ctx, sqlcrepo.UpdateUserParams{
+func (r *UserRepo) Update(ctx context.Context, user *model.User) error {
+	err := r.sqlcRepo.UpdateUser(ctx, sqlcrepo.UpdateUserParams{
 		Username: user.Username,
 		Password: user.Password,
 		ID:       user.ID,
@@ -159,30 +189,29 @@ func (r *UserRepo) Update(user *model.User) error {
 	return nil
 }
 
-func (r *UserRepo) GetUserByToken(token string) (*model.User, error) {
-	rows, err := r.sqlcRepo.GetUserByToken(r.ctx, token)
+func (r *UserRepo) UpdateRole(ctx context.Context, id string, role model.Role) error {
+	err := r.sqlcRepo.UpdateUserRole(ctx, sqlcrepo.UpdateUserRoleParams{
+		Role: string(role),
+		ID:   id,
+	})
 	if err != nil {
-		r.l.Error("failed to get user by token", err)
+		r.l.Error("failed to update user role", err)
 
-		return nil, err
+		return err
 	}
 
-	user := model.User{}
-	tokens := []string{}
-
-	for _, row := range rows {
-		user.ID = row.ID
-		user.Username = row.Username
-		tokens = append(tokens, row.Token)
-	}
+	return nil
+}
 
-	if user.ID == "" {
-		r.l.Warn("no user found with username")
+func (r *UserRepo) UpdateIdleTimeout(ctx context.Context, id string, idleTimeout *int) error {
+	if err := r.sqlcRepo.UpdateUserIdleTimeout(ctx, sqlcrepo.UpdateUserIdleTimeoutParams{
+		IdleTimeout: toNullInt(idleTimeout),
+		ID:          id,
+	}); err != nil {
+		r.l.Error("failed to update user idle timeout", err)
 
-		return nil, sql.ErrNoRows
+		return ToAppError(err)
 	}
 
-	user.Tokens = tokens
-
-	return &user, nil
+	return nil
 }
@@ -0,0 +1,91 @@
+-- name: CreateBuildJob :exec
+INSERT INTO
+    build_jobs (id, template_id, user_id, tag, status, created_at)
+VALUES
+    (?, ?, ?, ?, ?, ?);
+
+-- name: GetBuildJobByID :one
+SELECT
+    id,
+    template_id,
+    user_id,
+    tag,
+    status,
+    logs,
+    error,
+    created_at,
+    started_at,
+    finished_at
+FROM
+    build_jobs
+WHERE
+    id = ?;
+
+-- name: GetAllBuildJobs :many
+SELECT
+    id,
+    template_id,
+    user_id,
+    tag,
+    status,
+    logs,
+    error,
+    created_at,
+    started_at,
+    finished_at
+FROM
+    build_jobs
+ORDER BY
+    created_at DESC;
+
+-- name: GetBuildJobsByUserID :many
+SELECT
+    id,
+    template_id,
+    user_id,
+    tag,
+    status,
+    logs,
+    error,
+    created_at,
+    started_at,
+    finished_at
+FROM
+    build_jobs
+WHERE
+    user_id = ?
+ORDER BY
+    created_at DESC;
+
+-- name: StartBuildJob :exec
+UPDATE build_jobs
+SET
+    status = ?,
+    started_at = ?
+WHERE
+    id = ?;
+
+-- name: FinishBuildJob :exec
+UPDATE build_jobs
+SET
+    status = ?,
+    error = ?,
+    finished_at = ?
+WHERE
+    id = ?;
+
+-- name: UpdateBuildJobLogs :exec
+UPDATE build_jobs
+SET
+    logs = ?
+WHERE
+    id = ?;
+
+-- name: FailUnfinishedBuildJobs :exec
+UPDATE build_jobs
+SET
+    status = ?,
+    error = ?,
+    finished_at = ?
+WHERE
+    status IN ('queued', 'running');
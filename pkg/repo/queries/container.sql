@@ -6,12 +6,19 @@ INSERT INTO
         image_name,
         container_name,
         git_repo,
+        git_ref,
+        git_depth,
         user_id,
         env_vars,
-        ports
+        ports,
+        cpu_quota,
+        memory,
+        memory_swap,
+        pids_limit,
+        node_id
     )
 VALUES
-    (?, ?, ?, ?, ?, ?, ?, ?) returning id;
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) returning id;
 
 -- name: DeleteContainer :exec
 DELETE FROM containers
@@ -25,15 +32,26 @@ SELECT
     c.image_name,
     c.container_name,
     c.git_repo,
+    c.git_ref,
+    c.git_depth,
     c.user_id,
     c.env_vars,
     c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
     p.port as ui_port
 FROM
     containers c
-    JOIN ports p on p.container_id = c.id
+    JOIN node_ports p on p.container_id = c.id
 WHERE
-    id = ?;
+    id = ?
+    AND c.deleted_at IS NULL;
 
 -- name: GetAllContainers :many
 SELECT
@@ -42,19 +60,31 @@ SELECT
     c.image_name,
     c.container_name,
     c.git_repo,
+    c.git_ref,
+    c.git_depth,
     c.user_id,
     c.env_vars,
     c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
     p.port as ui_port
 FROM
     containers c
-    JOIN ports p on p.container_id = c.id;
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.deleted_at IS NULL;
 
 -- name: GetPortByContainerID :one
 SELECT
     port
 FROM
-    ports
+    node_ports
 WHERE
     container_id = ?;
 
@@ -62,35 +92,95 @@ WHERE
 SELECT
     port
 FROM
-    ports
+    node_ports
 WHERE
-    in_use = 0
+    node_id = ?
+    AND in_use = 0
 ORDER BY
     port
 LIMIT
     1;
 
 -- name: AllocatePort :exec
-UPDATE ports
+UPDATE node_ports
 SET
     in_use = 1,
-    container_id = ?
+    container_id = ?,
+    reserved_at = ?
+WHERE
+    node_id = ?
+    AND port = ?;
+
+-- name: AllocateFreePort :execrows
+UPDATE node_ports
+SET
+    in_use = 1,
+    container_id = ?,
+    reserved_at = ?
+WHERE
+    node_id = ?
+    AND port = ?
+    AND in_use = 0;
+
+-- name: ReservePort :execrows
+UPDATE node_ports
+SET
+    in_use = 1,
+    container_id = NULL,
+    reserved_at = ?
 WHERE
-    port = ?;
+    node_id = ?
+    AND port = ?
+    AND in_use = 0;
+
+-- name: GetStalePorts :many
+SELECT
+    node_id,
+    port
+FROM
+    node_ports
+WHERE
+    in_use = 1
+    AND (
+        container_id IS NULL
+        OR container_id NOT IN (
+            SELECT
+                id
+            FROM
+                containers
+        )
+    )
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            published_ports pp
+            JOIN containers c ON c.id = pp.container_id
+        WHERE
+            c.node_id = node_ports.node_id
+            AND pp.host_port = node_ports.port
+    )
+    AND (
+        reserved_at IS NULL
+        OR reserved_at < ?
+    );
 
 -- name: ReleasePortbyPort :exec
-UPDATE ports
+UPDATE node_ports
 SET
     in_use = 0,
-    container_id = NULL
+    container_id = NULL,
+    reserved_at = NULL
 WHERE
-    port = ?;
+    node_id = ?
+    AND port = ?;
 
 -- name: ReleasePortByContainer :exec
-UPDATE ports
+UPDATE node_ports
 SET
     in_use = 0,
-    container_id = NULL
+    container_id = NULL,
+    reserved_at = NULL
 WHERE
     container_id = ?;
 
@@ -101,9 +191,15 @@ SET
     image_name = ?,
     container_name = ?,
     git_repo = ?,
+    git_ref = ?,
+    git_depth = ?,
     user_id = ?,
     env_vars = ?,
-    ports = ?
+    ports = ?,
+    cpu_quota = ?,
+    memory = ?,
+    memory_swap = ?,
+    pids_limit = ?
 WHERE
     id = ?;
 
@@ -111,10 +207,330 @@ WHERE
 SELECT
     count(port)
 FROM
-    ports;
+    node_ports
+WHERE
+    node_id = ?;
 
 -- name: CreatePort :exec
 INSERT INTO
-    ports (port, in_use, container_id)
+    node_ports (node_id, port, in_use, container_id)
 VALUES
-    (?, 0, NULL);
\ No newline at end of file
+    (?, ?, 0, NULL) ON CONFLICT (node_id, port) DO NOTHING;
+
+-- name: CountPortsInUseOutside :one
+SELECT
+    count(port)
+FROM
+    node_ports
+WHERE
+    node_id = ?
+    AND in_use = 1
+    AND (
+        port < sqlc.arg(min_port)
+        OR port > sqlc.arg(max_port)
+    );
+
+-- name: DeletePortsOutside :exec
+DELETE FROM node_ports
+WHERE
+    node_id = ?
+    AND in_use = 0
+    AND (
+        port < sqlc.arg(min_port)
+        OR port > sqlc.arg(max_port)
+    );
+
+-- name: DeletePortsByNode :exec
+DELETE FROM node_ports
+WHERE
+    node_id = ?;
+
+-- name: GetFreePortCounts :many
+SELECT
+    node_id,
+    count(port) AS free
+FROM
+    node_ports
+WHERE
+    in_use = 0
+GROUP BY
+    node_id;
+
+-- name: GetContainerByIDAndUserID :one
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.id = ?
+    AND c.user_id = ?
+    AND c.deleted_at IS NULL;
+
+-- name: GetAllContainersByUserID :many
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.user_id = ?
+    AND c.deleted_at IS NULL;
+
+-- name: CreateContainerShare :exec
+INSERT INTO
+    container_shares (container_id, user_id, created_at)
+VALUES
+    (?, ?, ?);
+
+-- name: DeleteContainerShare :exec
+DELETE FROM container_shares
+WHERE
+    container_id = ?
+    AND user_id = ?;
+
+-- name: GetContainerShares :many
+SELECT
+    container_id,
+    user_id,
+    created_at
+FROM
+    container_shares
+WHERE
+    container_id = ?;
+
+-- name: CountContainerShare :one
+SELECT
+    count(*)
+FROM
+    container_shares
+WHERE
+    container_id = ?
+    AND user_id = ?;
+
+-- name: CreatePublishedPort :exec
+INSERT INTO
+    published_ports (container_id, port, host_port, created_at)
+VALUES
+    (?, ?, ?, ?);
+
+-- name: DeletePublishedPort :execrows
+DELETE FROM published_ports
+WHERE
+    container_id = ?
+    AND port = ?;
+
+-- name: DeletePublishedPortsByContainer :exec
+DELETE FROM published_ports
+WHERE
+    container_id = ?;
+
+-- name: GetPublishedPorts :many
+SELECT
+    container_id,
+    port,
+    created_at,
+    host_port
+FROM
+    published_ports
+WHERE
+    container_id = ?
+ORDER BY
+    port;
+
+-- name: SetContainerMissing :exec
+UPDATE containers
+SET
+    missing_since = ?
+WHERE
+    id = ?;
+
+-- name: SetContainerLastActivity :exec
+UPDATE containers
+SET
+    last_activity_at = ?
+WHERE
+    id = ?;
+
+-- name: SetContainerDeleted :exec
+UPDATE containers
+SET
+    deleted_at = ?
+WHERE
+    id = ?;
+
+-- name: GetAnyContainerByID :one
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    id = ?;
+
+-- name: GetAllContainersWithDeleted :many
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id;
+
+-- name: GetDeletedContainers :many
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.deleted_at IS NOT NULL
+ORDER BY
+    c.deleted_at;
+
+-- name: GetDeletedContainersByUserID :many
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.user_id = ?
+    AND c.deleted_at IS NOT NULL
+ORDER BY
+    c.deleted_at;
+
+-- name: GetContainerNodeID :one
+SELECT
+    node_id
+FROM
+    containers
+WHERE
+    docker_id = ?;
+
+-- name: GetNodeReservations :many
+SELECT
+    node_id,
+    count(id) AS workspaces,
+    CAST(coalesce(sum(cpu_quota), 0) AS INTEGER) AS cpu_quota,
+    CAST(coalesce(sum(memory), 0) AS INTEGER) AS memory
+FROM
+    containers
+WHERE
+    deleted_at IS NULL
+GROUP BY
+    node_id;
+
+-- name: CountContainersByNode :one
+SELECT
+    count(id)
+FROM
+    containers
+WHERE
+    node_id = ?;
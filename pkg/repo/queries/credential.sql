@@ -0,0 +1,57 @@
+-- name: GetGitCredentialsByUserID :many
+SELECT
+    id,
+    user_id,
+    kind,
+    host,
+    username,
+    secret,
+    created_at
+FROM
+    git_credentials
+WHERE
+    user_id = ?
+ORDER BY
+    kind,
+    host;
+
+-- name: GetGitCredential :one
+SELECT
+    id,
+    user_id,
+    kind,
+    host,
+    username,
+    secret,
+    created_at
+FROM
+    git_credentials
+WHERE
+    user_id = ?
+    AND kind = ?
+    AND host = ?;
+
+-- name: UpsertGitCredential :exec
+INSERT INTO
+    git_credentials (
+        id,
+        user_id,
+        kind,
+        host,
+        username,
+        secret,
+        created_at
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (user_id, kind, host) DO
+UPDATE
+SET
+    username = excluded.username,
+    secret = excluded.secret,
+    created_at = excluded.created_at;
+
+-- name: DeleteGitCredential :execrows
+DELETE FROM git_credentials
+WHERE
+    id = ?
+    AND user_id = ?;
@@ -0,0 +1,73 @@
+-- name: CreateNode :exec
+INSERT INTO
+    nodes (
+        id,
+        name,
+        host,
+        public_url,
+        ca_cert,
+        client_cert,
+        client_key,
+        min_port,
+        max_port,
+        cordoned,
+        created_at
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetNodeByID :one
+SELECT
+    id,
+    name,
+    host,
+    public_url,
+    ca_cert,
+    client_cert,
+    client_key,
+    min_port,
+    max_port,
+    cordoned,
+    created_at
+FROM
+    nodes
+WHERE
+    id = ?;
+
+-- name: GetAllNodes :many
+SELECT
+    id,
+    name,
+    host,
+    public_url,
+    ca_cert,
+    client_cert,
+    client_key,
+    min_port,
+    max_port,
+    cordoned,
+    created_at
+FROM
+    nodes
+ORDER BY
+    name;
+
+-- name: UpdateNode :exec
+UPDATE nodes
+SET
+    name = ?,
+    host = ?,
+    public_url = ?,
+    ca_cert = ?,
+    client_cert = ?,
+    client_key = ?,
+    min_port = ?,
+    max_port = ?,
+    cordoned = ?
+WHERE
+    id = ?;
+
+-- name: DeleteNode :exec
+DELETE FROM nodes
+WHERE
+    id = ?;
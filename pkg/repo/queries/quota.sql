@@ -0,0 +1,56 @@
+-- name: GetQuota :one
+SELECT
+    kind,
+    subject,
+    max_containers,
+    max_running,
+    max_memory,
+    max_cpu_quota,
+    max_volume_size
+FROM
+    quotas
+WHERE
+    kind = ?
+    AND subject = ?;
+
+-- name: GetAllQuotas :many
+SELECT
+    kind,
+    subject,
+    max_containers,
+    max_running,
+    max_memory,
+    max_cpu_quota,
+    max_volume_size
+FROM
+    quotas
+ORDER BY
+    kind,
+    subject;
+
+-- name: UpsertQuota :exec
+INSERT INTO
+    quotas (
+        kind,
+        subject,
+        max_containers,
+        max_running,
+        max_memory,
+        max_cpu_quota,
+        max_volume_size
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (kind, subject) DO
+UPDATE
+SET
+    max_containers = excluded.max_containers,
+    max_running = excluded.max_running,
+    max_memory = excluded.max_memory,
+    max_cpu_quota = excluded.max_cpu_quota,
+    max_volume_size = excluded.max_volume_size;
+
+-- name: DeleteQuota :execrows
+DELETE FROM quotas
+WHERE
+    kind = ?
+    AND subject = ?;
@@ -0,0 +1,60 @@
+-- name: GetSecretsByOwner :many
+SELECT
+    scope,
+    owner_id,
+    name,
+    value,
+    created_at,
+    updated_at
+FROM
+    secrets
+WHERE
+    scope = ?
+    AND owner_id = ?
+ORDER BY
+    name;
+
+-- name: GetSecret :one
+SELECT
+    scope,
+    owner_id,
+    name,
+    value,
+    created_at,
+    updated_at
+FROM
+    secrets
+WHERE
+    scope = ?
+    AND owner_id = ?
+    AND name = ?;
+
+-- name: UpsertSecret :exec
+INSERT INTO
+    secrets (
+        scope,
+        owner_id,
+        name,
+        value,
+        created_at,
+        updated_at
+    )
+VALUES
+    (?, ?, ?, ?, ?, ?) ON CONFLICT (scope, owner_id, name) DO
+UPDATE
+SET
+    value = excluded.value,
+    updated_at = excluded.updated_at;
+
+-- name: DeleteSecret :execrows
+DELETE FROM secrets
+WHERE
+    scope = ?
+    AND owner_id = ?
+    AND name = ?;
+
+-- name: DeleteSecretsByOwner :exec
+DELETE FROM secrets
+WHERE
+    scope = ?
+    AND owner_id = ?;
@@ -1,8 +1,18 @@
 -- name: CreateTemplate :one
 INSERT INTO
-    templates (id, name, repo_name, dockerfile)
+    templates (
+        id,
+        name,
+        repo_name,
+        dockerfile,
+        idle_timeout,
+        cpu_quota,
+        memory,
+        memory_swap,
+        pids_limit
+    )
 VALUES
-    (?, ?, ?, ?) RETURNING id;
+    (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id;
 
 -- name: DeleteTemplate :exec
 DELETE FROM templates
@@ -14,7 +24,12 @@ UPDATE templates
 SET
     name = ?,
     repo_name = ?,
-    dockerfile = ?
+    dockerfile = ?,
+    idle_timeout = ?,
+    cpu_quota = ?,
+    memory = ?,
+    memory_swap = ?,
+    pids_limit = ?
 WHERE
     id = ?;
 
@@ -23,7 +38,12 @@ SELECT
     id,
     name,
     repo_name,
-    dockerfile
+    dockerfile,
+    idle_timeout,
+    cpu_quota,
+    memory,
+    memory_swap,
+    pids_limit
 FROM
     templates
 WHERE
@@ -34,6 +54,11 @@ SELECT
     id,
     name,
     repo_name,
-    dockerfile
+    dockerfile,
+    idle_timeout,
+    cpu_quota,
+    memory,
+    memory_swap,
+    pids_limit
 FROM
     templates;
\ No newline at end of file
@@ -1,28 +1,87 @@
 -- name: CreateToken :exec
 INSERT INTO
-	tokens (user_id, token)
+	tokens (
+		id,
+		token_hash,
+		user_id,
+		name,
+		kind,
+		scopes,
+		created_at,
+		expires_at
+	)
 VALUES
-	(?, ?);
+	(?, ?, ?, ?, ?, ?, ?, ?);
 
 -- name: DeleteToken :exec
 DELETE FROM tokens
 WHERE
-	token = ?;
+	id = ?;
 
--- name: GetToken :one
+-- name: DeleteTokenByHash :exec
+DELETE FROM tokens
+WHERE
+	token_hash = ?;
+
+-- name: DeleteTokensByUserIDAndName :exec
+DELETE FROM tokens
+WHERE
+	user_id = ?
+	AND name = ?;
+
+-- name: GetTokenByHash :one
+SELECT
+	id,
+	token_hash,
+	user_id,
+	name,
+	kind,
+	scopes,
+	created_at,
+	expires_at,
+	last_used_at
+FROM
+	tokens
+WHERE
+	token_hash = ?;
+
+-- name: GetTokenByID :one
 SELECT
+	id,
+	token_hash,
 	user_id,
-	token
+	name,
+	kind,
+	scopes,
+	created_at,
+	expires_at,
+	last_used_at
 FROM
 	tokens
 WHERE
-	token = ?;
+	id = ?;
 
--- name: GetTokenByUserID :many
+-- name: GetTokensByUserID :many
 SELECT
+	id,
+	token_hash,
 	user_id,
-	token
+	name,
+	kind,
+	scopes,
+	created_at,
+	expires_at,
+	last_used_at
 FROM
 	tokens
 WHERE
-	user_id = ?;
\ No newline at end of file
+	user_id = ?
+ORDER BY
+	created_at;
+
+-- name: UpdateTokenLastUsed :exec
+UPDATE tokens
+SET
+	last_used_at = ?
+WHERE
+	id = ?;
\ No newline at end of file
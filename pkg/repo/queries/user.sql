@@ -1,8 +1,8 @@
 -- name: CreateUser :one
 INSERT INTO
-	users (id, username, password)
+	users (id, username, password, role)
 VALUES
-	(?, ?, ?) RETURNING id;
+	(?, ?, ?, ?) RETURNING id;
 
 -- name: DeleteUser :exec
 DELETE FROM users
@@ -17,23 +17,41 @@ SET
 WHERE
 	id = ?;
 
+-- name: UpdateUserRole :exec
+UPDATE users
+SET
+	role = ?
+WHERE
+	id = ?;
+
+-- name: UpdateUserIdleTimeout :exec
+UPDATE users
+SET
+	idle_timeout = ?
+WHERE
+	id = ?;
+
 -- name: GetUserByID :many
 SELECT
 	u.id,
 	u.username,
-	t.token
+	u.role,
+	u.idle_timeout,
+	t.id AS token_id
 FROM
 	users u
 	LEFT JOIN tokens t ON u.id = t.user_id
 WHERE
-	id = ?;
+	u.id = ?;
 
 -- name: GetUnsafeUserByUsername :many
 SELECT
 	u.id,
 	u.username,
 	u.password,
-	t.token
+	u.role,
+	u.idle_timeout,
+	t.id AS token_id
 FROM
 	users u
 	LEFT JOIN tokens t ON u.id = t.user_id
@@ -44,25 +62,9 @@ WHERE
 SELECT
 	u.id,
 	u.username,
-	t.token
+	u.role,
+	u.idle_timeout,
+	t.id AS token_id
 FROM
 	users u
-	LEFT JOIN tokens t ON u.id = t.user_id;
-
--- name: GetUserByToken :many
-SELECT
-	u.id,
-	u.username,
-	t.token
-FROM
-	tokens t
-	JOIN users u ON t.user_id = u.id
-WHERE
-	u.id = (
-		SELECT
-			user_id
-		FROM
-			tokens
-		WHERE
-			tokens.token = ?
-	);
\ No newline at end of file
+	LEFT JOIN tokens t ON u.id = t.user_id;
\ No newline at end of file
@@ -2,13 +2,22 @@ CREATE TABLE
     IF NOT EXISTS users (
         id TEXT PRIMARY KEY,
         username TEXT NOT NULL UNIQUE,
-        password TEXT NOT NULL
+        password TEXT NOT NULL,
+        role TEXT NOT NULL DEFAULT 'developer',
+        idle_timeout INTEGER
     );
 
 CREATE TABLE
     IF NOT EXISTS tokens (
-        token TEXT PRIMARY KEY,
+        id TEXT PRIMARY KEY,
+        token_hash TEXT NOT NULL UNIQUE,
         user_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        kind TEXT NOT NULL DEFAULT 'api',
+        scopes TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        expires_at DATETIME,
+        last_used_at DATETIME,
         FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
     );
 
@@ -17,7 +26,12 @@ CREATE TABLE
         id TEXT PRIMARY KEY,
         name TEXT NOT NULL,
         repo_name TEXT NOT NULL,
-        dockerfile TEXT NOT NULL
+        dockerfile TEXT NOT NULL,
+        idle_timeout INTEGER,
+        cpu_quota INTEGER NOT NULL DEFAULT 0,
+        memory INTEGER NOT NULL DEFAULT 0,
+        memory_swap INTEGER NOT NULL DEFAULT 0,
+        pids_limit INTEGER NOT NULL DEFAULT 0
     );
 
 CREATE TABLE
@@ -27,16 +41,114 @@ CREATE TABLE
         image_name TEXT NOT NULL,
         container_name TEXT NOT NULL,
         git_repo TEXT,
+        git_ref TEXT NOT NULL DEFAULT '',
+        git_depth INTEGER NOT NULL DEFAULT 0,
         user_id TEXT NOT NULL,
         env_vars TEXT,
         ports TEXT,
+        missing_since DATETIME,
+        last_activity_at DATETIME,
+        cpu_quota INTEGER NOT NULL DEFAULT 0,
+        memory INTEGER NOT NULL DEFAULT 0,
+        memory_swap INTEGER NOT NULL DEFAULT 0,
+        pids_limit INTEGER NOT NULL DEFAULT 0,
+        deleted_at DATETIME,
+        node_id TEXT NOT NULL DEFAULT 'local',
         FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
     );
 
 CREATE TABLE
-    IF NOT EXISTS ports (
-        port INTEGER PRIMARY KEY,
+    IF NOT EXISTS nodes (
+        id TEXT PRIMARY KEY,
+        name TEXT NOT NULL UNIQUE,
+        host TEXT NOT NULL,
+        public_url TEXT NOT NULL,
+        ca_cert TEXT NOT NULL DEFAULT '',
+        client_cert TEXT NOT NULL DEFAULT '',
+        client_key TEXT NOT NULL DEFAULT '',
+        min_port INTEGER NOT NULL,
+        max_port INTEGER NOT NULL,
+        cordoned BOOLEAN NOT NULL DEFAULT 0,
+        created_at DATETIME NOT NULL
+    );
+
+CREATE TABLE
+    IF NOT EXISTS node_ports (
+        node_id TEXT NOT NULL,
+        port INTEGER NOT NULL,
         in_use BOOLEAN NOT NULL,
         container_id TEXT,
+        reserved_at DATETIME,
+        PRIMARY KEY (node_id, port),
         FOREIGN KEY (container_id) REFERENCES containers (id)
-    );
\ No newline at end of file
+    );
+
+CREATE TABLE
+    IF NOT EXISTS container_shares (
+        container_id TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        PRIMARY KEY (container_id, user_id),
+        FOREIGN KEY (container_id) REFERENCES containers (id) ON DELETE CASCADE,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE TABLE
+    IF NOT EXISTS published_ports (
+        container_id TEXT NOT NULL,
+        port INTEGER NOT NULL,
+        created_at DATETIME NOT NULL,
+        host_port INTEGER NOT NULL,
+        PRIMARY KEY (container_id, port),
+        FOREIGN KEY (container_id) REFERENCES containers (id) ON DELETE CASCADE
+    );
+
+CREATE TABLE
+    IF NOT EXISTS build_jobs (
+        id TEXT PRIMARY KEY,
+        template_id TEXT NOT NULL,
+        user_id TEXT NOT NULL,
+        tag TEXT NOT NULL,
+        status TEXT NOT NULL,
+        logs TEXT NOT NULL DEFAULT '',
+        error TEXT NOT NULL DEFAULT '',
+        created_at DATETIME NOT NULL,
+        started_at DATETIME,
+        finished_at DATETIME,
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+CREATE TABLE
+    IF NOT EXISTS quotas (
+        kind TEXT NOT NULL,
+        subject TEXT NOT NULL,
+        max_containers INTEGER NOT NULL DEFAULT 0,
+        max_running INTEGER NOT NULL DEFAULT 0,
+        max_memory INTEGER NOT NULL DEFAULT 0,
+        max_cpu_quota INTEGER NOT NULL DEFAULT 0,
+        max_volume_size INTEGER NOT NULL DEFAULT 0,
+        PRIMARY KEY (kind, subject)
+    );
+
+CREATE TABLE
+    IF NOT EXISTS git_credentials (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL,
+        kind TEXT NOT NULL,
+        host TEXT NOT NULL,
+        username TEXT NOT NULL DEFAULT '',
+        secret TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        UNIQUE (user_id, kind, host),
+        FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+    );
+
+CREATE TABLE
+    IF NOT EXISTS secrets (
+        scope TEXT NOT NULL,
+        owner_id TEXT NOT NULL,
+        name TEXT NOT NULL,
+        value TEXT NOT NULL,
+        created_at DATETIME NOT NULL,
+        updated_at DATETIME NOT NULL,
+        PRIMARY KEY (scope, owner_id, name)
+    );
@@ -8,27 +8,134 @@ package sqlcrepo
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
+const allocateFreePort = `-- name: AllocateFreePort :execrows
+UPDATE node_ports
+SET
+    in_use = 1,
+    container_id = ?,
+    reserved_at = ?
+WHERE
+    node_id = ?
+    AND port = ?
+    AND in_use = 0
+`
+
+type AllocateFreePortParams struct {
+	ContainerID sql.NullString
+	ReservedAt  sql.NullTime
+	NodeID      string
+	Port        int64
+}
+
+func (q *Queries) AllocateFreePort(ctx context.Context, arg AllocateFreePortParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, allocateFreePort,
+		arg.ContainerID,
+		arg.ReservedAt,
+		arg.NodeID,
+		arg.Port,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const allocatePort = `-- name: AllocatePort :exec
-UPDATE ports
+UPDATE node_ports
 SET
     in_use = 1,
-    container_id = ?
+    container_id = ?,
+    reserved_at = ?
 WHERE
-    port = ?
+    node_id = ?
+    AND port = ?
 `
 
 type AllocatePortParams struct {
 	ContainerID sql.NullString
+	ReservedAt  sql.NullTime
+	NodeID      string
 	Port        int64
 }
 
 func (q *Queries) AllocatePort(ctx context.Context, arg AllocatePortParams) error {
-	_, err := q.db.ExecContext(ctx, allocatePort, arg.ContainerID, arg.Port)
+	_, err := q.db.ExecContext(ctx, allocatePort,
+		arg.ContainerID,
+		arg.ReservedAt,
+		arg.NodeID,
+		arg.Port,
+	)
 	return err
 }
 
+const countContainerShare = `-- name: CountContainerShare :one
+SELECT
+    count(*)
+FROM
+    container_shares
+WHERE
+    container_id = ?
+    AND user_id = ?
+`
+
+type CountContainerShareParams struct {
+	ContainerID string
+	UserID      string
+}
+
+func (q *Queries) CountContainerShare(ctx context.Context, arg CountContainerShareParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countContainerShare, arg.ContainerID, arg.UserID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countContainersByNode = `-- name: CountContainersByNode :one
+SELECT
+    count(id)
+FROM
+    containers
+WHERE
+    node_id = ?
+`
+
+func (q *Queries) CountContainersByNode(ctx context.Context, nodeID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countContainersByNode, nodeID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPortsInUseOutside = `-- name: CountPortsInUseOutside :one
+SELECT
+    count(port)
+FROM
+    node_ports
+WHERE
+    node_id = ?
+    AND in_use = 1
+    AND (
+        port < ?
+        OR port > ?
+    )
+`
+
+type CountPortsInUseOutsideParams struct {
+	NodeID  string
+	MinPort int64
+	MaxPort int64
+}
+
+func (q *Queries) CountPortsInUseOutside(ctx context.Context, arg CountPortsInUseOutsideParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPortsInUseOutside, arg.NodeID, arg.MinPort, arg.MaxPort)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createContainer = `-- name: CreateContainer :one
 INSERT INTO
     containers (
@@ -37,12 +144,19 @@ INSERT INTO
         image_name,
         container_name,
         git_repo,
+        git_ref,
+        git_depth,
         user_id,
         env_vars,
-        ports
+        ports,
+        cpu_quota,
+        memory,
+        memory_swap,
+        pids_limit,
+        node_id
     )
 VALUES
-    (?, ?, ?, ?, ?, ?, ?, ?) returning id
+    (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) returning id
 `
 
 type CreateContainerParams struct {
@@ -51,9 +165,16 @@ type CreateContainerParams struct {
 	ImageName     string
 	ContainerName string
 	GitRepo       sql.NullString
+	GitRef        string
+	GitDepth      int64
 	UserID        string
 	EnvVars       sql.NullString
 	Ports         sql.NullString
+	CpuQuota      int64
+	Memory        int64
+	MemorySwap    int64
+	PidsLimit     int64
+	NodeID        string
 }
 
 func (q *Queries) CreateContainer(ctx context.Context, arg CreateContainerParams) (string, error) {
@@ -63,24 +184,78 @@ func (q *Queries) CreateContainer(ctx context.Context, arg CreateContainerParams
 		arg.ImageName,
 		arg.ContainerName,
 		arg.GitRepo,
+		arg.GitRef,
+		arg.GitDepth,
 		arg.UserID,
 		arg.EnvVars,
 		arg.Ports,
+		arg.CpuQuota,
+		arg.Memory,
+		arg.MemorySwap,
+		arg.PidsLimit,
+		arg.NodeID,
 	)
 	var id string
 	err := row.Scan(&id)
 	return id, err
 }
 
+const createContainerShare = `-- name: CreateContainerShare :exec
+INSERT INTO
+    container_shares (container_id, user_id, created_at)
+VALUES
+    (?, ?, ?)
+`
+
+type CreateContainerShareParams struct {
+	ContainerID string
+	UserID      string
+	CreatedAt   time.Time
+}
+
+func (q *Queries) CreateContainerShare(ctx context.Context, arg CreateContainerShareParams) error {
+	_, err := q.db.ExecContext(ctx, createContainerShare, arg.ContainerID, arg.UserID, arg.CreatedAt)
+	return err
+}
+
 const createPort = `-- name: CreatePort :exec
 INSERT INTO
-    ports (port, in_use, container_id)
+    node_ports (node_id, port, in_use, container_id)
+VALUES
+    (?, ?, 0, NULL) ON CONFLICT (node_id, port) DO NOTHING
+`
+
+type CreatePortParams struct {
+	NodeID string
+	Port   int64
+}
+
+func (q *Queries) CreatePort(ctx context.Context, arg CreatePortParams) error {
+	_, err := q.db.ExecContext(ctx, createPort, arg.NodeID, arg.Port)
+	return err
+}
+
+const createPublishedPort = `-- name: CreatePublishedPort :exec
+INSERT INTO
+    published_ports (container_id, port, host_port, created_at)
 VALUES
-    (?, 0, NULL)
+    (?, ?, ?, ?)
 `
 
-func (q *Queries) CreatePort(ctx context.Context, port int64) error {
-	_, err := q.db.ExecContext(ctx, createPort, port)
+type CreatePublishedPortParams struct {
+	ContainerID string
+	Port        int64
+	HostPort    int64
+	CreatedAt   time.Time
+}
+
+func (q *Queries) CreatePublishedPort(ctx context.Context, arg CreatePublishedPortParams) error {
+	_, err := q.db.ExecContext(ctx, createPublishedPort,
+		arg.ContainerID,
+		arg.Port,
+		arg.HostPort,
+		arg.CreatedAt,
+	)
 	return err
 }
 
@@ -95,6 +270,87 @@ func (q *Queries) DeleteContainer(ctx context.Context, id string) error {
 	return err
 }
 
+const deleteContainerShare = `-- name: DeleteContainerShare :exec
+DELETE FROM container_shares
+WHERE
+    container_id = ?
+    AND user_id = ?
+`
+
+type DeleteContainerShareParams struct {
+	ContainerID string
+	UserID      string
+}
+
+func (q *Queries) DeleteContainerShare(ctx context.Context, arg DeleteContainerShareParams) error {
+	_, err := q.db.ExecContext(ctx, deleteContainerShare, arg.ContainerID, arg.UserID)
+	return err
+}
+
+const deletePortsByNode = `-- name: DeletePortsByNode :exec
+DELETE FROM node_ports
+WHERE
+    node_id = ?
+`
+
+func (q *Queries) DeletePortsByNode(ctx context.Context, nodeID string) error {
+	_, err := q.db.ExecContext(ctx, deletePortsByNode, nodeID)
+	return err
+}
+
+const deletePortsOutside = `-- name: DeletePortsOutside :exec
+DELETE FROM node_ports
+WHERE
+    node_id = ?
+    AND in_use = 0
+    AND (
+        port < ?
+        OR port > ?
+    )
+`
+
+type DeletePortsOutsideParams struct {
+	NodeID  string
+	MinPort int64
+	MaxPort int64
+}
+
+func (q *Queries) DeletePortsOutside(ctx context.Context, arg DeletePortsOutsideParams) error {
+	_, err := q.db.ExecContext(ctx, deletePortsOutside, arg.NodeID, arg.MinPort, arg.MaxPort)
+	return err
+}
+
+const deletePublishedPort = `-- name: DeletePublishedPort :execrows
+DELETE FROM published_ports
+WHERE
+    container_id = ?
+    AND port = ?
+`
+
+type DeletePublishedPortParams struct {
+	ContainerID string
+	Port        int64
+}
+
+func (q *Queries) DeletePublishedPort(ctx context.Context, arg DeletePublishedPortParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deletePublishedPort, arg.ContainerID, arg.Port)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deletePublishedPortsByContainer = `-- name: DeletePublishedPortsByContainer :exec
+DELETE FROM published_ports
+WHERE
+    container_id = ?
+`
+
+func (q *Queries) DeletePublishedPortsByContainer(ctx context.Context, containerID string) error {
+	_, err := q.db.ExecContext(ctx, deletePublishedPortsByContainer, containerID)
+	return err
+}
+
 const getAllContainers = `-- name: GetAllContainers :many
 SELECT
     c.id,
@@ -102,25 +358,47 @@ SELECT
     c.image_name,
     c.container_name,
     c.git_repo,
+    c.git_ref,
+    c.git_depth,
     c.user_id,
     c.env_vars,
     c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
     p.port as ui_port
 FROM
     containers c
-    JOIN ports p on p.container_id = c.id
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.deleted_at IS NULL
 `
 
 type GetAllContainersRow struct {
-	ID            string
-	DockerID      string
-	ImageName     string
-	ContainerName string
-	GitRepo       sql.NullString
-	UserID        string
-	EnvVars       sql.NullString
-	Ports         sql.NullString
-	UiPort        int64
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+	UiPort         int64
 }
 
 func (q *Queries) GetAllContainers(ctx context.Context) ([]GetAllContainersRow, error) {
@@ -138,9 +416,19 @@ func (q *Queries) GetAllContainers(ctx context.Context) ([]GetAllContainersRow,
 			&i.ImageName,
 			&i.ContainerName,
 			&i.GitRepo,
+			&i.GitRef,
+			&i.GitDepth,
 			&i.UserID,
 			&i.EnvVars,
 			&i.Ports,
+			&i.MissingSince,
+			&i.LastActivityAt,
+			&i.CpuQuota,
+			&i.Memory,
+			&i.MemorySwap,
+			&i.PidsLimit,
+			&i.DeletedAt,
+			&i.NodeID,
 			&i.UiPort,
 		); err != nil {
 			return nil, err
@@ -156,78 +444,786 @@ func (q *Queries) GetAllContainers(ctx context.Context) ([]GetAllContainersRow,
 	return items, nil
 }
 
-const getContainerByID = `-- name: GetContainerByID :one
+const getAllContainersByUserID = `-- name: GetAllContainersByUserID :many
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.user_id = ?
+    AND c.deleted_at IS NULL
+`
+
+type GetAllContainersByUserIDRow struct {
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+	UiPort         int64
+}
+
+func (q *Queries) GetAllContainersByUserID(ctx context.Context, userID string) ([]GetAllContainersByUserIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAllContainersByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllContainersByUserIDRow
+	for rows.Next() {
+		var i GetAllContainersByUserIDRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DockerID,
+			&i.ImageName,
+			&i.ContainerName,
+			&i.GitRepo,
+			&i.GitRef,
+			&i.GitDepth,
+			&i.UserID,
+			&i.EnvVars,
+			&i.Ports,
+			&i.MissingSince,
+			&i.LastActivityAt,
+			&i.CpuQuota,
+			&i.Memory,
+			&i.MemorySwap,
+			&i.PidsLimit,
+			&i.DeletedAt,
+			&i.NodeID,
+			&i.UiPort,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAllContainersWithDeleted = `-- name: GetAllContainersWithDeleted :many
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+`
+
+type GetAllContainersWithDeletedRow struct {
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+	UiPort         int64
+}
+
+func (q *Queries) GetAllContainersWithDeleted(ctx context.Context) ([]GetAllContainersWithDeletedRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAllContainersWithDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetAllContainersWithDeletedRow
+	for rows.Next() {
+		var i GetAllContainersWithDeletedRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DockerID,
+			&i.ImageName,
+			&i.ContainerName,
+			&i.GitRepo,
+			&i.GitRef,
+			&i.GitDepth,
+			&i.UserID,
+			&i.EnvVars,
+			&i.Ports,
+			&i.MissingSince,
+			&i.LastActivityAt,
+			&i.CpuQuota,
+			&i.Memory,
+			&i.MemorySwap,
+			&i.PidsLimit,
+			&i.DeletedAt,
+			&i.NodeID,
+			&i.UiPort,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAnyContainerByID = `-- name: GetAnyContainerByID :one
 SELECT
     c.id,
     c.docker_id,
     c.image_name,
     c.container_name,
     c.git_repo,
+    c.git_ref,
+    c.git_depth,
     c.user_id,
     c.env_vars,
     c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
     p.port as ui_port
 FROM
     containers c
-    JOIN ports p on p.container_id = c.id
+    JOIN node_ports p on p.container_id = c.id
 WHERE
     id = ?
 `
 
-type GetContainerByIDRow struct {
-	ID            string
-	DockerID      string
-	ImageName     string
-	ContainerName string
-	GitRepo       sql.NullString
-	UserID        string
-	EnvVars       sql.NullString
-	Ports         sql.NullString
-	UiPort        int64
+type GetAnyContainerByIDRow struct {
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+	UiPort         int64
 }
 
-func (q *Queries) GetContainerByID(ctx context.Context, id string) (GetContainerByIDRow, error) {
-	row := q.db.QueryRowContext(ctx, getContainerByID, id)
-	var i GetContainerByIDRow
+func (q *Queries) GetAnyContainerByID(ctx context.Context, id string) (GetAnyContainerByIDRow, error) {
+	row := q.db.QueryRowContext(ctx, getAnyContainerByID, id)
+	var i GetAnyContainerByIDRow
 	err := row.Scan(
 		&i.ID,
 		&i.DockerID,
 		&i.ImageName,
 		&i.ContainerName,
 		&i.GitRepo,
+		&i.GitRef,
+		&i.GitDepth,
 		&i.UserID,
 		&i.EnvVars,
 		&i.Ports,
+		&i.MissingSince,
+		&i.LastActivityAt,
+		&i.CpuQuota,
+		&i.Memory,
+		&i.MemorySwap,
+		&i.PidsLimit,
+		&i.DeletedAt,
+		&i.NodeID,
 		&i.UiPort,
 	)
 	return i, err
 }
 
-const getFreePort = `-- name: GetFreePort :one
+const getContainerByID = `-- name: GetContainerByID :one
 SELECT
-    port
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
 FROM
-    ports
+    containers c
+    JOIN node_ports p on p.container_id = c.id
 WHERE
-    in_use = 0
-ORDER BY
-    port
-LIMIT
-    1
+    id = ?
+    AND c.deleted_at IS NULL
 `
 
-func (q *Queries) GetFreePort(ctx context.Context) (int64, error) {
-	row := q.db.QueryRowContext(ctx, getFreePort)
-	var port int64
-	err := row.Scan(&port)
-	return port, err
+type GetContainerByIDRow struct {
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+	UiPort         int64
 }
 
-const getPortByContainerID = `-- name: GetPortByContainerID :one
-SELECT
-    port
+func (q *Queries) GetContainerByID(ctx context.Context, id string) (GetContainerByIDRow, error) {
+	row := q.db.QueryRowContext(ctx, getContainerByID, id)
+	var i GetContainerByIDRow
+	err := row.Scan(
+		&i.ID,
+		&i.DockerID,
+		&i.ImageName,
+		&i.ContainerName,
+		&i.GitRepo,
+		&i.GitRef,
+		&i.GitDepth,
+		&i.UserID,
+		&i.EnvVars,
+		&i.Ports,
+		&i.MissingSince,
+		&i.LastActivityAt,
+		&i.CpuQuota,
+		&i.Memory,
+		&i.MemorySwap,
+		&i.PidsLimit,
+		&i.DeletedAt,
+		&i.NodeID,
+		&i.UiPort,
+	)
+	return i, err
+}
+
+const getContainerByIDAndUserID = `-- name: GetContainerByIDAndUserID :one
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.id = ?
+    AND c.user_id = ?
+    AND c.deleted_at IS NULL
+`
+
+type GetContainerByIDAndUserIDParams struct {
+	ID     string
+	UserID string
+}
+
+type GetContainerByIDAndUserIDRow struct {
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+	UiPort         int64
+}
+
+func (q *Queries) GetContainerByIDAndUserID(ctx context.Context, arg GetContainerByIDAndUserIDParams) (GetContainerByIDAndUserIDRow, error) {
+	row := q.db.QueryRowContext(ctx, getContainerByIDAndUserID, arg.ID, arg.UserID)
+	var i GetContainerByIDAndUserIDRow
+	err := row.Scan(
+		&i.ID,
+		&i.DockerID,
+		&i.ImageName,
+		&i.ContainerName,
+		&i.GitRepo,
+		&i.GitRef,
+		&i.GitDepth,
+		&i.UserID,
+		&i.EnvVars,
+		&i.Ports,
+		&i.MissingSince,
+		&i.LastActivityAt,
+		&i.CpuQuota,
+		&i.Memory,
+		&i.MemorySwap,
+		&i.PidsLimit,
+		&i.DeletedAt,
+		&i.NodeID,
+		&i.UiPort,
+	)
+	return i, err
+}
+
+const getContainerNodeID = `-- name: GetContainerNodeID :one
+SELECT
+    node_id
+FROM
+    containers
+WHERE
+    docker_id = ?
+`
+
+func (q *Queries) GetContainerNodeID(ctx context.Context, dockerID string) (string, error) {
+	row := q.db.QueryRowContext(ctx, getContainerNodeID, dockerID)
+	var nodeID string
+	err := row.Scan(&nodeID)
+	return nodeID, err
+}
+
+const getContainerShares = `-- name: GetContainerShares :many
+SELECT
+    container_id,
+    user_id,
+    created_at
 FROM
-    ports
+    container_shares
+WHERE
+    container_id = ?
+`
+
+func (q *Queries) GetContainerShares(ctx context.Context, containerID string) ([]ContainerShare, error) {
+	rows, err := q.db.QueryContext(ctx, getContainerShares, containerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ContainerShare
+	for rows.Next() {
+		var i ContainerShare
+		if err := rows.Scan(&i.ContainerID, &i.UserID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedContainers = `-- name: GetDeletedContainers :many
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.deleted_at IS NOT NULL
+ORDER BY
+    c.deleted_at
+`
+
+type GetDeletedContainersRow struct {
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+	UiPort         int64
+}
+
+func (q *Queries) GetDeletedContainers(ctx context.Context) ([]GetDeletedContainersRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDeletedContainers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDeletedContainersRow
+	for rows.Next() {
+		var i GetDeletedContainersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DockerID,
+			&i.ImageName,
+			&i.ContainerName,
+			&i.GitRepo,
+			&i.GitRef,
+			&i.GitDepth,
+			&i.UserID,
+			&i.EnvVars,
+			&i.Ports,
+			&i.MissingSince,
+			&i.LastActivityAt,
+			&i.CpuQuota,
+			&i.Memory,
+			&i.MemorySwap,
+			&i.PidsLimit,
+			&i.DeletedAt,
+			&i.NodeID,
+			&i.UiPort,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedContainersByUserID = `-- name: GetDeletedContainersByUserID :many
+SELECT
+    c.id,
+    c.docker_id,
+    c.image_name,
+    c.container_name,
+    c.git_repo,
+    c.git_ref,
+    c.git_depth,
+    c.user_id,
+    c.env_vars,
+    c.ports,
+    c.missing_since,
+    c.last_activity_at,
+    c.cpu_quota,
+    c.memory,
+    c.memory_swap,
+    c.pids_limit,
+    c.deleted_at,
+    c.node_id,
+    p.port as ui_port
+FROM
+    containers c
+    JOIN node_ports p on p.container_id = c.id
+WHERE
+    c.user_id = ?
+    AND c.deleted_at IS NOT NULL
+ORDER BY
+    c.deleted_at
+`
+
+type GetDeletedContainersByUserIDRow struct {
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+	UiPort         int64
+}
+
+func (q *Queries) GetDeletedContainersByUserID(ctx context.Context, userID string) ([]GetDeletedContainersByUserIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getDeletedContainersByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDeletedContainersByUserIDRow
+	for rows.Next() {
+		var i GetDeletedContainersByUserIDRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DockerID,
+			&i.ImageName,
+			&i.ContainerName,
+			&i.GitRepo,
+			&i.GitRef,
+			&i.GitDepth,
+			&i.UserID,
+			&i.EnvVars,
+			&i.Ports,
+			&i.MissingSince,
+			&i.LastActivityAt,
+			&i.CpuQuota,
+			&i.Memory,
+			&i.MemorySwap,
+			&i.PidsLimit,
+			&i.DeletedAt,
+			&i.NodeID,
+			&i.UiPort,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFreePort = `-- name: GetFreePort :one
+SELECT
+    port
+FROM
+    node_ports
+WHERE
+    node_id = ?
+    AND in_use = 0
+ORDER BY
+    port
+LIMIT
+    1
+`
+
+func (q *Queries) GetFreePort(ctx context.Context, nodeID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getFreePort, nodeID)
+	var port int64
+	err := row.Scan(&port)
+	return port, err
+}
+
+const getFreePortCounts = `-- name: GetFreePortCounts :many
+SELECT
+    node_id,
+    count(port) AS free
+FROM
+    node_ports
+WHERE
+    in_use = 0
+GROUP BY
+    node_id
+`
+
+type GetFreePortCountsRow struct {
+	NodeID string
+	Free   int64
+}
+
+func (q *Queries) GetFreePortCounts(ctx context.Context) ([]GetFreePortCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFreePortCounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFreePortCountsRow
+	for rows.Next() {
+		var i GetFreePortCountsRow
+		if err := rows.Scan(&i.NodeID, &i.Free); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getNodeReservations = `-- name: GetNodeReservations :many
+SELECT
+    node_id,
+    count(id) AS workspaces,
+    CAST(coalesce(sum(cpu_quota), 0) AS INTEGER) AS cpu_quota,
+    CAST(coalesce(sum(memory), 0) AS INTEGER) AS memory
+FROM
+    containers
+WHERE
+    deleted_at IS NULL
+GROUP BY
+    node_id
+`
+
+type GetNodeReservationsRow struct {
+	NodeID     string
+	Workspaces int64
+	CpuQuota   int64
+	Memory     int64
+}
+
+func (q *Queries) GetNodeReservations(ctx context.Context) ([]GetNodeReservationsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getNodeReservations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetNodeReservationsRow
+	for rows.Next() {
+		var i GetNodeReservationsRow
+		if err := rows.Scan(
+			&i.NodeID,
+			&i.Workspaces,
+			&i.CpuQuota,
+			&i.Memory,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPortByContainerID = `-- name: GetPortByContainerID :one
+SELECT
+    port
+FROM
+    node_ports
 WHERE
     container_id = ?
 `
@@ -243,21 +1239,127 @@ const getPortCount = `-- name: GetPortCount :one
 SELECT
     count(port)
 FROM
-    ports
+    node_ports
+WHERE
+    node_id = ?
 `
 
-func (q *Queries) GetPortCount(ctx context.Context) (int64, error) {
-	row := q.db.QueryRowContext(ctx, getPortCount)
+func (q *Queries) GetPortCount(ctx context.Context, nodeID string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, getPortCount, nodeID)
 	var count int64
 	err := row.Scan(&count)
 	return count, err
 }
 
+const getPublishedPorts = `-- name: GetPublishedPorts :many
+SELECT
+    container_id,
+    port,
+    created_at,
+    host_port
+FROM
+    published_ports
+WHERE
+    container_id = ?
+ORDER BY
+    port
+`
+
+func (q *Queries) GetPublishedPorts(ctx context.Context, containerID string) ([]PublishedPort, error) {
+	rows, err := q.db.QueryContext(ctx, getPublishedPorts, containerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PublishedPort
+	for rows.Next() {
+		var i PublishedPort
+		if err := rows.Scan(
+			&i.ContainerID,
+			&i.Port,
+			&i.CreatedAt,
+			&i.HostPort,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStalePorts = `-- name: GetStalePorts :many
+SELECT
+    node_id,
+    port
+FROM
+    node_ports
+WHERE
+    in_use = 1
+    AND (
+        container_id IS NULL
+        OR container_id NOT IN (
+            SELECT
+                id
+            FROM
+                containers
+        )
+    )
+    AND NOT EXISTS (
+        SELECT
+            1
+        FROM
+            published_ports pp
+            JOIN containers c ON c.id = pp.container_id
+        WHERE
+            c.node_id = node_ports.node_id
+            AND pp.host_port = node_ports.port
+    )
+    AND (
+        reserved_at IS NULL
+        OR reserved_at < ?
+    )
+`
+
+type GetStalePortsRow struct {
+	NodeID string
+	Port   int64
+}
+
+func (q *Queries) GetStalePorts(ctx context.Context, reservedAt sql.NullTime) ([]GetStalePortsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getStalePorts, reservedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetStalePortsRow
+	for rows.Next() {
+		var i GetStalePortsRow
+		if err := rows.Scan(&i.NodeID, &i.Port); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const releasePortByContainer = `-- name: ReleasePortByContainer :exec
-UPDATE ports
+UPDATE node_ports
 SET
     in_use = 0,
-    container_id = NULL
+    container_id = NULL,
+    reserved_at = NULL
 WHERE
     container_id = ?
 `
@@ -268,16 +1370,103 @@ func (q *Queries) ReleasePortByContainer(ctx context.Context, containerID sql.Nu
 }
 
 const releasePortbyPort = `-- name: ReleasePortbyPort :exec
-UPDATE ports
+UPDATE node_ports
 SET
     in_use = 0,
-    container_id = NULL
+    container_id = NULL,
+    reserved_at = NULL
 WHERE
-    port = ?
+    node_id = ?
+    AND port = ?
 `
 
-func (q *Queries) ReleasePortbyPort(ctx context.Context, port int64) error {
-	_, err := q.db.ExecContext(ctx, releasePortbyPort, port)
+type ReleasePortbyPortParams struct {
+	NodeID string
+	Port   int64
+}
+
+func (q *Queries) ReleasePortbyPort(ctx context.Context, arg ReleasePortbyPortParams) error {
+	_, err := q.db.ExecContext(ctx, releasePortbyPort, arg.NodeID, arg.Port)
+	return err
+}
+
+const reservePort = `-- name: ReservePort :execrows
+UPDATE node_ports
+SET
+    in_use = 1,
+    container_id = NULL,
+    reserved_at = ?
+WHERE
+    node_id = ?
+    AND port = ?
+    AND in_use = 0
+`
+
+type ReservePortParams struct {
+	ReservedAt sql.NullTime
+	NodeID     string
+	Port       int64
+}
+
+func (q *Queries) ReservePort(ctx context.Context, arg ReservePortParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, reservePort, arg.ReservedAt, arg.NodeID, arg.Port)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setContainerDeleted = `-- name: SetContainerDeleted :exec
+UPDATE containers
+SET
+    deleted_at = ?
+WHERE
+    id = ?
+`
+
+type SetContainerDeletedParams struct {
+	DeletedAt sql.NullTime
+	ID        string
+}
+
+func (q *Queries) SetContainerDeleted(ctx context.Context, arg SetContainerDeletedParams) error {
+	_, err := q.db.ExecContext(ctx, setContainerDeleted, arg.DeletedAt, arg.ID)
+	return err
+}
+
+const setContainerLastActivity = `-- name: SetContainerLastActivity :exec
+UPDATE containers
+SET
+    last_activity_at = ?
+WHERE
+    id = ?
+`
+
+type SetContainerLastActivityParams struct {
+	LastActivityAt sql.NullTime
+	ID             string
+}
+
+func (q *Queries) SetContainerLastActivity(ctx context.Context, arg SetContainerLastActivityParams) error {
+	_, err := q.db.ExecContext(ctx, setContainerLastActivity, arg.LastActivityAt, arg.ID)
+	return err
+}
+
+const setContainerMissing = `-- name: SetContainerMissing :exec
+UPDATE containers
+SET
+    missing_since = ?
+WHERE
+    id = ?
+`
+
+type SetContainerMissingParams struct {
+	MissingSince sql.NullTime
+	ID           string
+}
+
+func (q *Queries) SetContainerMissing(ctx context.Context, arg SetContainerMissingParams) error {
+	_, err := q.db.ExecContext(ctx, setContainerMissing, arg.MissingSince, arg.ID)
 	return err
 }
 
@@ -288,9 +1477,15 @@ SET
     image_name = ?,
     container_name = ?,
     git_repo = ?,
+    git_ref = ?,
+    git_depth = ?,
     user_id = ?,
     env_vars = ?,
-    ports = ?
+    ports = ?,
+    cpu_quota = ?,
+    memory = ?,
+    memory_swap = ?,
+    pids_limit = ?
 WHERE
     id = ?
 `
@@ -300,9 +1495,15 @@ type UpdateContainerParams struct {
 	ImageName     string
 	ContainerName string
 	GitRepo       sql.NullString
+	GitRef        string
+	GitDepth      int64
 	UserID        string
 	EnvVars       sql.NullString
 	Ports         sql.NullString
+	CpuQuota      int64
+	Memory        int64
+	MemorySwap    int64
+	PidsLimit     int64
 	ID            string
 }
 
@@ -312,9 +1513,15 @@ func (q *Queries) UpdateContainer(ctx context.Context, arg UpdateContainerParams
 		arg.ImageName,
 		arg.ContainerName,
 		arg.GitRepo,
+		arg.GitRef,
+		arg.GitDepth,
 		arg.UserID,
 		arg.EnvVars,
 		arg.Ports,
+		arg.CpuQuota,
+		arg.Memory,
+		arg.MemorySwap,
+		arg.PidsLimit,
 		arg.ID,
 	)
 	return err
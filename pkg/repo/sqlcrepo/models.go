@@ -6,39 +6,135 @@ package sqlcrepo
 
 import (
 	"database/sql"
+	"time"
 )
 
+type BuildJob struct {
+	ID         string
+	TemplateID string
+	UserID     string
+	Tag        string
+	Status     string
+	Logs       string
+	Error      string
+	CreatedAt  time.Time
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+}
+
 type Container struct {
-	ID            string
-	DockerID      string
-	ImageName     string
-	ContainerName string
-	GitRepo       sql.NullString
-	UserID        string
-	EnvVars       sql.NullString
-	Ports         sql.NullString
+	ID             string
+	DockerID       string
+	ImageName      string
+	ContainerName  string
+	GitRepo        sql.NullString
+	GitRef         string
+	GitDepth       int64
+	UserID         string
+	EnvVars        sql.NullString
+	Ports          sql.NullString
+	MissingSince   sql.NullTime
+	LastActivityAt sql.NullTime
+	CpuQuota       int64
+	Memory         int64
+	MemorySwap     int64
+	PidsLimit      int64
+	DeletedAt      sql.NullTime
+	NodeID         string
+}
+
+type ContainerShare struct {
+	ContainerID string
+	UserID      string
+	CreatedAt   time.Time
+}
+
+type GitCredential struct {
+	ID        string
+	UserID    string
+	Kind      string
+	Host      string
+	Username  string
+	Secret    string
+	CreatedAt time.Time
+}
+
+type Node struct {
+	ID         string
+	Name       string
+	Host       string
+	PublicUrl  string
+	CaCert     string
+	ClientCert string
+	ClientKey  string
+	MinPort    int64
+	MaxPort    int64
+	Cordoned   bool
+	CreatedAt  time.Time
 }
 
-type Port struct {
+type NodePort struct {
+	NodeID      string
 	Port        int64
 	InUse       bool
 	ContainerID sql.NullString
+	ReservedAt  sql.NullTime
+}
+
+type PublishedPort struct {
+	ContainerID string
+	Port        int64
+	CreatedAt   time.Time
+	HostPort    int64
+}
+
+type Quota struct {
+	Kind          string
+	Subject       string
+	MaxContainers int64
+	MaxRunning    int64
+	MaxMemory     int64
+	MaxCpuQuota   int64
+	MaxVolumeSize int64
+}
+
+type Secret struct {
+	Scope     string
+	OwnerID   string
+	Name      string
+	Value     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type Template struct {
-	ID         string
-	Name       string
-	RepoName   string
-	Dockerfile string
+	ID          string
+	Name        string
+	RepoName    string
+	Dockerfile  string
+	IdleTimeout sql.NullInt64
+	CpuQuota    int64
+	Memory      int64
+	MemorySwap  int64
+	PidsLimit   int64
 }
 
 type Token struct {
-	Token  string
-	UserID string
+	ID         string
+	TokenHash  string
+	UserID     string
+	Name       string
+	Kind       string
+	Scopes     string
+	CreatedAt  time.Time
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
 }
 
 type User struct {
-	ID       string
-	Username string
-	Password string
+	ID          string
+	Username    string
+	Password    string
+	Role        string
+	IdleTimeout sql.NullInt64
 }
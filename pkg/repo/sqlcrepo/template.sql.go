@@ -7,20 +7,36 @@ package sqlcrepo
 
 import (
 	"context"
+	"database/sql"
 )
 
 const createTemplate = `-- name: CreateTemplate :one
 INSERT INTO
-    templates (id, name, repo_name, dockerfile)
+    templates (
+        id,
+        name,
+        repo_name,
+        dockerfile,
+        idle_timeout,
+        cpu_quota,
+        memory,
+        memory_swap,
+        pids_limit
+    )
 VALUES
-    (?, ?, ?, ?) RETURNING id
+    (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id
 `
 
 type CreateTemplateParams struct {
-	ID         string
-	Name       string
-	RepoName   string
-	Dockerfile string
+	ID          string
+	Name        string
+	RepoName    string
+	Dockerfile  string
+	IdleTimeout sql.NullInt64
+	CpuQuota    int64
+	Memory      int64
+	MemorySwap  int64
+	PidsLimit   int64
 }
 
 func (q *Queries) CreateTemplate(ctx context.Context, arg CreateTemplateParams) (string, error) {
@@ -29,6 +45,11 @@ func (q *Queries) CreateTemplate(ctx context.Context, arg CreateTemplateParams)
 		arg.Name,
 		arg.RepoName,
 		arg.Dockerfile,
+		arg.IdleTimeout,
+		arg.CpuQuota,
+		arg.Memory,
+		arg.MemorySwap,
+		arg.PidsLimit,
 	)
 	var id string
 	err := row.Scan(&id)
@@ -51,7 +72,12 @@ SELECT
     id,
     name,
     repo_name,
-    dockerfile
+    dockerfile,
+    idle_timeout,
+    cpu_quota,
+    memory,
+    memory_swap,
+    pids_limit
 FROM
     templates
 `
@@ -70,6 +96,11 @@ func (q *Queries) GetAllTemplates(ctx context.Context) ([]Template, error) {
 			&i.Name,
 			&i.RepoName,
 			&i.Dockerfile,
+			&i.IdleTimeout,
+			&i.CpuQuota,
+			&i.Memory,
+			&i.MemorySwap,
+			&i.PidsLimit,
 		); err != nil {
 			return nil, err
 		}
@@ -89,7 +120,12 @@ SELECT
     id,
     name,
     repo_name,
-    dockerfile
+    dockerfile,
+    idle_timeout,
+    cpu_quota,
+    memory,
+    memory_swap,
+    pids_limit
 FROM
     templates
 WHERE
@@ -104,6 +140,11 @@ func (q *Queries) GetTemplate(ctx context.Context, id string) (Template, error)
 		&i.Name,
 		&i.RepoName,
 		&i.Dockerfile,
+		&i.IdleTimeout,
+		&i.CpuQuota,
+		&i.Memory,
+		&i.MemorySwap,
+		&i.PidsLimit,
 	)
 	return i, err
 }
@@ -113,16 +154,26 @@ UPDATE templates
 SET
     name = ?,
     repo_name = ?,
-    dockerfile = ?
+    dockerfile = ?,
+    idle_timeout = ?,
+    cpu_quota = ?,
+    memory = ?,
+    memory_swap = ?,
+    pids_limit = ?
 WHERE
     id = ?
 `
 
 type UpdateTemplateParams struct {
-	Name       string
-	RepoName   string
-	Dockerfile string
-	ID         string
+	Name        string
+	RepoName    string
+	Dockerfile  string
+	IdleTimeout sql.NullInt64
+	CpuQuota    int64
+	Memory      int64
+	MemorySwap  int64
+	PidsLimit   int64
+	ID          string
 }
 
 func (q *Queries) UpdateTemplate(ctx context.Context, arg UpdateTemplateParams) error {
@@ -130,6 +181,11 @@ func (q *Queries) UpdateTemplate(ctx context.Context, arg UpdateTemplateParams)
 		arg.Name,
 		arg.RepoName,
 		arg.Dockerfile,
+		arg.IdleTimeout,
+		arg.CpuQuota,
+		arg.Memory,
+		arg.MemorySwap,
+		arg.PidsLimit,
 		arg.ID,
 	)
 	return err
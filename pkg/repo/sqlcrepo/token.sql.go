@@ -7,83 +7,197 @@ package sqlcrepo
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 const createToken = `-- name: CreateToken :exec
 INSERT INTO
-	tokens (user_id, token)
+	tokens (
+		id,
+		token_hash,
+		user_id,
+		name,
+		kind,
+		scopes,
+		created_at,
+		expires_at
+	)
 VALUES
-	(?, ?)
+	(?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 type CreateTokenParams struct {
-	UserID string
-	Token  string
+	ID        string
+	TokenHash string
+	UserID    string
+	Name      string
+	Kind      string
+	Scopes    string
+	CreatedAt time.Time
+	ExpiresAt sql.NullTime
 }
 
 func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) error {
-	_, err := q.db.ExecContext(ctx, createToken, arg.UserID, arg.Token)
+	_, err := q.db.ExecContext(ctx, createToken,
+		arg.ID,
+		arg.TokenHash,
+		arg.UserID,
+		arg.Name,
+		arg.Kind,
+		arg.Scopes,
+		arg.CreatedAt,
+		arg.ExpiresAt,
+	)
 	return err
 }
 
 const deleteToken = `-- name: DeleteToken :exec
 DELETE FROM tokens
 WHERE
-	token = ?
+	id = ?
+`
+
+func (q *Queries) DeleteToken(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteToken, id)
+	return err
+}
+
+const deleteTokenByHash = `-- name: DeleteTokenByHash :exec
+DELETE FROM tokens
+WHERE
+	token_hash = ?
+`
+
+func (q *Queries) DeleteTokenByHash(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, deleteTokenByHash, tokenHash)
+	return err
+}
+
+const deleteTokensByUserIDAndName = `-- name: DeleteTokensByUserIDAndName :exec
+DELETE FROM tokens
+WHERE
+	user_id = ?
+	AND name = ?
 `
 
-func (q *Queries) DeleteToken(ctx context.Context, token string) error {
-	_, err := q.db.ExecContext(ctx, deleteToken, token)
+type DeleteTokensByUserIDAndNameParams struct {
+	UserID string
+	Name   string
+}
+
+func (q *Queries) DeleteTokensByUserIDAndName(ctx context.Context, arg DeleteTokensByUserIDAndNameParams) error {
+	_, err := q.db.ExecContext(ctx, deleteTokensByUserIDAndName, arg.UserID, arg.Name)
 	return err
 }
 
-const getToken = `-- name: GetToken :one
+const getTokenByHash = `-- name: GetTokenByHash :one
 SELECT
+	id,
+	token_hash,
 	user_id,
-	token
+	name,
+	kind,
+	scopes,
+	created_at,
+	expires_at,
+	last_used_at
 FROM
 	tokens
 WHERE
-	token = ?
+	token_hash = ?
 `
 
-type GetTokenRow struct {
-	UserID string
-	Token  string
+func (q *Queries) GetTokenByHash(ctx context.Context, tokenHash string) (Token, error) {
+	row := q.db.QueryRowContext(ctx, getTokenByHash, tokenHash)
+	var i Token
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.UserID,
+		&i.Name,
+		&i.Kind,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+	)
+	return i, err
 }
 
-func (q *Queries) GetToken(ctx context.Context, token string) (GetTokenRow, error) {
-	row := q.db.QueryRowContext(ctx, getToken, token)
-	var i GetTokenRow
-	err := row.Scan(&i.UserID, &i.Token)
+const getTokenByID = `-- name: GetTokenByID :one
+SELECT
+	id,
+	token_hash,
+	user_id,
+	name,
+	kind,
+	scopes,
+	created_at,
+	expires_at,
+	last_used_at
+FROM
+	tokens
+WHERE
+	id = ?
+`
+
+func (q *Queries) GetTokenByID(ctx context.Context, id string) (Token, error) {
+	row := q.db.QueryRowContext(ctx, getTokenByID, id)
+	var i Token
+	err := row.Scan(
+		&i.ID,
+		&i.TokenHash,
+		&i.UserID,
+		&i.Name,
+		&i.Kind,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+	)
 	return i, err
 }
 
-const getTokenByUserID = `-- name: GetTokenByUserID :many
+const getTokensByUserID = `-- name: GetTokensByUserID :many
 SELECT
+	id,
+	token_hash,
 	user_id,
-	token
+	name,
+	kind,
+	scopes,
+	created_at,
+	expires_at,
+	last_used_at
 FROM
 	tokens
 WHERE
 	user_id = ?
+ORDER BY
+	created_at
 `
 
-type GetTokenByUserIDRow struct {
-	UserID string
-	Token  string
-}
-
-func (q *Queries) GetTokenByUserID(ctx context.Context, userID string) ([]GetTokenByUserIDRow, error) {
-	rows, err := q.db.QueryContext(ctx, getTokenByUserID, userID)
+func (q *Queries) GetTokensByUserID(ctx context.Context, userID string) ([]Token, error) {
+	rows, err := q.db.QueryContext(ctx, getTokensByUserID, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetTokenByUserIDRow
+	var items []Token
 	for rows.Next() {
-		var i GetTokenByUserIDRow
-		if err := rows.Scan(&i.UserID, &i.Token); err != nil {
+		var i Token
+		if err := rows.Scan(
+			&i.ID,
+			&i.TokenHash,
+			&i.UserID,
+			&i.Name,
+			&i.Kind,
+			&i.Scopes,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -96,3 +210,21 @@ func (q *Queries) GetTokenByUserID(ctx context.Context, userID string) ([]GetTok
 	}
 	return items, nil
 }
+
+const updateTokenLastUsed = `-- name: UpdateTokenLastUsed :exec
+UPDATE tokens
+SET
+	last_used_at = ?
+WHERE
+	id = ?
+`
+
+type UpdateTokenLastUsedParams struct {
+	LastUsedAt sql.NullTime
+	ID         string
+}
+
+func (q *Queries) UpdateTokenLastUsed(ctx context.Context, arg UpdateTokenLastUsedParams) error {
+	_, err := q.db.ExecContext(ctx, updateTokenLastUsed, arg.LastUsedAt, arg.ID)
+	return err
+}
@@ -12,19 +12,25 @@ import (
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO
-	users (id, username, password)
+	users (id, username, password, role)
 VALUES
-	(?, ?, ?) RETURNING id
+	(?, ?, ?, ?) RETURNING id
 `
 
 type CreateUserParams struct {
 	ID       string
 	Username string
 	Password string
+	Role     string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (string, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.ID, arg.Username, arg.Password)
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.ID,
+		arg.Username,
+		arg.Password,
+		arg.Role,
+	)
 	var id string
 	err := row.Scan(&id)
 	return id, err
@@ -45,16 +51,20 @@ const getAllUsers = `-- name: GetAllUsers :many
 SELECT
 	u.id,
 	u.username,
-	t.token
+	u.role,
+	u.idle_timeout,
+	t.id AS token_id
 FROM
 	users u
 	LEFT JOIN tokens t ON u.id = t.user_id
 `
 
 type GetAllUsersRow struct {
-	ID       string
-	Username string
-	Token    sql.NullString
+	ID          string
+	Username    string
+	Role        string
+	IdleTimeout sql.NullInt64
+	TokenID     sql.NullString
 }
 
 func (q *Queries) GetAllUsers(ctx context.Context) ([]GetAllUsersRow, error) {
@@ -66,7 +76,13 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]GetAllUsersRow, error) {
 	var items []GetAllUsersRow
 	for rows.Next() {
 		var i GetAllUsersRow
-		if err := rows.Scan(&i.ID, &i.Username, &i.Token); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Role,
+			&i.IdleTimeout,
+			&i.TokenID,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -85,7 +101,9 @@ SELECT
 	u.id,
 	u.username,
 	u.password,
-	t.token
+	u.role,
+	u.idle_timeout,
+	t.id AS token_id
 FROM
 	users u
 	LEFT JOIN tokens t ON u.id = t.user_id
@@ -94,10 +112,12 @@ WHERE
 `
 
 type GetUnsafeUserByUsernameRow struct {
-	ID       string
-	Username string
-	Password string
-	Token    sql.NullString
+	ID          string
+	Username    string
+	Password    string
+	Role        string
+	IdleTimeout sql.NullInt64
+	TokenID     sql.NullString
 }
 
 func (q *Queries) GetUnsafeUserByUsername(ctx context.Context, username string) ([]GetUnsafeUserByUsernameRow, error) {
@@ -113,7 +133,9 @@ func (q *Queries) GetUnsafeUserByUsername(ctx context.Context, username string)
 			&i.ID,
 			&i.Username,
 			&i.Password,
-			&i.Token,
+			&i.Role,
+			&i.IdleTimeout,
+			&i.TokenID,
 		); err != nil {
 			return nil, err
 		}
@@ -132,18 +154,22 @@ const getUserByID = `-- name: GetUserByID :many
 SELECT
 	u.id,
 	u.username,
-	t.token
+	u.role,
+	u.idle_timeout,
+	t.id AS token_id
 FROM
 	users u
 	LEFT JOIN tokens t ON u.id = t.user_id
 WHERE
-	id = ?
+	u.id = ?
 `
 
 type GetUserByIDRow struct {
-	ID       string
-	Username string
-	Token    sql.NullString
+	ID          string
+	Username    string
+	Role        string
+	IdleTimeout sql.NullInt64
+	TokenID     sql.NullString
 }
 
 func (q *Queries) GetUserByID(ctx context.Context, id string) ([]GetUserByIDRow, error) {
@@ -155,55 +181,13 @@ func (q *Queries) GetUserByID(ctx context.Context, id string) ([]GetUserByIDRow,
 	var items []GetUserByIDRow
 	for rows.Next() {
 		var i GetUserByIDRow
-		if err := rows.Scan(&i.ID, &i.Username, &i.Token); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-const getUserByToken = `-- name: GetUserByToken :many
-SELECT
-	u.id,
-	u.username,
-	t.token
-FROM
-	tokens t
-	JOIN users u ON t.user_id = u.id
-WHERE
-	u.id = (
-		SELECT
-			user_id
-		FROM
-			tokens
-		WHERE
-			tokens.token = ?
-	)
-`
-
-type GetUserByTokenRow struct {
-	ID       string
-	Username string
-	Token    string
-}
-
-func (q *Queries) GetUserByToken(ctx context.Context, token string) ([]GetUserByTokenRow, error) {
-	rows, err := q.db.QueryContext(ctx, getUserByToken, token)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetUserByTokenRow
-	for rows.Next() {
-		var i GetUserByTokenRow
-		if err := rows.Scan(&i.ID, &i.Username, &i.Token); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.Role,
+			&i.IdleTimeout,
+			&i.TokenID,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -236,3 +220,39 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 	_, err := q.db.ExecContext(ctx, updateUser, arg.Username, arg.Password, arg.ID)
 	return err
 }
+
+const updateUserIdleTimeout = `-- name: UpdateUserIdleTimeout :exec
+UPDATE users
+SET
+	idle_timeout = ?
+WHERE
+	id = ?
+`
+
+type UpdateUserIdleTimeoutParams struct {
+	IdleTimeout sql.NullInt64
+	ID          string
+}
+
+func (q *Queries) UpdateUserIdleTimeout(ctx context.Context, arg UpdateUserIdleTimeoutParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserIdleTimeout, arg.IdleTimeout, arg.ID)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :exec
+UPDATE users
+SET
+	role = ?
+WHERE
+	id = ?
+`
+
+type UpdateUserRoleParams struct {
+	Role string
+	ID   string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserRole, arg.Role, arg.ID)
+	return err
+}
@@ -3,7 +3,11 @@ package utils
 import (
 	cryptoRand "crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -18,11 +22,38 @@ func GenerateULID() string {
 	return ulid.MustNew(ulid.Timestamp(t), entropy).String()
 }
 
+// IsULID reports whether s is a ULID like the ones of GenerateULID, in upper
+// case.
+func IsULID(s string) bool {
+	id, err := ulid.ParseStrict(s)
+
+	return err == nil && id.String() == s
+}
+
+// containerNamePattern matches the characters docker does not allow in
+// container names.
+var containerNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_.-]`) //nolint:gochecknoglobals
+
+// GitCredentialsMount is the path the git credentials of the owner are
+// mounted to inside a workspace.
+const GitCredentialsMount = "/run/cerodev/git"
+
+// ContainerName names a workspace after the owner and the last two path
+// elements of its repository. Repositories without a path are used as a whole.
 func ContainerName(userID, gitRepo string) string {
-	parts := strings.Split(strings.TrimPrefix(gitRepo, "https://"), "/")
-	repoName := strings.Join(parts[len(parts)-2:], "_")
+	// ssh urls like git@github.com:org/repo.git separate the path with a colon
+	parts := strings.Split(strings.ReplaceAll(strings.TrimPrefix(gitRepo, "https://"), ":", "/"), "/")
+	if len(parts) > 2 { //nolint:mnd
+		parts = parts[len(parts)-2:]
+	}
+
+	return "cd-" + userID + "-" + containerNamePattern.ReplaceAllString(strings.Join(parts, "_"), "_")
+}
 
-	return "cd-" + userID + "-" + repoName
+// GitCredentialsDir returns the host directory holding the git credentials
+// of a workspace. It is kept next to the volume, so backups never contain it.
+func GitCredentialsDir(volumesPath, containerID string) string {
+	return volumesPath + "/.git-" + containerID
 }
 
 func PrintPrettyJSON(a any) {
@@ -41,3 +72,30 @@ func RemoveEmptyStrings(s []string) []string {
 
 	return result
 }
+
+// DirSize returns the size of all regular files below path. Files removed
+// while walking and a missing directory are not counted.
+func DirSize(path string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			var info fs.FileInfo
+
+			if info, err = d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to walk %s: %w", path, err)
+	}
+
+	return size, nil
+}
@@ -1,6 +1,8 @@
 package ws
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -8,35 +10,130 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+var ErrClientNotFound = errors.New("websocket client not found")
+
 type WebSocketRepo struct {
 	mu      sync.RWMutex
 	clients map[string]*websocket.Conn
+	users   map[string]string // token -> user id
+	streams map[string]*streams
+}
+
+// streams are the background senders of a client. They are cancelled when the
+// client is removed and the connection is closed after they returned.
+type streams struct {
+	ctx    context.Context //nolint:containedctx
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 func New() *WebSocketRepo {
-	return &WebSocketRepo{clients: map[string]*websocket.Conn{}}
+	return &WebSocketRepo{ //nolint:exhaustruct
+		clients: map[string]*websocket.Conn{},
+		users:   map[string]string{},
+		streams: map[string]*streams{},
+	}
 }
 
-func (r *WebSocketRepo) Add(token string, conn *websocket.Conn) {
+func (r *WebSocketRepo) Add(token, userID string, conn *websocket.Conn) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	if old, ok := r.clients[token]; ok {
+		// a reconnect with the same token replaces the client
+		go r.closeClient(old, r.streams[token])
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	r.clients[token] = conn
+	r.users[token] = userID
+	r.streams[token] = &streams{ctx: ctx, cancel: cancel} //nolint:exhaustruct
 }
 
 func (r *WebSocketRepo) RemoveAndClose(token string) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
-	if client, ok := r.clients[token]; ok {
-		client.Close()
-		delete(r.clients, token)
+	client, ok := r.clients[token]
+	s := r.streams[token]
+	delete(r.clients, token)
+	delete(r.users, token)
+	delete(r.streams, token)
+	r.mu.Unlock()
+	if ok {
+		r.closeClient(client, s)
 		fmt.Printf("Cleaned up client")
 	}
 }
 
-func (r *WebSocketRepo) SendJSON(data any, token string) {
+// Remove removes the client of token if it is still connected with conn and
+// closes conn.
+func (r *WebSocketRepo) Remove(token string, conn *websocket.Conn) {
+	r.mu.Lock()
+	s, ok := r.streams[token]
+	if !ok || r.clients[token] != conn {
+		r.mu.Unlock()
+		conn.Close()
+		return
+	}
+	delete(r.clients, token)
+	delete(r.users, token)
+	delete(r.streams, token)
+	r.mu.Unlock()
+	r.closeClient(conn, s)
+}
+
+// Track registers a stream of the client connected with token. The returned
+// context ends when the client is removed, done has to be called when the
+// stream returned.
+func (r *WebSocketRepo) Track(token string) (context.Context, func(), error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.clients[token].WriteJSON(data)
+	s, ok := r.streams[token]
+	if !ok {
+		return nil, nil, ErrClientNotFound
+	}
+	s.wg.Add(1)
+	return s.ctx, s.wg.Done, nil
+}
+
+// closeClient cancels the streams of a client, closes the connection and waits
+// for the streams to return. It must not be called with the lock held, streams
+// send with it.
+func (r *WebSocketRepo) closeClient(conn *websocket.Conn, s *streams) {
+	if s != nil {
+		s.cancel()
+	}
+	conn.Close()
+	if s != nil {
+		s.wg.Wait()
+	}
+}
+
+func (r *WebSocketRepo) SendJSON(data any, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	client, ok := r.clients[token]
+	if !ok {
+		return ErrClientNotFound
+	}
+	return client.WriteJSON(data)
+}
+
+// SendJSONToUser sends data to every client of the user.
+func (r *WebSocketRepo) SendJSONToUser(data any, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sent := false
+	for token, client := range r.clients {
+		if r.users[token] != userID {
+			continue
+		}
+		if err := client.WriteJSON(data); err != nil {
+			return err
+		}
+		sent = true
+	}
+	if !sent {
+		return ErrClientNotFound
+	}
+	return nil
 }
 
 func (r *WebSocketRepo) HealthCheckAll() {
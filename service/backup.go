@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/archive"
+)
+
+const (
+	backupSuffix      = ".tar.gz"
+	backupTimeFormat  = "20060102T150405Z"
+	backupPermissions = 0o700
+)
+
+var (
+	backupNamePattern = regexp.MustCompile(`^\d{8}T\d{6}Z\.tar\.gz$`) //nolint:gochecknoglobals
+	idPattern         = regexp.MustCompile(`^[0-9A-Za-z]+$`)          //nolint:gochecknoglobals
+)
+
+// backupStore keeps volume archives under path/{user id}/{container id}.
+// Backups of deleted workspaces stay until they are removed manually or their
+// user is deleted.
+type backupStore struct {
+	path      string
+	retention int
+}
+
+func newBackupStore(cfg config.Configuration) backupStore {
+	return backupStore{path: cfg.BackupPath, retention: cfg.BackupRetention}
+}
+
+func (b backupStore) enabled() bool {
+	return b.path != ""
+}
+
+func (b backupStore) dir(userID, containerID string) string {
+	return filepath.Join(b.path, userID, containerID)
+}
+
+// Save archives a volume and drops the oldest backups beyond the retention.
+func (b backupStore) Save(userID, containerID, volumeDir string) (*model.Backup, error) {
+	dir := b.dir(userID, containerID)
+	if err := os.MkdirAll(dir, backupPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := time.Now().UTC().Format(backupTimeFormat) + backupSuffix
+	target := filepath.Join(dir, name)
+
+	// the archive only gets its final name when it is complete
+	f, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+
+	if err := archive.Write(f, volumeDir); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+
+		return nil, fmt.Errorf("failed to archive volume: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+
+		return nil, fmt.Errorf("failed to close backup file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), target); err != nil {
+		os.Remove(f.Name())
+
+		return nil, fmt.Errorf("failed to store backup: %w", err)
+	}
+
+	if err := b.prune(userID, containerID); err != nil {
+		return nil, err
+	}
+
+	backups, err := b.List(userID, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, backup := range backups {
+		if backup.Name == name {
+			return &backup, nil
+		}
+	}
+
+	return nil, fmt.Errorf("backup %s vanished: %w", name, errs.ErrInternalError)
+}
+
+// List returns the backups of a workspace, the newest first.
+func (b backupStore) List(userID, containerID string) ([]model.Backup, error) {
+	entries, err := os.ReadDir(b.dir(userID, containerID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []model.Backup{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	backups := []model.Backup{}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !backupNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		createdAt, err := time.Parse(backupTimeFormat, strings.TrimSuffix(entry.Name(), backupSuffix))
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, model.Backup{
+			ContainerID: containerID,
+			Name:        entry.Name(),
+			Size:        info.Size(),
+			CreatedAt:   createdAt,
+		})
+	}
+
+	slices.SortFunc(backups, func(a, b model.Backup) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// ListUser returns the backups of all workspaces of a user, including deleted ones.
+func (b backupStore) ListUser(userID string) ([]model.Backup, error) {
+	if !b.enabled() || !idPattern.MatchString(userID) {
+		return []model.Backup{}, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(b.path, userID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []model.Backup{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	backups := []model.Backup{}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		containerBackups, err := b.List(userID, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		backups = append(backups, containerBackups...)
+	}
+
+	return backups, nil
+}
+
+// RemoveUser deletes the backups of all workspaces of a user.
+func (b backupStore) RemoveUser(userID string) error {
+	if !b.enabled() || !idPattern.MatchString(userID) {
+		return nil
+	}
+
+	if err := os.RemoveAll(filepath.Join(b.path, userID)); err != nil {
+		return fmt.Errorf("failed to remove backups: %w", err)
+	}
+
+	return nil
+}
+
+// Open returns a stored backup of a workspace.
+func (b backupStore) Open(userID, containerID, name string) (*os.File, error) {
+	if !b.enabled() || !idPattern.MatchString(containerID) || !backupNamePattern.MatchString(name) {
+		return nil, errs.ErrDataNotFound
+	}
+
+	f, err := os.Open(filepath.Join(b.dir(userID, containerID), name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errs.ErrDataNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+
+	return f, nil
+}
+
+func (b backupStore) prune(userID, containerID string) error {
+	if b.retention <= 0 {
+		return nil
+	}
+
+	backups, err := b.List(userID, containerID)
+	if err != nil {
+		return err
+	}
+
+	for i := b.retention; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(b.dir(userID, containerID), backups[i].Name)); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type backupDBRepo interface {
+	GetAll(ctx context.Context) ([]model.Container, error)
+}
+
+// BackupService backs up every workspace volume each BackupInterval. It is
+// created once at startup.
+type BackupService struct {
+	dbrepo backupDBRepo
+	store  backupStore
+	l      log.Writer
+	cfg    config.Configuration
+}
+
+func NewBackupService(dbrepo backupDBRepo, l log.Writer, cfg config.Configuration) *BackupService {
+	return &BackupService{
+		dbrepo: dbrepo,
+		store:  newBackupStore(cfg),
+		l:      l.Named("backup_service"),
+		cfg:    cfg,
+	}
+}
+
+// Start runs the scheduled backups until ctx ends. They are disabled without
+// BackupPath or with an interval of 0.
+func (s *BackupService) Start(ctx context.Context) {
+	if !s.store.enabled() || s.cfg.BackupInterval <= 0 {
+		s.l.Info("scheduled backups are disabled")
+
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.BackupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Run(ctx); err != nil {
+				s.l.Warn("scheduled backup failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+// Run backs up all workspaces. Failures of single workspaces are logged.
+func (s *BackupService) Run(ctx context.Context) error {
+	containers, err := s.dbrepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to db GetAll: %w", err)
+	}
+
+	saved := 0
+
+	for _, c := range containers {
+		if _, err := s.store.Save(c.UserID, c.ID, s.cfg.VolumesPath+"/"+c.ID); err != nil {
+			s.l.Warn("failed to back up container %s: %s", c.ID, err.Error())
+
+			continue
+		}
+
+		saved++
+	}
+
+	s.l.Info("backed up %d of %d containers", saved, len(containers))
+
+	return nil
+}
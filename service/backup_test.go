@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kaibling/cerodev/errs"
+)
+
+const (
+	backupUserID      = "01JZ3F8Q7V5X2N4M6K8P0R2T4W"
+	backupContainerID = "01JZ3F8Q7V5X2N4M6K8P0R2T4X"
+	backupName        = "20250102T030405Z.tar.gz"
+)
+
+// newTestBackupStore returns a store with one backup of a workspace and a
+// file next to the backup directory.
+func newTestBackupStore(t *testing.T) backupStore {
+	t.Helper()
+
+	b := backupStore{path: filepath.Join(t.TempDir(), "backups"), retention: 2}
+
+	dir := b.dir(backupUserID, backupContainerID)
+	if err := os.MkdirAll(dir, backupPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, backupName), []byte("backup"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(b.path, "secret"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestBackupStoreOpen(t *testing.T) {
+	tests := []struct {
+		name        string
+		containerID string
+		backup      string
+		wantErr     error
+	}{
+		{name: "stored backup", containerID: backupContainerID, backup: backupName},
+		{name: "missing backup", containerID: backupContainerID, backup: "20250102T030406Z.tar.gz",
+			wantErr: errs.ErrDataNotFound},
+		{name: "parent directory as name", containerID: backupContainerID, backup: "../../secret",
+			wantErr: errs.ErrDataNotFound},
+		{name: "name without time", containerID: backupContainerID, backup: "backup.tar.gz",
+			wantErr: errs.ErrDataNotFound},
+		{name: "temporary file", containerID: backupContainerID, backup: backupName + ".123.tmp",
+			wantErr: errs.ErrDataNotFound},
+		{name: "parent directory as container", containerID: "..", backup: backupName,
+			wantErr: errs.ErrDataNotFound},
+		{name: "path as container", containerID: backupUserID + "/" + backupContainerID, backup: backupName,
+			wantErr: errs.ErrDataNotFound},
+		{name: "empty container", containerID: "", backup: backupName, wantErr: errs.ErrDataNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newTestBackupStore(t).Open(backupUserID, tt.containerID, tt.backup)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Open error = %v, want %v", err, tt.wantErr)
+			}
+
+			if f != nil {
+				f.Close()
+			}
+		})
+	}
+}
+
+func TestBackupStoreDisabled(t *testing.T) {
+	b := backupStore{path: "", retention: 0}
+
+	if _, err := b.Open(backupUserID, backupContainerID, backupName); !errors.Is(err, errs.ErrDataNotFound) {
+		t.Errorf("Open error = %v", err)
+	}
+
+	if backups, err := b.ListUser(backupUserID); err != nil || len(backups) != 0 {
+		t.Errorf("ListUser = %v, %v", backups, err)
+	}
+}
+
+func TestBackupStoreUserID(t *testing.T) {
+	tests := []struct {
+		userID string
+		want   int
+	}{
+		{userID: backupUserID, want: 1},
+		{userID: "..", want: 0},
+		{userID: ".", want: 0},
+		{userID: "", want: 0},
+		{userID: backupUserID + "/..", want: 0},
+	}
+
+	for _, tt := range tests {
+		b := newTestBackupStore(t)
+
+		backups, err := b.ListUser(tt.userID)
+		if err != nil || len(backups) != tt.want {
+			t.Errorf("ListUser(%q) = %v, %v, want %d backups", tt.userID, backups, err, tt.want)
+		}
+
+		if err := b.RemoveUser(tt.userID); err != nil {
+			t.Fatalf("RemoveUser(%q): %v", tt.userID, err)
+		}
+
+		// only a valid id removes anything, and never more than its directory
+		if _, err := os.Stat(filepath.Join(b.path, "secret")); err != nil {
+			t.Errorf("RemoveUser(%q) removed the backup path: %v", tt.userID, err)
+		}
+	}
+}
+
+func TestBackupStoreListAndPrune(t *testing.T) {
+	b := newTestBackupStore(t)
+	dir := b.dir(backupUserID, backupContainerID)
+
+	for _, name := range []string{"20250102T030406Z.tar.gz", "20250101T000000Z.tar.gz", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("backup"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.prune(backupUserID, backupContainerID); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+
+	backups, err := b.List(backupUserID, backupContainerID)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	if len(backups) != 2 || backups[0].Name != "20250102T030406Z.tar.gz" || backups[1].Name != backupName {
+		t.Errorf("backups after prune = %+v", backups)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("prune removed a file that is no backup: %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/utils"
+)
+
+const (
+	buildMessageType = "build_progress"
+	// buildLogInterval limits how often the logs of a running build are written.
+	buildLogInterval = 2 * time.Second
+)
+
+type buildrepo interface {
+	Create(ctx context.Context, job *model.BuildJob) (*model.BuildJob, error)
+	GetByID(ctx context.Context, id string) (*model.BuildJob, error)
+	GetAll(ctx context.Context) ([]*model.BuildJob, error)
+	GetByUserID(ctx context.Context, userID string) ([]*model.BuildJob, error)
+	Start(ctx context.Context, id string, startedAt time.Time) error
+	Finish(ctx context.Context, id string, status model.BuildStatus, errMsg string, finishedAt time.Time) error
+	UpdateLogs(ctx context.Context, id, logs string) error
+	FailUnfinished(ctx context.Context, errMsg string, finishedAt time.Time) error
+}
+
+// ImageBuilder builds an image and writes the build output to w. Cancelling
+// ctx aborts the build.
+type ImageBuilder interface {
+	Build(ctx context.Context, t model.Template, tag string, env map[string]*string, w io.Writer) error
+}
+
+// BuildService runs image builds as background jobs. Builds outlive the
+// request that enqueued them, they run in the context of the application.
+type BuildService struct {
+	ctx          context.Context //nolint:containedctx
+	repo         buildrepo
+	templaterepo templaterepo
+	builder      ImageBuilder
+	wss          *WebSocketService
+	l            log.Writer
+	slots        chan struct{}
+	mu           sync.Mutex
+	cancels      map[string]context.CancelFunc
+}
+
+func NewBuildService(
+	ctx context.Context,
+	repo buildrepo,
+	templaterepo templaterepo,
+	builder ImageBuilder,
+	wss *WebSocketService,
+	l log.Writer,
+	cfg config.Configuration,
+) *BuildService {
+	return &BuildService{ //nolint:exhaustruct
+		ctx:          ctx,
+		repo:         repo,
+		templaterepo: templaterepo,
+		builder:      builder,
+		wss:          wss,
+		l:            l.Named("build_service"),
+		slots:        make(chan struct{}, max(cfg.BuildConcurrency, 1)),
+		cancels:      map[string]context.CancelFunc{},
+	}
+}
+
+// FailUnfinished marks builds as failed that were queued or running when the
+// application stopped.
+func (s *BuildService) FailUnfinished(ctx context.Context) error {
+	if err := s.repo.FailUnfinished(ctx, "build was interrupted by a restart", time.Now()); err != nil {
+		return fmt.Errorf("failed to db FailUnfinished: %w", err)
+	}
+
+	return nil
+}
+
+// Enqueue creates a build job and runs it in the background. Progress is sent
+// to the websocket client connected with token.
+func (s *BuildService) Enqueue(
+	ctx context.Context,
+	req model.Requester,
+	token string,
+	params model.BuildParams,
+) (*model.BuildJob, error) {
+	t, err := s.templaterepo.GetByID(ctx, params.TemplateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetByID: %w", err)
+	}
+
+	job, err := s.repo.Create(ctx, &model.BuildJob{ //nolint:exhaustruct
+		ID:         utils.GenerateULID(),
+		TemplateID: t.ID,
+		UserID:     req.UserID,
+		Tag:        params.Tag,
+		Status:     model.BuildQueued,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to db Create: %w", err)
+	}
+
+	buildCtx, cancel := context.WithCancel(s.ctx)
+
+	s.mu.Lock()
+	s.cancels[job.ID] = cancel
+	s.mu.Unlock()
+
+	go s.run(buildCtx, *t, job.ID, job.Tag, params.BuildArgs, token)
+
+	return job, nil
+}
+
+func (s *BuildService) GetByID(ctx context.Context, req model.Requester, id string) (*model.BuildJob, error) {
+	job, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to db GetByID: %w", err)
+	}
+
+	if !req.IsAdmin() && job.UserID != req.UserID {
+		return nil, errs.ErrDataNotFound
+	}
+
+	return job, nil
+}
+
+// GetAll returns the builds visible to the requester without their logs.
+func (s *BuildService) GetAll(ctx context.Context, req model.Requester) ([]*model.BuildJob, error) {
+	var (
+		jobs []*model.BuildJob
+		err  error
+	)
+
+	if req.IsAdmin() {
+		jobs, err = s.repo.GetAll(ctx)
+	} else {
+		jobs, err = s.repo.GetByUserID(ctx, req.UserID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to db GetAll: %w", err)
+	}
+
+	for _, job := range jobs {
+		job.Logs = ""
+	}
+
+	return jobs, nil
+}
+
+// Cancel aborts a queued or running build.
+func (s *BuildService) Cancel(ctx context.Context, req model.Requester, id string) error {
+	job, err := s.GetByID(ctx, req, id)
+	if err != nil {
+		return err
+	}
+
+	if job.Status.Finished() {
+		return fmt.Errorf("%w: build is already %s", errs.ErrInvalidInput, job.Status)
+	}
+
+	s.mu.Lock()
+	cancel, ok := s.cancels[id]
+	s.mu.Unlock()
+
+	if !ok {
+		return errs.ErrDataNotFound
+	}
+
+	cancel()
+
+	return nil
+}
+
+func (s *BuildService) run(
+	ctx context.Context,
+	t model.Template,
+	jobID, tag string,
+	buildArgs map[string]*string,
+	token string,
+) {
+	defer s.forget(jobID)
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		s.finish(ctx, jobID, token, ctx.Err())
+
+		return
+	}
+
+	if err := s.repo.Start(s.ctx, jobID, time.Now()); err != nil {
+		s.l.Error("failed to start build "+jobID, err)
+	}
+
+	s.notify(token, jobID, string(model.BuildRunning))
+
+	if buildArgs == nil {
+		buildArgs = map[string]*string{}
+	}
+
+	buildArgs["ARCHITECTURE"] = &config.Architecture
+
+	w := &buildLogWriter{s: s, jobID: jobID, token: token} //nolint:exhaustruct
+	err := s.builder.Build(ctx, t, tag, buildArgs, w)
+	w.Flush()
+
+	s.finish(ctx, jobID, token, err)
+}
+
+func (s *BuildService) finish(ctx context.Context, jobID, token string, buildErr error) {
+	status := model.BuildSucceeded
+	errMsg := ""
+
+	switch {
+	case buildErr != nil && ctx.Err() != nil:
+		status = model.BuildCancelled
+		errMsg = "build was cancelled"
+	case buildErr != nil:
+		status = model.BuildFailed
+		errMsg = buildErr.Error()
+	}
+
+	// ctx of a cancelled build is done, the result is stored anyway
+	if err := s.repo.Finish(s.ctx, jobID, status, errMsg, time.Now()); err != nil {
+		s.l.Error("failed to finish build "+jobID, err)
+	}
+
+	message := string(status)
+	if errMsg != "" {
+		message += ": " + errMsg
+	}
+
+	s.notify(token, jobID, message)
+}
+
+func (s *BuildService) forget(jobID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cancel, ok := s.cancels[jobID]; ok {
+		cancel()
+		delete(s.cancels, jobID)
+	}
+}
+
+// notify sends a progress message. Builds do not depend on a connected
+// websocket client, so send errors are ignored.
+func (s *BuildService) notify(token, jobID, message string) {
+	err := s.wss.SendJSON(model.WebSocketMessage{ //nolint:exhaustruct
+		Timestamp:   time.Now().Format(time.RFC3339),
+		MessageType: buildMessageType,
+		Message:     message,
+		ReferenceID: jobID,
+	}, token)
+	if err != nil {
+		s.l.Debug("build progress not sent: %s", err.Error())
+	}
+}
+
+// buildLogWriter collects the build output, stores it periodically and sends
+// every line to the websocket client.
+type buildLogWriter struct {
+	s       *BuildService
+	jobID   string
+	token   string
+	logs    strings.Builder
+	line    []byte
+	written time.Time
+}
+
+func (w *buildLogWriter) Write(p []byte) (int, error) {
+	w.logs.Write(p)
+	w.line = append(w.line, p...)
+
+	for {
+		line, rest, found := bytes.Cut(w.line, []byte("\n"))
+		if !found {
+			break
+		}
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			w.s.notify(w.token, w.jobID, string(line))
+		}
+
+		w.line = rest
+	}
+
+	if time.Since(w.written) > buildLogInterval {
+		w.Flush()
+	}
+
+	return len(p), nil
+}
+
+// Flush stores the logs collected so far.
+func (w *buildLogWriter) Flush() {
+	w.written = time.Now()
+
+	if err := w.s.repo.UpdateLogs(w.s.ctx, w.jobID, w.logs.String()); err != nil {
+		w.s.l.Error("failed to store build logs "+w.jobID, err)
+	}
+}
@@ -1,72 +1,154 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kaibling/apiforge/log"
 	"github.com/kaibling/cerodev/config"
 	"github.com/kaibling/cerodev/errs"
 	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/archive"
 	"github.com/kaibling/cerodev/pkg/utils"
 )
 
+var (
+	snapshotNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)          //nolint:gochecknoglobals
+	snapshotTagPattern  = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)  //nolint:gochecknoglobals
+	gitRefPattern       = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._/-]{0,254}$`) //nolint:gochecknoglobals
+)
+
+const (
+	codeServerPort = 8765
+	maxPort        = 65535
+	runningState   = "running"
+	// reserveAttempts limits the retries when concurrent requests take the
+	// same free port.
+	reserveAttempts = 3
+)
+
 type dbrepo interface {
-	GetByID(id string) (*model.Container, error)
-	GetAll() ([]model.Container, error)
-	Create(container *model.Container) (*model.Container, error)
-	Delete(id string) error
-	Update(container *model.Container) (*model.Container, error)
-	ReleasePort(containerID string) error
-	GetFreePort() (int, error)
-	AllocatePort(containerID string, port int) error
-	GetPortCount() (int, error)
-	FillPorts(minPort, maxPort int) error
-}
-
-type dockerrepo interface {
-	StartContainer(containerID string) error
-	CreateContainer(container *model.Container) (string, error)
-	StopContainer(containerID string) error
-	DeleteContainer(containerID string) error
-	GetContainerStatuses(containerID []string) ([]model.ContainerStatus, error)
-	Build(t model.Template, tag string, env map[string]*string) error
-	GetImages() ([]model.Image, error)
+	GetByID(ctx context.Context, id string) (*model.Container, error)
+	GetByIDAndUserID(ctx context.Context, id, userID string) (*model.Container, error)
+	GetAll(ctx context.Context) ([]model.Container, error)
+	GetAllByUserID(ctx context.Context, userID string) ([]model.Container, error)
+	Create(ctx context.Context, container *model.Container) (*model.Container, error)
+	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, container *model.Container) (*model.Container, error)
+	ReleasePort(ctx context.Context, containerID string) error
+	GetFreePort(ctx context.Context, nodeID string) (int, error)
+	AllocatePort(ctx context.Context, nodeID, containerID string, port int) error
+	ReservePort(ctx context.Context, port model.NodePort) (bool, error)
+	ReleasePortByPort(ctx context.Context, port model.NodePort) error
+	GetPortCount(ctx context.Context, nodeID string) (int, error)
+	FillPorts(ctx context.Context, nodeID string, minPort, maxPort int) error
+	CreateShare(ctx context.Context, share *model.ContainerShare) error
+	DeleteShare(ctx context.Context, containerID, userID string) error
+	GetShares(ctx context.Context, containerID string) ([]model.ContainerShare, error)
+	IsSharedWith(ctx context.Context, containerID, userID string) (bool, error)
+	CreatePublishedPort(ctx context.Context, port *model.PublishedPort) error
+	DeletePublishedPort(ctx context.Context, containerID string, port int) error
+	DeletePublishedPorts(ctx context.Context, containerID string) error
+	GetPublishedPorts(ctx context.Context, containerID string) ([]model.PublishedPort, error)
+	GetAnyByID(ctx context.Context, id string) (*model.Container, error)
+	GetDeleted(ctx context.Context) ([]model.Container, error)
+	GetDeletedByUserID(ctx context.Context, userID string) ([]model.Container, error)
+	SetDeleted(ctx context.Context, id string, deletedAt *time.Time) error
+}
+
+type containerProvider interface {
+	StartContainer(ctx context.Context, containerID string) error
+	CreateContainer(ctx context.Context, container *model.Container) (string, error)
+	StopContainer(ctx context.Context, containerID string) error
+	UpdateLimits(ctx context.Context, containerID string, limits model.ResourceLimits) error
+	DeleteContainer(ctx context.Context, containerID string) error
+	GetContainerStatuses(ctx context.Context, containerID []string) ([]model.ContainerStatus, error)
+	GetContainerIP(ctx context.Context, containerID string) (string, error)
+	PublishPort(ctx context.Context, containerID string, hostPort, port int) error
+	UnpublishPort(ctx context.Context, containerID string, hostPort int) error
+	GetContainerStats(ctx context.Context, containerID string) (model.ContainerStats, error)
+	FollowLogs(ctx context.Context, containerID string, opts model.LogOptions, w io.Writer) error
+	CreateExec(ctx context.Context, containerID string, cmd []string) (string, error)
+	GetExec(ctx context.Context, execID string) (model.ExecSession, error)
+	AttachExec(ctx context.Context, execID string) (model.ExecStream, error)
+	GetImages(ctx context.Context) ([]model.Image, error)
+	GetImage(ctx context.Context, imageName string) (model.Image, error)
+	CommitContainer(ctx context.Context, containerID string, snapshot model.Snapshot) (model.Image, error)
+	RemoveImage(ctx context.Context, imageName string) error
+}
+
+type quotaChecker interface {
+	CheckCreate(ctx context.Context, userID string, limits model.ResourceLimits) error
+	CheckStart(ctx context.Context, c *model.Container) error
+	CheckUpdate(ctx context.Context, c *model.Container, limits model.ResourceLimits) error
+}
+
+type gitCredentialWriter interface {
+	WriteGitFiles(ctx context.Context, userID, dir string) error
+}
+
+type secretResolver interface {
+	Resolve(ctx context.Context, userID, imageName string, env []string) ([]string, error)
+}
+
+type nodeScheduler interface {
+	Schedule(ctx context.Context, limits model.ResourceLimits) (string, error)
+	PublicURL(ctx context.Context, nodeID string) (string, error)
 }
 
 type ContainerService struct {
 	dbrepo       dbrepo
-	dockerrepo   dockerrepo
+	provider     containerProvider
 	templaterepo templaterepo
+	quotas       quotaChecker
+	credentials  gitCredentialWriter
+	secrets      secretResolver
+	nodes        nodeScheduler
+	backups      backupStore
 	l            log.Writer
 	cfg          config.Configuration
 }
 
 func NewContainerService(dbrepo dbrepo,
-	dockerrepo dockerrepo,
+	provider containerProvider,
 	templaterepo templaterepo,
+	quotas quotaChecker,
+	credentials gitCredentialWriter,
+	secrets secretResolver,
+	nodes nodeScheduler,
 	l log.Writer,
 	cfg config.Configuration,
 ) *ContainerService {
 	return &ContainerService{
 		dbrepo:       dbrepo,
-		dockerrepo:   dockerrepo,
+		provider:     provider,
 		templaterepo: templaterepo,
+		quotas:       quotas,
+		credentials:  credentials,
+		secrets:      secrets,
+		nodes:        nodes,
+		backups:      newBackupStore(cfg),
 		l:            l.Named("container_service"),
 		cfg:          cfg,
 	}
 }
 
-func (s *ContainerService) GetByID(id string) (*model.Container, error) {
-	container, err := s.dbrepo.GetByID(id)
+func (s *ContainerService) GetByID(ctx context.Context, req model.Requester, id string) (*model.Container, error) {
+	container, err := s.getOwned(ctx, req, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to GetByID: %w", err)
 	}
 
-	status, err := s.dockerrepo.GetContainerStatuses([]string{container.DockerID})
+	status, err := s.provider.GetContainerStatuses(ctx, []string{container.DockerID})
 	if err != nil {
 		return nil, fmt.Errorf("failed to provider GetContainerStatuses: %w", err)
 	}
@@ -81,8 +163,18 @@ func (s *ContainerService) GetByID(id string) (*model.Container, error) {
 	return container, nil
 }
 
-func (s *ContainerService) GetAll() ([]model.Container, error) {
-	containers, err := s.dbrepo.GetAll()
+func (s *ContainerService) GetAll(ctx context.Context, req model.Requester) ([]model.Container, error) {
+	var (
+		containers []model.Container
+		err        error
+	)
+
+	if req.IsAdmin() {
+		containers, err = s.dbrepo.GetAll(ctx)
+	} else {
+		containers, err = s.dbrepo.GetAllByUserID(ctx, req.UserID)
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to GetAll: %w", err)
 	}
@@ -92,7 +184,7 @@ func (s *ContainerService) GetAll() ([]model.Container, error) {
 		containerIDs[i] = c.DockerID
 	}
 
-	statuses, err := s.dockerrepo.GetContainerStatuses(containerIDs)
+	statuses, err := s.provider.GetContainerStatuses(ctx, containerIDs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to GetContainerStatuses: %w", err)
 	}
@@ -109,10 +201,458 @@ func (s *ContainerService) GetAll() ([]model.Container, error) {
 	return containers, nil
 }
 
-func (s *ContainerService) Create(container *model.Container) (*model.Container, error) {
+// GetStats returns the resource usage of a workspace.
+func (s *ContainerService) GetStats(
+	ctx context.Context,
+	req model.Requester,
+	id string,
+) (*model.ContainerStats, error) {
+	c, err := s.getOwned(ctx, req, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	stats, err := collectStats(ctx, s.provider, s.cfg.VolumesPath, s.l, []model.Container{*c})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collectStats: %w", err)
+	}
+
+	return &stats[0], nil
+}
+
+// GetAllStats returns the resource usage of every workspace the requester can see.
+func (s *ContainerService) GetAllStats(ctx context.Context, req model.Requester) ([]model.ContainerStats, error) {
+	var (
+		containers []model.Container
+		err        error
+	)
+
+	if req.IsAdmin() {
+		containers, err = s.dbrepo.GetAll(ctx)
+	} else {
+		containers, err = s.dbrepo.GetAllByUserID(ctx, req.UserID)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetAll: %w", err)
+	}
+
+	val, err := collectStats(ctx, s.provider, s.cfg.VolumesPath, s.l, containers)
+
+	return HandleError[[]model.ContainerStats](val, err, "failed to collectStats")
+}
+
+// GetShared returns a container the requester owns or that was shared with
+// them. It is used to authorize access through the proxy.
+func (s *ContainerService) GetShared(ctx context.Context, req model.Requester, id string) (*model.Container, error) {
+	container, err := s.getOwned(ctx, req, id)
+	if err == nil {
+		return container, nil
+	}
+
+	if !errors.Is(err, errs.ErrDataNotFound) {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	shared, err := s.dbrepo.IsSharedWith(ctx, id, req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to IsSharedWith: %w", err)
+	}
+
+	if !shared {
+		return nil, errs.ErrDataNotFound
+	}
+
+	val, err := s.dbrepo.GetByID(ctx, id)
+
+	return HandleError[*model.Container](val, err, "failed to GetByID")
+}
+
+func (s *ContainerService) GetShares(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+) ([]model.ContainerShare, error) {
+	if _, err := s.getOwned(ctx, req, containerID); err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	val, err := s.dbrepo.GetShares(ctx, containerID)
+
+	return HandleError[[]model.ContainerShare](val, err, "failed to GetShares")
+}
+
+func (s *ContainerService) Share(
+	ctx context.Context,
+	req model.Requester,
+	containerID, userID string,
+) (*model.ContainerShare, error) {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	if userID == "" || userID == c.UserID {
+		return nil, fmt.Errorf("%w: cannot share a container with its owner", errs.ErrInvalidInput)
+	}
+
+	share := &model.ContainerShare{
+		ContainerID: containerID,
+		UserID:      userID,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.dbrepo.CreateShare(ctx, share); err != nil {
+		return nil, fmt.Errorf("failed to CreateShare: %w", err)
+	}
+
+	return share, nil
+}
+
+func (s *ContainerService) Unshare(ctx context.Context, req model.Requester, containerID, userID string) error {
+	if _, err := s.getOwned(ctx, req, containerID); err != nil {
+		return fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	if err := s.dbrepo.DeleteShare(ctx, containerID, userID); err != nil {
+		return fmt.Errorf("failed to DeleteShare: %w", err)
+	}
+
+	return nil
+}
+
+func (s *ContainerService) GetPublishedPorts(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+) ([]model.PublishedPort, error) {
+	if _, err := s.getOwned(ctx, req, containerID); err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	val, err := s.dbrepo.GetPublishedPorts(ctx, containerID)
+
+	return HandleError[[]model.PublishedPort](val, err, "failed to GetPublishedPorts")
+}
+
+// PublishPort makes a port of the workspace reachable through the proxy. A
+// host port is taken from the port pool of the node of the workspace and
+// forwarded to the port by the provider, the container is not recreated.
+func (s *ContainerService) PublishPort(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+	port int,
+) (_ *model.PublishedPort, err error) {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	if port < 1 || port > maxPort || port == codeServerPort {
+		return nil, fmt.Errorf("%w: port %d cannot be published", errs.ErrInvalidInput, port)
+	}
+
+	if _, ok := c.HostPort(strconv.Itoa(port)); ok {
+		return nil, fmt.Errorf("%w: port %d is already bound", errs.ErrInvalidInput, port)
+	}
+
+	published, err := s.dbrepo.GetPublishedPorts(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetPublishedPorts: %w", err)
+	}
+
+	for _, p := range published {
+		if p.Port == port {
+			return nil, fmt.Errorf("%w: port %d is already published", errs.ErrInvalidInput, port)
+		}
+	}
+
+	hostPort, err := s.reserveHostPort(ctx, c.NodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			s.releaseHostPort(context.WithoutCancel(ctx), c.NodeID, hostPort)
+		}
+	}()
+
+	publishedPort := &model.PublishedPort{
+		ContainerID: containerID,
+		Port:        port,
+		HostPort:    hostPort,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := s.dbrepo.CreatePublishedPort(ctx, publishedPort); err != nil {
+		return nil, fmt.Errorf("failed to CreatePublishedPort: %w", err)
+	}
+
+	if err := s.provider.PublishPort(ctx, c.DockerID, hostPort, port); err != nil {
+		if derr := s.dbrepo.DeletePublishedPort(context.WithoutCancel(ctx), containerID, port); derr != nil {
+			s.l.Warn("failed to delete published port %d of %s: %s", port, containerID, derr.Error())
+		}
+
+		return nil, fmt.Errorf("failed to provider PublishPort: %w", err)
+	}
+
+	return publishedPort, nil
+}
+
+// reserveHostPort takes a free port of the pool of a node. Another request
+// may take the same port first, the next free one is tried then.
+func (s *ContainerService) reserveHostPort(ctx context.Context, nodeID string) (int, error) {
+	for range reserveAttempts {
+		port, err := s.dbrepo.GetFreePort(ctx, nodeID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to GetFreePort: %w", err)
+		}
+
+		ok, err := s.dbrepo.ReservePort(ctx, model.NodePort{NodeID: nodeID, Port: port})
+		if err != nil {
+			return 0, fmt.Errorf("failed to ReservePort: %w", err)
+		}
+
+		if ok {
+			return port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: no free port on node %s", errs.ErrInvalidInput, nodeID)
+}
+
+func (s *ContainerService) releaseHostPort(ctx context.Context, nodeID string, port int) {
+	if err := s.dbrepo.ReleasePortByPort(ctx, model.NodePort{NodeID: nodeID, Port: port}); err != nil {
+		s.l.Warn("failed to release port %d of node %s: %s", port, nodeID, err.Error())
+	}
+}
+
+func (s *ContainerService) UnpublishPort(ctx context.Context, req model.Requester, containerID string, port int) error {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	published, err := s.dbrepo.GetPublishedPorts(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to GetPublishedPorts: %w", err)
+	}
+
+	i := slices.IndexFunc(published, func(p model.PublishedPort) bool { return p.Port == port })
+	if i < 0 {
+		return fmt.Errorf("failed to DeletePublishedPort: %w", errs.ErrDataNotFound)
+	}
+
+	if err := s.provider.UnpublishPort(ctx, c.DockerID, published[i].HostPort); err != nil {
+		return fmt.Errorf("failed to provider UnpublishPort: %w", err)
+	}
+
+	if err := s.dbrepo.DeletePublishedPort(ctx, containerID, port); err != nil {
+		return fmt.Errorf("failed to DeletePublishedPort: %w", err)
+	}
+
+	s.releaseHostPort(ctx, c.NodeID, published[i].HostPort)
+
+	return nil
+}
+
+// republishPorts forwards the published ports again after a workspace
+// started. A port that fails stays unreachable until the next start.
+func (s *ContainerService) republishPorts(ctx context.Context, c *model.Container) {
+	published, err := s.dbrepo.GetPublishedPorts(ctx, c.ID)
+	if err != nil {
+		s.l.Warn("failed to read published ports of %s: %s", c.ID, err.Error())
+
+		return
+	}
+
+	for _, p := range published {
+		if err := s.provider.PublishPort(ctx, c.DockerID, p.HostPort, p.Port); err != nil {
+			s.l.Warn("failed to publish port %d of %s: %s", p.Port, c.ID, err.Error())
+		}
+	}
+}
+
+// ProxyTarget returns the url the proxy forwards to. Port 0 addresses the
+// code-server. Like the code-server, published ports and ports bound at
+// create time are reached via their host port on the node of the workspace.
+func (s *ContainerService) ProxyTarget(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+	port int,
+) (string, error) {
+	c, err := s.GetShared(ctx, req, containerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to GetShared: %w", err)
+	}
+
+	nodeURL, err := s.nodes.PublicURL(ctx, c.NodeID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get PublicURL of node: %w", err)
+	}
+
+	if port == 0 {
+		return nodeURL + ":" + c.UIPort, nil
+	}
+
+	published, err := s.dbrepo.GetPublishedPorts(ctx, containerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to GetPublishedPorts: %w", err)
+	}
+
+	for _, p := range published {
+		if p.Port == port {
+			return nodeURL + ":" + strconv.Itoa(p.HostPort), nil
+		}
+	}
+
+	if hostPort, ok := c.HostPort(strconv.Itoa(port)); ok {
+		return nodeURL + ":" + hostPort, nil
+	}
+
+	return "", errs.ErrDataNotFound
+}
+
+// StreamLogs copies the output of a container to w. With opts.Follow it
+// blocks until the container stops or the context of the service ends.
+func (s *ContainerService) StreamLogs(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+	opts model.LogOptions,
+	w io.Writer,
+) error {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	if err := s.provider.FollowLogs(ctx, c.DockerID, opts, w); err != nil {
+		return fmt.Errorf("failed to provider FollowLogs: %w", err)
+	}
+
+	return nil
+}
+
+// CreateExec prepares an interactive TTY exec in a running workspace. It is
+// started when attached with AttachExec.
+func (s *ContainerService) CreateExec(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+	cmd []string,
+) (*model.ExecSession, error) {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	if len(cmd) == 0 {
+		cmd = []string{"/bin/bash"}
+	}
+
+	execID, err := s.provider.CreateExec(ctx, c.DockerID, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provider CreateExec: %w", err)
+	}
+
+	return &model.ExecSession{
+		ID:          execID,
+		ContainerID: containerID,
+		DockerID:    c.DockerID,
+		Cmd:         cmd,
+		Started:     false,
+	}, nil
+}
+
+// AttachExec starts an exec created by CreateExec. Execs of other containers
+// are reported as not found and every exec can only be attached once.
+func (s *ContainerService) AttachExec(ctx context.Context, req model.Requester, containerID, execID string) (model.ExecStream, error) { //nolint:ireturn,lll
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	session, err := s.provider.GetExec(ctx, execID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to provider GetExec: %w", errs.ErrDataNotFound, err)
+	}
+
+	if session.DockerID != c.DockerID {
+		return nil, errs.ErrDataNotFound
+	}
+
+	if session.Started {
+		return nil, fmt.Errorf("%w: exec %s was already attached", errs.ErrInvalidInput, execID)
+	}
+
+	stream, err := s.provider.AttachExec(ctx, execID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provider AttachExec: %w", err)
+	}
+
+	return stream, nil
+}
+
+// getOwned reads a container from the db. Containers of other users are
+// reported as not found, unless the requester is an admin.
+func (s *ContainerService) getOwned(ctx context.Context, req model.Requester, id string) (*model.Container, error) {
+	if req.IsAdmin() {
+		return s.dbrepo.GetByID(ctx, id)
+	}
+
+	return s.dbrepo.GetByIDAndUserID(ctx, id, req.UserID)
+}
+
+func (s *ContainerService) Create(ctx context.Context, container *model.Container) (_ *model.Container, err error) {
+	if container.GitRef != "" && !gitRefPattern.MatchString(container.GitRef) {
+		return nil, fmt.Errorf("%w: invalid git ref %q", errs.ErrInvalidInput, container.GitRef)
+	}
+
+	if container.GitDepth < 0 {
+		return nil, fmt.Errorf("%w: git depth must not be negative", errs.ErrInvalidInput)
+	}
+
+	img, err := s.checkImageAccess(ctx, container.UserID, container.ImageName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checkImageAccess: %w", err)
+	}
+
+	// snapshots keep the defaults of the template of their source workspace
+	templateImage := container.ImageName
+	if img.SourceImage != "" {
+		templateImage = img.SourceImage
+	}
+
+	limits, err := resolveLimits(container.Limits, s.templateLimits(ctx, templateImage), s.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolveLimits: %w", err)
+	}
+
+	if err := s.quotas.CheckCreate(ctx, container.UserID, limits); err != nil {
+		return nil, fmt.Errorf("failed to CheckCreate: %w", err)
+	}
+
+	container.EnvVars = utils.RemoveEmptyStrings(container.EnvVars)
+
+	// the db keeps the references, only the provider gets the secret values
+	resolvedEnv, err := s.secrets.Resolve(ctx, container.UserID, templateImage, container.EnvVars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Resolve secrets: %w", err)
+	}
+
 	container.ID = utils.GenerateULID()
+	container.Limits = limits
+
+	container.NodeID, err = s.nodes.Schedule(ctx, limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Schedule: %w", err)
+	}
 
-	freePort, err := s.dbrepo.GetFreePort()
+	freePort, err := s.dbrepo.GetFreePort(ctx, container.NodeID)
 	if err != nil {
 		s.l.Error("Failed to get free port", err)
 
@@ -120,78 +660,359 @@ func (s *ContainerService) Create(container *model.Container) (*model.Container,
 	}
 
 	// add vscode port to container
-	if err := s.dbrepo.AllocatePort(container.ID, freePort); err != nil {
+	if err := s.dbrepo.AllocatePort(ctx, container.NodeID, container.ID, freePort); err != nil {
 		return nil, fmt.Errorf("failed to AllocatePort: %w", err)
 	}
 
-	container.Ports = append(container.Ports, strconv.Itoa(freePort)+":8765/tcp")
+	// a failed create gives the port back, also when the request is gone
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if rerr := s.dbrepo.ReleasePort(context.WithoutCancel(ctx), container.ID); rerr != nil {
+			s.l.Warn("failed to release port of failed container %s: %s", container.ID, rerr.Error())
+		}
+	}()
+
+	container.Ports = append(container.Ports, strconv.Itoa(freePort)+":"+strconv.Itoa(codeServerPort)+"/tcp")
 
 	// container data validation
 	container.ContainerName = utils.ContainerName(container.UserID, container.GitRepo)
-	container.EnvVars = utils.RemoveEmptyStrings(container.EnvVars)
 	container.Ports = utils.RemoveEmptyStrings(container.Ports)
-	container.EnvVars = append(container.EnvVars, "GIT_REPO="+container.GitRepo)
+	container.EnvVars = append(container.EnvVars, gitEnv(container)...)
 
-	ctrID, err := s.dockerrepo.CreateContainer(container)
+	resolved := *container
+	resolved.EnvVars = slices.Concat(resolvedEnv, gitEnv(container))
+
+	// credentials are mounted as files, they never show up in the env vars
+	gitDir := utils.GitCredentialsDir(s.cfg.VolumesPath, container.ID)
+	if err := s.credentials.WriteGitFiles(ctx, container.UserID, gitDir); err != nil {
+		return nil, fmt.Errorf("failed to WriteGitFiles: %w", err)
+	}
+
+	ctrID, err := s.provider.CreateContainer(ctx, &resolved)
 	if err != nil {
+		if rerr := os.RemoveAll(gitDir); rerr != nil {
+			s.l.Warn("failed to remove git credentials: %s", rerr.Error())
+		}
+
 		return nil, fmt.Errorf("failed to CreateContainer: %w", err)
 	}
 
 	container.DockerID = ctrID
 
-	val, err := s.dbrepo.Create(container)
+	val, err := s.dbrepo.Create(ctx, container)
+	if err != nil {
+		if derr := s.provider.DeleteContainer(context.WithoutCancel(ctx), ctrID); derr != nil {
+			s.l.Warn("failed to delete container %s of failed create: %s", ctrID, derr.Error())
+		}
+
+		if rerr := os.RemoveAll(gitDir); rerr != nil {
+			s.l.Warn("failed to remove git credentials: %s", rerr.Error())
+		}
+
+		return nil, fmt.Errorf("failed to db Create: %w", err)
+	}
+
+	return val, nil
+}
+
+// UpdateLimits changes the resource limits of a workspace without recreating
+// it. Unset limits fall back to the template defaults and the maximums.
+func (s *ContainerService) UpdateLimits(ctx context.Context, req model.Requester, containerID string, limits model.ResourceLimits) (*model.Container, error) { //nolint:lll
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	limits, err = resolveLimits(limits, s.templateLimits(ctx, c.ImageName), s.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolveLimits: %w", err)
+	}
+
+	if (c.Limits.CPUQuota > 0 && limits.CPUQuota == 0) ||
+		(c.Limits.Memory > 0 && limits.Memory == 0) ||
+		(c.Limits.MemorySwap != 0 && limits.MemorySwap == 0) {
+		return nil, fmt.Errorf("%w: cpu and memory limits cannot be removed from an existing container",
+			errs.ErrInvalidInput)
+	}
+
+	if err := s.quotas.CheckUpdate(ctx, c, limits); err != nil {
+		return nil, fmt.Errorf("failed to CheckUpdate: %w", err)
+	}
+
+	if err := s.provider.UpdateLimits(ctx, c.DockerID, limits); err != nil {
+		return nil, fmt.Errorf("failed to provider UpdateLimits: %w", err)
+	}
+
+	c.Limits = limits
+
+	val, err := s.dbrepo.Update(ctx, c)
+
+	return HandleError[*model.Container](val, err, "failed to db Update")
+}
+
+// templateLimits returns the default limits of the template the image was
+// built from.
+func (s *ContainerService) templateLimits(ctx context.Context, imageName string) model.ResourceLimits {
+	templates, err := s.templaterepo.GetAll(ctx)
+	if err != nil {
+		s.l.Warn("failed to read templates: %s", err.Error())
+
+		return model.ResourceLimits{} //nolint:exhaustruct
+	}
+
+	for _, t := range templates {
+		if t.BuiltImage(imageName) {
+			return t.Limits
+		}
+	}
 
-	return HandleError[*model.Container](val, err, "failed to db Create")
+	return model.ResourceLimits{} //nolint:exhaustruct
 }
 
-func (s *ContainerService) Update(container *model.Container) (*model.Container, error) {
-	return s.dbrepo.Update(container)
+func (s *ContainerService) Update(ctx context.Context, container *model.Container) (*model.Container, error) {
+	return s.dbrepo.Update(ctx, container)
 }
 
-func (s *ContainerService) StartContainer(containerID string) error {
-	m, err := s.GetByID(containerID)
+func (s *ContainerService) StartContainer(ctx context.Context, req model.Requester, containerID string) error {
+	m, err := s.GetByID(ctx, req, containerID)
 	if err != nil {
 		return fmt.Errorf("failed to GetByID: %w", err)
 	}
 
-	if err := s.dockerrepo.StartContainer(m.DockerID); err != nil {
+	if err := s.quotas.CheckStart(ctx, m); err != nil {
+		return fmt.Errorf("failed to CheckStart: %w", err)
+	}
+
+	s.refreshGitFiles(ctx, m)
+
+	if err := s.provider.StartContainer(ctx, m.DockerID); err != nil {
 		return fmt.Errorf("failed to provider StartContainer: %w", err)
 	}
 
+	s.republishPorts(ctx, m)
+
 	return nil
 }
 
-func (s *ContainerService) StopContainer(containerID string) error {
-	m, err := s.GetByID(containerID)
+// EnsureRunning starts a stopped workspace the requester has access to, also
+// through a share. It reports whether the workspace was started.
+func (s *ContainerService) EnsureRunning(ctx context.Context, req model.Requester, containerID string) (bool, error) {
+	c, err := s.GetShared(ctx, req, containerID)
+	if err != nil {
+		return false, fmt.Errorf("failed to GetShared: %w", err)
+	}
+
+	statuses, err := s.provider.GetContainerStatuses(ctx, []string{c.DockerID})
+	if err != nil {
+		return false, fmt.Errorf("failed to provider GetContainerStatuses: %w", err)
+	}
+
+	if len(statuses) == 0 {
+		return false, errs.ErrContainerNotInProvider
+	}
+
+	if statuses[0].State == runningState {
+		return false, nil
+	}
+
+	if err := s.quotas.CheckStart(ctx, c); err != nil {
+		return false, fmt.Errorf("failed to CheckStart: %w", err)
+	}
+
+	s.refreshGitFiles(ctx, c)
+
+	if err := s.provider.StartContainer(ctx, c.DockerID); err != nil {
+		return false, fmt.Errorf("failed to provider StartContainer: %w", err)
+	}
+
+	s.republishPorts(ctx, c)
+
+	s.l.Info("started container %s on proxy access", containerID)
+
+	return true, nil
+}
+
+// refreshGitFiles writes the current git credentials of the owner before a
+// workspace starts. The workspace starts with the previous files on failure.
+func (s *ContainerService) refreshGitFiles(ctx context.Context, c *model.Container) {
+	if err := s.credentials.WriteGitFiles(ctx, c.UserID, utils.GitCredentialsDir(s.cfg.VolumesPath, c.ID)); err != nil {
+		s.l.Warn("failed to refresh git credentials of %s: %s", c.ID, err.Error())
+	}
+}
+
+func (s *ContainerService) StopContainer(ctx context.Context, req model.Requester, containerID string) error {
+	m, err := s.GetByID(ctx, req, containerID)
 	if err != nil {
 		return fmt.Errorf("failed to GetByID: %w", err)
 	}
 
-	if err := s.dockerrepo.StopContainer(m.DockerID); err != nil {
+	if err := s.provider.StopContainer(ctx, m.DockerID); err != nil {
 		return fmt.Errorf("failed to provider StopContainer: %w", err)
 	}
 
 	return nil
 }
 
-func (s *ContainerService) DeleteContainer(containerID string) error {
-	m, err := s.GetByID(containerID)
-	if err != nil { //nolint:nestif
-		if errors.Is(err, errs.ErrContainerNotInProvider) {
-			s.l.Warn("container is not in provider. skip deletion in provider")
-		} else {
-			return fmt.Errorf("could not get container: %w", err)
+// DeleteContainer moves a container into the trash when TrashPeriod is set.
+// It is stopped and its volume is kept until the janitor purges it. Without a
+// trash period the container is purged right away.
+func (s *ContainerService) DeleteContainer(ctx context.Context, req model.Requester, containerID string) error {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	if s.cfg.TrashPeriod <= 0 {
+		return s.purge(ctx, c)
+	}
+
+	if err := s.provider.StopContainer(ctx, c.DockerID); err != nil {
+		if !strings.Contains(err.Error(), "No such container") {
+			return fmt.Errorf("failed to StopContainer: %w", err)
 		}
-	} else {
-		if err := s.dockerrepo.DeleteContainer(m.DockerID); err != nil {
-			if !strings.Contains(err.Error(), "No such container") {
-				return fmt.Errorf("failed to DeleteContainer: %w", err)
-			}
+
+		s.l.Warn("container is not in provider. skip stopping in provider")
+	}
+
+	now := time.Now()
+	if err := s.dbrepo.SetDeleted(ctx, c.ID, &now); err != nil {
+		return fmt.Errorf("failed to SetDeleted: %w", err)
+	}
+
+	s.l.Info("moved container %s to the trash", c.ID)
+
+	return nil
+}
+
+// PurgeContainer removes a container including the trashed ones right away.
+// It is restricted to admins by the route.
+func (s *ContainerService) PurgeContainer(ctx context.Context, containerID string) error {
+	c, err := s.dbrepo.GetAnyByID(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to GetAnyByID: %w", err)
+	}
+
+	return s.purge(ctx, c)
+}
+
+// GetTrash returns the trashed containers of the requester, the oldest
+// deletion first. Admins see the trash of all users.
+func (s *ContainerService) GetTrash(ctx context.Context, req model.Requester) ([]model.Container, error) {
+	if req.IsAdmin() {
+		val, err := s.dbrepo.GetDeleted(ctx)
+
+		return HandleError[[]model.Container](val, err, "failed to GetDeleted")
+	}
+
+	val, err := s.dbrepo.GetDeletedByUserID(ctx, req.UserID)
+
+	return HandleError[[]model.Container](val, err, "failed to GetDeletedByUserID")
+}
+
+// IsTrashed reports whether a container of the requester is in the trash.
+func (s *ContainerService) IsTrashed(ctx context.Context, req model.Requester, containerID string) (bool, error) {
+	c, err := s.getTrashed(ctx, req, containerID)
+	if err != nil {
+		if errors.Is(err, errs.ErrDataNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return c != nil, nil
+}
+
+// Undelete takes a container out of the trash. It stays stopped and counts
+// against the quota of its owner again.
+func (s *ContainerService) Undelete(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+) (*model.Container, error) {
+	c, err := s.getTrashed(ctx, req, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if c == nil {
+		return nil, fmt.Errorf("%w: container is not in the trash", errs.ErrInvalidInput)
+	}
+
+	if err := s.quotas.CheckCreate(ctx, c.UserID, c.Limits); err != nil {
+		return nil, fmt.Errorf("failed to CheckCreate: %w", err)
+	}
+
+	if err := s.dbrepo.SetDeleted(ctx, c.ID, nil); err != nil {
+		return nil, fmt.Errorf("failed to SetDeleted: %w", err)
+	}
+
+	c.DeletedAt = nil
+	s.l.Info("restored container %s from the trash", c.ID)
+
+	return c, nil
+}
+
+// getTrashed reads a container of the requester regardless of the trash. It
+// returns nil if the container is not trashed.
+func (s *ContainerService) getTrashed(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+) (*model.Container, error) {
+	c, err := s.dbrepo.GetAnyByID(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetAnyByID: %w", err)
+	}
+
+	if !req.IsAdmin() && c.UserID != req.UserID {
+		return nil, fmt.Errorf("failed to GetAnyByID: %w", errs.ErrDataNotFound)
+	}
+
+	if c.DeletedAt == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	return c, nil
+}
+
+// purge removes the container from the provider, takes a last backup,
+// deletes the volume and releases the ports.
+func (s *ContainerService) purge(ctx context.Context, c *model.Container) error {
+	return s.remove(ctx, c, s.backups.enabled())
+}
+
+// remove deletes a container like purge, a last backup is only taken with
+// lastBackup.
+func (s *ContainerService) remove(ctx context.Context, c *model.Container, lastBackup bool) error {
+	statuses, err := s.provider.GetContainerStatuses(ctx, []string{c.DockerID})
+	if err != nil {
+		return fmt.Errorf("failed to provider GetContainerStatuses: %w", err)
+	}
+
+	if len(statuses) == 0 {
+		s.l.Warn("container is not in provider. skip deletion in provider")
+	} else if err := s.provider.DeleteContainer(ctx, c.DockerID); err != nil {
+		if !strings.Contains(err.Error(), "No such container") {
+			return fmt.Errorf("failed to DeleteContainer: %w", err)
 		}
 	}
 
 	// delete volumes directory
-	volumeDir := s.cfg.VolumesPath + "/" + m.ID
+	volumeDir := s.cfg.VolumesPath + "/" + c.ID
+
+	if lastBackup {
+		backup, err := s.backups.Save(c.UserID, c.ID, volumeDir)
+		if err != nil {
+			return fmt.Errorf("failed to back up volume: %w", err)
+		}
+
+		s.l.Info("stored last backup %s of container %s", backup.Name, c.ID)
+	}
+
 	if err := os.RemoveAll(volumeDir); err != nil {
 		s.l.Warn("Failed to remove volumes directory: %s", err.Error())
 
@@ -200,48 +1021,361 @@ func (s *ContainerService) DeleteContainer(containerID string) error {
 
 	s.l.Debug("Removed volumes directory: %s", volumeDir)
 
-	if err := s.dbrepo.ReleasePort(containerID); err != nil {
+	if err := os.RemoveAll(utils.GitCredentialsDir(s.cfg.VolumesPath, c.ID)); err != nil {
+		return fmt.Errorf("failed to delete git credentials: %w", err)
+	}
+
+	if err := s.dbrepo.ReleasePort(ctx, c.ID); err != nil {
 		return fmt.Errorf("failed to ReleasePort: %w", err)
 	}
 
-	s.l.Debug("Released UI port: %s", m.UIPort)
+	s.l.Debug("Released UI port: %s", c.UIPort)
+
+	published, err := s.dbrepo.GetPublishedPorts(ctx, c.ID)
+	if err != nil {
+		return fmt.Errorf("failed to GetPublishedPorts: %w", err)
+	}
+
+	for _, p := range published {
+		s.releaseHostPort(ctx, c.NodeID, p.HostPort)
+	}
 
-	if err := s.dbrepo.Delete(containerID); err != nil {
+	if err := s.dbrepo.DeletePublishedPorts(ctx, c.ID); err != nil {
+		return fmt.Errorf("failed to DeletePublishedPorts: %w", err)
+	}
+
+	if err := s.dbrepo.Delete(ctx, c.ID); err != nil {
 		return fmt.Errorf("failed to db Delete: %w", err)
 	}
 
 	return nil
 }
 
-func (s *ContainerService) BuildTemplate(templateID string, tag string, env map[string]*string) error {
-	t, err := s.templaterepo.GetByID(templateID)
+// OpenBackup returns an archive of the workspace volume. An empty name
+// packs the current volume, otherwise the stored backup is returned.
+func (s *ContainerService) OpenBackup(
+	ctx context.Context,
+	req model.Requester,
+	containerID, name string,
+) (io.ReadCloser, error) {
+	c, err := s.getOwned(ctx, req, containerID)
 	if err != nil {
-		return fmt.Errorf("failed to GetByID: %w", err)
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
 	}
 
-	env["ARCHITECTURE"] = &config.Architecture
+	if name != "" {
+		f, err := s.backups.Open(c.UserID, c.ID, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open backup: %w", err)
+		}
 
-	if err := s.dockerrepo.Build(*t, tag, env); err != nil {
-		return fmt.Errorf("failed to provider Build: %w", err)
+		return f, nil
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(archive.Write(pw, s.cfg.VolumesPath+"/"+c.ID))
+	}()
+
+	return pr, nil
+}
+
+// GetBackups returns the stored backups of a workspace, the newest first.
+func (s *ContainerService) GetBackups(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+) ([]model.Backup, error) {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	if !s.backups.enabled() {
+		return []model.Backup{}, nil
+	}
+
+	val, err := s.backups.List(c.UserID, c.ID)
+
+	return HandleError[[]model.Backup](val, err, "failed to List backups")
+}
+
+// GetUserBackups returns the stored backups of all workspaces of a user,
+// including deleted ones.
+func (s *ContainerService) GetUserBackups(userID string) ([]model.Backup, error) {
+	val, err := s.backups.ListUser(userID)
+
+	return HandleError[[]model.Backup](val, err, "failed to ListUser backups")
+}
+
+// RestoreBackup replaces the volume of a stopped workspace with a stored
+// backup of it or of another workspace of the same owner.
+func (s *ContainerService) RestoreBackup(
+	ctx context.Context,
+	req model.Requester,
+	containerID string,
+	restore model.RestoreRequest,
+) error {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	source := restore.SourceContainerID
+	if source == "" {
+		source = c.ID
+	}
+
+	f, err := s.backups.Open(c.UserID, source, restore.Backup)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	return s.restore(ctx, c, f)
+}
+
+// CreateRestored creates a workspace whose volume is filled with a stored
+// backup before its first start. The backup is of a workspace of the same
+// owner, usually a deleted one.
+func (s *ContainerService) CreateRestored(
+	ctx context.Context,
+	container *model.Container,
+	restore model.RestoreRequest,
+) (*model.Container, error) {
+	if restore.SourceContainerID == "" {
+		return nil, fmt.Errorf("%w: source_container_id is required", errs.ErrInvalidInput)
+	}
+
+	f, err := s.backups.Open(container.UserID, restore.SourceContainerID, restore.Backup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	c, err := s.Create(ctx, container)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.restore(ctx, c, f); err != nil {
+		if rerr := s.remove(context.WithoutCancel(ctx), c, false); rerr != nil {
+			s.l.Warn("failed to remove container %s of failed restore: %s", c.ID, rerr.Error())
+		}
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Restore replaces the volume of a stopped workspace with an uploaded archive.
+func (s *ContainerService) Restore(ctx context.Context, req model.Requester, containerID string, r io.Reader) error {
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	return s.restore(ctx, c, r)
+}
+
+// restore unpacks the archive next to the volume and swaps the directories,
+// so a broken archive leaves the volume untouched.
+func (s *ContainerService) restore(ctx context.Context, c *model.Container, r io.Reader) error {
+	statuses, err := s.provider.GetContainerStatuses(ctx, []string{c.DockerID})
+	if err != nil {
+		return fmt.Errorf("failed to provider GetContainerStatuses: %w", err)
+	}
+
+	if len(statuses) > 0 && statuses[0].State == runningState {
+		return fmt.Errorf("%w: stop the workspace before restoring", errs.ErrInvalidInput)
+	}
+
+	volumeDir := s.cfg.VolumesPath + "/" + c.ID
+	restoreDir := s.cfg.VolumesPath + "/.restore-" + c.ID
+	oldDir := s.cfg.VolumesPath + "/.old-" + c.ID
+
+	if err := os.RemoveAll(restoreDir); err != nil {
+		return fmt.Errorf("failed to clean up restore directory: %w", err)
+	}
+
+	if err := archive.Extract(r, restoreDir, s.cfg.MaxRestoreSize); err != nil {
+		s.removeRestoreDir(restoreDir)
+
+		if errors.Is(err, archive.ErrInvalidArchive) {
+			return fmt.Errorf("%w: %w", errs.ErrInvalidInput, err)
+		}
+
+		if errors.Is(err, archive.ErrTooLarge) {
+			return fmt.Errorf("%w: %w", errs.ErrTooLarge, err)
+		}
+
+		return fmt.Errorf("failed to extract archive: %w", err)
+	}
+
+	if err := os.Rename(volumeDir, oldDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.removeRestoreDir(restoreDir)
+
+		return fmt.Errorf("failed to move volume: %w", err)
+	}
+
+	if err := os.Rename(restoreDir, volumeDir); err != nil {
+		// put the old volume back, the workspace must not lose its data
+		if rerr := os.Rename(oldDir, volumeDir); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+			s.l.Error("failed to move back volume of container "+c.ID+" from "+oldDir, rerr)
+		}
+
+		s.removeRestoreDir(restoreDir)
+
+		return fmt.Errorf("failed to move restored volume: %w", err)
+	}
+
+	if err := os.RemoveAll(oldDir); err != nil {
+		s.l.Warn("failed to remove replaced volume: %s", err.Error())
+	}
+
+	s.l.Info("restored volume of container %s", c.ID)
+
+	return nil
+}
+
+// removeRestoreDir cleans up after a failed restore.
+func (s *ContainerService) removeRestoreDir(restoreDir string) {
+	if err := os.RemoveAll(restoreDir); err != nil {
+		s.l.Warn("failed to remove restore directory: %s", err.Error())
+	}
+}
+
+// DeleteAllByUserID removes every container of a user including the trashed
+// ones, their volumes and port allocations, the snapshots and the backups of
+// the user. No last backups are taken.
+func (s *ContainerService) DeleteAllByUserID(ctx context.Context, userID string) error {
+	containers, err := s.dbrepo.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to GetAllByUserID: %w", err)
+	}
+
+	trashed, err := s.dbrepo.GetDeletedByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to GetDeletedByUserID: %w", err)
+	}
+
+	for _, c := range append(containers, trashed...) {
+		if err := s.remove(ctx, &c, false); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", c.ID, err)
+		}
+	}
+
+	images, err := s.provider.GetImages(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to GetImages: %w", err)
+	}
+
+	for _, img := range images {
+		if img.Owner != userID {
+			continue
+		}
+
+		if err := s.provider.RemoveImage(ctx, img.RepoName+":"+img.Tag); err != nil {
+			return fmt.Errorf("failed to provider RemoveImage: %w", err)
+		}
+	}
+
+	if err := s.backups.RemoveUser(userID); err != nil {
+		return fmt.Errorf("failed to RemoveUser backups: %w", err)
 	}
 
 	return nil
 }
 
-func (s *ContainerService) GetImages() ([]model.Image, error) {
-	val, err := s.dockerrepo.GetImages()
+// GetImages returns the template images and the snapshots of the requester.
+// Admins see the snapshots of all users.
+func (s *ContainerService) GetImages(ctx context.Context, req model.Requester) ([]model.Image, error) {
+	images, err := s.provider.GetImages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetImages: %w", err)
+	}
+
+	if req.IsAdmin() {
+		return images, nil
+	}
+
+	visible := []model.Image{}
+
+	for _, img := range images {
+		if img.Owner == "" || img.Owner == req.UserID {
+			visible = append(visible, img)
+		}
+	}
+
+	return visible, nil
+}
+
+// Snapshot commits the file system of a workspace into an image owned by the
+// requester. New workspaces can be created from it, the volume is not part of
+// the snapshot.
+func (s *ContainerService) Snapshot(ctx context.Context, req model.Requester, containerID string, snapshot model.SnapshotRequest) (*model.Image, error) { //nolint:lll
+	c, err := s.getOwned(ctx, req, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to getOwned: %w", err)
+	}
+
+	if snapshot.Tag == "" {
+		snapshot.Tag = "latest"
+	}
+
+	if !snapshotNamePattern.MatchString(snapshot.Name) || !snapshotTagPattern.MatchString(snapshot.Tag) {
+		return nil, fmt.Errorf("%w: snapshot name must be lowercase letters, digits, '.', '_' or '-' "+
+			"and the tag letters, digits, '.', '_' or '-'", errs.ErrInvalidInput)
+	}
+
+	img, err := s.provider.CommitContainer(ctx, c.DockerID, model.Snapshot{
+		ImageName:         snapshotImageName(req.UserID, snapshot.Name, snapshot.Tag),
+		Owner:             req.UserID,
+		SourceContainerID: c.ID,
+		SourceImage:       c.ImageName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to provider CommitContainer: %w", err)
+	}
+
+	s.l.Info("created snapshot %s:%s of container %s", img.RepoName, img.Tag, c.ID)
+
+	return &img, nil
+}
+
+// snapshotImageName returns the image a snapshot of a user is stored as.
+// Image names have to be lowercase.
+func snapshotImageName(userID, name, tag string) string {
+	return "cd-" + strings.ToLower(userID) + "-" + name + ":" + tag
+}
+
+// checkImageAccess returns the image and rejects snapshots of other users.
+// Template images are available to everyone.
+func (s *ContainerService) checkImageAccess(ctx context.Context, userID, imageName string) (model.Image, error) {
+	img, err := s.provider.GetImage(ctx, imageName)
+	if err != nil {
+		return img, fmt.Errorf("failed to provider GetImage: %w", err)
+	}
+
+	if img.Owner != "" && img.Owner != userID {
+		return img, fmt.Errorf("%w: image %s", errs.ErrDataNotFound, imageName)
+	}
 
-	return HandleError[[]model.Image](val, err, "failed to GetImages")
+	return img, nil
 }
 
-func (s *ContainerService) GetPortCount() (int, error) {
-	val, err := s.dbrepo.GetPortCount()
+// GetPortCount returns the size of the port pool of the local node.
+func (s *ContainerService) GetPortCount(ctx context.Context) (int, error) {
+	val, err := s.dbrepo.GetPortCount(ctx, model.LocalNodeID)
 
 	return HandleError[int](val, err, "failed to GetPortCount")
 }
 
-func (s *ContainerService) FillPorts(minPort, maxPort int) error {
-	if err := s.dbrepo.FillPorts(minPort, maxPort); err != nil {
+// FillPorts creates the port pool of the local node.
+func (s *ContainerService) FillPorts(ctx context.Context, minPort, maxPort int) error {
+	if err := s.dbrepo.FillPorts(ctx, model.LocalNodeID, minPort, maxPort); err != nil {
 		return fmt.Errorf("failed to db FillPorts: %w", err)
 	}
 
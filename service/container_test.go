@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+// fakeImageProvider serves images by name. The other methods are not used
+// by the tests and panic.
+type fakeImageProvider struct {
+	containerProvider
+
+	images map[string]model.Image
+}
+
+func (p *fakeImageProvider) GetImage(_ context.Context, imageName string) (model.Image, error) {
+	img, ok := p.images[imageName]
+	if !ok {
+		return img, errs.ErrDataNotFound
+	}
+
+	return img, nil
+}
+
+func TestSnapshotImageName(t *testing.T) {
+	got := snapshotImageName("01JZ3F8Q7V5X2N4M6K8P0R2T4W", "my-app", "v1")
+	if got != "cd-01jz3f8q7v5x2n4m6k8p0r2t4w-my-app:v1" {
+		t.Errorf("snapshotImageName = %q", got)
+	}
+}
+
+func TestSnapshotNames(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want bool
+	}{
+		{name: "my-app", tag: "latest", want: true},
+		{name: "app.v2_x", tag: "V1.0-rc_1", want: true},
+		{name: "My-App", tag: "latest", want: false},
+		{name: "-app", tag: "latest", want: false},
+		{name: "app/other", tag: "latest", want: false},
+		{name: "app:v1", tag: "latest", want: false},
+		{name: "", tag: "latest", want: false},
+		{name: "app", tag: ".hidden", want: false},
+		{name: "app", tag: "v1:v2", want: false},
+		{name: "app", tag: "", want: false},
+	}
+
+	for _, tt := range tests {
+		got := snapshotNamePattern.MatchString(tt.name) && snapshotTagPattern.MatchString(tt.tag)
+		if got != tt.want {
+			t.Errorf("snapshot %q:%q valid = %v, want %v", tt.name, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestCheckImageAccess(t *testing.T) {
+	s := &ContainerService{provider: &fakeImageProvider{images: map[string]model.Image{ //nolint:exhaustruct
+		"cd-go:v1":        {RepoName: "cd-go", Tag: "v1"},                        //nolint:exhaustruct
+		"cd-alice-app:v1": {RepoName: "cd-alice-app", Tag: "v1", Owner: "alice"}, //nolint:exhaustruct
+	}}}
+
+	tests := []struct {
+		userID    string
+		imageName string
+		wantErr   bool
+	}{
+		{userID: "alice", imageName: "cd-go:v1"},
+		{userID: "bob", imageName: "cd-go:v1"},
+		{userID: "alice", imageName: "cd-alice-app:v1"},
+		{userID: "bob", imageName: "cd-alice-app:v1", wantErr: true},
+		{userID: "alice", imageName: "cd-missing:v1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := s.checkImageAccess(context.Background(), tt.userID, tt.imageName)
+		if tt.wantErr != (err != nil) || (err != nil && !errors.Is(err, errs.ErrDataNotFound)) {
+			t.Errorf("checkImageAccess(%s, %s) = %v, want error %v", tt.userID, tt.imageName, err, tt.wantErr)
+		}
+	}
+}
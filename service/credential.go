@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/crypto"
+	"github.com/kaibling/cerodev/pkg/utils"
+)
+
+const (
+	gitCredentialsFile = "git-credentials"
+	sshConfigFile      = "ssh_config"
+	defaultGitUsername = "git"
+	// workspaceUID owns the files mounted into a workspace, it is the coder
+	// user of the code-server images.
+	workspaceUID = 1000
+)
+
+var gitHostPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?(:[0-9]{1,5})?$`) //nolint:gochecknoglobals
+
+type credentialrepo interface {
+	GetByUserID(ctx context.Context, userID string) ([]model.GitCredential, error)
+	Save(ctx context.Context, credential *model.GitCredential) (*model.GitCredential, error)
+	Delete(ctx context.Context, id, userID string) error
+}
+
+// CredentialService stores the git credentials of users encrypted with the
+// master key and hands them to workspaces as mounted files.
+type CredentialService struct {
+	repo credentialrepo
+	cfg  config.Configuration
+}
+
+func NewCredentialService(repo credentialrepo, cfg config.Configuration) *CredentialService {
+	return &CredentialService{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+// GetAll returns the credentials of a user without their secrets.
+func (s *CredentialService) GetAll(ctx context.Context, userID string) ([]model.GitCredential, error) {
+	credentials, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetByUserID: %w", err)
+	}
+
+	for i := range credentials {
+		credentials[i].Secret = ""
+	}
+
+	return credentials, nil
+}
+
+// Save encrypts and stores a credential. It replaces the credential of the
+// same kind for the host.
+func (s *CredentialService) Save(
+	ctx context.Context,
+	userID string,
+	credential model.GitCredential,
+) (*model.GitCredential, error) {
+	credential.UserID = userID
+	credential.Host = strings.ToLower(strings.TrimSpace(credential.Host))
+
+	if err := s.validate(&credential); err != nil {
+		return nil, err
+	}
+
+	secret, err := crypto.Encrypt(s.cfg.MasterKey, []byte(credential.Secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	credential.ID = utils.GenerateULID()
+	credential.Secret = secret
+	credential.CreatedAt = time.Now()
+
+	saved, err := s.repo.Save(ctx, &credential)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Save: %w", err)
+	}
+
+	saved.Secret = ""
+
+	return saved, nil
+}
+
+func (s *CredentialService) Delete(ctx context.Context, userID, id string) error {
+	if err := s.repo.Delete(ctx, id, userID); err != nil {
+		return fmt.Errorf("failed to Delete: %w", err)
+	}
+
+	return nil
+}
+
+func (s *CredentialService) validate(credential *model.GitCredential) error {
+	if s.cfg.MasterKey == "" {
+		return fmt.Errorf("%w: git credentials require CD_MASTER_KEY to be set", errs.ErrInvalidInput)
+	}
+
+	if !credential.Kind.Valid() {
+		return fmt.Errorf("%w: kind must be https or ssh", errs.ErrInvalidInput)
+	}
+
+	if !gitHostPattern.MatchString(credential.Host) {
+		return fmt.Errorf("%w: invalid host %q", errs.ErrInvalidInput, credential.Host)
+	}
+
+	switch credential.Kind {
+	case model.GitCredentialHTTPS:
+		if credential.Username == "" {
+			credential.Username = defaultGitUsername
+		}
+
+		if credential.Secret == "" || strings.ContainsAny(credential.Secret+credential.Username, " \t\r\n") {
+			return fmt.Errorf("%w: token and username must not be empty or contain whitespace", errs.ErrInvalidInput)
+		}
+	case model.GitCredentialSSH:
+		credential.Username = ""
+
+		if !strings.Contains(credential.Secret, "PRIVATE KEY-----") {
+			return fmt.Errorf("%w: secret must be a PEM or OpenSSH private key", errs.ErrInvalidInput)
+		}
+
+		// ssh rejects keys without a final newline
+		credential.Secret = strings.TrimSpace(credential.Secret) + "\n"
+	}
+
+	return nil
+}
+
+// WriteGitFiles writes the credentials of a user into dir, which is mounted
+// into the workspace at utils.GitCredentialsMount. Https tokens end up in a
+// git credential store, ssh keys in key files referenced by an ssh config.
+// Existing files are replaced, so changed credentials apply on restart.
+func (s *CredentialService) WriteGitFiles(ctx context.Context, userID, dir string) error {
+	credentials, err := s.repo.GetByUserID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to GetByUserID: %w", err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clean up git credentials: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil { //nolint:mnd
+		return fmt.Errorf("failed to create git credentials directory: %w", err)
+	}
+
+	var store, sshConfig strings.Builder
+
+	files := map[string]string{}
+
+	for _, credential := range credentials {
+		secret, err := crypto.Decrypt(s.cfg.MasterKey, credential.Secret)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt git credential %s: %w", credential.ID, err)
+		}
+
+		switch credential.Kind {
+		case model.GitCredentialHTTPS:
+			u := url.URL{ //nolint:exhaustruct
+				Scheme: "https",
+				User:   url.UserPassword(credential.Username, string(secret)),
+				Host:   credential.Host,
+			}
+			store.WriteString(u.String() + "\n")
+		case model.GitCredentialSSH:
+			keyFile := "id_" + strings.ToLower(credential.ID)
+			files[keyFile] = string(secret)
+			sshConfig.WriteString(sshHostConfig(credential.Host, utils.GitCredentialsMount+"/"+keyFile))
+		}
+	}
+
+	files[gitCredentialsFile] = store.String()
+	files[sshConfigFile] = sshConfig.String()
+
+	for name, content := range files {
+		if err := writeOwnedFile(filepath.Join(dir, name), content); err != nil {
+			return err
+		}
+	}
+
+	return chownWorkspace(dir)
+}
+
+// sshHostConfig selects the key for a host. The port of the host is kept
+// separate, ssh matches the host name only.
+func sshHostConfig(host, keyFile string) string {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, ""
+	}
+
+	config := "Host " + name + "\n  IdentityFile " + keyFile + "\n  IdentitiesOnly yes\n"
+	if port != "" {
+		config += "  Port " + port + "\n"
+	}
+
+	return config
+}
+
+func writeOwnedFile(path, content string) error {
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil { //nolint:mnd
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+
+	return chownWorkspace(path)
+}
+
+// chownWorkspace hands a file to the workspace user. Without the permission
+// to do so, e.g. when running rootless, the file is left as is.
+func chownWorkspace(path string) error {
+	if err := os.Lchown(path, workspaceUID, workspaceUID); err != nil && !errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("failed to chown %s: %w", filepath.Base(path), err)
+	}
+
+	return nil
+}
+
+// gitEnv points git inside the workspace at the mounted credentials. Only
+// paths are passed, the secrets stay in the mounted files.
+func gitEnv(c *model.Container) []string {
+	return []string{
+		"GIT_REPO=" + c.GitRepo,
+		"GIT_REF=" + c.GitRef,
+		"GIT_DEPTH=" + strconv.Itoa(c.GitDepth),
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=credential.helper",
+		"GIT_CONFIG_VALUE_0=store --file=" + utils.GitCredentialsMount + "/" + gitCredentialsFile,
+		"GIT_SSH_COMMAND=ssh -F " + utils.GitCredentialsMount + "/" + sshConfigFile + " -o StrictHostKeyChecking=accept-new",
+	}
+}
@@ -0,0 +1,356 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+const (
+	idleWarningMessageType = "container_idle_warning"
+	idleStoppedMessageType = "container_idle_stopped"
+	// idleCheckInterval is the pause between two idle checks.
+	idleCheckInterval = time.Minute
+)
+
+type idleDBRepo interface {
+	GetAll(ctx context.Context) ([]model.Container, error)
+	SetLastActivity(ctx context.Context, id string, lastActivityAt time.Time) error
+}
+
+type idleProvider interface {
+	GetContainerStatuses(ctx context.Context, containerID []string) ([]model.ContainerStatus, error)
+	StopContainer(ctx context.Context, containerID string) error
+}
+
+type idleUserRepo interface {
+	GetByID(ctx context.Context, id string) (*model.User, error)
+}
+
+type idleNotifier interface {
+	SendJSONToUser(data any, userID string) error
+}
+
+// IdleService tracks the last activity of every workspace and stops running
+// workspaces that were idle longer than their timeout. Proxy requests, attached
+// exec sessions and followed log streams count as activity.
+// It is created once at startup.
+type IdleService struct {
+	dbrepo       idleDBRepo
+	provider     idleProvider
+	userrepo     idleUserRepo
+	templaterepo templaterepo
+	notifier     idleNotifier
+	l            log.Writer
+	cfg          config.Configuration
+
+	mu       sync.Mutex
+	activity map[string]time.Time // container id -> last activity
+	sessions map[string]int       // container id -> attached exec sessions
+	warned   map[string]time.Time // container id -> time of the stop warning
+	running  map[string]bool      // containers running during the previous check
+	stored   map[string]time.Time // activity written to the db
+}
+
+func NewIdleService(
+	dbrepo idleDBRepo,
+	provider idleProvider,
+	userrepo idleUserRepo,
+	templaterepo templaterepo,
+	notifier idleNotifier,
+	l log.Writer,
+	cfg config.Configuration,
+) *IdleService {
+	return &IdleService{ //nolint:exhaustruct
+		dbrepo:       dbrepo,
+		provider:     provider,
+		userrepo:     userrepo,
+		templaterepo: templaterepo,
+		notifier:     notifier,
+		l:            l.Named("idle_service"),
+		cfg:          cfg,
+		activity:     map[string]time.Time{},
+		sessions:     map[string]int{},
+		warned:       map[string]time.Time{},
+		running:      map[string]bool{},
+		stored:       map[string]time.Time{},
+	}
+}
+
+// Touch records activity of a workspace.
+func (s *IdleService) Touch(containerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.activity[containerID] = time.Now()
+}
+
+// Attach marks a workspace as active until the returned function is called.
+func (s *IdleService) Attach(containerID string) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[containerID]++
+	s.activity[containerID] = time.Now()
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.sessions[containerID]--
+		if s.sessions[containerID] <= 0 {
+			delete(s.sessions, containerID)
+		}
+
+		s.activity[containerID] = time.Now()
+	}
+}
+
+// Start checks the workspaces every minute until ctx ends.
+func (s *IdleService) Start(ctx context.Context) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Check(ctx); err != nil {
+				s.l.Warn("idle check failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+// Check warns the owners of workspaces that are about to be stopped and stops
+// those whose warning period is over. Workspaces that were just started count
+// as active.
+func (s *IdleService) Check(ctx context.Context) error {
+	containers, err := s.dbrepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to db GetAll: %w", err)
+	}
+
+	dockerIDs := make([]string, len(containers))
+	for i, c := range containers {
+		dockerIDs[i] = c.DockerID
+	}
+
+	statuses, err := s.provider.GetContainerStatuses(ctx, dockerIDs)
+	if err != nil {
+		return fmt.Errorf("failed to provider GetContainerStatuses: %w", err)
+	}
+
+	running := map[string]bool{}
+	for _, status := range statuses {
+		if status.State == runningState {
+			running[status.DockerID] = true
+		}
+	}
+
+	timeouts := s.timeouts(ctx, containers)
+	now := time.Now()
+
+	for _, c := range containers {
+		if !running[c.DockerID] {
+			s.forget(c.ID)
+
+			continue
+		}
+
+		lastActivity := s.lastActivity(c, now)
+		s.persist(ctx, c.ID, lastActivity)
+
+		timeout := timeouts[c.ID]
+		if timeout <= 0 {
+			continue
+		}
+
+		s.checkContainer(ctx, c, timeout, lastActivity, now)
+	}
+
+	s.prune(containers)
+
+	return nil
+}
+
+// lastActivity returns the last activity of a running container. Containers
+// that were not running in the previous check and containers with an attached
+// session count as active now.
+func (s *IdleService) lastActivity(c model.Container, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running[c.ID] || s.sessions[c.ID] > 0 {
+		s.activity[c.ID] = now
+	}
+
+	s.running[c.ID] = true
+
+	return s.activity[c.ID]
+}
+
+func (s *IdleService) checkContainer(
+	ctx context.Context,
+	c model.Container,
+	timeout time.Duration,
+	lastActivity, now time.Time,
+) {
+	warning := min(s.cfg.IdleWarning, timeout)
+	idle := now.Sub(lastActivity)
+
+	s.mu.Lock()
+	warnedAt, warned := s.warned[c.ID]
+	s.mu.Unlock()
+
+	if idle < timeout-warning {
+		if warned {
+			s.mu.Lock()
+			delete(s.warned, c.ID)
+			s.mu.Unlock()
+		}
+
+		return
+	}
+
+	// the owner always gets the full warning period, even if the check was late
+	if !warned {
+		s.mu.Lock()
+		s.warned[c.ID] = now
+		s.mu.Unlock()
+
+		s.notify(c, idleWarningMessageType, fmt.Sprintf(
+			"workspace %s is idle and will be stopped in %s", c.ContainerName, warning.Round(time.Second)))
+
+		return
+	}
+
+	if idle < timeout || now.Sub(warnedAt) < warning {
+		return
+	}
+
+	if err := s.provider.StopContainer(ctx, c.DockerID); err != nil {
+		s.l.Warn("failed to stop idle container %s: %s", c.ID, err.Error())
+
+		return
+	}
+
+	s.l.Info("stopped container %s after %s without activity", c.ID, idle.Round(time.Second))
+	s.forget(c.ID)
+	s.notify(c, idleStoppedMessageType, fmt.Sprintf(
+		"workspace %s was stopped after %s without activity", c.ContainerName, idle.Round(time.Second)))
+}
+
+// timeouts resolves the idle timeout of every container. The setting of the
+// owner wins over the one of the template the image was built from, which
+// wins over the global default.
+func (s *IdleService) timeouts(ctx context.Context, containers []model.Container) map[string]time.Duration {
+	templates, err := s.templaterepo.GetAll(ctx)
+	if err != nil {
+		s.l.Warn("failed to read templates: %s", err.Error())
+	}
+
+	users := map[string]*model.User{}
+	timeouts := map[string]time.Duration{}
+
+	for _, c := range containers {
+		user, ok := users[c.UserID]
+		if !ok {
+			if user, err = s.userrepo.GetByID(ctx, c.UserID); err != nil {
+				s.l.Warn("failed to read owner of %s: %s", c.ID, err.Error())
+			}
+
+			users[c.UserID] = user
+		}
+
+		timeout := s.cfg.IdleTimeout
+
+		for _, t := range templates {
+			if t.IdleTimeout != nil && t.BuiltImage(c.ImageName) {
+				timeout = time.Duration(*t.IdleTimeout) * time.Second
+			}
+		}
+
+		if user != nil && user.IdleTimeout != nil {
+			timeout = time.Duration(*user.IdleTimeout) * time.Second
+		}
+
+		timeouts[c.ID] = timeout
+	}
+
+	return timeouts
+}
+
+// persist writes the activity to the db when it changed.
+func (s *IdleService) persist(ctx context.Context, containerID string, lastActivity time.Time) {
+	s.mu.Lock()
+	stored := s.stored[containerID]
+	s.mu.Unlock()
+
+	if stored.Equal(lastActivity) {
+		return
+	}
+
+	if err := s.dbrepo.SetLastActivity(ctx, containerID, lastActivity); err != nil {
+		s.l.Warn("failed to store activity of %s: %s", containerID, err.Error())
+
+		return
+	}
+
+	s.mu.Lock()
+	s.stored[containerID] = lastActivity
+	s.mu.Unlock()
+}
+
+// forget resets the state of a container that is not running.
+func (s *IdleService) forget(containerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.running, containerID)
+	delete(s.warned, containerID)
+}
+
+// validateIdleTimeout rejects negative timeouts. nil inherits the timeout.
+func validateIdleTimeout(timeout *int) error {
+	if timeout != nil && *timeout < 0 {
+		return fmt.Errorf("%w: idle timeout must not be negative", errs.ErrInvalidInput)
+	}
+
+	return nil
+}
+
+// prune drops the state of deleted containers.
+func (s *IdleService) prune(containers []model.Container) {
+	exists := map[string]bool{}
+	for _, c := range containers {
+		exists[c.ID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.activity {
+		if !exists[id] && s.sessions[id] == 0 {
+			delete(s.activity, id)
+			delete(s.stored, id)
+		}
+	}
+}
+
+func (s *IdleService) notify(c model.Container, messageType, message string) {
+	// the owner may not be connected, the container is handled anyway
+	_ = s.notifier.SendJSONToUser(model.WebSocketMessage{ //nolint:exhaustruct
+		Timestamp:   time.Now().Format(time.RFC3339),
+		MessageType: messageType,
+		Message:     message,
+		ReferenceID: c.ID,
+	}, c.UserID)
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/model"
+)
+
+// janitorInterval is the pause between two janitor runs.
+const janitorInterval = 10 * time.Minute
+
+type janitorDBRepo interface {
+	GetDeleted(ctx context.Context) ([]model.Container, error)
+}
+
+type containerPurger interface {
+	PurgeContainer(ctx context.Context, containerID string) error
+}
+
+// JanitorService purges trashed workspaces once their trash period is over.
+// It is created once at startup.
+type JanitorService struct {
+	dbrepo janitorDBRepo
+	purger containerPurger
+	l      log.Writer
+	cfg    config.Configuration
+}
+
+func NewJanitorService(
+	dbrepo janitorDBRepo,
+	purger containerPurger,
+	l log.Writer,
+	cfg config.Configuration,
+) *JanitorService {
+	return &JanitorService{
+		dbrepo: dbrepo,
+		purger: purger,
+		l:      l.Named("janitor_service"),
+		cfg:    cfg,
+	}
+}
+
+// Start purges the trash every ten minutes until ctx ends. Without a trash
+// period nothing is ever trashed and the janitor is disabled.
+func (s *JanitorService) Start(ctx context.Context) {
+	if s.cfg.TrashPeriod <= 0 {
+		s.l.Info("trash is disabled")
+
+		return
+	}
+
+	ticker := time.NewTicker(janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Run(ctx); err != nil {
+			s.l.Warn("janitor run failed: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run purges all workspaces that were deleted longer than the trash period
+// ago. Failures of single workspaces are logged.
+func (s *JanitorService) Run(ctx context.Context) error {
+	containers, err := s.dbrepo.GetDeleted(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to db GetDeleted: %w", err)
+	}
+
+	deadline := time.Now().Add(-s.cfg.TrashPeriod)
+
+	for _, c := range containers {
+		// the trash is ordered by deletion time
+		if c.DeletedAt == nil || c.DeletedAt.After(deadline) {
+			break
+		}
+
+		if err := s.purger.PurgeContainer(ctx, c.ID); err != nil {
+			s.l.Warn("failed to purge container %s: %s", c.ID, err.Error())
+
+			continue
+		}
+
+		s.l.Info("purged container %s deleted at %s", c.ID, c.DeletedAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+// validateLimits rejects negative limits, limits above the configured
+// maximums and a swap limit without a memory limit below it.
+func validateLimits(limits model.ResourceLimits, cfg config.Configuration) error {
+	if limits.CPUQuota < 0 || limits.Memory < 0 || limits.PidsLimit < 0 || limits.MemorySwap < -1 {
+		return fmt.Errorf("%w: limits must not be negative", errs.ErrInvalidInput)
+	}
+
+	for _, check := range []struct {
+		name       string
+		value, max int64
+	}{
+		{"cpu_quota", limits.CPUQuota, cfg.MaxCPUQuota},
+		{"memory", limits.Memory, cfg.MaxMemory},
+		{"memory_swap", limits.MemorySwap, cfg.MaxMemorySwap},
+		{"pids_limit", limits.PidsLimit, cfg.MaxPids},
+	} {
+		if check.max > 0 && (check.value > check.max || check.value == -1) {
+			return fmt.Errorf("%w: %s must not exceed %d", errs.ErrInvalidInput, check.name, check.max)
+		}
+	}
+
+	if limits.MemorySwap > 0 && (limits.Memory == 0 || limits.MemorySwap < limits.Memory) {
+		return fmt.Errorf("%w: memory_swap must not be below memory", errs.ErrInvalidInput)
+	}
+
+	if limits.MemorySwap == -1 && limits.Memory == 0 {
+		return fmt.Errorf("%w: memory_swap needs a memory limit", errs.ErrInvalidInput)
+	}
+
+	return nil
+}
+
+// resolveLimits applies the template defaults and the configured maximums to
+// the limits requested for a container and validates the result.
+func resolveLimits(
+	limits model.ResourceLimits,
+	defaults model.ResourceLimits,
+	cfg config.Configuration,
+) (model.ResourceLimits, error) {
+	limits = limits.WithDefaults(defaults).WithDefaults(model.ResourceLimits{
+		CPUQuota:   cfg.MaxCPUQuota,
+		Memory:     cfg.MaxMemory,
+		MemorySwap: 0,
+		PidsLimit:  cfg.MaxPids,
+	})
+
+	// docker rejects a swap limit without a memory limit
+	if limits.Memory > 0 {
+		limits = limits.WithDefaults(model.ResourceLimits{MemorySwap: cfg.MaxMemorySwap}) //nolint:exhaustruct
+	}
+
+	if err := validateLimits(limits, cfg); err != nil {
+		return limits, err
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+func TestResolveLimits(t *testing.T) {
+	limited := config.Configuration{ //nolint:exhaustruct
+		MaxCPUQuota:   400000,
+		MaxMemory:     8 * gib,
+		MaxMemorySwap: 16 * gib,
+		MaxPids:       1000,
+	}
+	unlimited := config.Configuration{} //nolint:exhaustruct
+
+	tests := []struct {
+		name     string
+		cfg      config.Configuration
+		limits   model.ResourceLimits
+		defaults model.ResourceLimits
+		want     model.ResourceLimits
+		wantErr  bool
+	}{
+		{
+			name: "maximums without request and template",
+			cfg:  limited,
+			want: model.ResourceLimits{CPUQuota: 400000, Memory: 8 * gib, MemorySwap: 16 * gib, PidsLimit: 1000},
+		},
+		{
+			name:     "template defaults",
+			cfg:      limited,
+			defaults: model.ResourceLimits{CPUQuota: 100000, Memory: 2 * gib}, //nolint:exhaustruct
+			want:     model.ResourceLimits{CPUQuota: 100000, Memory: 2 * gib, MemorySwap: 16 * gib, PidsLimit: 1000},
+		},
+		{
+			name:     "request before template",
+			cfg:      limited,
+			limits:   model.ResourceLimits{CPUQuota: 200000, MemorySwap: 4 * gib}, //nolint:exhaustruct
+			defaults: model.ResourceLimits{CPUQuota: 100000, Memory: 2 * gib},     //nolint:exhaustruct
+			want:     model.ResourceLimits{CPUQuota: 200000, Memory: 2 * gib, MemorySwap: 4 * gib, PidsLimit: 1000},
+		},
+		{
+			name:    "request above the maximum",
+			cfg:     limited,
+			limits:  model.ResourceLimits{Memory: 8*gib + 1}, //nolint:exhaustruct
+			wantErr: true,
+		},
+		{
+			name:    "unlimited swap above the maximum",
+			cfg:     limited,
+			limits:  model.ResourceLimits{MemorySwap: -1}, //nolint:exhaustruct
+			wantErr: true,
+		},
+		{
+			name:    "swap below memory",
+			cfg:     limited,
+			limits:  model.ResourceLimits{Memory: 4 * gib, MemorySwap: 2 * gib}, //nolint:exhaustruct
+			wantErr: true,
+		},
+		{
+			name: "unlimited without maximums",
+			cfg:  unlimited,
+			want: model.ResourceLimits{}, //nolint:exhaustruct
+		},
+		{
+			name:   "unlimited swap with memory",
+			cfg:    unlimited,
+			limits: model.ResourceLimits{Memory: gib, MemorySwap: -1}, //nolint:exhaustruct
+			want:   model.ResourceLimits{Memory: gib, MemorySwap: -1}, //nolint:exhaustruct
+		},
+		{
+			name:    "swap without memory",
+			cfg:     unlimited,
+			limits:  model.ResourceLimits{MemorySwap: 2 * gib}, //nolint:exhaustruct
+			wantErr: true,
+		},
+		{
+			name:    "negative limit",
+			cfg:     unlimited,
+			limits:  model.ResourceLimits{PidsLimit: -1}, //nolint:exhaustruct
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveLimits(tt.limits, tt.defaults, tt.cfg)
+			if tt.wantErr {
+				if !errors.Is(err, errs.ErrInvalidInput) {
+					t.Errorf("resolveLimits error = %v, want ErrInvalidInput", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("resolveLimits: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("resolveLimits = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
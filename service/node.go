@@ -0,0 +1,477 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/crypto"
+	"github.com/kaibling/cerodev/pkg/utils"
+)
+
+// cpuPeriod is the cfs period a cpu quota refers to, one cpu is a quota of
+// one period.
+const cpuPeriod = 100000
+
+var nodeNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{0,62}$`) //nolint:gochecknoglobals
+
+type noderepo interface {
+	GetAll(ctx context.Context) ([]model.Node, error)
+	GetByID(ctx context.Context, id string) (*model.Node, error)
+	Create(ctx context.Context, node *model.Node) (*model.Node, error)
+	Update(ctx context.Context, node *model.Node) (*model.Node, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type nodeContainerRepo interface {
+	FillPorts(ctx context.Context, nodeID string, minPort, maxPort int) error
+	ResizePorts(ctx context.Context, nodeID string, minPort, maxPort int) error
+	DeletePorts(ctx context.Context, nodeID string) error
+	GetFreePortCounts(ctx context.Context) (map[string]int, error)
+	GetNodeReservations(ctx context.Context) (map[string]model.NodeReservation, error)
+	CountByNode(ctx context.Context, nodeID string) (int, error)
+}
+
+type nodeEngines interface {
+	NodeResources(ctx context.Context, nodeID string) (model.NodeResources, error)
+	Connect(node model.Node) error
+	Disconnect(nodeID string)
+}
+
+// NodeService manages the docker daemons workspaces run on and places new
+// workspaces. The local node is the engine configured with CD_PROVIDER,
+// further docker daemons are registered by admins.
+type NodeService struct {
+	repo       noderepo
+	containers nodeContainerRepo
+	engines    nodeEngines
+	l          log.Writer
+	cfg        config.Configuration
+}
+
+func NewNodeService(
+	repo noderepo,
+	containers nodeContainerRepo,
+	engines nodeEngines,
+	l log.Writer,
+	cfg config.Configuration,
+) *NodeService {
+	return &NodeService{
+		repo:       repo,
+		containers: containers,
+		engines:    engines,
+		l:          l.Named("node_service"),
+		cfg:        cfg,
+	}
+}
+
+// ConnectAll connects to the registered nodes at startup. Nodes that cannot
+// be connected are reported unreachable.
+func (s *NodeService) ConnectAll(ctx context.Context) error {
+	nodes, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to GetAll nodes: %w", err)
+	}
+
+	for _, node := range nodes {
+		key, err := crypto.Decrypt(s.cfg.MasterKey, node.ClientKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt client key of node %s: %w", node.Name, err)
+		}
+
+		node.ClientKey = string(key)
+		s.connect(node)
+	}
+
+	return nil
+}
+
+// GetAll returns the local and the registered nodes with their capacity.
+func (s *NodeService) GetAll(ctx context.Context) ([]model.NodeStatus, error) {
+	nodes, err := s.nodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.statuses(ctx, nodes)
+}
+
+func (s *NodeService) GetByID(ctx context.Context, id string) (*model.NodeStatus, error) {
+	node, err := s.node(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := s.statuses(ctx, []model.Node{*node})
+	if err != nil {
+		return nil, err
+	}
+
+	return &statuses[0], nil
+}
+
+// Create registers a docker daemon and fills its port pool. The port range
+// defaults to the one of the local node.
+func (s *NodeService) Create(ctx context.Context, node model.Node) (*model.Node, error) {
+	if s.cfg.Provider != config.ProviderDocker {
+		return nil, fmt.Errorf("%w: nodes can only be registered with the docker provider", errs.ErrInvalidInput)
+	}
+
+	if node.MinPort == 0 && node.MaxPort == 0 {
+		node.MinPort = s.cfg.ContainerMinPort
+		node.MaxPort = s.cfg.ContainerMaxPort
+	}
+
+	node.ID = utils.GenerateULID()
+
+	if err := s.validate(ctx, &node); err != nil {
+		return nil, err
+	}
+
+	plain := node
+
+	key, err := crypto.Encrypt(s.cfg.MasterKey, []byte(node.ClientKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt client key: %w", err)
+	}
+
+	node.ClientKey = key
+	node.CreatedAt = time.Now()
+
+	created, err := s.repo.Create(ctx, &node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Create node: %w", err)
+	}
+
+	if err := s.containers.FillPorts(ctx, created.ID, created.MinPort, created.MaxPort); err != nil {
+		if derr := s.repo.Delete(ctx, created.ID); derr != nil {
+			s.l.Warn("failed to remove node %s: %s", created.Name, derr.Error())
+		}
+
+		return nil, fmt.Errorf("failed to FillPorts: %w", err)
+	}
+
+	s.l.Info("registered node %s at %s", created.Name, created.Host)
+	s.connect(plain)
+
+	created.ClientKey = ""
+
+	return created, nil
+}
+
+// Update changes a registered node. Empty certificates and key keep the
+// stored ones. The port pool is resized, ports in use have to stay in the
+// range.
+func (s *NodeService) Update(ctx context.Context, id string, update model.Node) (*model.Node, error) {
+	if id == model.LocalNodeID {
+		return nil, fmt.Errorf("%w: the local node is configured with the environment", errs.ErrInvalidInput)
+	}
+
+	node, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetByID: %w", err)
+	}
+
+	update.ID = node.ID
+	update.CreatedAt = node.CreatedAt
+	update.CACert = cmp.Or(update.CACert, node.CACert)
+	update.ClientCert = cmp.Or(update.ClientCert, node.ClientCert)
+
+	if update.ClientKey == "" {
+		key, err := crypto.Decrypt(s.cfg.MasterKey, node.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt client key: %w", err)
+		}
+
+		update.ClientKey = string(key)
+	}
+
+	if err := s.validate(ctx, &update); err != nil {
+		return nil, err
+	}
+
+	if update.MinPort != node.MinPort || update.MaxPort != node.MaxPort {
+		if err := s.containers.ResizePorts(ctx, node.ID, update.MinPort, update.MaxPort); err != nil {
+			return nil, fmt.Errorf("failed to ResizePorts: %w", err)
+		}
+	}
+
+	plain := update
+
+	key, err := crypto.Encrypt(s.cfg.MasterKey, []byte(update.ClientKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt client key: %w", err)
+	}
+
+	update.ClientKey = key
+
+	updated, err := s.repo.Update(ctx, &update)
+	if err != nil {
+		return nil, fmt.Errorf("failed to Update node: %w", err)
+	}
+
+	s.connect(plain)
+
+	updated.ClientKey = ""
+
+	return updated, nil
+}
+
+// Delete removes a registered node without workspaces, trashed ones
+// included.
+func (s *NodeService) Delete(ctx context.Context, id string) error {
+	if id == model.LocalNodeID {
+		return fmt.Errorf("%w: the local node cannot be removed", errs.ErrInvalidInput)
+	}
+
+	node, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to GetByID: %w", err)
+	}
+
+	count, err := s.containers.CountByNode(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to CountByNode: %w", err)
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%w: node %s still has %d workspaces", errs.ErrInvalidInput, node.Name, count)
+	}
+
+	if err := s.containers.DeletePorts(ctx, id); err != nil {
+		return fmt.Errorf("failed to DeletePorts: %w", err)
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to Delete node: %w", err)
+	}
+
+	s.engines.Disconnect(id)
+	s.l.Info("removed node %s", node.Name)
+
+	return nil
+}
+
+// Schedule returns the node a new workspace with the limits is placed on.
+// Candidates are the reachable, not cordoned nodes with a free port whose
+// cpus and memory are not reserved by the limits of their workspaces. The
+// node with the most free memory wins, then the one with the most free cpu.
+func (s *NodeService) Schedule(ctx context.Context, limits model.ResourceLimits) (string, error) {
+	nodes, err := s.nodes(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	statuses, err := s.statuses(ctx, nodes)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := []model.NodeStatus{}
+
+	for _, n := range statuses {
+		switch {
+		case n.Cordoned:
+			continue
+		case !n.Reachable:
+			s.l.Warn("skipping unreachable node %s: %s", n.Name, n.Error)
+
+			continue
+		case n.FreePorts == 0:
+			continue
+		case n.Memory > 0 && limits.Memory > freeMemory(n):
+			continue
+		case n.CPUs > 0 && limits.CPUQuota > freeCPU(n):
+			continue
+		}
+
+		candidates = append(candidates, n)
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("%w: no node has a free port, %d bytes of memory and a cpu quota of %d left",
+			errs.ErrNoCapacity, limits.Memory, limits.CPUQuota)
+	}
+
+	// stable, so that ties keep the local node first
+	slices.SortStableFunc(candidates, func(a, b model.NodeStatus) int {
+		return cmp.Or(cmp.Compare(freeMemory(b), freeMemory(a)), cmp.Compare(freeCPU(b), freeCPU(a)))
+	})
+
+	return candidates[0].ID, nil
+}
+
+// PublicURL returns the base url the host ports of a node are reached on.
+func (s *NodeService) PublicURL(ctx context.Context, nodeID string) (string, error) {
+	node, err := s.node(ctx, nodeID)
+	if err != nil {
+		return "", err
+	}
+
+	return node.PublicURL, nil
+}
+
+// connect creates the engine of a node with its decrypted client key.
+func (s *NodeService) connect(node model.Node) {
+	if err := s.engines.Connect(node); err != nil {
+		s.l.Warn("node %s is unavailable: %s", node.Name, err.Error())
+	}
+}
+
+func freeMemory(n model.NodeStatus) int64 {
+	return n.Memory - n.ReservedMemory
+}
+
+func freeCPU(n model.NodeStatus) int64 {
+	return n.CPUs*cpuPeriod - n.ReservedCPU
+}
+
+// localNode describes the engine configured with CD_PROVIDER.
+func (s *NodeService) localNode() model.Node {
+	return model.Node{ //nolint:exhaustruct
+		ID:        model.LocalNodeID,
+		Name:      model.LocalNodeID,
+		Host:      s.cfg.Provider,
+		PublicURL: s.cfg.PublicURL,
+		MinPort:   s.cfg.ContainerMinPort,
+		MaxPort:   s.cfg.ContainerMaxPort,
+	}
+}
+
+// nodes returns the local node and the registered nodes without keys.
+func (s *NodeService) nodes(ctx context.Context) ([]model.Node, error) {
+	registered, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetAll nodes: %w", err)
+	}
+
+	for i := range registered {
+		registered[i].ClientKey = ""
+	}
+
+	return append([]model.Node{s.localNode()}, registered...), nil
+}
+
+func (s *NodeService) node(ctx context.Context, id string) (*model.Node, error) {
+	if id == "" || id == model.LocalNodeID {
+		node := s.localNode()
+
+		return &node, nil
+	}
+
+	node, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetByID: %w", err)
+	}
+
+	node.ClientKey = ""
+
+	return node, nil
+}
+
+// statuses adds the capacity, the reservations and the free ports to nodes.
+// Nodes that cannot be asked for their capacity are marked unreachable.
+func (s *NodeService) statuses(ctx context.Context, nodes []model.Node) ([]model.NodeStatus, error) {
+	reservations, err := s.containers.GetNodeReservations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetNodeReservations: %w", err)
+	}
+
+	freePorts, err := s.containers.GetFreePortCounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetFreePortCounts: %w", err)
+	}
+
+	statuses := make([]model.NodeStatus, len(nodes))
+
+	for i, node := range nodes {
+		reservation := reservations[node.ID]
+		status := model.NodeStatus{ //nolint:exhaustruct
+			Node:           node,
+			Reachable:      true,
+			Workspaces:     reservation.Workspaces,
+			ReservedCPU:    reservation.CPUQuota,
+			ReservedMemory: reservation.Memory,
+			FreePorts:      freePorts[node.ID],
+		}
+
+		resources, err := s.engines.NodeResources(ctx, node.ID)
+		if err != nil {
+			status.Reachable = false
+			status.Error = err.Error()
+		}
+
+		status.NodeResources = resources
+		statuses[i] = status
+	}
+
+	return statuses, nil
+}
+
+// validate checks a node and that its name is not taken by another node.
+func (s *NodeService) validate(ctx context.Context, node *model.Node) error {
+	if err := validateNode(node); err != nil {
+		return err
+	}
+
+	nodes, err := s.repo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to GetAll nodes: %w", err)
+	}
+
+	for _, n := range nodes {
+		if n.Name == node.Name && n.ID != node.ID {
+			return fmt.Errorf("%w: node %s exists already", errs.ErrInvalidInput, node.Name)
+		}
+	}
+
+	return nil
+}
+
+// validateNode normalizes and checks a node before it is stored.
+func validateNode(node *model.Node) error {
+	node.Name = strings.ToLower(strings.TrimSpace(node.Name))
+	node.Host = strings.TrimSpace(node.Host)
+	node.PublicURL = strings.TrimRight(strings.TrimSpace(node.PublicURL), "/")
+
+	if !nodeNamePattern.MatchString(node.Name) || node.Name == model.LocalNodeID {
+		return fmt.Errorf("%w: node name must be lowercase letters, digits, '.' or '-' and not %q",
+			errs.ErrInvalidInput, model.LocalNodeID)
+	}
+
+	host, found := strings.CutPrefix(node.Host, "tcp://")
+	if _, _, err := net.SplitHostPort(host); !found || err != nil {
+		return fmt.Errorf("%w: host must be a docker endpoint like tcp://10.0.0.2:2376", errs.ErrInvalidInput)
+	}
+
+	u, err := url.Parse(node.PublicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+		return fmt.Errorf("%w: public url must be like http://10.0.0.2", errs.ErrInvalidInput)
+	}
+
+	if node.MinPort < 1 || node.MaxPort > maxPort || node.MinPort > node.MaxPort {
+		return fmt.Errorf("%w: invalid port range %d-%d", errs.ErrInvalidInput, node.MinPort, node.MaxPort)
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(node.CACert)) {
+		return fmt.Errorf("%w: ca_cert must be a PEM encoded certificate", errs.ErrInvalidInput)
+	}
+
+	if _, err := tls.X509KeyPair([]byte(node.ClientCert), []byte(node.ClientKey)); err != nil {
+		return fmt.Errorf("%w: invalid client certificate or key: %w", errs.ErrInvalidInput, err)
+	}
+
+	return nil
+}
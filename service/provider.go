@@ -0,0 +1,17 @@
+package service
+
+import (
+	"context"
+
+	"github.com/kaibling/cerodev/model"
+)
+
+// Provider is the engine that runs workspaces and builds their images. The
+// implementation is selected with CD_PROVIDER. Services depend on the subset
+// they use, a provider has to implement all of it.
+type Provider interface {
+	containerProvider
+	ImageBuilder
+	ListManagedContainers(ctx context.Context) ([]model.ProviderContainer, error)
+	InspectManagedContainer(ctx context.Context, containerID string) (model.ProviderContainer, error)
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/utils"
+)
+
+type quotarepo interface {
+	Get(ctx context.Context, kind model.QuotaKind, subject string) (*model.Quota, error)
+	GetAll(ctx context.Context) ([]*model.Quota, error)
+	Save(ctx context.Context, quota *model.Quota) (*model.Quota, error)
+	Delete(ctx context.Context, kind model.QuotaKind, subject string) error
+}
+
+type quotaDBRepo interface {
+	GetAllByUserID(ctx context.Context, userID string) ([]model.Container, error)
+	GetDeletedByUserID(ctx context.Context, userID string) ([]model.Container, error)
+}
+
+type quotaProvider interface {
+	GetContainerStatuses(ctx context.Context, containerID []string) ([]model.ContainerStatus, error)
+}
+
+type quotaUserRepo interface {
+	GetByID(ctx context.Context, id string) (*model.User, error)
+}
+
+// QuotaService manages the quotas of users and roles and checks them before
+// workspaces are created or started.
+type QuotaService struct {
+	quotarepo quotarepo
+	dbrepo    quotaDBRepo
+	provider  quotaProvider
+	userrepo  quotaUserRepo
+	cfg       config.Configuration
+}
+
+func NewQuotaService(
+	quotarepo quotarepo,
+	dbrepo quotaDBRepo,
+	provider quotaProvider,
+	userrepo quotaUserRepo,
+	cfg config.Configuration,
+) *QuotaService {
+	return &QuotaService{
+		quotarepo: quotarepo,
+		dbrepo:    dbrepo,
+		provider:  provider,
+		userrepo:  userrepo,
+		cfg:       cfg,
+	}
+}
+
+func (s *QuotaService) GetAll(ctx context.Context) ([]*model.Quota, error) {
+	val, err := s.quotarepo.GetAll(ctx)
+
+	return HandleError[[]*model.Quota](val, err, "failed to GetAll")
+}
+
+// Save creates or replaces the quota of a role or a user.
+func (s *QuotaService) Save(ctx context.Context, quota *model.Quota) (*model.Quota, error) {
+	if err := s.validate(ctx, quota); err != nil {
+		return nil, err
+	}
+
+	val, err := s.quotarepo.Save(ctx, quota)
+
+	return HandleError[*model.Quota](val, err, "failed to Save")
+}
+
+func (s *QuotaService) Delete(ctx context.Context, kind model.QuotaKind, subject string) error {
+	if err := s.quotarepo.Delete(ctx, kind, subject); err != nil {
+		return fmt.Errorf("failed to Delete: %w", err)
+	}
+
+	return nil
+}
+
+// Usage returns the current consumption of a user and the quota it is
+// compared against.
+func (s *QuotaService) Usage(ctx context.Context, userID string) (*model.Usage, error) {
+	quota, err := s.effective(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.usage(ctx, userID, quota)
+}
+
+// CheckCreate fails with errs.ErrQuotaExceeded if the owner cannot have
+// another workspace with the given limits.
+func (s *QuotaService) CheckCreate(ctx context.Context, userID string, limits model.ResourceLimits) error {
+	quota, err := s.effective(ctx, userID)
+	if err != nil || quota == nil {
+		return err
+	}
+
+	usage, err := s.usage(ctx, userID, quota)
+	if err != nil {
+		return err
+	}
+
+	if quota.MaxContainers > 0 && usage.Containers >= quota.MaxContainers {
+		return fmt.Errorf("%w: at most %d workspaces are allowed", errs.ErrQuotaExceeded, quota.MaxContainers)
+	}
+
+	if quota.MaxVolumeSize > 0 && usage.VolumeSize >= quota.MaxVolumeSize {
+		return fmt.Errorf("%w: volumes use %d of %d bytes", errs.ErrQuotaExceeded, usage.VolumeSize, quota.MaxVolumeSize)
+	}
+
+	// a workspace that could never be started is rejected right away
+	return checkLimits(quota, limits)
+}
+
+// CheckStart fails with errs.ErrQuotaExceeded if starting the workspace
+// would exceed the quota of its owner. Running workspaces always pass.
+func (s *QuotaService) CheckStart(ctx context.Context, c *model.Container) error {
+	if c.State == runningState {
+		return nil
+	}
+
+	quota, err := s.effective(ctx, c.UserID)
+	if err != nil || quota == nil {
+		return err
+	}
+
+	usage, err := s.usage(ctx, c.UserID, quota)
+	if err != nil {
+		return err
+	}
+
+	if quota.MaxRunning > 0 && usage.Running >= quota.MaxRunning {
+		return fmt.Errorf("%w: at most %d running workspaces are allowed", errs.ErrQuotaExceeded, quota.MaxRunning)
+	}
+
+	if quota.MaxVolumeSize > 0 && usage.VolumeSize > quota.MaxVolumeSize {
+		return fmt.Errorf("%w: volumes use %d of %d bytes", errs.ErrQuotaExceeded, usage.VolumeSize, quota.MaxVolumeSize)
+	}
+
+	if err := checkLimits(quota, c.Limits); err != nil {
+		return err
+	}
+
+	return checkTotals(quota, usage.Memory+c.Limits.Memory, usage.CPUQuota+c.Limits.CPUQuota)
+}
+
+// CheckUpdate fails with errs.ErrQuotaExceeded if the workspace would exceed
+// the quota of its owner with the new limits in place of its current ones.
+// The totals only matter while the workspace is running, a stopped one is
+// checked again when it is started.
+func (s *QuotaService) CheckUpdate(ctx context.Context, c *model.Container, limits model.ResourceLimits) error {
+	quota, err := s.effective(ctx, c.UserID)
+	if err != nil || quota == nil {
+		return err
+	}
+
+	if err := checkLimits(quota, limits); err != nil {
+		return err
+	}
+
+	statuses, err := s.provider.GetContainerStatuses(ctx, []string{c.DockerID})
+	if err != nil {
+		return fmt.Errorf("failed to provider GetContainerStatuses: %w", err)
+	}
+
+	if len(statuses) == 0 || statuses[0].State != runningState {
+		return nil
+	}
+
+	usage, err := s.usage(ctx, c.UserID, quota)
+	if err != nil {
+		return err
+	}
+
+	return checkTotals(quota,
+		usage.Memory-c.Limits.Memory+limits.Memory,
+		usage.CPUQuota-c.Limits.CPUQuota+limits.CPUQuota)
+}
+
+// checkTotals fails if the limits of all running workspaces together exceed
+// the quota.
+func checkTotals(quota *model.Quota, memory, cpuQuota int64) error {
+	if quota.MaxMemory > 0 && memory > quota.MaxMemory {
+		return fmt.Errorf("%w: running workspaces would use %d of %d bytes of memory",
+			errs.ErrQuotaExceeded, memory, quota.MaxMemory)
+	}
+
+	if quota.MaxCPUQuota > 0 && cpuQuota > quota.MaxCPUQuota {
+		return fmt.Errorf("%w: running workspaces would use a cpu quota of %d of %d",
+			errs.ErrQuotaExceeded, cpuQuota, quota.MaxCPUQuota)
+	}
+
+	return nil
+}
+
+// checkLimits rejects workspaces without memory or cpu limit if the total is
+// restricted, and workspaces that alone exceed the total.
+func checkLimits(quota *model.Quota, limits model.ResourceLimits) error {
+	if quota.MaxMemory > 0 && (limits.Memory == 0 || limits.Memory > quota.MaxMemory) {
+		return fmt.Errorf("%w: workspaces need a memory limit of at most %d bytes",
+			errs.ErrQuotaExceeded, quota.MaxMemory)
+	}
+
+	if quota.MaxCPUQuota > 0 && (limits.CPUQuota == 0 || limits.CPUQuota > quota.MaxCPUQuota) {
+		return fmt.Errorf("%w: workspaces need a cpu quota of at most %d",
+			errs.ErrQuotaExceeded, quota.MaxCPUQuota)
+	}
+
+	return nil
+}
+
+// effective returns the quota of the user, or else the quota of its role.
+// nil means the user is unlimited.
+func (s *QuotaService) effective(ctx context.Context, userID string) (*model.Quota, error) {
+	user, err := s.userrepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetByID: %w", err)
+	}
+
+	quota, err := s.quotarepo.Get(ctx, model.QuotaKindUser, user.ID)
+	if err == nil {
+		return quota, nil
+	}
+
+	if !errors.Is(err, errs.ErrDataNotFound) {
+		return nil, fmt.Errorf("failed to Get user quota: %w", err)
+	}
+
+	quota, err = s.quotarepo.Get(ctx, model.QuotaKindRole, string(user.Role))
+	if err == nil {
+		return quota, nil
+	}
+
+	if !errors.Is(err, errs.ErrDataNotFound) {
+		return nil, fmt.Errorf("failed to Get role quota: %w", err)
+	}
+
+	return nil, nil //nolint:nilnil
+}
+
+func (s *QuotaService) usage(ctx context.Context, userID string, quota *model.Quota) (*model.Usage, error) {
+	containers, err := s.dbrepo.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetAllByUserID: %w", err)
+	}
+
+	// trashed workspaces keep their volume until they are purged
+	trashed, err := s.dbrepo.GetDeletedByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetDeletedByUserID: %w", err)
+	}
+
+	usage := &model.Usage{ //nolint:exhaustruct
+		UserID:     userID,
+		Quota:      quota,
+		Containers: len(containers),
+	}
+
+	for _, c := range trashed {
+		size, err := utils.DirSize(s.cfg.VolumesPath + "/" + c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read volume size of %s: %w", c.ID, err)
+		}
+
+		usage.VolumeSize += size
+	}
+
+	if len(containers) == 0 {
+		return usage, nil
+	}
+
+	dockerIDs := make([]string, len(containers))
+	for i, c := range containers {
+		dockerIDs[i] = c.DockerID
+	}
+
+	statuses, err := s.provider.GetContainerStatuses(ctx, dockerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provider GetContainerStatuses: %w", err)
+	}
+
+	running := map[string]bool{}
+	for _, status := range statuses {
+		if status.State == runningState {
+			running[status.DockerID] = true
+		}
+	}
+
+	for _, c := range containers {
+		size, err := utils.DirSize(s.cfg.VolumesPath + "/" + c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read volume size of %s: %w", c.ID, err)
+		}
+
+		usage.VolumeSize += size
+
+		if running[c.DockerID] {
+			usage.Running++
+			usage.Memory += c.Limits.Memory
+			usage.CPUQuota += c.Limits.CPUQuota
+		}
+	}
+
+	return usage, nil
+}
+
+func (s *QuotaService) validate(ctx context.Context, quota *model.Quota) error {
+	switch quota.Kind {
+	case model.QuotaKindRole:
+		if !model.Role(quota.Subject).Valid() {
+			return errs.ErrInvalidRole
+		}
+	case model.QuotaKindUser:
+		if _, err := s.userrepo.GetByID(ctx, quota.Subject); err != nil {
+			return fmt.Errorf("failed to GetByID: %w", err)
+		}
+	default:
+		return fmt.Errorf("%w: quota kind must be role or user", errs.ErrInvalidInput)
+	}
+
+	if quota.MaxContainers < 0 || quota.MaxRunning < 0 || quota.MaxMemory < 0 ||
+		quota.MaxCPUQuota < 0 || quota.MaxVolumeSize < 0 {
+		return fmt.Errorf("%w: quotas must not be negative", errs.ErrInvalidInput)
+	}
+
+	return nil
+}
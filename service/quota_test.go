@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+const gib = 1 << 30
+
+// fakeQuotaRepo serves quotas by kind and subject. The other methods are not
+// used by the tests and panic.
+type fakeQuotaRepo struct {
+	quotarepo
+
+	quotas map[string]*model.Quota
+}
+
+func (r *fakeQuotaRepo) Get(_ context.Context, kind model.QuotaKind, subject string) (*model.Quota, error) {
+	q, ok := r.quotas[string(kind)+"/"+subject]
+	if !ok {
+		return nil, errs.ErrDataNotFound
+	}
+
+	return q, nil
+}
+
+type fakeQuotaDBRepo struct {
+	containers []model.Container
+	trashed    []model.Container
+}
+
+func (r *fakeQuotaDBRepo) GetAllByUserID(_ context.Context, _ string) ([]model.Container, error) {
+	return r.containers, nil
+}
+
+func (r *fakeQuotaDBRepo) GetDeletedByUserID(_ context.Context, _ string) ([]model.Container, error) {
+	return r.trashed, nil
+}
+
+// fakeStatusProvider reports the listed docker ids as running.
+type fakeStatusProvider map[string]bool
+
+func (p fakeStatusProvider) GetContainerStatuses(
+	_ context.Context,
+	containerID []string,
+) ([]model.ContainerStatus, error) {
+	statuses := []model.ContainerStatus{}
+
+	for _, id := range containerID {
+		state := "exited"
+		if p[id] {
+			state = runningState
+		}
+
+		statuses = append(statuses, model.ContainerStatus{DockerID: id, Status: state, State: state})
+	}
+
+	return statuses, nil
+}
+
+// workspace returns a container of the developer with one cpu and the given
+// memory limit.
+func workspace(id string, memory int64) model.Container {
+	return model.Container{ //nolint:exhaustruct
+		ID:       id,
+		DockerID: "d-" + id,
+		UserID:   "dev",
+		Limits:   model.ResourceLimits{Memory: memory, CPUQuota: 100000}, //nolint:exhaustruct
+	}
+}
+
+// newTestQuotaService returns the quota service of a developer with the
+// running workspace "a" (2 GiB), the stopped workspace "b" (1 GiB) and the
+// trashed workspace "t". Each volume holds 100 bytes.
+func newTestQuotaService(t *testing.T, quotas ...*model.Quota) *QuotaService {
+	t.Helper()
+
+	volumes := t.TempDir()
+
+	for _, id := range []string{"a", "b", "t"} {
+		if err := os.Mkdir(filepath.Join(volumes, id), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(volumes, id, "data"), make([]byte, 100), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := &fakeQuotaRepo{quotas: map[string]*model.Quota{}} //nolint:exhaustruct
+	for _, q := range quotas {
+		repo.quotas[string(q.Kind)+"/"+q.Subject] = q
+	}
+
+	users := &fakeUserRepo{users: map[string]*model.User{ //nolint:exhaustruct
+		"dev": {ID: "dev", Username: "dev", Role: model.RoleDeveloper}, //nolint:exhaustruct
+	}}
+
+	db := &fakeQuotaDBRepo{
+		containers: []model.Container{workspace("a", 2*gib), workspace("b", gib)},
+		trashed:    []model.Container{workspace("t", gib)},
+	}
+
+	cfg := config.Configuration{VolumesPath: volumes} //nolint:exhaustruct
+
+	return NewQuotaService(repo, db, fakeStatusProvider{"d-a": true}, users, cfg)
+}
+
+// roleQuota is a quota of the developer role.
+func roleQuota(q model.Quota) *model.Quota {
+	q.Kind = model.QuotaKindRole
+	q.Subject = string(model.RoleDeveloper)
+
+	return &q
+}
+
+func TestUsage(t *testing.T) {
+	s := newTestQuotaService(t)
+
+	usage, err := s.Usage(context.Background(), "dev")
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+
+	if usage.Quota != nil {
+		t.Errorf("quota of an unlimited user = %+v", usage.Quota)
+	}
+
+	if usage.Containers != 2 || usage.Running != 1 {
+		t.Errorf("containers = %d, running = %d", usage.Containers, usage.Running)
+	}
+
+	if usage.Memory != 2*gib || usage.CPUQuota != 100000 {
+		t.Errorf("memory = %d, cpu quota = %d", usage.Memory, usage.CPUQuota)
+	}
+
+	// the trashed volume is counted too
+	if usage.VolumeSize != 300 {
+		t.Errorf("volume size = %d", usage.VolumeSize)
+	}
+}
+
+func TestEffectiveQuota(t *testing.T) {
+	user := &model.Quota{Kind: model.QuotaKindUser, Subject: "dev", MaxContainers: 5} //nolint:exhaustruct
+	role := roleQuota(model.Quota{MaxContainers: 3})                                  //nolint:exhaustruct
+	other := &model.Quota{Kind: model.QuotaKindRole, Subject: "viewer"}               //nolint:exhaustruct
+
+	tests := []struct {
+		name   string
+		quotas []*model.Quota
+		want   *model.Quota
+	}{
+		{name: "no quota", quotas: nil, want: nil},
+		{name: "quota of another role", quotas: []*model.Quota{other}, want: nil},
+		{name: "role quota", quotas: []*model.Quota{role, other}, want: role},
+		{name: "user quota wins", quotas: []*model.Quota{role, user}, want: user},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newTestQuotaService(t, tt.quotas...).effective(context.Background(), "dev")
+			if err != nil {
+				t.Fatalf("effective: %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("effective = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCreate(t *testing.T) {
+	oneCPU := model.ResourceLimits{Memory: gib, CPUQuota: 100000} //nolint:exhaustruct
+
+	tests := []struct {
+		name    string
+		quota   model.Quota
+		limits  model.ResourceLimits
+		wantErr bool
+	}{
+		{name: "below the container count", quota: model.Quota{MaxContainers: 3}, limits: oneCPU},
+		{name: "at the container count", quota: model.Quota{MaxContainers: 2}, limits: oneCPU, wantErr: true},
+		{name: "trash within the volume size", quota: model.Quota{MaxVolumeSize: 301}, limits: oneCPU},
+		{name: "trash at the volume size", quota: model.Quota{MaxVolumeSize: 300}, limits: oneCPU, wantErr: true},
+		{name: "memory limit required", quota: model.Quota{MaxMemory: 4 * gib}, wantErr: true},
+		{name: "memory limit above the total", quota: model.Quota{MaxMemory: gib / 2}, limits: oneCPU, wantErr: true},
+		{name: "cpu limit required", quota: model.Quota{MaxCPUQuota: 200000}, wantErr: true},
+		{name: "cpu limit within the total", quota: model.Quota{MaxCPUQuota: 100000}, limits: oneCPU},
+		// the totals of the running workspaces are checked when it is started
+		{name: "totals used up", quota: model.Quota{MaxMemory: 2 * gib, MaxCPUQuota: 100000}, limits: oneCPU},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestQuotaService(t, roleQuota(tt.quota))
+
+			err := s.CheckCreate(context.Background(), "dev", tt.limits)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, errs.ErrQuotaExceeded)) {
+				t.Errorf("CheckCreate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckStart(t *testing.T) {
+	tests := []struct {
+		name      string
+		quota     model.Quota
+		container string
+		wantErr   bool
+	}{
+		{name: "running workspace", quota: model.Quota{MaxRunning: 1}, container: "a"},
+		{name: "below the running count", quota: model.Quota{MaxRunning: 2}, container: "b"},
+		{name: "at the running count", quota: model.Quota{MaxRunning: 1}, container: "b", wantErr: true},
+		{name: "memory within the total", quota: model.Quota{MaxMemory: 3 * gib}, container: "b"},
+		{name: "memory above the total", quota: model.Quota{MaxMemory: 3*gib - 1}, container: "b", wantErr: true},
+		{name: "cpu within the total", quota: model.Quota{MaxCPUQuota: 200000}, container: "b"},
+		{name: "cpu above the total", quota: model.Quota{MaxCPUQuota: 150000}, container: "b", wantErr: true},
+		{name: "volume size at the quota", quota: model.Quota{MaxVolumeSize: 300}, container: "b"},
+		{name: "volume size above the quota", quota: model.Quota{MaxVolumeSize: 299}, container: "b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestQuotaService(t, roleQuota(tt.quota))
+
+			c := workspace(tt.container, gib)
+			if tt.container == "a" {
+				c = workspace("a", 2*gib)
+				c.State = runningState
+			}
+
+			err := s.CheckStart(context.Background(), &c)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, errs.ErrQuotaExceeded)) {
+				t.Errorf("CheckStart = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		quota     model.Quota
+		container model.Container
+		memory    int64
+		wantErr   bool
+	}{
+		{name: "running within the total", quota: model.Quota{MaxMemory: 3 * gib}, container: workspace("a", 2*gib),
+			memory: 3 * gib},
+		{name: "running above the total", quota: model.Quota{MaxMemory: 3 * gib}, container: workspace("a", 2*gib),
+			memory: 3*gib + 1, wantErr: true},
+		{name: "running lowered", quota: model.Quota{MaxMemory: gib}, container: workspace("a", 2*gib),
+			memory: gib},
+		{name: "stopped above the total of running", quota: model.Quota{MaxMemory: 3 * gib},
+			container: workspace("b", gib), memory: 3 * gib},
+		{name: "stopped above the quota", quota: model.Quota{MaxMemory: 3 * gib}, container: workspace("b", gib),
+			memory: 3*gib + 1, wantErr: true},
+		{name: "no memory limit", quota: model.Quota{MaxMemory: 3 * gib}, container: workspace("b", gib),
+			memory: 0, wantErr: true},
+		{name: "unlimited", quota: model.Quota{MaxContainers: 1}, container: workspace("a", 2*gib),
+			memory: 8 * gib},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestQuotaService(t, roleQuota(tt.quota))
+
+			limits := model.ResourceLimits{Memory: tt.memory, CPUQuota: 100000} //nolint:exhaustruct
+
+			err := s.CheckUpdate(context.Background(), &tt.container, limits)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, errs.ErrQuotaExceeded)) {
+				t.Errorf("CheckUpdate = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/utils"
+)
+
+const (
+	// stalePortIntervals is the number of reconcile intervals a reserved port
+	// is left alone without a container.
+	stalePortIntervals = 3
+	// minPortGracePeriod applies to short intervals and runs on demand.
+	minPortGracePeriod = 15 * time.Minute
+)
+
+type reconcileDBRepo interface {
+	GetAllWithDeleted(ctx context.Context) ([]model.Container, error)
+	Create(ctx context.Context, container *model.Container) (*model.Container, error)
+	Update(ctx context.Context, container *model.Container) (*model.Container, error)
+	SetMissing(ctx context.Context, id string, missingSince *time.Time) error
+	AllocateFreePort(ctx context.Context, nodeID, containerID string, port int) (bool, error)
+	GetStalePorts(ctx context.Context, reservedBefore time.Time) ([]model.NodePort, error)
+	ReleasePortByPort(ctx context.Context, port model.NodePort) error
+}
+
+type reconcileProvider interface {
+	CreateContainer(ctx context.Context, container *model.Container) (string, error)
+	ListManagedContainers(ctx context.Context) ([]model.ProviderContainer, error)
+	InspectManagedContainer(ctx context.Context, containerID string) (model.ProviderContainer, error)
+	GetImage(ctx context.Context, imageName string) (model.Image, error)
+}
+
+type reconcileSecrets interface {
+	Resolve(ctx context.Context, userID, imageName string, env []string) ([]string, error)
+	Mask(ctx context.Context, userID, imageName string, env []string) ([]string, error)
+}
+
+type reconcileUserRepo interface {
+	GetByID(ctx context.Context, id string) (*model.User, error)
+}
+
+// ReconcileService compares the stored containers with the provider. It marks
+// containers the provider lost, reports or adopts containers unknown to the db
+// and releases ports held by deleted containers. It is created once at startup.
+type ReconcileService struct {
+	dbrepo   reconcileDBRepo
+	provider reconcileProvider
+	userrepo reconcileUserRepo
+	secrets  reconcileSecrets
+	l        log.Writer
+	cfg      config.Configuration
+
+	mu         sync.Mutex
+	last       *model.ReconcileReport
+	orphans    map[string]bool         // docker ids seen as orphan in the previous run
+	stalePorts map[model.NodePort]bool // ports seen as stale in the previous run
+}
+
+func NewReconcileService(
+	dbrepo reconcileDBRepo,
+	provider reconcileProvider,
+	userrepo reconcileUserRepo,
+	secrets reconcileSecrets,
+	l log.Writer,
+	cfg config.Configuration,
+) *ReconcileService {
+	return &ReconcileService{ //nolint:exhaustruct
+		dbrepo:     dbrepo,
+		provider:   provider,
+		userrepo:   userrepo,
+		secrets:    secrets,
+		l:          l.Named("reconcile_service"),
+		cfg:        cfg,
+		orphans:    map[string]bool{},
+		stalePorts: map[model.NodePort]bool{},
+	}
+}
+
+// Start runs the reconciler every ReconcileInterval until ctx ends. An
+// interval of 0 disables the background runs.
+func (s *ReconcileService) Start(ctx context.Context) {
+	if s.cfg.ReconcileInterval <= 0 {
+		s.l.Info("reconciler is disabled")
+
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		s.Run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// LastReport returns the findings of the latest run.
+func (s *ReconcileService) LastReport() *model.ReconcileReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+// Run reconciles once and returns the report. Orphans and stale ports are
+// only acted upon when they were seen in the previous run too, so containers
+// that are being created are left alone.
+func (s *ReconcileService) Run(ctx context.Context) *model.ReconcileReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &model.ReconcileReport{ //nolint:exhaustruct
+		StartedAt:     time.Now(),
+		Missing:       []model.MissingContainer{},
+		Orphans:       []model.OrphanContainer{},
+		ReleasedPorts: []model.NodePort{},
+		Errors:        []string{},
+	}
+
+	if err := s.reconcileContainers(ctx, report); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	if err := s.reconcilePorts(ctx, report); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	report.FinishedAt = time.Now()
+	s.last = report
+
+	for _, e := range report.Errors {
+		s.l.Warn("reconciler: %s", e)
+	}
+
+	return report
+}
+
+func (s *ReconcileService) reconcileContainers(ctx context.Context, report *model.ReconcileReport) error {
+	// trashed containers are included, so they are not taken for orphans
+	stored, err := s.dbrepo.GetAllWithDeleted(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to db GetAllWithDeleted: %w", err)
+	}
+
+	managed, err := s.provider.ListManagedContainers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to provider ListManagedContainers: %w", err)
+	}
+
+	known := map[string]bool{}
+	for _, pc := range managed {
+		known[pc.DockerID] = true
+	}
+
+	storedIDs := map[string]bool{}
+
+	for _, c := range stored {
+		storedIDs[c.DockerID] = true
+
+		if known[c.DockerID] {
+			if c.MissingSince != nil {
+				if err := s.dbrepo.SetMissing(ctx, c.ID, nil); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("failed to clear missing mark of %s: %s", c.ID, err))
+				}
+			}
+
+			continue
+		}
+
+		// the janitor purges trashed containers, nothing to recreate
+		if c.DeletedAt != nil {
+			continue
+		}
+
+		report.Missing = append(report.Missing, s.handleMissing(ctx, c, report))
+	}
+
+	orphans := map[string]bool{}
+
+	for _, pc := range managed {
+		if storedIDs[pc.DockerID] {
+			continue
+		}
+
+		orphans[pc.DockerID] = true
+		orphan := model.OrphanContainer{ProviderContainer: pc} //nolint:exhaustruct
+
+		if s.cfg.ReconcileAdopt && s.orphans[pc.DockerID] {
+			id, err := s.adopt(ctx, pc.DockerID)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("failed to adopt %s: %s", pc.ContainerName, err))
+			} else {
+				orphan.AdoptedAs = id
+				delete(orphans, pc.DockerID)
+			}
+		}
+
+		report.Orphans = append(report.Orphans, orphan)
+	}
+
+	s.orphans = orphans
+
+	return nil
+}
+
+// handleMissing marks a container as missing and recreates it from the stored
+// spec if enabled. The volume is kept, so the workspace survives.
+func (s *ReconcileService) handleMissing(
+	ctx context.Context,
+	c model.Container,
+	report *model.ReconcileReport,
+) model.MissingContainer {
+	missingSince := time.Now()
+	if c.MissingSince != nil {
+		missingSince = *c.MissingSince
+	} else if err := s.dbrepo.SetMissing(ctx, c.ID, &missingSince); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to mark %s as missing: %s", c.ID, err))
+	}
+
+	missing := model.MissingContainer{
+		ContainerID:   c.ID,
+		ContainerName: c.ContainerName,
+		UserID:        c.UserID,
+		MissingSince:  missingSince,
+		Recreated:     false,
+	}
+
+	if !s.cfg.ReconcileRecreate {
+		return missing
+	}
+
+	dockerID, err := s.recreate(ctx, c)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to recreate %s: %s", c.ID, err))
+
+		return missing
+	}
+
+	c.DockerID = dockerID
+	if _, err := s.dbrepo.Update(ctx, &c); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to store recreated %s: %s", c.ID, err))
+
+		return missing
+	}
+
+	if err := s.dbrepo.SetMissing(ctx, c.ID, nil); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to clear missing mark of %s: %s", c.ID, err))
+	}
+
+	missing.Recreated = true
+
+	return missing
+}
+
+// recreate creates the container from the stored spec with its secrets
+// resolved. Snapshots use the secrets of the template of their source.
+func (s *ReconcileService) recreate(ctx context.Context, c model.Container) (string, error) {
+	env, err := s.secrets.Resolve(ctx, c.UserID, s.templateImage(ctx, c.ImageName), c.EnvVars)
+	if err != nil {
+		return "", fmt.Errorf("failed to Resolve secrets: %w", err)
+	}
+
+	c.EnvVars = env
+
+	return s.provider.CreateContainer(ctx, &c)
+}
+
+// templateImage returns the image the template secrets of a workspace are
+// looked up by, for snapshots that is the image of their source.
+func (s *ReconcileService) templateImage(ctx context.Context, imageName string) string {
+	if img, err := s.provider.GetImage(ctx, imageName); err == nil && img.SourceImage != "" {
+		return img.SourceImage
+	}
+
+	return imageName
+}
+
+// adopt stores an orphaned container. The owner is read from the container
+// name and its code-server port has to be free in the port pool of its node.
+func (s *ReconcileService) adopt(ctx context.Context, dockerID string) (string, error) {
+	pc, err := s.provider.InspectManagedContainer(ctx, dockerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to provider InspectManagedContainer: %w", err)
+	}
+
+	userID, _, found := strings.Cut(strings.TrimPrefix(pc.ContainerName, "cd-"), "-")
+	if !found {
+		return "", fmt.Errorf("cannot read owner from name %s", pc.ContainerName) //nolint:err113
+	}
+
+	if _, err := s.userrepo.GetByID(ctx, userID); err != nil {
+		return "", fmt.Errorf("failed to GetByID owner %s: %w", userID, err)
+	}
+
+	// the provider knows the resolved secrets, the db keeps the references
+	env, err := s.secrets.Mask(ctx, userID, s.templateImage(ctx, pc.ImageName), pc.EnvVars)
+	if err != nil {
+		return "", fmt.Errorf("failed to Mask secrets: %w", err)
+	}
+
+	c := &model.Container{ //nolint:exhaustruct
+		ID:            utils.GenerateULID(),
+		DockerID:      pc.DockerID,
+		ImageName:     pc.ImageName,
+		ContainerName: pc.ContainerName,
+		UserID:        userID,
+		EnvVars:       env,
+		Ports:         pc.Ports,
+		Limits:        pc.Limits,
+		NodeID:        cmp.Or(pc.NodeID, model.LocalNodeID),
+	}
+
+	for _, env := range pc.EnvVars {
+		if repo, ok := strings.CutPrefix(env, "GIT_REPO="); ok {
+			c.GitRepo = repo
+		}
+
+		if ref, ok := strings.CutPrefix(env, "GIT_REF="); ok {
+			c.GitRef = ref
+		}
+
+		if depth, ok := strings.CutPrefix(env, "GIT_DEPTH="); ok {
+			c.GitDepth, _ = strconv.Atoi(depth)
+		}
+	}
+
+	uiPort, ok := c.HostPort(strconv.Itoa(codeServerPort))
+	if !ok {
+		return "", fmt.Errorf("container has no host port for %d", codeServerPort) //nolint:err113
+	}
+
+	port, err := strconv.Atoi(uiPort)
+	if err != nil {
+		return "", fmt.Errorf("invalid host port %s: %w", uiPort, err)
+	}
+
+	allocated, err := s.dbrepo.AllocateFreePort(ctx, c.NodeID, c.ID, port)
+	if err != nil {
+		return "", fmt.Errorf("failed to AllocateFreePort: %w", err)
+	}
+
+	if !allocated {
+		return "", fmt.Errorf("port %d is in use or outside of the port range", port) //nolint:err113
+	}
+
+	if _, err := s.dbrepo.Create(ctx, c); err != nil {
+		return "", fmt.Errorf("failed to db Create: %w", err)
+	}
+
+	s.l.Info("adopted container %s as %s", pc.ContainerName, c.ID)
+
+	return c.ID, nil
+}
+
+func (s *ReconcileService) reconcilePorts(ctx context.Context, report *model.ReconcileReport) error {
+	ports, err := s.dbrepo.GetStalePorts(ctx, time.Now().Add(-s.portGracePeriod()))
+	if err != nil {
+		return fmt.Errorf("failed to db GetStalePorts: %w", err)
+	}
+
+	stalePorts := map[model.NodePort]bool{}
+
+	for _, port := range ports {
+		if !s.stalePorts[port] {
+			stalePorts[port] = true
+
+			continue
+		}
+
+		if err := s.dbrepo.ReleasePortByPort(ctx, port); err != nil {
+			report.Errors = append(report.Errors,
+				fmt.Sprintf("failed to release port %d of node %s: %s", port.Port, port.NodeID, err))
+
+			continue
+		}
+
+		report.ReleasedPorts = append(report.ReleasedPorts, port)
+	}
+
+	slices.SortFunc(report.ReleasedPorts, func(a, b model.NodePort) int {
+		return cmp.Or(cmp.Compare(a.NodeID, b.NodeID), cmp.Compare(a.Port, b.Port))
+	})
+	s.stalePorts = stalePorts
+
+	return nil
+}
+
+// portGracePeriod is the time a port may be reserved without a container.
+// Creating a workspace can take a while, e.g. when its image is copied to a
+// node first.
+func (s *ReconcileService) portGracePeriod() time.Duration {
+	return max(stalePortIntervals*s.cfg.ReconcileInterval, minPortGracePeriod)
+}
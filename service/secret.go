@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/crypto"
+)
+
+// minMaskedLength is the minimum length of a secret value that is masked.
+const minMaskedLength = 4
+
+var (
+	secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,63}$`) //nolint:gochecknoglobals
+	// secretRefPattern matches ${secret:NAME} references in env var values.
+	secretRefPattern = regexp.MustCompile(`\$\{secret:([^}]*)\}`) //nolint:gochecknoglobals
+)
+
+type secretrepo interface {
+	GetByOwner(ctx context.Context, scope model.SecretScope, ownerID string) ([]model.Secret, error)
+	Save(ctx context.Context, secret *model.Secret) (*model.Secret, error)
+	Delete(ctx context.Context, scope model.SecretScope, ownerID, name string) error
+	DeleteByOwner(ctx context.Context, scope model.SecretScope, ownerID string) error
+}
+
+type secretTemplateRepo interface {
+	GetAll(ctx context.Context) ([]*model.Template, error)
+}
+
+// SecretService stores user and template secrets encrypted with the master
+// key and resolves the references in workspace env vars.
+type SecretService struct {
+	repo         secretrepo
+	templaterepo secretTemplateRepo
+	cfg          config.Configuration
+}
+
+func NewSecretService(repo secretrepo, templaterepo secretTemplateRepo, cfg config.Configuration) *SecretService {
+	return &SecretService{
+		repo:         repo,
+		templaterepo: templaterepo,
+		cfg:          cfg,
+	}
+}
+
+// GetAll returns the secrets of a user or template without their values.
+func (s *SecretService) GetAll(ctx context.Context, scope model.SecretScope, ownerID string) ([]model.Secret, error) {
+	secrets, err := s.repo.GetByOwner(ctx, scope, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetByOwner: %w", err)
+	}
+
+	for i := range secrets {
+		secrets[i].Value = ""
+	}
+
+	return secrets, nil
+}
+
+// Save encrypts and stores a secret, replacing the value of an existing one.
+func (s *SecretService) Save(
+	ctx context.Context,
+	scope model.SecretScope,
+	ownerID, name, value string,
+) (*model.Secret, error) {
+	if s.cfg.MasterKey == "" {
+		return nil, fmt.Errorf("%w: secrets require CD_MASTER_KEY to be set", errs.ErrInvalidInput)
+	}
+
+	if !secretNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("%w: invalid secret name %q", errs.ErrInvalidInput, name)
+	}
+
+	encrypted, err := crypto.Encrypt(s.cfg.MasterKey, []byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	now := time.Now()
+
+	saved, err := s.repo.Save(ctx, &model.Secret{
+		Scope:     scope,
+		OwnerID:   ownerID,
+		Name:      name,
+		Value:     encrypted,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to Save: %w", err)
+	}
+
+	saved.Value = ""
+
+	return saved, nil
+}
+
+func (s *SecretService) Delete(ctx context.Context, scope model.SecretScope, ownerID, name string) error {
+	if err := s.repo.Delete(ctx, scope, ownerID, name); err != nil {
+		return fmt.Errorf("failed to Delete: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAll removes the secrets of a deleted user or template.
+func (s *SecretService) DeleteAll(ctx context.Context, scope model.SecretScope, ownerID string) error {
+	if err := s.repo.DeleteByOwner(ctx, scope, ownerID); err != nil {
+		return fmt.Errorf("failed to DeleteByOwner: %w", err)
+	}
+
+	return nil
+}
+
+// Resolve replaces the ${secret:NAME} references in env vars with the
+// decrypted values. Secrets of the user win over the ones of the template
+// imageName was built from. Unknown secrets fail with errs.ErrInvalidInput.
+// The result must only be handed to the provider, never stored.
+func (s *SecretService) Resolve(ctx context.Context, userID, imageName string, env []string) ([]string, error) {
+	if !hasSecretRefs(env) {
+		return env, nil
+	}
+
+	secrets, err := s.available(ctx, userID, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make([]string, len(env))
+
+	for i, e := range env {
+		var rerr error
+
+		resolved[i] = secretRefPattern.ReplaceAllStringFunc(e, func(ref string) string {
+			name := secretRefPattern.FindStringSubmatch(ref)[1]
+
+			secret, ok := secrets[name]
+			if !ok {
+				rerr = fmt.Errorf("%w: unknown secret %q", errs.ErrInvalidInput, name)
+
+				return ref
+			}
+
+			value, err := crypto.Decrypt(s.cfg.MasterKey, secret.Value)
+			if err != nil {
+				rerr = fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+
+				return ref
+			}
+
+			return string(value)
+		})
+		if rerr != nil {
+			return nil, rerr
+		}
+	}
+
+	return resolved, nil
+}
+
+// Mask replaces the values of the secrets available to a workspace with
+// their references, the reverse of Resolve. It is used for env vars read back
+// from the provider. Values shorter than minMaskedLength are left alone, they
+// would match too much.
+func (s *SecretService) Mask(ctx context.Context, userID, imageName string, env []string) ([]string, error) {
+	secrets, err := s.available(ctx, userID, imageName)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := []string{}
+
+	for name, secret := range secrets {
+		value, err := crypto.Decrypt(s.cfg.MasterKey, secret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+		}
+
+		if len(value) >= minMaskedLength {
+			pairs = append(pairs, string(value), "${secret:"+name+"}")
+		}
+	}
+
+	if len(pairs) == 0 {
+		return env, nil
+	}
+
+	replacer := strings.NewReplacer(pairs...)
+	masked := make([]string, len(env))
+
+	for i, e := range env {
+		key, value, found := strings.Cut(e, "=")
+		if !found {
+			masked[i] = e
+
+			continue
+		}
+
+		masked[i] = key + "=" + replacer.Replace(value)
+	}
+
+	return masked, nil
+}
+
+// available returns the encrypted secrets usable by a workspace by name.
+func (s *SecretService) available(ctx context.Context, userID, imageName string) (map[string]model.Secret, error) {
+	secrets := map[string]model.Secret{}
+
+	templates, err := s.templaterepo.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+
+	for _, t := range templates {
+		if !t.BuiltImage(imageName) {
+			continue
+		}
+
+		templateSecrets, err := s.repo.GetByOwner(ctx, model.SecretScopeTemplate, t.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to GetByOwner template: %w", err)
+		}
+
+		for _, secret := range templateSecrets {
+			secrets[secret.Name] = secret
+		}
+	}
+
+	userSecrets, err := s.repo.GetByOwner(ctx, model.SecretScopeUser, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to GetByOwner user: %w", err)
+	}
+
+	for _, secret := range userSecrets {
+		secrets[secret.Name] = secret
+	}
+
+	return secrets, nil
+}
+
+func hasSecretRefs(env []string) bool {
+	for _, e := range env {
+		if strings.Contains(e, "${secret:") {
+			return true
+		}
+	}
+
+	return false
+}
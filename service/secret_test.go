@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+// fakeSecretRepo keeps secrets by scope and owner.
+type fakeSecretRepo struct {
+	secrets map[string][]model.Secret
+}
+
+func (r *fakeSecretRepo) GetByOwner(
+	_ context.Context,
+	scope model.SecretScope,
+	ownerID string,
+) ([]model.Secret, error) {
+	return append([]model.Secret{}, r.secrets[string(scope)+"/"+ownerID]...), nil
+}
+
+func (r *fakeSecretRepo) Save(_ context.Context, secret *model.Secret) (*model.Secret, error) {
+	key := string(secret.Scope) + "/" + secret.OwnerID
+	r.secrets[key] = append(r.secrets[key], *secret)
+
+	saved := *secret
+
+	return &saved, nil
+}
+
+func (r *fakeSecretRepo) Delete(context.Context, model.SecretScope, string, string) error {
+	return nil
+}
+
+func (r *fakeSecretRepo) DeleteByOwner(context.Context, model.SecretScope, string) error {
+	return nil
+}
+
+type fakeTemplateRepo []*model.Template
+
+func (r fakeTemplateRepo) GetAll(context.Context) ([]*model.Template, error) {
+	return r, nil
+}
+
+// newTestSecretService returns a service with the template "go" building
+// cd-go images.
+func newTestSecretService(t *testing.T) *SecretService {
+	t.Helper()
+
+	templates := fakeTemplateRepo{{ID: "tmpl-go", RepoName: "go"}} //nolint:exhaustruct
+
+	return NewSecretService(
+		&fakeSecretRepo{secrets: map[string][]model.Secret{}},
+		templates,
+		config.Configuration{MasterKey: "k3y"}, //nolint:exhaustruct
+	)
+}
+
+func save(t *testing.T, s *SecretService, scope model.SecretScope, ownerID, name, value string) {
+	t.Helper()
+
+	saved, err := s.Save(context.Background(), scope, ownerID, name, value)
+	if err != nil {
+		t.Fatalf("Save %s: %v", name, err)
+	}
+
+	if saved.Value != "" {
+		t.Errorf("Save %s returned the value", name)
+	}
+}
+
+func TestSecretResolve(t *testing.T) {
+	s := newTestSecretService(t)
+
+	save(t, s, model.SecretScopeTemplate, "tmpl-go", "TOKEN", "template-token")
+	save(t, s, model.SecretScopeTemplate, "tmpl-go", "REGISTRY", "template-registry")
+	save(t, s, model.SecretScopeUser, "u1", "TOKEN", "user-token")
+
+	tests := []struct {
+		name      string
+		userID    string
+		imageName string
+		env       []string
+		want      []string
+		wantErr   error
+	}{
+		{
+			name:      "user secret wins over template secret",
+			userID:    "u1",
+			imageName: "cd-go:v1",
+			env:       []string{"TOKEN=${secret:TOKEN}", "REGISTRY=https://${secret:REGISTRY}/v2", "PLAIN=x"},
+			want:      []string{"TOKEN=user-token", "REGISTRY=https://template-registry/v2", "PLAIN=x"},
+		},
+		{
+			name:      "template secret without user secret",
+			userID:    "u2",
+			imageName: "cd-go:v1",
+			env:       []string{"TOKEN=${secret:TOKEN}"},
+			want:      []string{"TOKEN=template-token"},
+		},
+		{
+			name:      "template secrets only for its images",
+			userID:    "u2",
+			imageName: "cd-rust:v1",
+			env:       []string{"TOKEN=${secret:TOKEN}"},
+			wantErr:   errs.ErrInvalidInput,
+		},
+		{
+			name:      "unknown secret",
+			userID:    "u1",
+			imageName: "cd-go:v1",
+			env:       []string{"A=${secret:MISSING}"},
+			wantErr:   errs.ErrInvalidInput,
+		},
+		{
+			name:      "no references",
+			userID:    "u1",
+			imageName: "cd-go:v1",
+			env:       []string{"A=b"},
+			want:      []string{"A=b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Resolve(context.Background(), tt.userID, tt.imageName, tt.env)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve error = %v, want %v", err, tt.wantErr)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Resolve = %q, want %q", got, tt.want)
+			}
+
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Resolve[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSecretResolveWrongKey(t *testing.T) {
+	s := newTestSecretService(t)
+	save(t, s, model.SecretScopeUser, "u1", "TOKEN", "user-token")
+
+	s.cfg.MasterKey = "other"
+
+	if _, err := s.Resolve(context.Background(), "u1", "cd-go:v1", []string{"T=${secret:TOKEN}"}); err == nil {
+		t.Error("Resolve with another master key succeeded")
+	}
+}
+
+func TestSecretMask(t *testing.T) {
+	s := newTestSecretService(t)
+	save(t, s, model.SecretScopeUser, "u1", "TOKEN", "user-token")
+	save(t, s, model.SecretScopeUser, "u1", "PIN", "123")
+
+	got, err := s.Mask(context.Background(), "u1", "cd-go:v1", []string{"TOKEN=user-token", "PIN=123", "NOEQUALS"})
+	if err != nil {
+		t.Fatalf("Mask: %v", err)
+	}
+
+	want := []string{"TOKEN=${secret:TOKEN}", "PIN=123", "NOEQUALS"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Mask[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSecretSaveValidates(t *testing.T) {
+	s := newTestSecretService(t)
+
+	for _, name := range []string{"", "1ABC", "A B", "${x}"} {
+		_, err := s.Save(context.Background(), model.SecretScopeUser, "u1", name, "v")
+		if !errors.Is(err, errs.ErrInvalidInput) {
+			t.Errorf("Save %q error = %v, want invalid input", name, err)
+		}
+	}
+
+	s.cfg.MasterKey = ""
+
+	if _, err := s.Save(context.Background(), model.SecretScopeUser, "u1", "A", "v"); !errors.Is(err, errs.ErrInvalidInput) { //nolint:lll
+		t.Errorf("Save without master key error = %v, want invalid input", err)
+	}
+}
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/kaibling/apiforge/log"
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+	"github.com/kaibling/cerodev/pkg/utils"
+)
+
+const statsMessageType = "container_stats"
+
+type statsProvider interface {
+	GetContainerStatuses(ctx context.Context, containerID []string) ([]model.ContainerStatus, error)
+	GetContainerStats(ctx context.Context, containerID string) (model.ContainerStats, error)
+}
+
+type statsDBRepo interface {
+	GetByID(ctx context.Context, id string) (*model.Container, error)
+	GetAll(ctx context.Context) ([]model.Container, error)
+	GetAllByUserID(ctx context.Context, userID string) ([]model.Container, error)
+}
+
+type statsNotifier interface {
+	SendJSON(data any, token string) error
+}
+
+// statsSubscription selects the workspaces a websocket client receives stats of.
+type statsSubscription struct {
+	requester    model.Requester
+	all          bool            // every workspace the requester can see
+	containerIDs map[string]bool // single workspaces
+}
+
+// snapshot copies the subscription, so that it can be read without holding
+// the lock of the service.
+func (sub *statsSubscription) snapshot() statsSubscription {
+	return statsSubscription{
+		requester:    sub.requester,
+		all:          sub.all,
+		containerIDs: maps.Clone(sub.containerIDs),
+	}
+}
+
+// StatsService pushes the stats of workspaces to subscribed websocket clients
+// every StatsInterval. It is created once at startup.
+type StatsService struct {
+	dbrepo   statsDBRepo
+	provider statsProvider
+	notifier statsNotifier
+	l        log.Writer
+	cfg      config.Configuration
+
+	mu            sync.Mutex
+	subscriptions map[string]*statsSubscription // websocket token -> subscription
+}
+
+func NewStatsService(
+	dbrepo statsDBRepo,
+	provider statsProvider,
+	notifier statsNotifier,
+	l log.Writer,
+	cfg config.Configuration,
+) *StatsService {
+	return &StatsService{ //nolint:exhaustruct
+		dbrepo:        dbrepo,
+		provider:      provider,
+		notifier:      notifier,
+		l:             l.Named("stats_service"),
+		cfg:           cfg,
+		subscriptions: map[string]*statsSubscription{},
+	}
+}
+
+// Subscribe sends the stats of a workspace to the websocket client connected
+// with token. An empty containerID subscribes to every workspace the requester
+// can see. Access to a single workspace has to be checked by the caller.
+func (s *StatsService) Subscribe(token string, req model.Requester, containerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[token]
+	if !ok {
+		sub = &statsSubscription{requester: req, all: false, containerIDs: map[string]bool{}}
+		s.subscriptions[token] = sub
+	}
+
+	if containerID == "" {
+		sub.all = true
+	} else {
+		sub.containerIDs[containerID] = true
+	}
+}
+
+// Unsubscribe stops the stats of a workspace. An empty containerID stops all
+// stats of the client.
+func (s *StatsService) Unsubscribe(token, containerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[token]
+	if !ok {
+		return
+	}
+
+	if containerID != "" {
+		delete(sub.containerIDs, containerID)
+	}
+
+	if containerID == "" || (!sub.all && len(sub.containerIDs) == 0) {
+		delete(s.subscriptions, token)
+	}
+}
+
+// Start pushes the stats until ctx ends. An interval of 0 disables it.
+func (s *StatsService) Start(ctx context.Context) {
+	if s.cfg.StatsInterval <= 0 {
+		s.l.Info("stats push is disabled")
+
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.StatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.push(ctx)
+		}
+	}
+}
+
+func (s *StatsService) push(ctx context.Context) {
+	s.mu.Lock()
+	subscriptions := make(map[string]statsSubscription, len(s.subscriptions))
+
+	for token, sub := range s.subscriptions {
+		subscriptions[token] = sub.snapshot()
+	}
+	s.mu.Unlock()
+
+	for token, sub := range subscriptions {
+		containers, err := s.containers(ctx, sub)
+		if err != nil {
+			s.l.Warn("failed to read subscribed containers: %s", err.Error())
+
+			continue
+		}
+
+		stats, err := collectStats(ctx, s.provider, s.cfg.VolumesPath, s.l, containers)
+		if err != nil {
+			s.l.Warn("failed to collect stats: %s", err.Error())
+
+			continue
+		}
+
+		for _, st := range stats {
+			if err := s.notifier.SendJSON(model.WebSocketMessage{ //nolint:exhaustruct
+				Timestamp:   time.Now().Format(time.RFC3339),
+				MessageType: statsMessageType,
+				ReferenceID: st.ContainerID,
+				Data:        st,
+			}, token); err != nil {
+				// the client is gone
+				s.Unsubscribe(token, "")
+
+				break
+			}
+		}
+	}
+}
+
+func (s *StatsService) containers(ctx context.Context, sub statsSubscription) ([]model.Container, error) {
+	if sub.all && sub.requester.IsAdmin() {
+		return s.dbrepo.GetAll(ctx)
+	}
+
+	if sub.all {
+		return s.dbrepo.GetAllByUserID(ctx, sub.requester.UserID)
+	}
+
+	containers := []model.Container{}
+
+	for id := range sub.containerIDs {
+		c, err := s.dbrepo.GetByID(ctx, id)
+		if errors.Is(err, errs.ErrDataNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to GetByID: %w", err)
+		}
+
+		containers = append(containers, *c)
+	}
+
+	return containers, nil
+}
+
+// collectStats reads the stats of the running containers in parallel and the
+// volume size of all. Failures of single containers are logged and reported
+// as zero usage.
+func collectStats(
+	ctx context.Context,
+	provider statsProvider,
+	volumesPath string,
+	l log.Writer,
+	containers []model.Container,
+) ([]model.ContainerStats, error) {
+	result := make([]model.ContainerStats, len(containers))
+	if len(containers) == 0 {
+		return result, nil
+	}
+
+	dockerIDs := make([]string, len(containers))
+	for i, c := range containers {
+		dockerIDs[i] = c.DockerID
+	}
+
+	statuses, err := provider.GetContainerStatuses(ctx, dockerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provider GetContainerStatuses: %w", err)
+	}
+
+	states := map[string]string{}
+	for _, status := range statuses {
+		states[status.DockerID] = status.State
+	}
+
+	var wg sync.WaitGroup
+
+	for i, c := range containers {
+		result[i].ContainerID = c.ID
+		result[i].State = states[c.DockerID]
+
+		if result[i].State != runningState {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			stats, err := provider.GetContainerStats(ctx, c.DockerID)
+			if err != nil {
+				l.Warn("failed to read stats of %s: %s", c.ID, err.Error())
+
+				return
+			}
+
+			stats.ContainerID = result[i].ContainerID
+			stats.State = result[i].State
+			result[i] = stats
+		}()
+	}
+
+	wg.Wait()
+
+	for i, c := range containers {
+		size, err := utils.DirSize(volumesPath + "/" + c.ID)
+		if err != nil {
+			l.Warn("failed to read volume size of %s: %s", c.ID, err.Error())
+		}
+
+		result[i].VolumeSize = size
+	}
+
+	return result, nil
+}
@@ -1,62 +1,82 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
+	"github.com/kaibling/cerodev/config"
 	"github.com/kaibling/cerodev/model"
 	"github.com/kaibling/cerodev/pkg/utils"
 )
 
 type templaterepo interface {
-	GetByID(id string) (*model.Template, error)
-	GetAll() ([]*model.Template, error)
-	Create(template *model.Template) (*model.Template, error)
-	Delete(id string) error
-	Update(template *model.Template) (*model.Template, error)
+	GetByID(ctx context.Context, id string) (*model.Template, error)
+	GetAll(ctx context.Context) ([]*model.Template, error)
+	Create(ctx context.Context, template *model.Template) (*model.Template, error)
+	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, template *model.Template) (*model.Template, error)
 }
 
 type TemplateService struct {
 	dbrepo templaterepo
+	cfg    config.Configuration
 }
 
-func NewTemplateService(dbrepo templaterepo) *TemplateService {
+func NewTemplateService(dbrepo templaterepo, cfg config.Configuration) *TemplateService {
 	return &TemplateService{
 		dbrepo: dbrepo,
+		cfg:    cfg,
 	}
 }
 
-func (s *TemplateService) GetByID(id string) (*model.Template, error) {
-	val, err := s.dbrepo.GetByID(id)
+func (s *TemplateService) GetByID(ctx context.Context, id string) (*model.Template, error) {
+	val, err := s.dbrepo.GetByID(ctx, id)
 
 	return HandleError[*model.Template](val, err, "failed to GetByID")
 }
 
-func (s *TemplateService) GetAll() ([]*model.Template, error) {
-	val, err := s.dbrepo.GetAll()
+func (s *TemplateService) GetAll(ctx context.Context) ([]*model.Template, error) {
+	val, err := s.dbrepo.GetAll(ctx)
 
 	return HandleError[[]*model.Template](val, err, "failed to GetAll")
 }
 
-func (s *TemplateService) Create(template *model.Template) (*model.Template, error) {
+func (s *TemplateService) Create(ctx context.Context, template *model.Template) (*model.Template, error) {
+	if err := validateIdleTimeout(template.IdleTimeout); err != nil {
+		return nil, err
+	}
+
+	if err := validateLimits(template.Limits, s.cfg); err != nil {
+		return nil, err
+	}
+
 	template.ID = utils.GenerateULID()
 	template.Dockerfile = baseTemplate
 	template.RepoName = strings.ToLower(template.RepoName)
-	val, err := s.dbrepo.Create(template)
+	val, err := s.dbrepo.Create(ctx, template)
 
 	return HandleError[*model.Template](val, err, "failed to Create")
 }
 
-func (s *TemplateService) Delete(id string) error {
-	if err := s.dbrepo.Delete(id); err != nil {
+func (s *TemplateService) Delete(ctx context.Context, id string) error {
+	if err := s.dbrepo.Delete(ctx, id); err != nil {
 		return fmt.Errorf("failed to db template Delete: %w", err)
 	}
 
 	return nil
 }
 
-func (s *TemplateService) Update(template *model.Template) (*model.Template, error) {
-	val, err := s.dbrepo.Update(template)
+func (s *TemplateService) Update(ctx context.Context, template *model.Template) (*model.Template, error) {
+	if err := validateIdleTimeout(template.IdleTimeout); err != nil {
+		return nil, err
+	}
+
+	if err := validateLimits(template.Limits, s.cfg); err != nil {
+		return nil, err
+	}
+
+	val, err := s.dbrepo.Update(ctx, template)
 
 	return HandleError[*model.Template](val, err, "failed to Update")
 }
@@ -1,18 +1,38 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
 	"github.com/kaibling/cerodev/model"
 	"github.com/kaibling/cerodev/pkg/crypto"
+	"github.com/kaibling/cerodev/pkg/utils"
+)
+
+const (
+	LoginTokenName = "login"
+	AdminTokenName = "admin"
+	// ProxySessionTokenName is the name of the tokens of proxy session
+	// cookies. They are told apart by their kind, the name is reserved so that
+	// they stand out in the token list.
+	ProxySessionTokenName = "proxy_session"
+
+	// lastUsedInterval limits how often the last used timestamp of a token is written.
+	lastUsedInterval = time.Minute
 )
 
 type tokenrepo interface {
-	Create(token *model.Token) (*model.Token, error)
-	Get(tokenKey string) (*model.Token, error)
-	GetByUserID(userID string) ([]*model.Token, error)
-	Delete(token string) error
+	Create(ctx context.Context, token *model.Token) (*model.Token, error)
+	GetByHash(ctx context.Context, tokenHash string) (*model.Token, error)
+	GetByID(ctx context.Context, id string) (*model.Token, error)
+	GetByUserID(ctx context.Context, userID string) ([]*model.Token, error)
+	Delete(ctx context.Context, id string) error
+	DeleteByHash(ctx context.Context, tokenHash string) error
+	DeleteByUserIDAndName(ctx context.Context, userID, name string) error
+	UpdateLastUsed(ctx context.Context, id string, lastUsed time.Time) error
 }
 
 type TokenService struct {
@@ -27,47 +47,196 @@ func NewTokenService(repo tokenrepo, cfg config.Configuration) *TokenService {
 	}
 }
 
-func (s *TokenService) CreateForUser(userID string) (*model.Token, error) {
+// CreateForUser creates a named token for the requester. The scopes of the new
+// token are limited to the permissions of the requester.
+func (s *TokenService) CreateForUser(
+	ctx context.Context,
+	req model.Requester,
+	tokenRequest *model.TokenRequest,
+) (*model.Token, error) {
+	for _, scope := range tokenRequest.Scopes {
+		if !scope.Valid() || !req.Can(scope) {
+			return nil, fmt.Errorf("%w: scope %s", errs.ErrInvalidInput, scope)
+		}
+	}
+
+	scopes := tokenRequest.Scopes
+	if len(scopes) == 0 {
+		scopes = req.Scopes
+	}
+
+	if tokenRequest.ExpiresAt != nil && tokenRequest.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at is in the past", errs.ErrInvalidInput)
+	}
+
+	if tokenRequest.Name == "" {
+		return nil, fmt.Errorf("%w: name is missing", errs.ErrInvalidInput)
+	}
+
+	if tokenRequest.Name == ProxySessionTokenName {
+		return nil, fmt.Errorf("%w: name %s is reserved", errs.ErrInvalidInput, ProxySessionTokenName)
+	}
+
+	return s.create(ctx, req.UserID, tokenRequest.Name, model.TokenKindAPI, scopes, tokenRequest.ExpiresAt)
+}
+
+// CreateLoginToken creates an unscoped token that expires after the configured token expiry.
+func (s *TokenService) CreateLoginToken(ctx context.Context, userID string) (*model.Token, error) {
+	var expiresAt *time.Time
+
+	if s.cfg.TokenExpiry > 0 {
+		t := time.Now().Add(s.cfg.TokenExpiry)
+		expiresAt = &t
+	}
+
+	return s.create(ctx, userID, LoginTokenName, model.TokenKindAPI, nil, expiresAt)
+}
+
+// CreateProxySession creates the token of the session cookie. Workspaces can
+// read the requests of the browser, so it only grants access to workspaces and
+// expires after the proxy session expiry.
+func (s *TokenService) CreateProxySession(ctx context.Context, userID string) (*model.Token, error) {
+	expiresAt := time.Now().Add(s.cfg.SessionExpiry)
+
+	return s.create(ctx, userID, ProxySessionTokenName, model.TokenKindSession,
+		[]model.Permission{model.PermWorkspacesAccess}, &expiresAt)
+}
+
+// DeleteProxySession removes the proxy session of a user. Other tokens are
+// left untouched.
+func (s *TokenService) DeleteProxySession(ctx context.Context, userID, tokenKey string) error {
+	t, err := s.GetByTokenKey(ctx, tokenKey)
+	if err != nil {
+		return err
+	}
+
+	if t.UserID != userID || t.Kind != model.TokenKindSession {
+		return errs.ErrDataNotFound
+	}
+
+	if err := s.repo.Delete(ctx, t.ID); err != nil {
+		return fmt.Errorf("failed to db Delete: %w", err)
+	}
+
+	return nil
+}
+
+// CreateUnsafe stores the given plaintext token without generating a new one.
+// Tokens without kind are api tokens.
+func (s *TokenService) CreateUnsafe(ctx context.Context, token *model.Token) (*model.Token, error) {
+	if token.Kind == "" {
+		token.Kind = model.TokenKindAPI
+	}
+
+	token.ID = utils.GenerateULID()
+	token.TokenHash = crypto.HashToken(token.Token)
+	token.CreatedAt = time.Now()
+
+	val, err := s.repo.Create(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to db Create: %w", err)
+	}
+
+	val.Token = token.Token
+
+	return val, nil
+}
+
+func (s *TokenService) create(
+	ctx context.Context,
+	userID, name string,
+	kind model.TokenKind,
+	scopes []model.Permission,
+	expiresAt *time.Time,
+) (*model.Token, error) {
 	tokenKey, err := crypto.GenerateToken(s.cfg.TokenLength)
 	if err != nil {
 		return nil, fmt.Errorf("failed to GenerateToken: %w", err)
 	}
 
-	newToken := &model.Token{
-		UserID: userID,
-		Token:  tokenKey,
+	return s.CreateUnsafe(ctx, &model.Token{ //nolint:exhaustruct
+		UserID:    userID,
+		Token:     tokenKey,
+		Name:      name,
+		Kind:      kind,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Authenticate resolves a plaintext token, rejects expired ones and records
+// when it was last used.
+func (s *TokenService) Authenticate(ctx context.Context, tokenKey string) (*model.Token, error) {
+	t, err := s.GetByTokenKey(ctx, tokenKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errs.ErrInvalidToken, err)
+	}
+
+	now := time.Now()
+
+	if t.Expired(now) {
+		if err := s.repo.Delete(ctx, t.ID); err != nil {
+			return nil, fmt.Errorf("failed to db Delete: %w", err)
+		}
+
+		return nil, errs.ErrInvalidToken
 	}
 
-	val, err := s.repo.Create(newToken)
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > lastUsedInterval {
+		if err := s.repo.UpdateLastUsed(ctx, t.ID, now); err != nil {
+			return nil, fmt.Errorf("failed to db UpdateLastUsed: %w", err)
+		}
+
+		t.LastUsedAt = &now
+	}
 
-	return HandleError[*model.Token](val, err, "failed to db Create")
+	return t, nil
 }
 
-func (s *TokenService) CreateUnsafe(token *model.Token) (*model.Token, error) {
-	val, err := s.repo.Create(token)
+// Delete removes a token by its plaintext value.
+func (s *TokenService) Delete(ctx context.Context, tokenKey string) error {
+	if err := s.repo.DeleteByHash(ctx, crypto.HashToken(tokenKey)); err != nil {
+		return fmt.Errorf("failed to db DeleteByHash: %w", err)
+	}
 
-	return HandleError[*model.Token](val, err, "failed to db Create")
+	return nil
 }
 
-func (s *TokenService) Delete(token string) error {
-	if err := s.repo.Delete(token); err != nil {
+// Revoke removes a token of a user by its id. Tokens of other users are
+// reported as not found.
+func (s *TokenService) Revoke(ctx context.Context, userID, id string) error {
+	t, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to db GetByID: %w", err)
+	}
+
+	if t.UserID != userID {
+		return errs.ErrDataNotFound
+	}
+
+	if err := s.repo.Delete(ctx, id); err != nil {
 		return fmt.Errorf("failed to db Delete: %w", err)
 	}
 
 	return nil
 }
 
-func (s *TokenService) Validate(token string) (bool, error) {
-	t, err := s.GetByTokenKey(token)
-	if err != nil {
-		return false, fmt.Errorf("failed to GetByTokenKey: %w", err)
+func (s *TokenService) DeleteByName(ctx context.Context, userID, name string) error {
+	if err := s.repo.DeleteByUserIDAndName(ctx, userID, name); err != nil {
+		return fmt.Errorf("failed to db DeleteByUserIDAndName: %w", err)
 	}
 
-	return t != nil, nil
+	return nil
+}
+
+func (s *TokenService) GetByUserID(ctx context.Context, userID string) ([]*model.Token, error) {
+	val, err := s.repo.GetByUserID(ctx, userID)
+
+	return HandleError[[]*model.Token](val, err, "failed to db GetByUserID")
 }
 
-func (s *TokenService) GetByTokenKey(token string) (*model.Token, error) {
-	val, err := s.repo.Get(token)
+func (s *TokenService) GetByTokenKey(ctx context.Context, tokenKey string) (*model.Token, error) {
+	val, err := s.repo.GetByHash(ctx, crypto.HashToken(tokenKey))
 
-	return HandleError[*model.Token](val, err, "failed to db Get")
+	return HandleError[*model.Token](val, err, "failed to db GetByHash")
 }
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kaibling/cerodev/config"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
+)
+
+// fakeTokenRepo keeps tokens by id.
+type fakeTokenRepo struct {
+	tokens map[string]model.Token
+}
+
+func (r *fakeTokenRepo) Create(_ context.Context, token *model.Token) (*model.Token, error) {
+	stored := *token
+	stored.Token = ""
+	r.tokens[token.ID] = stored
+
+	return &stored, nil
+}
+
+func (r *fakeTokenRepo) GetByHash(_ context.Context, tokenHash string) (*model.Token, error) {
+	for _, t := range r.tokens {
+		if t.TokenHash == tokenHash {
+			return &t, nil
+		}
+	}
+
+	return nil, errs.ErrDataNotFound
+}
+
+func (r *fakeTokenRepo) GetByID(_ context.Context, id string) (*model.Token, error) {
+	t, ok := r.tokens[id]
+	if !ok {
+		return nil, errs.ErrDataNotFound
+	}
+
+	return &t, nil
+}
+
+func (r *fakeTokenRepo) GetByUserID(_ context.Context, userID string) ([]*model.Token, error) {
+	tokens := []*model.Token{}
+
+	for _, t := range r.tokens {
+		if t.UserID == userID {
+			tokens = append(tokens, &t)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (r *fakeTokenRepo) Delete(_ context.Context, id string) error {
+	delete(r.tokens, id)
+
+	return nil
+}
+
+func (r *fakeTokenRepo) DeleteByHash(_ context.Context, tokenHash string) error {
+	for id, t := range r.tokens {
+		if t.TokenHash == tokenHash {
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *fakeTokenRepo) DeleteByUserIDAndName(_ context.Context, userID, name string) error {
+	for id, t := range r.tokens {
+		if t.UserID == userID && t.Name == name {
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *fakeTokenRepo) UpdateLastUsed(_ context.Context, id string, lastUsed time.Time) error {
+	t := r.tokens[id]
+	t.LastUsedAt = &lastUsed
+	r.tokens[id] = t
+
+	return nil
+}
+
+// fakeUserRepo serves users by id. The other methods are not used by the
+// tests and panic.
+type fakeUserRepo struct {
+	userrepo
+
+	users map[string]*model.User
+}
+
+func (r *fakeUserRepo) GetByID(_ context.Context, id string) (*model.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, errs.ErrDataNotFound
+	}
+
+	return u, nil
+}
+
+func newTestUserService(t *testing.T) (*UserService, *fakeTokenRepo) {
+	t.Helper()
+
+	tokens := &fakeTokenRepo{tokens: map[string]model.Token{}}
+	cfg := config.Configuration{TokenLength: 16, SessionExpiry: time.Hour} //nolint:exhaustruct
+
+	users := &fakeUserRepo{users: map[string]*model.User{ //nolint:exhaustruct
+		"dev": {ID: "dev", Username: "dev", Role: model.RoleDeveloper}, //nolint:exhaustruct
+	}}
+
+	return NewUserService(users, NewTokenService(tokens, cfg), cfg), tokens
+}
+
+func TestCreateForUserScopes(t *testing.T) {
+	developer := model.Requester{UserID: "dev", Role: model.RoleDeveloper} //nolint:exhaustruct
+
+	scoped := model.Requester{ //nolint:exhaustruct
+		UserID: "dev",
+		Role:   model.RoleDeveloper,
+		Scopes: []model.Permission{model.PermContainersRead, model.PermContainersWrite},
+	}
+
+	tests := []struct {
+		name       string
+		req        model.Requester
+		scopes     []model.Permission
+		wantScopes []model.Permission
+		wantErr    error
+	}{
+		{
+			name:       "subset of the role",
+			req:        developer,
+			scopes:     []model.Permission{model.PermContainersRead},
+			wantScopes: []model.Permission{model.PermContainersRead},
+		},
+		{
+			name:    "beyond the role",
+			req:     developer,
+			scopes:  []model.Permission{model.PermUsersWrite},
+			wantErr: errs.ErrInvalidInput,
+		},
+		{
+			name:    "beyond the scopes of the requesting token",
+			req:     scoped,
+			scopes:  []model.Permission{model.PermImagesRead},
+			wantErr: errs.ErrInvalidInput,
+		},
+		{
+			name:       "inherits the scopes of the requesting token",
+			req:        scoped,
+			wantScopes: scoped.Scopes,
+		},
+		{
+			name:    "unknown scope",
+			req:     developer,
+			scopes:  []model.Permission{"containers:all"},
+			wantErr: errs.ErrInvalidInput,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			us, _ := newTestUserService(t)
+
+			token, err := us.tokenService.CreateForUser(context.Background(), tt.req, &model.TokenRequest{
+				Name:   "ci",
+				Scopes: tt.scopes,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateForUser error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			_, checked, err := us.CheckToken(context.Background(), token.Token)
+			if err != nil {
+				t.Fatalf("CheckToken: %v", err)
+			}
+
+			if !slices.Equal(checked.Scopes, tt.wantScopes) {
+				t.Errorf("scopes = %v, want %v", checked.Scopes, tt.wantScopes)
+			}
+
+			if checked.Kind != model.TokenKindAPI {
+				t.Errorf("kind = %q", checked.Kind)
+			}
+		})
+	}
+}
+
+func TestCreateForUserReservedName(t *testing.T) {
+	us, _ := newTestUserService(t)
+	req := model.Requester{UserID: "dev", Role: model.RoleDeveloper} //nolint:exhaustruct
+
+	_, err := us.tokenService.CreateForUser(context.Background(), req, &model.TokenRequest{ //nolint:exhaustruct
+		Name: ProxySessionTokenName,
+	})
+	if !errors.Is(err, errs.ErrInvalidInput) {
+		t.Errorf("CreateForUser %s error = %v, want invalid input", ProxySessionTokenName, err)
+	}
+}
+
+func TestCheckTokenExpiry(t *testing.T) {
+	us, tokens := newTestUserService(t)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		wantErr   error
+	}{
+		{name: "never expires", expiresAt: nil},
+		{name: "expires later", expiresAt: &future},
+		{name: "expired", expiresAt: &past, wantErr: errs.ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := us.tokenService.CreateUnsafe(context.Background(), &model.Token{ //nolint:exhaustruct
+				UserID:    "dev",
+				Token:     "plain-" + tt.name,
+				Name:      "test",
+				ExpiresAt: tt.expiresAt,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, checked, err := us.CheckToken(context.Background(), token.Token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CheckToken error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				if _, ok := tokens.tokens[token.ID]; ok {
+					t.Error("expired token was not deleted")
+				}
+
+				return
+			}
+
+			if user.ID != "dev" || checked.ID != token.ID || checked.LastUsedAt == nil {
+				t.Errorf("CheckToken = %+v, %+v", user, checked)
+			}
+		})
+	}
+}
+
+func TestCheckTokenUnknown(t *testing.T) {
+	us, _ := newTestUserService(t)
+
+	if _, _, err := us.CheckToken(context.Background(), "unknown"); !errors.Is(err, errs.ErrInvalidToken) {
+		t.Errorf("CheckToken error = %v, want invalid token", err)
+	}
+}
+
+func TestProxySession(t *testing.T) {
+	us, _ := newTestUserService(t)
+	ts := us.tokenService
+
+	session, err := ts.CreateProxySession(context.Background(), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, checked, err := us.CheckToken(context.Background(), session.Token)
+	if err != nil {
+		t.Fatalf("CheckToken: %v", err)
+	}
+
+	if checked.Kind != model.TokenKindSession ||
+		!slices.Equal(checked.Scopes, []model.Permission{model.PermWorkspacesAccess}) {
+		t.Errorf("session = %+v", checked)
+	}
+
+	// an api token cannot be removed as proxy session
+	api, err := ts.CreateLoginToken(context.Background(), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ts.DeleteProxySession(context.Background(), "dev", api.Token); !errors.Is(err, errs.ErrDataNotFound) {
+		t.Errorf("DeleteProxySession of an api token error = %v", err)
+	}
+
+	if err := ts.DeleteProxySession(context.Background(), "other", session.Token); !errors.Is(err, errs.ErrDataNotFound) {
+		t.Errorf("DeleteProxySession of another user error = %v", err)
+	}
+
+	if err := ts.DeleteProxySession(context.Background(), "dev", session.Token); err != nil {
+		t.Errorf("DeleteProxySession: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/kaibling/cerodev/config"
@@ -11,13 +12,14 @@ import (
 )
 
 type userrepo interface {
-	GetByID(id string) (*model.User, error)
-	GetUnsafeByUsername(username string) (*model.User, error)
-	GetAll() ([]*model.User, error)
-	Create(user *model.User) (*model.User, error)
-	Delete(id string) error
-	Update(user *model.User) error
-	GetUserByToken(token string) (*model.User, error)
+	GetByID(ctx context.Context, id string) (*model.User, error)
+	GetUnsafeByUsername(ctx context.Context, username string) (*model.User, error)
+	GetAll(ctx context.Context) ([]*model.User, error)
+	Create(ctx context.Context, user *model.User) (*model.User, error)
+	Delete(ctx context.Context, id string) error
+	Update(ctx context.Context, user *model.User) error
+	UpdateRole(ctx context.Context, id string, role model.Role) error
+	UpdateIdleTimeout(ctx context.Context, id string, idleTimeout *int) error
 }
 
 type UserService struct {
@@ -34,8 +36,8 @@ func NewUserService(repo userrepo, tokenService *TokenService, cfg config.Config
 	}
 }
 
-func (s *UserService) GetByID(id string) (*model.User, error) {
-	user, err := s.userRepo.GetByID(id)
+func (s *UserService) GetByID(ctx context.Context, id string) (*model.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to user GetByID: %w", err)
 	}
@@ -43,8 +45,8 @@ func (s *UserService) GetByID(id string) (*model.User, error) {
 	return user, nil
 }
 
-func (s *UserService) GetAll() ([]model.User, error) {
-	users, err := s.userRepo.GetAll()
+func (s *UserService) GetAll(ctx context.Context) ([]model.User, error) {
+	users, err := s.userRepo.GetAll(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to user GetAll: %w", err)
 	}
@@ -57,9 +59,21 @@ func (s *UserService) GetAll() ([]model.User, error) {
 	return result, nil
 }
 
-func (s *UserService) Create(user *model.User) (*model.User, error) {
+func (s *UserService) Create(ctx context.Context, user *model.User) (*model.User, error) {
+	if user.Username == "" || user.Password == "" {
+		return nil, errs.ErrInvalidInput
+	}
+
 	user.ID = utils.GenerateULID()
 
+	if user.Role == "" {
+		user.Role = model.RoleDeveloper
+	}
+
+	if !user.Role.Valid() {
+		return nil, errs.ErrInvalidRole
+	}
+
 	hashedPassword, err := crypto.HashPassword(user.Password, s.cfg.PasswordCost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to user HashPassword: %w", err)
@@ -67,64 +81,137 @@ func (s *UserService) Create(user *model.User) (*model.User, error) {
 
 	user.Password = hashedPassword
 
-	val, err := s.userRepo.Create(user)
+	val, err := s.userRepo.Create(ctx, user)
 
-	return HandleError[*model.User](val, err, "failed to db Get")
+	return HandleError[*model.User](val, err, "failed to db Create")
 }
 
-func (s *UserService) Delete(id string) error {
-	if err := s.userRepo.Delete(id); err != nil {
+func (s *UserService) Delete(ctx context.Context, id string) error {
+	if err := s.userRepo.Delete(ctx, id); err != nil {
 		return fmt.Errorf("failed to db Delete: %w", err)
 	}
 
 	return nil
 }
 
-func (s *UserService) Update(user model.User) error {
-	if err := s.userRepo.Update(&user); err != nil {
-		return fmt.Errorf("failed to db Delete: %w", err)
+// Update changes the username and/or the password of a user. The current
+// password is only verified if checkCurrentPassword is set, which is the case
+// when users change their own password.
+func (s *UserService) Update(
+	ctx context.Context,
+	id string,
+	update *model.UserUpdateRequest,
+	checkCurrentPassword bool,
+) (*model.User, error) {
+	user, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	unsafeUser, err := s.userRepo.GetUnsafeByUsername(ctx, user.Username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to db GetUnsafeByUsername: %w", err)
+	}
+
+	if update.Username != "" {
+		unsafeUser.Username = update.Username
+	}
+
+	if update.Password != "" {
+		if checkCurrentPassword {
+			ok, err := crypto.CheckPasswordHash(update.CurrentPassword, unsafeUser.Password)
+			if err != nil || !ok {
+				return nil, errs.ErrWrongCredentials
+			}
+		}
+
+		hashedPassword, err := crypto.HashPassword(update.Password, s.cfg.PasswordCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to user HashPassword: %w", err)
+		}
+
+		unsafeUser.Password = hashedPassword
+	}
+
+	if err := s.userRepo.Update(ctx, unsafeUser); err != nil {
+		return nil, fmt.Errorf("failed to db Update: %w", err)
+	}
+
+	return s.GetByID(ctx, id)
+}
+
+func (s *UserService) SetRole(ctx context.Context, id string, role model.Role) (*model.User, error) {
+	if !role.Valid() {
+		return nil, errs.ErrInvalidRole
+	}
+
+	if err := s.userRepo.UpdateRole(ctx, id, role); err != nil {
+		return nil, fmt.Errorf("failed to db UpdateRole: %w", err)
+	}
+
+	return s.GetByID(ctx, id)
 }
 
-func (s *UserService) CheckToken(token string) (*model.User, error) {
-	val, err := s.userRepo.GetUserByToken(token)
+// SetIdleTimeout overrides the idle timeout of all workspaces of the user.
+func (s *UserService) SetIdleTimeout(ctx context.Context, id string, idleTimeout *int) (*model.User, error) {
+	if err := validateIdleTimeout(idleTimeout); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if err := s.userRepo.UpdateIdleTimeout(ctx, id, idleTimeout); err != nil {
+		return nil, fmt.Errorf("failed to db UpdateIdleTimeout: %w", err)
+	}
 
-	return HandleError[*model.User](val, err, "failed to db GGetUserByTokent")
+	return s.GetByID(ctx, id)
 }
 
-func (s *UserService) GetUnsafeByUsername(username string) (*model.User, error) {
-	val, err := s.userRepo.GetUnsafeByUsername(username)
+// CheckToken authenticates a plaintext token and returns its owner.
+func (s *UserService) CheckToken(ctx context.Context, tokenKey string) (*model.User, *model.Token, error) {
+	token, err := s.tokenService.Authenticate(ctx, tokenKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to Authenticate: %w", err)
+	}
+
+	user, err := s.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, token, nil
+}
+
+func (s *UserService) GetUnsafeByUsername(ctx context.Context, username string) (*model.User, error) {
+	val, err := s.userRepo.GetUnsafeByUsername(ctx, username)
 
 	return HandleError[*model.User](val, err, "failed to db GetUnsafeByUsername")
 }
 
-func (s *UserService) Login(loginRequest *model.LoginRequest) (*model.LoginResponse, error) {
+func (s *UserService) Login(ctx context.Context, loginRequest *model.LoginRequest) (*model.LoginResponse, error) {
 	// check credentials
-	user, err := s.userRepo.GetUnsafeByUsername(loginRequest.Username)
+	user, err := s.userRepo.GetUnsafeByUsername(ctx, loginRequest.Username)
 	if err != nil {
 		return nil, errs.ErrWrongCredentials
 	}
 
 	ok, err := crypto.CheckPasswordHash(loginRequest.Password, user.Password)
-	if err != nil {
-		return nil, err
-	}
-
-	if !ok {
+	if err != nil || !ok {
 		return nil, errs.ErrWrongCredentials
 	}
 
 	// create new token
-	newToken, err := s.tokenService.CreateForUser(user.ID)
+	newToken, err := s.tokenService.CreateLoginToken(ctx, user.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to CreateForUser: %w", err)
+		return nil, fmt.Errorf("failed to CreateLoginToken: %w", err)
 	}
 
 	return &model.LoginResponse{
-		Username: user.Username,
-		UserID:   user.ID,
-		Token:    newToken.Token,
+		Username:  user.Username,
+		UserID:    user.ID,
+		Token:     newToken.Token,
+		ExpiresAt: newToken.ExpiresAt,
 	}, nil
 }
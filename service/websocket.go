@@ -1,17 +1,23 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/kaibling/cerodev/errs"
+	"github.com/kaibling/cerodev/model"
 )
 
 type websocketRepo interface {
-	Add(token string, conn *websocket.Conn)
+	Add(token, userID string, conn *websocket.Conn)
 	RemoveAndClose(token string)
-	SendJSON(data any, token string)
+	Remove(token string, conn *websocket.Conn)
+	Track(token string) (context.Context, func(), error)
+	SendJSON(data any, token string) error
+	SendJSONToUser(data any, userID string) error
 	HealthCheckAll()
 }
 
@@ -23,16 +29,104 @@ func NewWebSocketService(repo websocketRepo) *WebSocketService {
 	return &WebSocketService{repo: repo}
 }
 
-func (s *WebSocketService) Add(token string, conn *websocket.Conn) {
-	s.repo.Add(token, conn)
+func (s *WebSocketService) Add(token, userID string, conn *websocket.Conn) {
+	s.repo.Add(token, userID, conn)
 }
 
 func (s *WebSocketService) RemoveAndClose(token string) {
 	s.repo.RemoveAndClose(token)
 }
 
-func (s *WebSocketService) SendJSON(data any, token string) {
-	s.repo.SendJSON(data, token)
+// Remove removes a client whose connection is gone. A newer connection with
+// the same token is kept.
+func (s *WebSocketService) Remove(token string, conn *websocket.Conn) {
+	s.repo.Remove(token, conn)
+}
+
+// Go runs fn in the background for the client connected with token. The
+// context of fn is cancelled when ctx ends or the client is gone, the client
+// is closed after fn returned.
+func (s *WebSocketService) Go(ctx context.Context, token string, fn func(ctx context.Context)) error {
+	clientCtx, done, err := s.repo.Track(token)
+	if err != nil {
+		return fmt.Errorf("%w: no websocket client is connected with the token: %w", errs.ErrInvalidInput, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(clientCtx, cancel)
+
+	go func() {
+		defer done()
+		defer stop()
+		defer cancel()
+
+		fn(ctx)
+	}()
+
+	return nil
+}
+
+func (s *WebSocketService) SendJSON(data any, token string) error {
+	return s.repo.SendJSON(data, token)
+}
+
+// SendJSONToUser sends data to all websocket clients of a user.
+func (s *WebSocketService) SendJSONToUser(data any, userID string) error {
+	return s.repo.SendJSONToUser(data, userID)
+}
+
+// NewMessageWriter returns a writer that sends every written line as a
+// WebSocketMessage to the client connected with token.
+func (s *WebSocketService) NewMessageWriter(token, messageType, referenceID string) *MessageWriter {
+	return &MessageWriter{s: s, token: token, messageType: messageType, referenceID: referenceID} //nolint:exhaustruct
+}
+
+type MessageWriter struct {
+	s           *WebSocketService
+	token       string
+	messageType string
+	referenceID string
+	buf         []byte
+}
+
+func (w *MessageWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		line, rest, found := bytes.Cut(w.buf, []byte("\n"))
+		if !found {
+			break
+		}
+
+		if err := w.send(string(line)); err != nil {
+			return 0, err
+		}
+
+		w.buf = rest
+	}
+
+	return len(p), nil
+}
+
+// Flush sends an incomplete last line.
+func (w *MessageWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	line := string(w.buf)
+	w.buf = nil
+
+	return w.send(line)
+}
+
+func (w *MessageWriter) send(line string) error {
+	return w.s.SendJSON(model.WebSocketMessage{ //nolint:exhaustruct
+		Timestamp:   time.Now().Format(time.RFC3339),
+		MessageType: w.messageType,
+		Message:     line,
+		ReferenceID: w.referenceID,
+	}, w.token)
 }
 
 func (s *WebSocketService) StartHealthCheck(ctx context.Context) {